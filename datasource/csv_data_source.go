@@ -1,21 +1,43 @@
 package datasource
 
 import (
-	"bytes"
+	"bufio"
+	"context"
 	"encoding/csv"
-	"fmt"
 	"github.com/apache/arrow/go/v6/arrow/memory"
 	"io"
-	"io/ioutil"
+	"os"
 	"query-engine/datatypes"
 )
 
+// CsvOptions configures how a csv file is read, zero values mean defaults
+type CsvOptions struct {
+	// Delimiter separates the fields of a record, default is ','
+	Delimiter rune
+	// MinPartitionBytes is the least number of bytes read by a partition of the file, default is 1MB
+	MinPartitionBytes int64
+	// SortedBy are the columns the records of the file are known to be sorted by, like for a sorted export
+	SortedBy []string
+}
+
+const defaultMinPartitionBytes = 1 << 20
+
 // CsvDataSource must have headers
 type CsvDataSource struct {
 	filename  string
+	options   CsvOptions
 	schema    datatypes.Schema
 	batchSize int
+	// start and end are the byte range of the records read by a partition, end is 0 when the whole file is read
+	start int64
+	end   int64
+
+	// file and csvReader are opened lazily by the first Next, and closed once all records are read or by Close
+	file      *os.File
 	csvReader *csv.Reader
+	eof       bool
+	// err failed the last Next, it is returned by the following Scan
+	err error
 
 	// due to csv reader can't get total line nums, so use next() method to hold recordBatch
 	cursorBatchBuf [][]string
@@ -28,35 +50,67 @@ type CsvDataSource struct {
 	builders []datatypes.ArrowArrayBuilder
 }
 
-func NewCsvDataSource(filename string, batchSize int) *CsvDataSource {
+func NewCsvDataSource(filename string, batchSize int) (*CsvDataSource, error) {
+	return NewCsvDataSourceWithOptions(filename, batchSize, CsvOptions{})
+}
+
+func NewCsvDataSourceWithOptions(filename string, batchSize int, options CsvOptions) (*CsvDataSource, error) {
 	ds := &CsvDataSource{
 		filename:  filename,
+		options:   options,
 		batchSize: batchSize,
 	}
-	ds.inferSchema()
-	return ds
+	if err := ds.inferSchema(); err != nil {
+		return nil, err
+	}
+	return ds, nil
 }
 
 func (c *CsvDataSource) Schema() datatypes.Schema {
 	return c.schema
 }
 
-func (c *CsvDataSource) Scan(projection []string) datatypes.RecordBatch {
-	c.inferProjection(projection)
-	return c.createBatch(c.pjSchema, c.pjIndices, c.cursorBatchBuf)
+func (c *CsvDataSource) Scan(ctx context.Context, projection []string) (datatypes.RecordBatch, error) {
+	if c.err != nil {
+		return datatypes.RecordBatch{}, c.err
+	}
+	if err := ctx.Err(); err != nil {
+		return datatypes.RecordBatch{}, err
+	}
+	if err := c.inferProjection(projection); err != nil {
+		return datatypes.RecordBatch{}, err
+	}
+	return c.createBatch(c.pjSchema, c.pjIndices, c.cursorBatchBuf), nil
 }
 
-func (c *CsvDataSource) Next() bool {
+func (c *CsvDataSource) Next(ctx context.Context) bool {
+	if c.eof {
+		return false
+	}
+	// check for cancellation before reading each batch
+	if err := ctx.Err(); err != nil {
+		c.fail(err)
+		return true
+	}
+	if c.csvReader == nil {
+		if err := c.open(); err != nil {
+			c.fail(err)
+			return true
+		}
+	}
+
 	batchBuf := make([][]string, 0, c.batchSize)
 	iterCnt := 0
 	for {
 		// read one row from csv, then createBatch into columnar memory format
 		record, err := c.csvReader.Read()
 		if err == io.EOF {
+			c.Close()
 			break
 		}
 		if err != nil {
-			panic(fmt.Sprintf("csv read err: %v", err))
+			c.fail(datatypes.NewIOError(err, "read csv file %s", c.filename))
+			return true
 		}
 		batchBuf = append(batchBuf, record)
 		iterCnt++
@@ -74,16 +128,125 @@ func (c *CsvDataSource) Next() bool {
 	return false
 }
 
-func (c *CsvDataSource) inferSchema() {
-	file, err := ioutil.ReadFile(c.filename)
+func (c *CsvDataSource) Reopen() DataSource {
+	ds := &CsvDataSource{
+		filename:  c.filename,
+		options:   c.options,
+		schema:    c.schema,
+		batchSize: c.batchSize,
+		start:     c.start,
+		end:       c.end,
+	}
+	ds.initBuilders()
+	return ds
+}
+
+func (c *CsvDataSource) SortedBy() []string {
+	return c.options.SortedBy
+}
+
+// Partitions splits the records into byte ranges of at least MinPartitionBytes, every range starts
+// at the beginning of a record, the file is scanned from the start of the records to find them,
+// so that a line break quoted in a field doesn't split its record.
+func (c *CsvDataSource) Partitions(n int) ([]DataSource, error) {
+	file, err := os.Open(c.filename)
+	if err != nil {
+		return nil, datatypes.NewIOError(err, "open csv file")
+	}
+	defer file.Close()
+
+	start, end := c.start, c.end
+	if end == 0 {
+		info, err := file.Stat()
+		if err != nil {
+			return nil, datatypes.NewIOError(err, "stat csv file %s", c.filename)
+		}
+		end = info.Size()
+		// the records start after the header record
+		starts, err := c.recordStarts(file, 0, end, []int64{1})
+		if err != nil {
+			return nil, err
+		}
+		start = starts[0]
+	}
+
+	minBytes := c.options.MinPartitionBytes
+	if minBytes <= 0 {
+		minBytes = defaultMinPartitionBytes
+	}
+	count := int64(n)
+	if max := (end - start) / minBytes; max < count {
+		count = max
+	}
+	if count <= 1 {
+		return []DataSource{c.Reopen()}, nil
+	}
+
+	offsets := make([]int64, count-1)
+	for i := range offsets {
+		offsets[i] = start + (end-start)*int64(i+1)/count
+	}
+	splits, err := c.recordStarts(file, start, end, offsets)
+	if err != nil {
+		return nil, err
+	}
+	splits = append(splits, end)
+
+	partitions := make([]DataSource, 0, count)
+	partStart := start
+	for _, partEnd := range splits {
+		if partEnd > partStart {
+			ds := c.Reopen().(*CsvDataSource)
+			ds.start, ds.end = partStart, partEnd
+			partitions = append(partitions, ds)
+		}
+		partStart = partEnd
+	}
+	return partitions, nil
+}
+
+// recordStarts returns, for every offset of the ascending offsets, the offset of the first record starting
+// at it or after it, end when there is none. The bytes are scanned from start, which begins a record,
+// so that the quoted fields are known: a record starts after a line break which isn't quoted.
+func (c *CsvDataSource) recordStarts(file *os.File, start, end int64, offsets []int64) ([]int64, error) {
+	starts := make([]int64, 0, len(offsets))
+	reader := bufio.NewReader(io.NewSectionReader(file, start, end-start))
+	quoted := false
+	for offset := start; len(starts) < len(offsets); {
+		b, err := reader.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, datatypes.NewIOError(err, "read csv file %s", c.filename)
+		}
+		offset++
+		// an escaped quote "" toggles twice
+		if b == '"' {
+			quoted = !quoted
+		} else if b == '\n' && !quoted {
+			for len(starts) < len(offsets) && offset >= offsets[len(starts)] {
+				starts = append(starts, offset)
+			}
+		}
+	}
+	for len(starts) < len(offsets) {
+		starts = append(starts, end)
+	}
+	return starts, nil
+}
+
+// inferSchema only reads the header line
+func (c *CsvDataSource) inferSchema() error {
+	file, err := os.Open(c.filename)
 	if err != nil {
-		panic(fmt.Sprintf("csv file: %s not exist!", c.filename))
+		return datatypes.NewIOError(err, "open csv file")
 	}
+	defer file.Close()
 
-	r := csv.NewReader(bytes.NewReader(file))
-	firstRecord, err := r.Read()
+	firstRecord, err := c.newReader(file).Read()
 	if err != nil {
-		panic(fmt.Sprintf("csv read err: %v", err))
+		return datatypes.NewIOError(err, "read csv header of %s", c.filename)
 	}
 
 	headers := make([]datatypes.Field, 0)
@@ -95,16 +258,62 @@ func (c *CsvDataSource) inferSchema() {
 	}
 
 	c.schema = datatypes.Schema{Fields: headers}
-	c.csvReader = r
+	c.initBuilders()
+	return nil
+}
+
+// open the file for reading records, the header line is skipped, a partition only reads its byte range
+func (c *CsvDataSource) open() error {
+	file, err := os.Open(c.filename)
+	if err != nil {
+		return datatypes.NewIOError(err, "open csv file")
+	}
+	c.file = file
+	if c.end > 0 {
+		c.csvReader = c.newReader(io.NewSectionReader(file, c.start, c.end-c.start))
+		return nil
+	}
+	c.csvReader = c.newReader(file)
+	if _, err := c.csvReader.Read(); err != nil && err != io.EOF {
+		c.Close()
+		return datatypes.NewIOError(err, "read csv header of %s", c.filename)
+	}
+	return nil
+}
+
+func (c *CsvDataSource) Close() {
+	c.eof = true
+	if c.file != nil {
+		_ = c.file.Close()
+		c.file = nil
+	}
+}
+
+// fail stops reading, err is returned by the next Scan
+func (c *CsvDataSource) fail(err error) {
+	c.err = err
+	c.Close()
+}
+
+func (c *CsvDataSource) newReader(r io.Reader) *csv.Reader {
+	reader := csv.NewReader(r)
+	if c.options.Delimiter != 0 {
+		reader.Comma = c.options.Delimiter
+	}
+	return reader
+}
 
+func (c *CsvDataSource) initBuilders() {
 	c.builders = make([]datatypes.ArrowArrayBuilder, len(c.schema.Fields))
 	for i, field := range c.schema.Fields {
 		c.builders[i] = datatypes.NewArrowArrayBuilder(memory.NewGoAllocator(), field.DataType)
 	}
 }
 
-func (c *CsvDataSource) inferProjection(projection []string) {
-	c.pjSchema, c.pjIndices = c.schema.SelectByName(projection)
+func (c *CsvDataSource) inferProjection(projection []string) error {
+	var err error
+	c.pjSchema, c.pjIndices, err = selectProjection(c.schema, projection)
+	return err
 }
 
 func (c *CsvDataSource) createBatch(
@@ -1,16 +1,24 @@
 package datasource
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/stretchr/testify/require"
+	"os"
+	"query-engine/datatypes"
+	"strconv"
 	"testing"
 )
 
 const dir = "../testdata"
 
 func TestCsvDataSource_Schema(t *testing.T) {
-	csv := NewCsvDataSource(dir+"/employee.csv", 1024)
-	csv.Next()
-	recordBatch := csv.Scan([]string{})
+	csv, err := NewCsvDataSource(dir+"/employee.csv", 1024)
+	require.NoError(t, err)
+	csv.Next(context.Background())
+	recordBatch, err := csv.Scan(context.Background(), []string{})
+	require.NoError(t, err)
 
 	require.Len(t, recordBatch.Fields, 6)
 
@@ -21,9 +29,11 @@ func TestCsvDataSource_Schema(t *testing.T) {
 }
 
 func TestCsvDataSource_Scan_with_no_projection(t *testing.T) {
-	csv := NewCsvDataSource(dir+"/employee.csv", 1024)
-	csv.Next()
-	recordBatch := csv.Scan([]string{})
+	csv, err := NewCsvDataSource(dir+"/employee.csv", 1024)
+	require.NoError(t, err)
+	csv.Next(context.Background())
+	recordBatch, err := csv.Scan(context.Background(), []string{})
+	require.NoError(t, err)
 
 	require.Len(t, recordBatch.Fields, 6)
 
@@ -37,9 +47,11 @@ func TestCsvDataSource_Scan_with_no_projection(t *testing.T) {
 }
 
 func TestCsvDataSource_Scan_with_projection(t *testing.T) {
-	csv := NewCsvDataSource(dir+"/employee.csv", 1024)
-	csv.Next()
-	recordBatch := csv.Scan([]string{"id", "state", "salary"})
+	csv, err := NewCsvDataSource(dir+"/employee.csv", 1024)
+	require.NoError(t, err)
+	csv.Next(context.Background())
+	recordBatch, err := csv.Scan(context.Background(), []string{"id", "state", "salary"})
+	require.NoError(t, err)
 	require.Len(t, recordBatch.Fields, 3)
 
 	secondColumn := recordBatch.Field(1)
@@ -52,21 +64,158 @@ func TestCsvDataSource_Scan_with_projection(t *testing.T) {
 }
 
 func TestCsvDataSource_Scan_with_smallBatch(t *testing.T) {
-	csv := NewCsvDataSource(dir+"/employee.csv", 2)
+	csv, err := NewCsvDataSource(dir+"/employee.csv", 2)
+	require.NoError(t, err)
 
-	csv.Next()
-	recordBatch := csv.Scan([]string{"state", "salary"})
+	csv.Next(context.Background())
+	recordBatch, err := csv.Scan(context.Background(), []string{"state", "salary"})
+	require.NoError(t, err)
 	secondField := recordBatch.Field(1)
 	secondFieldData := []string{"12000", "10000"}
 	for i, datum := range secondFieldData {
 		require.Equal(t, datum, secondField.GetValue(i))
 	}
 
-	csv.Next()
-	recordBatch = csv.Scan([]string{"state", "salary"})
+	csv.Next(context.Background())
+	recordBatch, err = csv.Scan(context.Background(), []string{"state", "salary"})
+	require.NoError(t, err)
 	firstField := recordBatch.Field(0)
 	firstFieldData := []string{"CO", ""}
 	for i, datum := range firstFieldData {
 		require.Equal(t, datum, firstField.GetValue(i))
 	}
 }
+
+func TestCsvDataSource_Reopen(t *testing.T) {
+	csv, err := NewCsvDataSource(dir+"/employee.csv", 3)
+	require.NoError(t, err)
+	for csv.Next(context.Background()) {
+		csv.Scan(context.Background(), []string{"id"})
+	}
+	require.False(t, csv.Next(context.Background()))
+
+	reopened := csv.Reopen()
+	require.Equal(t, csv.Schema(), reopened.Schema())
+	require.True(t, reopened.Next(context.Background()))
+	recordBatch, err := reopened.Scan(context.Background(), []string{"id"})
+	require.NoError(t, err)
+	require.Equal(t, "1\n2\n3\n", recordBatch.ToCSV())
+}
+
+func TestCsvDataSource_missing_file(t *testing.T) {
+	_, err := NewCsvDataSource(dir+"/missing.csv", 1024)
+	var ioErr *datatypes.IOError
+	require.True(t, errors.As(err, &ioErr))
+	require.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestCsvDataSource_Scan_unknown_column(t *testing.T) {
+	csv, err := NewCsvDataSource(dir+"/employee.csv", 1024)
+	require.NoError(t, err)
+	require.True(t, csv.Next(context.Background()))
+	_, err = csv.Scan(context.Background(), []string{"id", "age"})
+	var schemaErr *datatypes.SchemaError
+	require.True(t, errors.As(err, &schemaErr))
+	require.Equal(t, "No column named: age", err.Error())
+}
+
+func TestCsvDataSource_cancel(t *testing.T) {
+	csv, err := NewCsvDataSource(dir+"/employee.csv", 2)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	require.True(t, csv.Next(ctx))
+	_, err = csv.Scan(ctx, []string{"id"})
+	require.NoError(t, err)
+
+	cancel()
+	require.True(t, csv.Next(ctx))
+	_, err = csv.Scan(ctx, []string{"id"})
+	require.ErrorIs(t, err, context.Canceled)
+	require.False(t, csv.Next(ctx))
+}
+
+// scanPartitions scans all the partitions, returning the values of the first column of every partition
+func scanPartitions(t *testing.T, partitions []DataSource, projection []string) [][]interface{} {
+	values := make([][]interface{}, len(partitions))
+	for i, ds := range partitions {
+		for ds.Next(context.Background()) {
+			batch, err := ds.Scan(context.Background(), projection)
+			require.NoError(t, err)
+			for row := 0; row < batch.RowCount(); row++ {
+				values[i] = append(values[i], batch.Field(0).GetValue(row))
+			}
+		}
+	}
+	return values
+}
+
+func TestCsvDataSource_Partitions(t *testing.T) {
+	filename := t.TempDir() + "/numbers.csv"
+	content := "id,name\n"
+	for i := 0; i < 100; i++ {
+		content += fmt.Sprintf("%d,\"name, %d\"\n", i, i)
+	}
+	require.NoError(t, os.WriteFile(filename, []byte(content), 0644))
+
+	csv, err := NewCsvDataSourceWithOptions(filename, 7, CsvOptions{MinPartitionBytes: 100})
+	require.NoError(t, err)
+	partitions, err := csv.Partitions(4)
+	require.NoError(t, err)
+	require.Len(t, partitions, 4)
+
+	// every record is read by exactly one partition, in file order
+	ids := make([]interface{}, 0)
+	for _, values := range scanPartitions(t, partitions, []string{"id"}) {
+		require.NotEmpty(t, values)
+		ids = append(ids, values...)
+	}
+	require.Len(t, ids, 100)
+	for i, id := range ids {
+		require.Equal(t, strconv.Itoa(i), id)
+	}
+
+	// a partition can be split again
+	parts, err := partitions[0].(PartitionedDataSource).Partitions(2)
+	require.NoError(t, err)
+	require.Len(t, parts, 2)
+	values := scanPartitions(t, parts, []string{"name"})
+	require.Equal(t, "name, 0", values[0][0])
+	require.Equal(t, len(scanPartitions(t, []DataSource{partitions[0].Reopen()}, []string{"id"})[0]),
+		len(values[0])+len(values[1]))
+}
+
+func TestCsvDataSource_Partitions_quoted_line_breaks(t *testing.T) {
+	filename := t.TempDir() + "/notes.csv"
+	content := "id,\"multi\nline note\"\n"
+	for i := 0; i < 2000; i++ {
+		content += fmt.Sprintf("%d,\"note\n%d, \"\"quoted\"\"\n\"\n", i, i)
+	}
+	require.NoError(t, os.WriteFile(filename, []byte(content), 0644))
+
+	csv, err := NewCsvDataSourceWithOptions(filename, 64, CsvOptions{MinPartitionBytes: 512})
+	require.NoError(t, err)
+	require.Equal(t, "multi\nline note", csv.Schema().Fields[1].Name)
+	partitions, err := csv.Partitions(4)
+	require.NoError(t, err)
+	require.Len(t, partitions, 4)
+
+	// the partitions only start at the line breaks which aren't quoted
+	notes := make([]interface{}, 0)
+	for _, values := range scanPartitions(t, partitions, []string{"multi\nline note"}) {
+		notes = append(notes, values...)
+	}
+	require.Len(t, notes, 2000)
+	for i, note := range notes {
+		require.Equal(t, fmt.Sprintf("note\n%d, \"quoted\"\n", i), note)
+	}
+}
+
+func TestCsvDataSource_Partitions_small_file(t *testing.T) {
+	csv, err := NewCsvDataSource(dir+"/employee.csv", 1024)
+	require.NoError(t, err)
+	partitions, err := csv.Partitions(4)
+	require.NoError(t, err)
+	require.Len(t, partitions, 1)
+	require.Equal(t, [][]interface{}{{"1", "2", "3", "4"}}, scanPartitions(t, partitions, []string{"id"}))
+}
@@ -1,14 +1,56 @@
 package datasource
 
-import "query-engine/datatypes"
+import (
+	"context"
+	"query-engine/datatypes"
+)
 
 type DataSource interface {
 	// Schema Return the schema for the underlying data source
 	Schema() datatypes.Schema
 
-	// Scan the data source, selecting the specified columns
-	Scan(projection []string) datatypes.RecordBatch
+	// Scan the data source, selecting the specified columns, an unknown column is a SchemaError.
+	// Once ctx is done, the ctx error is returned.
+	Scan(ctx context.Context, projection []string) (datatypes.RecordBatch, error)
 
-	// Next prepares the next recordBatch for reading with then Scan method
-	Next() bool
+	// Next prepares the next recordBatch for reading with then Scan method,
+	// when preparing fails or ctx is done, it returns true so that the error is returned by Scan
+	Next(ctx context.Context) bool
+
+	// Reopen returns a new DataSource reading the same data from the beginning,
+	// it shares the already inferred schema, so that a source can be scanned by several queries
+	Reopen() DataSource
+
+	// Close releases the files opened by the scan, like when a query stops before the end of the data,
+	// Next returns false once the source is closed
+	Close()
+}
+
+// PartitionedDataSource is a DataSource which can be split, so that its parts are scanned in parallel
+type PartitionedDataSource interface {
+	DataSource
+
+	// Partitions splits the data into at most n data sources reading disjoint parts of it,
+	// a source too small to be worth splitting returns a single partition.
+	Partitions(n int) ([]DataSource, error)
+}
+
+// SortedDataSource is a DataSource whose rows are sorted by some of its columns, so that the rows
+// with equal values of a prefix of the columns are adjacent, as are the rows of its partitions.
+type SortedDataSource interface {
+	DataSource
+
+	// SortedBy returns the names of the columns the rows are sorted by, the most significant first
+	SortedBy() []string
+}
+
+// selectProjection returns the schema and the indices of the projected columns, which must all exist
+func selectProjection(schema datatypes.Schema, projection []string) (datatypes.Schema, []int, error) {
+	for _, name := range projection {
+		if schema.FindFirstIndexByName(name) < 0 {
+			return datatypes.Schema{}, nil, datatypes.NewSchemaError("No column named: %s", name)
+		}
+	}
+	pjSchema, pjIndices := schema.SelectByName(projection)
+	return pjSchema, pjIndices, nil
 }
@@ -1,6 +1,7 @@
 package datasource
 
 import (
+	"context"
 	"github.com/apache/arrow/go/v6/arrow/memory"
 	"query-engine/datatypes"
 )
@@ -37,8 +38,15 @@ func (memDS *InMemDataSource) Schema() datatypes.Schema {
 	return memDS.schema
 }
 
-func (memDS *InMemDataSource) Scan(projection []string) datatypes.RecordBatch {
-	memDS.inferProjection(projection)
+func (memDS *InMemDataSource) Scan(ctx context.Context, projection []string) (datatypes.RecordBatch, error) {
+	if err := ctx.Err(); err != nil {
+		// stop scanning
+		memDS.cursor = memDS.numRows
+		return datatypes.RecordBatch{}, err
+	}
+	if err := memDS.inferProjection(projection); err != nil {
+		return datatypes.RecordBatch{}, err
+	}
 	for i, pjIdx := range memDS.pjIndices {
 		colDatum := memDS.data.Fields[pjIdx]
 		memDS.builders[i].Append(colDatum.GetValue(memDS.cursor))
@@ -52,17 +60,30 @@ func (memDS *InMemDataSource) Scan(projection []string) datatypes.RecordBatch {
 	return datatypes.RecordBatch{
 		Schema: memDS.schema,
 		Fields: fields,
-	}
+	}, nil
 }
 
-func (memDS *InMemDataSource) Next() bool {
+func (memDS *InMemDataSource) Next(ctx context.Context) bool {
 	return memDS.cursor < memDS.numRows
 }
 
-func (memDS *InMemDataSource) inferProjection(projection []string) {
-	memDS.pjSchema, memDS.pjIndices = memDS.schema.SelectByName(projection)
+func (memDS *InMemDataSource) Close() {
+	memDS.cursor = memDS.numRows
+}
+
+func (memDS *InMemDataSource) Reopen() DataSource {
+	return NewInMemDataSource(memDS.schema, memDS.data)
+}
+
+func (memDS *InMemDataSource) inferProjection(projection []string) error {
+	var err error
+	memDS.pjSchema, memDS.pjIndices, err = selectProjection(memDS.schema, projection)
+	if err != nil {
+		return err
+	}
 	memDS.builders = make([]datatypes.ArrowArrayBuilder, len(memDS.pjSchema.Fields))
 	for i, field := range memDS.pjSchema.Fields {
 		memDS.builders[i] = datatypes.NewArrowArrayBuilder(memory.NewGoAllocator(), field.DataType)
 	}
+	return nil
 }
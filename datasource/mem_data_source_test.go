@@ -1,6 +1,7 @@
 package datasource
 
 import (
+	"context"
 	"github.com/apache/arrow/go/v6/arrow/memory"
 	"github.com/stretchr/testify/require"
 	"query-engine/datatypes"
@@ -27,8 +28,9 @@ func TestInMemDataSource_Scan_with_no_projection(t *testing.T) {
 
 	memDS := NewInMemDataSource(schema, data)
 	cursor := 0
-	for memDS.Next() {
-		recordBatch := memDS.Scan([]string{})
+	for memDS.Next(context.Background()) {
+		recordBatch, err := memDS.Scan(context.Background(), []string{})
+		require.NoError(t, err)
 		require.Equal(t, idData[cursor], recordBatch.Field(0).GetValue(0))
 		require.Equal(t, nameData[cursor], recordBatch.Field(1).GetValue(0))
 		cursor++
@@ -41,8 +43,9 @@ func TestInMemDataSource_Scan_with_projection(t *testing.T) {
 
 	memDS := NewInMemDataSource(schema, data)
 	cursor := 0
-	for memDS.Next() {
-		recordBatch := memDS.Scan([]string{"Name"})
+	for memDS.Next(context.Background()) {
+		recordBatch, err := memDS.Scan(context.Background(), []string{"Name"})
+		require.NoError(t, err)
 		require.Equal(t, nameData[cursor], recordBatch.Field(0).GetValue(0))
 		cursor++
 	}
@@ -1,7 +1,7 @@
 package datasource
 
 import (
-	"fmt"
+	"context"
 	"github.com/apache/arrow/go/v6/arrow"
 	"github.com/apache/arrow/go/v6/arrow/memory"
 	"github.com/xitongsys/parquet-go-source/local"
@@ -16,11 +16,16 @@ type ParquetDataSource struct {
 	filename  string
 	schema    datatypes.Schema
 	batchSize int
-	pr        *reader.ParquetReader
+	// pr is opened lazily by the first Scan, and closed once the last batch is read, on error or by Close
+	pr *reader.ParquetReader
 	// current scan row pos
 	cursor int64
-	// the number of rows in recordBatch
+	// rowStart is the first row read by a partition, the rows before it are skipped when the file is opened
+	rowStart int64
+	// numRows is the end of the rows to read
 	numRows int64
+	// sortedBy are the sorting columns declared by the file
+	sortedBy []string
 
 	// projection schema
 	pjSchema datatypes.Schema
@@ -28,30 +33,66 @@ type ParquetDataSource struct {
 	pjIndices []int
 	// arrow array builders
 	builders []datatypes.ArrowArrayBuilder
+	// err stops the scan, Next returns false once it is set
+	err error
 }
 
-func NewParquetDataSource(filename string, batchSize int) *ParquetDataSource {
+func NewParquetDataSource(filename string, batchSize int) (*ParquetDataSource, error) {
 	p := &ParquetDataSource{filename: filename, batchSize: batchSize}
-	p.inferSchema()
-	return p
+	if err := p.inferSchema(); err != nil {
+		return nil, err
+	}
+	return p, nil
 }
 
 func (p *ParquetDataSource) Schema() datatypes.Schema {
 	return p.schema
 }
 
-func (p *ParquetDataSource) Scan(projection []string) datatypes.RecordBatch {
-	p.inferProjection(projection)
+func (p *ParquetDataSource) Scan(ctx context.Context, projection []string) (datatypes.RecordBatch, error) {
+	if p.err != nil {
+		return datatypes.RecordBatch{}, p.err
+	}
+	// check for cancellation before reading each batch
+	if err := ctx.Err(); err != nil {
+		p.fail(err)
+		return datatypes.RecordBatch{}, err
+	}
+	if err := p.inferProjection(projection); err != nil {
+		return datatypes.RecordBatch{}, err
+	}
+	if p.pr == nil {
+		pr, err := p.open()
+		if err == nil {
+			err = p.skipRows(pr)
+		}
+		if err != nil {
+			if pr != nil {
+				closeReader(pr)
+			}
+			p.fail(err)
+			return datatypes.RecordBatch{}, err
+		}
+		p.pr = pr
+	}
 
+	batchRows := int64(p.batchSize)
+	if remaining := p.numRows - p.cursor; remaining < batchRows {
+		batchRows = remaining
+	}
 	for i, pjIdx := range p.pjIndices {
-		data, _, _, err := p.pr.ReadColumnByIndex(int64(pjIdx), int64(p.batchSize))
+		data, _, _, err := p.pr.ReadColumnByIndex(int64(pjIdx), batchRows)
 		if err != nil {
-			panic(fmt.Sprintf("parquet read data err: %v", err))
+			p.fail(datatypes.NewIOError(err, "read parquet file %s", p.filename))
+			return datatypes.RecordBatch{}, p.err
 		}
 		p.builders[i].AppendValues(data...)
 	}
 
-	p.cursor += int64(p.batchSize)
+	p.cursor += batchRows
+	if p.cursor >= p.numRows {
+		p.Close()
+	}
 	fields := make([]datatypes.ColumnArray, len(p.pjIndices))
 	for i := 0; i < len(p.builders); i++ {
 		fields[i] = p.builders[i].Build()
@@ -60,45 +101,166 @@ func (p *ParquetDataSource) Scan(projection []string) datatypes.RecordBatch {
 	return datatypes.RecordBatch{
 		Schema: p.schema,
 		Fields: fields,
+	}, nil
+}
+
+func (p *ParquetDataSource) Next(ctx context.Context) bool {
+	return p.err == nil && p.cursor < p.numRows
+}
+
+func (p *ParquetDataSource) Close() {
+	p.cursor = p.numRows
+	if p.pr != nil {
+		closeReader(p.pr)
+		p.pr = nil
+	}
+}
+
+// fail stops the scan, err is returned by the next Scan
+func (p *ParquetDataSource) fail(err error) {
+	p.err = err
+	p.Close()
+}
+
+// Reopen the file lazily on the first Scan, the schema and row range are shared
+func (p *ParquetDataSource) Reopen() DataSource {
+	return &ParquetDataSource{
+		filename:  p.filename,
+		schema:    p.schema,
+		batchSize: p.batchSize,
+		cursor:    p.rowStart,
+		rowStart:  p.rowStart,
+		numRows:   p.numRows,
+		sortedBy:  p.sortedBy,
+	}
+}
+
+// SortedBy returns the sorting columns of the row group of a file with a single row group.
+// A file with several row groups is unsorted, as the sorting columns only order the rows of each row group.
+func (p *ParquetDataSource) SortedBy() []string {
+	return p.sortedBy
+}
+
+// Partitions splits the row groups into at most n ranges of about the same number of rows
+func (p *ParquetDataSource) Partitions(n int) ([]DataSource, error) {
+	pr, err := p.open()
+	if err != nil {
+		return nil, err
 	}
+	defer closeReader(pr)
+
+	// the rows where the row groups in the range start, followed by the end of the range
+	bounds := make([]int64, 0)
+	groupStart := int64(0)
+	for _, rowGroup := range pr.Footer.RowGroups {
+		if groupStart >= p.rowStart && groupStart < p.numRows {
+			bounds = append(bounds, groupStart)
+		}
+		groupStart += rowGroup.NumRows
+	}
+	bounds = append(bounds, p.numRows)
+
+	count := int64(n)
+	if groups := int64(len(bounds) - 1); groups < count {
+		count = groups
+	}
+	if count <= 1 {
+		return []DataSource{p.Reopen()}, nil
+	}
+
+	partitions := make([]DataSource, 0, count)
+	start, b := bounds[0], 0
+	for i := int64(1); i <= count; i++ {
+		// end the partition at the first row group reaching its share of the rows
+		target := bounds[0] + (p.numRows-bounds[0])*i/count
+		for bounds[b] < target {
+			b++
+		}
+		if bounds[b] > start {
+			ds := p.Reopen().(*ParquetDataSource)
+			ds.cursor, ds.rowStart, ds.numRows = start, start, bounds[b]
+			partitions = append(partitions, ds)
+		}
+		start = bounds[b]
+	}
+	return partitions, nil
 }
 
-func (p *ParquetDataSource) Next() bool {
-	return p.cursor < p.numRows
+// skipRows skips the rows of the projected columns before the partition
+func (p *ParquetDataSource) skipRows(pr *reader.ParquetReader) error {
+	for _, pjIdx := range p.pjIndices {
+		if err := pr.SkipRowsByPath(pr.SchemaHandler.ValueColumns[pjIdx], p.rowStart); err != nil {
+			return datatypes.NewIOError(err, "skip rows of parquet file %s", p.filename)
+		}
+	}
+	return nil
 }
 
 // parquet read refer to https://github.com/xitongsys/parquet-go/blob/master/tool/parquet-tools/parquet-tools.go
-func (p *ParquetDataSource) inferSchema() {
+func (p *ParquetDataSource) open() (*reader.ParquetReader, error) {
 	fr, err := local.NewLocalFileReader(p.filename)
 	if err != nil {
-		panic(fmt.Sprintf("Can't open file: %v", err))
+		return nil, datatypes.NewIOError(err, "open parquet file")
 	}
 	pr, err := reader.NewParquetColumnReader(fr, 4)
 	if err != nil {
-		panic(fmt.Sprintf("Can't create column reader: %v", err))
+		_ = fr.Close()
+		return nil, datatypes.NewIOError(err, "create column reader of %s", p.filename)
 	}
+	return pr, nil
+}
+
+func closeReader(pr *reader.ParquetReader) {
+	pr.ReadStop()
+	_ = pr.PFile.Close()
+}
+
+// inferSchema only reads the footer, the file is opened again by the first Scan
+func (p *ParquetDataSource) inferSchema() error {
+	pr, err := p.open()
+	if err != nil {
+		return err
+	}
+	defer closeReader(pr)
 
 	headers := make([]datatypes.Field, 0)
 	elems := pr.SchemaHandler.SchemaElements
 	for i := 1; i < len(elems); i++ {
-		headers = append(headers, p.createFiled(elems[i]))
+		field, err := p.createFiled(elems[i])
+		if err != nil {
+			return err
+		}
+		headers = append(headers, field)
 	}
 
 	p.schema = datatypes.Schema{Fields: headers}
-	p.pr = pr
+	if rowGroups := pr.Footer.RowGroups; len(rowGroups) == 1 {
+		for _, column := range rowGroups[0].SortingColumns {
+			if int(column.ColumnIdx) >= len(headers) {
+				break
+			}
+			p.sortedBy = append(p.sortedBy, headers[column.ColumnIdx].Name)
+		}
+	}
 	p.cursor = 0
-	p.numRows = p.pr.GetNumRows()
+	p.numRows = pr.GetNumRows()
+	return nil
 }
 
-func (p *ParquetDataSource) inferProjection(projection []string) {
-	p.pjSchema, p.pjIndices = p.schema.SelectByName(projection)
+func (p *ParquetDataSource) inferProjection(projection []string) error {
+	var err error
+	p.pjSchema, p.pjIndices, err = selectProjection(p.schema, projection)
+	if err != nil {
+		return err
+	}
 	p.builders = make([]datatypes.ArrowArrayBuilder, len(p.pjSchema.Fields))
 	for i, field := range p.pjSchema.Fields {
 		p.builders[i] = datatypes.NewArrowArrayBuilder(memory.NewGoAllocator(), field.DataType)
 	}
+	return nil
 }
 
-func (p *ParquetDataSource) createFiled(elem *parquet.SchemaElement) datatypes.Field {
+func (p *ParquetDataSource) createFiled(elem *parquet.SchemaElement) (datatypes.Field, error) {
 	var dType arrow.DataType
 	switch elem.GetType() {
 	case parquet.Type_BOOLEAN:
@@ -114,11 +276,11 @@ func (p *ParquetDataSource) createFiled(elem *parquet.SchemaElement) datatypes.F
 	case parquet.Type_BYTE_ARRAY, parquet.Type_FIXED_LEN_BYTE_ARRAY, parquet.Type_INT96:
 		dType = datatypes.StringType
 	default:
-		panic(fmt.Sprintf("parquet not support type: %v", elem.GetType()))
+		return datatypes.Field{}, datatypes.NewSchemaError("parquet not support type: %v", elem.GetType())
 	}
 
 	return datatypes.Field{
 		Name:     elem.GetName(),
 		DataType: dType,
-	}
+	}, nil
 }
@@ -1,15 +1,23 @@
 package datasource
 
 import (
+	"context"
+	"errors"
 	"github.com/stretchr/testify/require"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/parquet"
 	"github.com/xitongsys/parquet-go/types"
+	"github.com/xitongsys/parquet-go/writer"
+	"os"
+	"query-engine/datatypes"
 	"testing"
 )
 
 const filename = dir + "/alltypes_plain.parquet"
 
 func TestParquetDataSource_Schema(t *testing.T) {
-	pds := NewParquetDataSource(filename, 10)
+	pds, err := NewParquetDataSource(filename, 10)
+	require.NoError(t, err)
 	headers := []string{"Id", "Bool_col", "Tinyint_col", "Smallint_col", "Int_col", "Bigint_col", "Float_col", "Double_col", "Date_string_col", "String_col", "Timestamp_col"}
 	for i, header := range headers {
 		require.Equal(t, header, pds.Schema().Fields[i].Name)
@@ -17,8 +25,10 @@ func TestParquetDataSource_Schema(t *testing.T) {
 }
 
 func TestParquetDataSource_Scan_with_no_projection(t *testing.T) {
-	pds := NewParquetDataSource(filename, 1204)
-	recordBatch := pds.Scan([]string{})
+	pds, err := NewParquetDataSource(filename, 1204)
+	require.NoError(t, err)
+	recordBatch, err := pds.Scan(context.Background(), []string{})
+	require.NoError(t, err)
 	firstColumn := recordBatch.Field(0)
 	firstColumnData := []int32{4, 5, 6, 7, 2, 3, 0, 1}
 	for i, datum := range firstColumnData {
@@ -27,8 +37,10 @@ func TestParquetDataSource_Scan_with_no_projection(t *testing.T) {
 }
 
 func TestParquetDataSource_Scan_with_projection(t *testing.T) {
-	pds := NewParquetDataSource(filename, 1024)
-	recordBatch := pds.Scan([]string{"Timestamp_col"})
+	pds, err := NewParquetDataSource(filename, 1024)
+	require.NoError(t, err)
+	recordBatch, err := pds.Scan(context.Background(), []string{"Timestamp_col"})
+	require.NoError(t, err)
 	firstColumn := recordBatch.Field(0)
 	firstValue := firstColumn.GetValue(1)
 	time := types.INT96ToTime(firstValue.(string))
@@ -36,20 +48,24 @@ func TestParquetDataSource_Scan_with_projection(t *testing.T) {
 }
 
 func TestParquetDataSource_Scan_with_smallBatch(t *testing.T) {
-	pds := NewParquetDataSource(filename, 3)
+	pds, err := NewParquetDataSource(filename, 3)
+	require.NoError(t, err)
 
-	require.True(t, pds.Next())
-	res := pds.Scan([]string{"Bool_col"})
+	require.True(t, pds.Next(context.Background()))
+	res, err := pds.Scan(context.Background(), []string{"Bool_col"})
+	require.NoError(t, err)
 	require.Equal(t, 3, res.RowCount())
 
-	require.True(t, pds.Next())
-	res = pds.Scan([]string{"Bool_col"})
+	require.True(t, pds.Next(context.Background()))
+	res, err = pds.Scan(context.Background(), []string{"Bool_col"})
+	require.NoError(t, err)
 	require.Equal(t, 3, res.RowCount())
 
-	require.True(t, pds.Next())
-	res = pds.Scan([]string{"Bool_col"})
+	require.True(t, pds.Next(context.Background()))
+	res, err = pds.Scan(context.Background(), []string{"Bool_col"})
+	require.NoError(t, err)
 	require.Equal(t, 2, res.RowCount())
-	require.False(t, pds.Next())
+	require.False(t, pds.Next(context.Background()))
 
 	firstColumn := res.Field(0)
 	require.Equal(t, 2, firstColumn.Size())
@@ -57,3 +73,160 @@ func TestParquetDataSource_Scan_with_smallBatch(t *testing.T) {
 	firstValue := firstColumn.GetValue(0)
 	require.Equal(t, true, firstValue)
 }
+
+func TestParquetDataSource_Reopen(t *testing.T) {
+	pds, err := NewParquetDataSource(filename, 8)
+	require.NoError(t, err)
+	require.True(t, pds.Next(context.Background()))
+	pds.Scan(context.Background(), []string{"Id"})
+	require.False(t, pds.Next(context.Background()))
+
+	reopened := pds.Reopen()
+	require.True(t, reopened.Next(context.Background()))
+	res, err := reopened.Scan(context.Background(), []string{"Id"})
+	require.NoError(t, err)
+	require.Equal(t, 8, res.RowCount())
+	require.Equal(t, int32(4), res.Field(0).GetValue(0))
+	require.False(t, reopened.Next(context.Background()))
+}
+
+// openFiles counts the open file descriptors of the process
+func openFiles(t *testing.T) int {
+	fds, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skip("no /proc/self/fd to count the open files")
+	}
+	return len(fds)
+}
+
+func TestParquetDataSource_Close(t *testing.T) {
+	pds, err := NewParquetDataSource(filename, 3)
+	require.NoError(t, err)
+	files := openFiles(t)
+
+	// the file is closed once the last batch is read
+	ds := pds.Reopen()
+	for ds.Next(context.Background()) {
+		_, err := ds.Scan(context.Background(), []string{"Id", "Bool_col"})
+		require.NoError(t, err)
+	}
+	require.Equal(t, files, openFiles(t))
+
+	// a scan stopped early is closed by Close
+	ds = pds.Reopen()
+	require.True(t, ds.Next(context.Background()))
+	_, err = ds.Scan(context.Background(), []string{"Id"})
+	require.NoError(t, err)
+	require.Greater(t, openFiles(t), files)
+	ds.Close()
+	require.Equal(t, files, openFiles(t))
+	require.False(t, ds.Next(context.Background()))
+
+	// a failed scan is closed
+	ds = pds.Reopen()
+	require.True(t, ds.Next(context.Background()))
+	_, err = ds.Scan(context.Background(), []string{"Id"})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = ds.Scan(ctx, []string{"Id"})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, files, openFiles(t))
+}
+
+func TestParquetDataSource_missing_file(t *testing.T) {
+	_, err := NewParquetDataSource(dir+"/missing.parquet", 1024)
+	var ioErr *datatypes.IOError
+	require.True(t, errors.As(err, &ioErr))
+}
+
+func TestParquetDataSource_Partitions(t *testing.T) {
+	type row struct {
+		Id int64 `parquet:"name=id, type=INT64"`
+	}
+	filename := t.TempDir() + "/numbers.parquet"
+	fw, err := local.NewLocalFileWriter(filename)
+	require.NoError(t, err)
+	pw, err := writer.NewParquetWriter(fw, new(row), 1)
+	require.NoError(t, err)
+	// 5 row groups of 10 rows
+	for i := 0; i < 50; i++ {
+		require.NoError(t, pw.Write(row{Id: int64(i)}))
+		if i%10 == 9 {
+			require.NoError(t, pw.Flush(true))
+		}
+	}
+	require.NoError(t, pw.WriteStop())
+	require.NoError(t, fw.Close())
+
+	pds, err := NewParquetDataSource(filename, 3)
+	require.NoError(t, err)
+	partitions, err := pds.Partitions(2)
+	require.NoError(t, err)
+	require.Len(t, partitions, 2)
+
+	// the partitions are split at row groups, every row is read by exactly one partition
+	values := scanPartitions(t, partitions, []string{})
+	require.Len(t, values[0], 30)
+	require.Len(t, values[1], 20)
+	ids := append(values[0], values[1]...)
+	for i, id := range ids {
+		require.Equal(t, int64(i), id)
+	}
+
+	partitions, err = pds.Partitions(8)
+	require.NoError(t, err)
+	require.Len(t, partitions, 5)
+	values = scanPartitions(t, partitions, []string{})
+	require.Equal(t, int64(40), values[4][0])
+}
+
+func TestParquetDataSource_Partitions_single_row_group(t *testing.T) {
+	pds, err := NewParquetDataSource(filename, 3)
+	require.NoError(t, err)
+	partitions, err := pds.Partitions(4)
+	require.NoError(t, err)
+	require.Len(t, partitions, 1)
+	require.Len(t, scanPartitions(t, partitions, []string{"Id"})[0], 8)
+}
+
+func writeSortedParquet(t *testing.T, rowGroups int) string {
+	type row struct {
+		Bucket int64 `parquet:"name=bucket, type=INT64"`
+		Id     int64 `parquet:"name=id, type=INT64"`
+	}
+	filename := t.TempDir() + "/sorted.parquet"
+	fw, err := local.NewLocalFileWriter(filename)
+	require.NoError(t, err)
+	pw, err := writer.NewParquetWriter(fw, new(row), 1)
+	require.NoError(t, err)
+	for g := 0; g < rowGroups; g++ {
+		for i := 0; i < 10; i++ {
+			require.NoError(t, pw.Write(row{Bucket: int64(g*10+i) / 4, Id: int64(g*10 + i)}))
+		}
+		require.NoError(t, pw.Flush(true))
+	}
+	// the row groups are sorted by bucket then id
+	for _, rowGroup := range pw.Footer.RowGroups {
+		rowGroup.SortingColumns = []*parquet.SortingColumn{{ColumnIdx: 0}, {ColumnIdx: 1}}
+	}
+	require.NoError(t, pw.WriteStop())
+	require.NoError(t, fw.Close())
+	return filename
+}
+
+func TestParquetDataSource_SortedBy(t *testing.T) {
+	pds, err := NewParquetDataSource(writeSortedParquet(t, 1), 3)
+	require.NoError(t, err)
+	require.Equal(t, []string{"Bucket", "Id"}, pds.SortedBy())
+	require.Equal(t, []string{"Bucket", "Id"}, pds.Reopen().(SortedDataSource).SortedBy())
+
+	// the sorting columns only order the rows of each row group
+	pds, err = NewParquetDataSource(writeSortedParquet(t, 2), 3)
+	require.NoError(t, err)
+	require.Empty(t, pds.SortedBy())
+
+	pds, err = NewParquetDataSource(filename, 3)
+	require.NoError(t, err)
+	require.Empty(t, pds.SortedBy())
+}
@@ -23,6 +23,39 @@ var (
 	StringType  = &arrow.StringType{}
 )
 
+// NewListType is the type of the lists of elem values, the value of a list is the []interface{} of its elements
+func NewListType(elem arrow.DataType) arrow.DataType {
+	return arrow.ListOf(elem)
+}
+
+// WidenType returns the type the values of two types are cast to so that they can be combined: the type itself
+// when they are the same, Int64 for two integer types and Double for two numeric types of which one is a float.
+// Only Int64 and Double are produced, as they are the numeric types a cast produces. Other types can't be combined.
+func WidenType(l, r arrow.DataType) (arrow.DataType, bool) {
+	switch {
+	case arrow.TypeEqual(l, r):
+		return l, true
+	case isInteger(l) && isInteger(r):
+		return Int64Type, true
+	case (isInteger(l) || isFloat(l)) && (isInteger(r) || isFloat(r)):
+		return DoubleType, true
+	default:
+		return nil, false
+	}
+}
+
+func isInteger(dataType arrow.DataType) bool {
+	switch dataType.ID() {
+	case arrow.INT8, arrow.INT16, arrow.INT32, arrow.INT64, arrow.UINT8, arrow.UINT16, arrow.UINT32, arrow.UINT64:
+		return true
+	}
+	return false
+}
+
+func isFloat(dataType arrow.DataType) bool {
+	return dataType.ID() == arrow.FLOAT32 || dataType.ID() == arrow.FLOAT64
+}
+
 type ArrowArrayBuilder struct {
 	builder array.Builder
 }
@@ -63,6 +96,10 @@ func (ab *ArrowArrayBuilder) Append(val interface{}) {
 		b.Append(val.(float64))
 	case *array.StringBuilder:
 		b.Append(val.(string))
+	case *array.ListBuilder:
+		b.Append(true)
+		elements := ArrowArrayBuilder{builder: b.ValueBuilder()}
+		elements.AppendValues(val.([]interface{})...)
 	default:
 		panic(fmt.Errorf("arrow/array: unsupported builder for %T", b))
 	}
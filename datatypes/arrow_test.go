@@ -261,3 +261,22 @@ func TestArrowJson(t *testing.T) {
 		n++
 	}
 }
+
+func TestWidenType(t *testing.T) {
+	for _, test := range []struct {
+		l, r   arrow.DataType
+		expect arrow.DataType
+	}{
+		{StringType, StringType, StringType},
+		{Int8Type, Int64Type, Int64Type},
+		{UInt64Type, Int64Type, Int64Type},
+		{FloatType, Int64Type, DoubleType},
+		{DoubleType, FloatType, DoubleType},
+		{StringType, Int64Type, nil},
+		{BooleanType, Int8Type, nil},
+	} {
+		dataType, ok := WidenType(test.l, test.r)
+		require.Equal(t, test.expect != nil, ok, "%s %s", test.l, test.r)
+		require.Equal(t, test.expect, dataType, "%s %s", test.l, test.r)
+	}
+}
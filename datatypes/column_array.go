@@ -10,6 +10,8 @@ type ColumnArray interface {
 	GetType() arrow.DataType
 	GetValue(i int) interface{}
 	Size() int
+	// Slice returns the values in [i, j) as a new column
+	Slice(i, j int) ColumnArray
 }
 
 type ArrowFieldArray struct {
@@ -20,6 +22,11 @@ func NewArrowFieldArray(fieldArray array.Interface) *ArrowFieldArray {
 	return &ArrowFieldArray{fieldArray}
 }
 
+// Array returns the underlying arrow array, so that kernels can read its typed values and validity bitmap
+func (a *ArrowFieldArray) Array() array.Interface {
+	return a.fieldArray
+}
+
 func (a *ArrowFieldArray) GetType() arrow.DataType {
 	return a.fieldArray.DataType()
 }
@@ -53,6 +60,16 @@ func (a *ArrowFieldArray) GetValue(i int) interface{} {
 		return v.Value(i)
 	case *array.String:
 		return v.Value(i)
+	case *array.List:
+		// the offsets are the ones of the whole list array, of which v may be a slice
+		j := i + v.Data().Offset()
+		start, end := int(v.Offsets()[j]), int(v.Offsets()[j+1])
+		elements := NewArrowFieldArray(v.ListValues())
+		values := make([]interface{}, end-start)
+		for k := range values {
+			values[k] = elements.GetValue(start + k)
+		}
+		return values
 	default:
 		panic("invalid fieldArray type")
 	}
@@ -62,6 +79,10 @@ func (a *ArrowFieldArray) Size() int {
 	return a.fieldArray.Len()
 }
 
+func (a *ArrowFieldArray) Slice(i, j int) ColumnArray {
+	return &ArrowFieldArray{array.NewSlice(a.fieldArray, int64(i), int64(j))}
+}
+
 type LiteralValueArray struct {
 	arrowType arrow.DataType
 	value     interface{}
@@ -83,6 +104,10 @@ func (l LiteralValueArray) Size() int {
 	return l.arraySize
 }
 
+func (l LiteralValueArray) Slice(i, j int) ColumnArray {
+	return NewLiteralValueArray(l.arrowType, l.value, j-i)
+}
+
 func NewLiteralValueArray(arrowType arrow.DataType, value interface{}, arraySize int) LiteralValueArray {
 	return LiteralValueArray{arrowType, value, arraySize}
 }
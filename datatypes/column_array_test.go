@@ -33,3 +33,25 @@ func TestArrowArrayBuilder_Set(t *testing.T) {
 		require.Equal(t, int8(i), res.GetValue(i))
 	}
 }
+
+func TestArrowArrayBuilder_list(t *testing.T) {
+	listType := NewListType(StringType)
+	builder := NewArrowArrayBuilder(memory.NewGoAllocator(), listType)
+	builder.AppendValues([]interface{}{"a", nil}, nil, []interface{}{}, []interface{}{"b", "c", "d"})
+	res := builder.Build()
+	require.Equal(t, listType, res.GetType())
+	require.Equal(t, 4, res.Size())
+	require.Equal(t, []interface{}{"a", nil}, res.GetValue(0))
+	require.Nil(t, res.GetValue(1))
+	require.Equal(t, []interface{}{}, res.GetValue(2))
+	require.Equal(t, []interface{}{"b", "c", "d"}, res.GetValue(3))
+
+	// a slice reads the lists at its offset
+	slice := res.Slice(2, 4)
+	require.Equal(t, []interface{}{}, slice.GetValue(0))
+	require.Equal(t, []interface{}{"b", "c", "d"}, slice.GetValue(1))
+
+	batch := RecordBatch{Schema: Schema{Fields: []Field{{Name: "l", DataType: listType}}}, Fields: []ColumnArray{res}}
+	require.Equal(t, "[a <nil>]\nnull\n[]\n[b c d]\n", batch.ToCSV())
+	require.Greater(t, batch.MemorySize(), int64(4*4))
+}
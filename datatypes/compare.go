@@ -0,0 +1,106 @@
+package datatypes
+
+import (
+	"fmt"
+	"math"
+)
+
+// Compare orders two values of the same type as returned by ColumnArray.GetValue,
+// it returns -1, 0 or 1. A nil (null) value is smaller than any other value,
+// and NaN is greater than any other float, so that floats are totally ordered.
+func Compare(l, r interface{}) int {
+	if l == nil || r == nil {
+		switch {
+		case l == nil && r == nil:
+			return 0
+		case l == nil:
+			return -1
+		default:
+			return 1
+		}
+	}
+	switch lv := l.(type) {
+	case bool:
+		rv := r.(bool)
+		switch {
+		case lv == rv:
+			return 0
+		case !lv:
+			return -1
+		default:
+			return 1
+		}
+	case int8:
+		return compareOrdered(int64(lv), int64(r.(int8)))
+	case int16:
+		return compareOrdered(int64(lv), int64(r.(int16)))
+	case int32:
+		return compareOrdered(int64(lv), int64(r.(int32)))
+	case int64:
+		return compareOrdered(lv, r.(int64))
+	case uint8:
+		return compareUnsigned(uint64(lv), uint64(r.(uint8)))
+	case uint16:
+		return compareUnsigned(uint64(lv), uint64(r.(uint16)))
+	case uint32:
+		return compareUnsigned(uint64(lv), uint64(r.(uint32)))
+	case uint64:
+		return compareUnsigned(lv, r.(uint64))
+	case float32:
+		return compareFloat(float64(lv), float64(r.(float32)))
+	case float64:
+		return compareFloat(lv, r.(float64))
+	case string:
+		rv := r.(string)
+		switch {
+		case lv < rv:
+			return -1
+		case lv > rv:
+			return 1
+		default:
+			return 0
+		}
+	default:
+		panic(fmt.Sprintf("Compare is not implemented for type: %T", l))
+	}
+}
+
+func compareOrdered(l, r int64) int {
+	switch {
+	case l < r:
+		return -1
+	case l > r:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareUnsigned(l, r uint64) int {
+	switch {
+	case l < r:
+		return -1
+	case l > r:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareFloat(l, r float64) int {
+	lNaN, rNaN := math.IsNaN(l), math.IsNaN(r)
+	switch {
+	case lNaN && rNaN:
+		return 0
+	case lNaN:
+		return 1
+	case rNaN:
+		return -1
+	case l < r:
+		return -1
+	case l > r:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,38 @@
+package datatypes
+
+import (
+	"github.com/stretchr/testify/require"
+	"math"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	testCases := []struct {
+		l, r   interface{}
+		expect int
+	}{
+		{nil, nil, 0},
+		{nil, int8(1), -1},
+		{"a", nil, 1},
+		{false, true, -1},
+		{true, true, 0},
+		{int8(-1), int8(1), -1},
+		{int16(2), int16(1), 1},
+		{int32(7), int32(7), 0},
+		{int64(-5), int64(3), -1},
+		{uint8(200), uint8(100), 1},
+		{uint16(1), uint16(2), -1},
+		{uint32(3), uint32(3), 0},
+		{uint64(math.MaxUint64), uint64(1), 1},
+		{float32(1.5), float32(2.5), -1},
+		{2.5, 1.5, 1},
+		{math.NaN(), 1e300, 1},
+		{math.Inf(-1), math.NaN(), -1},
+		{math.NaN(), math.NaN(), 0},
+		{"CA", "CO", -1},
+		{"b", "a", 1},
+	}
+	for _, tc := range testCases {
+		require.Equal(t, tc.expect, Compare(tc.l, tc.r), "%v vs %v", tc.l, tc.r)
+	}
+}
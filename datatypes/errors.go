@@ -0,0 +1,69 @@
+package datatypes
+
+import (
+	"fmt"
+	"github.com/apache/arrow/go/v6/arrow"
+)
+
+// PlanError is returned when a plan or an expression can't be planned or executed,
+// like an unsupported expression or aggregate function.
+type PlanError struct {
+	Msg string
+}
+
+func (e *PlanError) Error() string {
+	return e.Msg
+}
+
+func NewPlanError(format string, a ...interface{}) *PlanError {
+	return &PlanError{fmt.Sprintf(format, a...)}
+}
+
+// SchemaError is returned when a column doesn't exist, or has a type the operation doesn't support.
+type SchemaError struct {
+	Msg string
+}
+
+func (e *SchemaError) Error() string {
+	return e.Msg
+}
+
+func NewSchemaError(format string, a ...interface{}) *SchemaError {
+	return &SchemaError{fmt.Sprintf(format, a...)}
+}
+
+// CastError is returned when a value can't be cast to DataType, Err is the parsing error if any.
+type CastError struct {
+	Value    interface{}
+	DataType arrow.DataType
+	Err      error
+}
+
+func (e *CastError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("cannot cast %v to %s: %v", e.Value, e.DataType, e.Err)
+	}
+	return fmt.Sprintf("cannot cast %v to %s", e.Value, e.DataType)
+}
+
+func (e *CastError) Unwrap() error {
+	return e.Err
+}
+
+// IOError is returned when reading or writing a file fails.
+type IOError struct {
+	Msg string
+	Err error
+}
+
+func (e *IOError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Msg, e.Err)
+}
+
+func (e *IOError) Unwrap() error {
+	return e.Err
+}
+
+func NewIOError(err error, format string, a ...interface{}) *IOError {
+	return &IOError{fmt.Sprintf(format, a...), err}
+}
@@ -2,6 +2,8 @@ package datatypes
 
 import (
 	"fmt"
+	"github.com/apache/arrow/go/v6/arrow/array"
+	"github.com/apache/arrow/go/v6/arrow/memory"
 	"strings"
 )
 
@@ -23,6 +25,67 @@ func (r *RecordBatch) Field(i int) ColumnArray {
 	return r.Fields[i]
 }
 
+// Slice returns the rows in [i, j) as a new RecordBatch
+func (r *RecordBatch) Slice(i, j int) RecordBatch {
+	fields := make([]ColumnArray, len(r.Fields))
+	for idx, field := range r.Fields {
+		fields[idx] = field.Slice(i, j)
+	}
+	return RecordBatch{Schema: r.Schema, Fields: fields}
+}
+
+// MemorySize estimates the bytes held by the batch from the sizes of its arrow buffers,
+// a sliced batch counts the whole buffers it shares with the original batch.
+func (r *RecordBatch) MemorySize() int64 {
+	size := int64(0)
+	for _, field := range r.Fields {
+		if a, ok := field.(*ArrowFieldArray); ok {
+			size += arraySize(a.fieldArray)
+		}
+	}
+	return size
+}
+
+// arraySize is the size of the buffers of an arrow array, along with the ones of the elements of a list
+func arraySize(arr array.Interface) int64 {
+	size := int64(0)
+	for _, buf := range arr.Data().Buffers() {
+		if buf != nil {
+			size += int64(buf.Len())
+		}
+	}
+	if list, ok := arr.(*array.List); ok {
+		size += arraySize(list.ListValues())
+	}
+	return size
+}
+
+// ToArrowRecord converts the batch into an arrow Record, columns which are not arrow arrays are copied into one
+func (r *RecordBatch) ToArrowRecord() array.Record {
+	columns := make([]array.Interface, len(r.Fields))
+	for i, field := range r.Fields {
+		if a, ok := field.(*ArrowFieldArray); ok {
+			columns[i] = a.fieldArray
+			continue
+		}
+		builder := NewArrowArrayBuilder(memory.NewGoAllocator(), field.GetType())
+		for rowIdx := 0; rowIdx < field.Size(); rowIdx++ {
+			builder.Append(field.GetValue(rowIdx))
+		}
+		columns[i] = builder.Build().(*ArrowFieldArray).fieldArray
+	}
+	return array.NewRecord(r.Schema.ToArrow(), columns, int64(r.RowCount()))
+}
+
+// NewRecordBatchFromArrow wraps the columns of an arrow Record
+func NewRecordBatchFromArrow(schema Schema, record array.Record) RecordBatch {
+	fields := make([]ColumnArray, record.NumCols())
+	for i, column := range record.Columns() {
+		fields[i] = NewArrowFieldArray(column)
+	}
+	return RecordBatch{Schema: schema, Fields: fields}
+}
+
 // ToCSV for better testing
 func (r *RecordBatch) ToCSV() string {
 	b := make([]string, 0)
@@ -0,0 +1,58 @@
+package execution
+
+import (
+	"query-engine/datasource"
+	"query-engine/datatypes"
+	. "query-engine/logicalplan"
+	"sort"
+)
+
+// RegisterCSV registers a csv file as a table, its schema is inferred once at registration
+func (c *Ctx) RegisterCSV(name string, path string, options datasource.CsvOptions) error {
+	ds, err := datasource.NewCsvDataSourceWithOptions(path, c.BatchSize, options)
+	if err != nil {
+		return err
+	}
+	c.RegisterDataSource(name, ds)
+	return nil
+}
+
+// RegisterParquet registers a parquet file as a table, its schema is inferred once at registration
+func (c *Ctx) RegisterParquet(name string, path string) error {
+	ds, err := datasource.NewParquetDataSource(path, c.BatchSize)
+	if err != nil {
+		return err
+	}
+	c.RegisterDataSource(name, ds)
+	return nil
+}
+
+// RegisterDataSource registers a DataSource as a table, a table with the same name is replaced
+func (c *Ctx) RegisterDataSource(name string, ds datasource.DataSource) {
+	c.tables[name] = ds
+}
+
+// DeregisterTable removes a table from the catalog, it's a no-op for an unknown name
+func (c *Ctx) DeregisterTable(name string) {
+	delete(c.tables, name)
+}
+
+// Table returns a DataFrame scanning the named table,
+// every call reopens the DataSource, so that each query reads the table from the beginning
+func (c *Ctx) Table(name string) (DataFrame, error) {
+	ds, ok := c.tables[name]
+	if !ok {
+		return nil, datatypes.NewPlanError("no table named %s", name)
+	}
+	return NewDefaultDataFrame(NewScan(name, ds.Reopen(), []string{})), nil
+}
+
+// ListTables returns the sorted names of the registered tables
+func (c *Ctx) ListTables() []string {
+	names := make([]string, 0, len(c.tables))
+	for name := range c.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
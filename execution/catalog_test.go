@@ -0,0 +1,84 @@
+package execution
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"query-engine/datasource"
+	. "query-engine/logicalplan"
+	"strings"
+	"testing"
+)
+
+func TestCtx_Catalog(t *testing.T) {
+	ctx := NewCtx()
+	require.NoError(t, ctx.RegisterCSV("employee", dir+"/employee.csv", datasource.CsvOptions{}))
+	require.NoError(t, ctx.RegisterParquet("alltypes", dir+"/alltypes_plain.parquet"))
+	require.Equal(t, []string{"alltypes", "employee"}, ctx.ListTables())
+
+	df, err := ctx.Table("employee")
+	require.NoError(t, err)
+	require.Equal(t, "\nScan: employee; projection=None\n", PrettyFormat(df.LogicalPlan()))
+
+	ctx.DeregisterTable("alltypes")
+	require.Equal(t, []string{"employee"}, ctx.ListTables())
+	_, err = ctx.Table("alltypes")
+	require.EqualError(t, err, "no table named alltypes")
+}
+
+func TestCtx_Catalog_reuse_table_across_queries(t *testing.T) {
+	ctx := NewCtx()
+	require.NoError(t, ctx.RegisterParquet("alltypes", dir+"/alltypes_plain.parquet"))
+
+	for i := 0; i < 2; i++ {
+		df, err := ctx.Sql("SELECT Id FROM alltypes")
+		require.NoError(t, err)
+		require.NoError(t, ctx.Plan(df.LogicalPlan()))
+		require.Equal(t, 8, strings.Count(collect(t, ctx), "\n"))
+	}
+}
+
+// reopenCounter counts the reopening of a DataSource
+type reopenCounter struct {
+	datasource.DataSource
+	count *int
+}
+
+func (r reopenCounter) Reopen() datasource.DataSource {
+	*r.count++
+	return r.DataSource.Reopen()
+}
+
+func TestCtx_Catalog_reopens_query_tables(t *testing.T) {
+	ctx := NewCtx()
+	ds, err := datasource.NewCsvDataSource(dir+"/employee.csv", ctx.BatchSize)
+	require.NoError(t, err)
+	employee, other := 0, 0
+	ctx.RegisterDataSource("employee", reopenCounter{ds, &employee})
+	ctx.RegisterDataSource("other", reopenCounter{ds, &other})
+
+	_, err = ctx.Sql("SELECT id FROM employee UNION SELECT id FROM employee")
+	require.NoError(t, err)
+	require.Equal(t, 1, employee)
+	require.Equal(t, 0, other)
+
+	_, err = ctx.Sql("SELECT id FROM employee UNION SELECT id FROM missing")
+	require.EqualError(t, err, "no table named missing")
+}
+
+func TestCtx_Catalog_csv_options(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.csv")
+	require.NoError(t, os.WriteFile(path, []byte("id;name\n1;a\n2;b\n"), 0644))
+
+	ctx := NewCtx()
+	require.NoError(t, ctx.RegisterCSV("data", path, datasource.CsvOptions{Delimiter: ';'}))
+	df, err := ctx.Sql("SELECT name FROM data WHERE id = '2'")
+	require.NoError(t, err)
+
+	require.NoError(t, ctx.Plan(df.LogicalPlan()))
+	require.True(t, ctx.Next(context.Background()))
+	result, err := ctx.Execute(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "b\n", result.ToCSV())
+}
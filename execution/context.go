@@ -1,44 +1,146 @@
 package execution
 
 import (
+	"context"
 	"query-engine/datasource"
 	"query-engine/datatypes"
 	. "query-engine/logicalplan"
 	"query-engine/optimizer"
 	"query-engine/physicalplan"
 	"query-engine/queryplaner"
+	"query-engine/sql"
+	"runtime"
 )
 
 type Ctx struct {
-	BatchSize    int
-	PhysicalPlan physicalplan.PhysicalPlan
+	BatchSize int
+	// MemoryLimit is the memory budget in bytes of operators which can spill to disk, like sort and aggregate, 0 means no limit
+	MemoryLimit int64
+	// SpillDir is where the spill files are written, the default temp directory when empty
+	SpillDir string
+	// TargetPartitions is the number of partitions a scan is split into to run on several cores,
+	// the number of CPUs by default, 1 runs the query in the calling goroutine
+	TargetPartitions int
+	PhysicalPlan     physicalplan.PhysicalPlan
+
+	// queryCtx is the ctx the PhysicalPlan runs under, derived from the ctx of its first Next,
+	// cancel stops the goroutines of its partitions once the query is drained, closed or replaced
+	queryCtx context.Context
+	cancel   context.CancelFunc
+	// closed is set once the PhysicalPlan is closed, Next returns false until the next Plan
+	closed bool
+	// err is the error of the ctx of a later Next, which is done, it is returned by Execute
+	err error
+
+	// catalog of the registered tables, see catalog.go
+	tables map[string]datasource.DataSource
 }
 
 func NewCtx() *Ctx {
-	return &Ctx{BatchSize: 1024}
+	return &Ctx{
+		BatchSize:        1024,
+		TargetPartitions: runtime.NumCPU(),
+		tables:           make(map[string]datasource.DataSource),
+	}
 }
 
-func (c *Ctx) CSV(filename string) DataFrame {
-	csvDataSource := datasource.NewCsvDataSource(filename, c.BatchSize)
+func (c *Ctx) CSV(filename string) (DataFrame, error) {
+	csvDataSource, err := datasource.NewCsvDataSource(filename, c.BatchSize)
+	if err != nil {
+		return nil, err
+	}
 	scan := NewScan(filename, csvDataSource, []string{})
-	return NewDefaultDataFrame(scan)
+	return NewDefaultDataFrame(scan), nil
 }
 
-func (c *Ctx) Parquet(filename string) DataFrame {
-	parquetDataSource := datasource.NewParquetDataSource(filename, c.BatchSize)
+func (c *Ctx) Parquet(filename string) (DataFrame, error) {
+	parquetDataSource, err := datasource.NewParquetDataSource(filename, c.BatchSize)
+	if err != nil {
+		return nil, err
+	}
 	scan := NewScan(filename, parquetDataSource, []string{})
-	return NewDefaultDataFrame(scan)
+	return NewDefaultDataFrame(scan), nil
+}
+
+// Sql creates a DataFrame from a SELECT query, or a set operation of SELECTs, over the tables registered in the catalog
+func (c *Ctx) Sql(query string) (DataFrame, error) {
+	tokens, err := sql.NewTokenizer(query).Tokenize()
+	if err != nil {
+		return nil, err
+	}
+	ast, err := sql.NewParser(tokens).Parse()
+	if err != nil {
+		return nil, err
+	}
+	// only the tables of the query are reopened
+	names := sql.Tables(ast)
+	tables := make(map[string]DataFrame, len(names))
+	for _, name := range names {
+		if tables[name], err = c.Table(name); err != nil {
+			return nil, err
+		}
+	}
+	return sql.NewPlanner().CreateDataFrame(ast, tables)
+}
+
+// Plan optimizes the logical plan and creates the physical plan to run by Next and Execute,
+// the previous query is closed
+func (c *Ctx) Plan(plan LogicalPlan) error {
+	c.Close()
+	c.PhysicalPlan, c.closed, c.err = nil, false, nil
+	optimizedPlan, err := optimizer.NewOptimizer().Optimize(plan)
+	if err != nil {
+		return err
+	}
+	c.PhysicalPlan, err = queryplaner.NewPhysicalPlanWithConfig(optimizedPlan, queryplaner.Config{
+		BatchSize:        c.BatchSize,
+		MemoryLimit:      c.MemoryLimit,
+		SpillDir:         c.SpillDir,
+		TargetPartitions: c.TargetPartitions,
+	})
+	return err
 }
 
-func (c *Ctx) Plan(plan LogicalPlan) {
-	optimizedPlan := optimizer.NewOptimizer().Optimize(plan)
-	c.PhysicalPlan = queryplaner.NewPhysicalPlan(optimizedPlan)
+// Next prepares the next batch of the planned query. The query runs under the ctx of its first Next,
+// it is cancelled once that ctx is done, like when its deadline is exceeded or it is cancelled from another goroutine.
+// The ctx of every Next is checked too, once it is done the query is closed and Execute returns its error.
+// Once Next returns false the query is closed.
+func (c *Ctx) Next(ctx context.Context) bool {
+	if c.closed {
+		return false
+	}
+	if err := ctx.Err(); err != nil {
+		c.Close()
+		c.err = err
+		return true
+	}
+	if c.queryCtx == nil {
+		c.queryCtx, c.cancel = context.WithCancel(ctx)
+	}
+	if c.PhysicalPlan.Next(c.queryCtx) {
+		return true
+	}
+	c.Close()
+	return false
 }
 
-func (c *Ctx) Next() bool {
-	return c.PhysicalPlan.Next()
+// Execute returns the batch prepared by Next, or ctx error once the query is cancelled
+func (c *Ctx) Execute(ctx context.Context) (datatypes.RecordBatch, error) {
+	if c.err != nil {
+		return datatypes.RecordBatch{}, c.err
+	}
+	return c.PhysicalPlan.Execute(ctx)
 }
 
-func (c *Ctx) Execute() datatypes.RecordBatch {
-	return c.PhysicalPlan.Execute()
+// Close stops the goroutines of the planned query and releases its files, for a caller which doesn't
+// read all its batches
+func (c *Ctx) Close() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.queryCtx, c.cancel = nil, nil
+	if c.PhysicalPlan != nil && !c.closed {
+		c.PhysicalPlan.Close()
+		c.closed = true
+	}
 }
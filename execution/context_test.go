@@ -0,0 +1,741 @@
+package execution
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"math"
+	"os"
+	"query-engine/datasource"
+	"query-engine/datatypes"
+	. "query-engine/logicalplan"
+	"query-engine/physicalplan"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const dir = "../testdata"
+
+// writeNumbersCSV writes a numbers table of n rows, whose id is the row number and parity is 0 or 1
+func writeNumbersCSV(t *testing.T, n int) string {
+	filename := t.TempDir() + "/numbers.csv"
+	content := "id,parity\n"
+	for i := 0; i < n; i++ {
+		content += fmt.Sprintf("%d,%d\n", i, i%2)
+	}
+	require.NoError(t, os.WriteFile(filename, []byte(content), 0644))
+	return filename
+}
+
+// collectBatches drains the planned query and returns its batches, which have the schema of the plan
+func collectBatches(t *testing.T, ctx *Ctx) []datatypes.RecordBatch {
+	batches := make([]datatypes.RecordBatch, 0)
+	for ctx.Next(context.Background()) {
+		batch, err := ctx.Execute(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, ctx.PhysicalPlan.Schema(), batch.Schema)
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// collect drains the planned query and returns its rows as CSV
+func collect(t *testing.T, ctx *Ctx) string {
+	result := ""
+	for _, batch := range collectBatches(t, ctx) {
+		result += batch.ToCSV()
+	}
+	return result
+}
+
+func TestCtx_Sql(t *testing.T) {
+	ctx := NewCtx()
+	require.NoError(t, ctx.RegisterCSV("employee", dir+"/employee.csv", datasource.CsvOptions{}))
+
+	df, err := ctx.Sql("SELECT id, first_name, last_name FROM employee WHERE state = 'CO'")
+	require.NoError(t, err)
+
+	require.NoError(t, ctx.Plan(df.LogicalPlan()))
+	require.True(t, ctx.Next(context.Background()))
+	result, err := ctx.Execute(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "2,Gregg,Langford\n3,John,Travis\n", result.ToCSV())
+	require.False(t, ctx.Next(context.Background()))
+}
+
+func TestCtx_Sql_modulus(t *testing.T) {
+	ctx := NewCtx()
+	require.NoError(t, ctx.RegisterCSV("employee", dir+"/employee.csv", datasource.CsvOptions{}))
+
+	df, err := ctx.Sql("SELECT id, CAST(salary AS INT) % 7000, CAST(id AS INT) % 2 FROM employee WHERE CAST(id AS INT) % 2 = 1")
+	require.NoError(t, err)
+
+	require.NoError(t, ctx.Plan(df.LogicalPlan()))
+	require.True(t, ctx.Next(context.Background()))
+	result, err := ctx.Execute(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "1,5000,1\n3,4500,1\n", result.ToCSV())
+	require.False(t, ctx.Next(context.Background()))
+}
+
+func TestCtx_Sql_between_not(t *testing.T) {
+	ctx := NewCtx()
+	require.NoError(t, ctx.RegisterCSV("employee", dir+"/employee.csv", datasource.CsvOptions{}))
+
+	df, err := ctx.Sql("SELECT employee.id FROM employee " +
+		"WHERE CAST(employee.salary AS INT) BETWEEN 10000 AND 11500 AND NOT employee.state = 'CO'")
+	require.NoError(t, err)
+	require.NoError(t, ctx.Plan(df.LogicalPlan()))
+	require.Equal(t, "4\n", collect(t, ctx))
+
+	df, err = ctx.Sql("SELECT state, COUNT(*) FROM employee GROUP BY state HAVING COUNT(*) NOT BETWEEN 1 AND 1")
+	require.NoError(t, err)
+	require.NoError(t, ctx.Plan(df.LogicalPlan()))
+	require.Equal(t, "CO,2\n", collect(t, ctx))
+}
+
+func TestCtx_Sql_aggregate_empty_input(t *testing.T) {
+	filename := writeNumbersCSV(t, 1000)
+
+	// without GROUP BY a single row is returned, by the single or the two-phase aggregation
+	for _, targetPartitions := range []int{1, 4} {
+		ctx := NewCtx()
+		ctx.TargetPartitions = targetPartitions
+		require.NoError(t, ctx.RegisterCSV("numbers", filename, datasource.CsvOptions{MinPartitionBytes: 512}))
+		df, err := ctx.Sql("SELECT COUNT(*), SUM(CAST(id AS INT)), MAX(id) FROM numbers WHERE parity = '2'")
+		require.NoError(t, err)
+		require.NoError(t, ctx.Plan(df.LogicalPlan()))
+		require.Equal(t, "0,null,null\n", collect(t, ctx))
+	}
+}
+
+func TestCtx_Sql_aggregate(t *testing.T) {
+	ctx := NewCtx()
+	require.NoError(t, ctx.RegisterCSV("employee", dir+"/employee.csv", datasource.CsvOptions{}))
+
+	df, err := ctx.Sql("SELECT state, MAX(CAST(salary AS double)) AS max_salary FROM employee GROUP BY state")
+	require.NoError(t, err)
+
+	require.NoError(t, ctx.Plan(df.LogicalPlan()))
+	require.True(t, ctx.Next(context.Background()))
+	result, err := ctx.Execute(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "CA,12000\nCO,11500\n,11500\n", result.ToCSV())
+	require.Equal(t, "max_salary", result.Schema.Fields[1].Name)
+}
+
+func TestCtx_Sql_count_avg(t *testing.T) {
+	ctx := NewCtx()
+	require.NoError(t, ctx.RegisterCSV("employee", dir+"/employee.csv", datasource.CsvOptions{}))
+
+	df, err := ctx.Sql(`SELECT state, COUNT(*), COUNT(DISTINCT job_title), AVG(CAST(salary AS int)) AS avg_salary
+FROM employee GROUP BY state ORDER BY state`)
+	require.NoError(t, err)
+
+	require.NoError(t, ctx.Plan(df.LogicalPlan()))
+	require.Equal(t, ",1,1,11500\nCA,1,1,12000\nCO,2,2,10750\n", collect(t, ctx))
+	schema := ctx.PhysicalPlan.Schema()
+	require.Equal(t, df.Schema(), schema)
+	require.Equal(t, datatypes.UInt64Type, schema.Fields[1].DataType)
+	require.Equal(t, datatypes.DoubleType, schema.Fields[3].DataType)
+}
+
+func TestCtx_Sql_percentile(t *testing.T) {
+	ctx := NewCtx()
+	require.NoError(t, ctx.RegisterCSV("employee", dir+"/employee.csv", datasource.CsvOptions{}))
+
+	df, err := ctx.Sql(`SELECT state, MEDIAN(CAST(salary AS int)), PERCENTILE_CONT(CAST(salary AS int), 0.25),
+PERCENTILE_DISC(CAST(salary AS int), 0.5) FROM employee GROUP BY state ORDER BY state`)
+	require.NoError(t, err)
+
+	require.NoError(t, ctx.Plan(df.LogicalPlan()))
+	require.Equal(t, df.Schema(), ctx.PhysicalPlan.Schema())
+	require.Equal(t, ",11500,11500,11500\nCA,12000,12000,12000\nCO,10750,10375,10000\n", collect(t, ctx))
+	require.Equal(t, datatypes.DoubleType, df.Schema().Fields[1].DataType)
+	require.Equal(t, datatypes.Int64Type, df.Schema().Fields[3].DataType)
+}
+
+func TestCtx_Sql_array_agg(t *testing.T) {
+	ctx := NewCtx()
+	require.NoError(t, ctx.RegisterCSV("employee", dir+"/employee.csv", datasource.CsvOptions{}))
+
+	df, err := ctx.Sql(`SELECT state, ARRAY_AGG(first_name), STRING_AGG(job_title, '; ')
+FROM employee GROUP BY state ORDER BY state`)
+	require.NoError(t, err)
+	require.Equal(t, datatypes.NewListType(datatypes.StringType), df.Schema().Fields[1].DataType)
+
+	require.NoError(t, ctx.Plan(df.LogicalPlan()))
+	require.Equal(t, df.Schema(), ctx.PhysicalPlan.Schema())
+	rows := make([][]interface{}, 0)
+	for _, batch := range collectBatches(t, ctx) {
+		for i := 0; i < batch.RowCount(); i++ {
+			rows = append(rows, []interface{}{batch.Field(0).GetValue(i), batch.Field(1).GetValue(i), batch.Field(2).GetValue(i)})
+		}
+	}
+	require.Equal(t, [][]interface{}{
+		{"", []interface{}{"Von"}, "Defensive End"},
+		{"CA", []interface{}{"Bill"}, "Manager"},
+		{"CO", []interface{}{"Gregg", "John"}, "Driver; Manager, Software"},
+	}, rows)
+}
+
+func TestCtx_Sql_array_agg_partitions(t *testing.T) {
+	filename := writeNumbersCSV(t, 1000)
+
+	// the list states are repartitioned and spilled by the two-phase aggregation
+	ctx := NewCtx()
+	ctx.BatchSize = 64
+	ctx.TargetPartitions = 4
+	ctx.MemoryLimit = 1
+	ctx.SpillDir = t.TempDir()
+	require.NoError(t, ctx.RegisterCSV("numbers", filename, datasource.CsvOptions{MinPartitionBytes: 512}))
+	df, err := ctx.Sql("SELECT parity, ARRAY_AGG(CAST(id AS INT)), STRING_AGG(id, ',') FROM numbers GROUP BY parity ORDER BY parity")
+	require.NoError(t, err)
+	require.NoError(t, ctx.Plan(df.LogicalPlan()))
+	require.Contains(t, physicalplan.PrettyFormat(ctx.PhysicalPlan), "RepartitionExec")
+
+	rows := 0
+	for _, batch := range collectBatches(t, ctx) {
+		for i := 0; i < batch.RowCount(); i++ {
+			parity := batch.Field(0).GetValue(i).(string)
+			values := batch.Field(1).GetValue(i).([]interface{})
+			require.Len(t, values, 500)
+			ids := make([]int, 0)
+			for _, id := range strings.Split(batch.Field(2).GetValue(i).(string), ",") {
+				n, err := strconv.Atoi(id)
+				require.NoError(t, err)
+				ids = append(ids, n)
+			}
+			sort.Ints(ids)
+			require.Len(t, ids, 500)
+			for j, id := range ids {
+				require.Equal(t, 2*j+int(parity[0]-'0'), id)
+			}
+			rows++
+		}
+	}
+	require.Equal(t, 2, rows)
+}
+
+func TestCtx_Sql_grouping_sets(t *testing.T) {
+	ctx := NewCtx()
+	require.NoError(t, ctx.RegisterCSV("employee", dir+"/employee.csv", datasource.CsvOptions{}))
+
+	testCases := []struct {
+		query  string
+		expect string
+	}{
+		{
+			`SELECT state, job_title, SUM(CAST(salary AS int)), GROUPING(state, job_title) AS level
+FROM employee GROUP BY ROLLUP(state, job_title) ORDER BY level, state, job_title`,
+			",Defensive End,11500,0\nCA,Manager,12000,0\nCO,Driver,10000,0\nCO,Manager, Software,11500,0\n" +
+				",null,11500,1\nCA,null,12000,1\nCO,null,21500,1\nnull,null,45000,3\n",
+		},
+		{
+			"SELECT state, COUNT(*) FROM employee GROUP BY CUBE(state) ORDER BY GROUPING(state), state",
+			",1\nCA,1\nCO,2\nnull,4\n",
+		},
+		{
+			`SELECT state, last_name, COUNT(*) FROM employee
+GROUP BY GROUPING SETS ((state), (last_name)) ORDER BY state, last_name`,
+			",null,1\nCA,null,1\nCO,null,2\nnull,Hopkins,1\nnull,Langford,1\nnull,Mill,1\nnull,Travis,1\n",
+		},
+		{
+			"SELECT state, GROUPING(state) FROM employee GROUP BY state ORDER BY state",
+			",0\nCA,0\nCO,0\n",
+		},
+	}
+	for _, tc := range testCases {
+		df, err := ctx.Sql(tc.query)
+		require.NoError(t, err)
+		require.NoError(t, ctx.Plan(df.LogicalPlan()))
+		require.Equal(t, df.Schema(), ctx.PhysicalPlan.Schema())
+		require.Equal(t, tc.expect, collect(t, ctx), tc.query)
+	}
+}
+
+func TestCtx_Sql_grouping_sets_partitions(t *testing.T) {
+	filename := writeNumbersCSV(t, 1000)
+
+	// the expanded rows are aggregated in two phases and spilled
+	ctx := NewCtx()
+	ctx.BatchSize = 64
+	ctx.TargetPartitions = 4
+	ctx.MemoryLimit = 1
+	ctx.SpillDir = t.TempDir()
+	require.NoError(t, ctx.RegisterCSV("numbers", filename, datasource.CsvOptions{MinPartitionBytes: 512}))
+	df, err := ctx.Sql(`SELECT parity, COUNT(*), SUM(CAST(id AS INT)), GROUPING(parity) FROM numbers
+GROUP BY ROLLUP(parity) ORDER BY parity`)
+	require.NoError(t, err)
+	require.NoError(t, ctx.Plan(df.LogicalPlan()))
+	require.Contains(t, physicalplan.PrettyFormat(ctx.PhysicalPlan), "ExpandExec")
+
+	require.Equal(t, "0,500,249500,0\n1,500,250000,0\nnull,1000,499500,1\n", collect(t, ctx))
+}
+
+func TestCtx_Sql_having_filter(t *testing.T) {
+	ctx := NewCtx()
+	require.NoError(t, ctx.RegisterCSV("employee", dir+"/employee.csv", datasource.CsvOptions{}))
+
+	testCases := []struct {
+		query  string
+		expect string
+	}{
+		{
+			`SELECT state, COUNT(*), COUNT(*) FILTER (WHERE job_title = 'Manager') FROM employee
+GROUP BY state HAVING MIN(CAST(salary AS int)) > 10000 ORDER BY state`,
+			",1,0\nCA,1,1\n",
+		},
+		{
+			"SELECT SUM(CAST(salary AS int)) FILTER (WHERE state = 'CO') FROM employee HAVING COUNT(*) > 1",
+			"21500\n",
+		},
+		{
+			// the count is compared with the literal without a cast
+			"SELECT state, COUNT(*) FROM employee GROUP BY state HAVING COUNT(*) >= 2 OR COUNT(*) < 0.5 ORDER BY state",
+			"CO,2\n",
+		},
+		{
+			"SELECT COUNT(*) FROM employee HAVING MAX(CAST(id AS int)) > 4",
+			"",
+		},
+		{
+			// the arithmetic operands are coerced like the compared ones
+			"SELECT COUNT(*) + 1, MAX(CAST(salary AS int)) * 1.5 FROM employee HAVING COUNT(*) + 1 > 4",
+			"5,18000\n",
+		},
+	}
+	for _, tc := range testCases {
+		df, err := ctx.Sql(tc.query)
+		require.NoError(t, err)
+		require.NoError(t, ctx.Plan(df.LogicalPlan()))
+		require.Equal(t, df.Schema(), ctx.PhysicalPlan.Schema())
+		require.Equal(t, tc.expect, collect(t, ctx), tc.query)
+	}
+}
+
+func TestCtx_Sql_having_filter_partitions(t *testing.T) {
+	filename := writeNumbersCSV(t, 1000)
+
+	// the partial aggregations accumulate the filtered rows, the final one merges their states
+	ctx := NewCtx()
+	ctx.BatchSize = 64
+	ctx.TargetPartitions = 4
+	require.NoError(t, ctx.RegisterCSV("numbers", filename, datasource.CsvOptions{MinPartitionBytes: 512}))
+	df, err := ctx.Sql(`SELECT parity, SUM(CAST(id AS INT)) FILTER (WHERE CAST(id AS INT) < 10),
+COUNT(*) FILTER (WHERE CAST(id AS INT) >= 990) FROM numbers
+GROUP BY parity HAVING SUM(CAST(id AS INT)) > 249500 ORDER BY parity`)
+	require.NoError(t, err)
+	require.NoError(t, ctx.Plan(df.LogicalPlan()))
+	require.Contains(t, physicalplan.PrettyFormat(ctx.PhysicalPlan), "mode=partial")
+
+	require.Equal(t, "1,25,5\n", collect(t, ctx))
+}
+
+func TestCtx_Sql_set_operations(t *testing.T) {
+	ctx := NewCtx()
+	require.NoError(t, ctx.RegisterCSV("employee", dir+"/employee.csv", datasource.CsvOptions{}))
+
+	testCases := []struct {
+		query  string
+		expect string
+	}{
+		{"SELECT DISTINCT state FROM employee ORDER BY state", "\nCA\nCO\n"},
+		{"SELECT DISTINCT state FROM employee LIMIT 1 OFFSET 1", "CO\n"},
+		{
+			"SELECT state FROM employee UNION SELECT job_title FROM employee WHERE id = '1' ORDER BY state",
+			"\nCA\nCO\nManager\n",
+		},
+		{
+			// the tinyint and int columns are widened to int
+			`SELECT CAST(id AS tinyint) FROM employee UNION ALL
+SELECT CAST(salary AS int) FROM employee WHERE state = 'CA' ORDER BY id DESC`,
+			"12000\n4\n3\n2\n1\n",
+		},
+		{"SELECT state FROM employee INTERSECT SELECT state FROM employee WHERE job_title = 'Driver'", "CO\n"},
+		{"SELECT state FROM employee EXCEPT SELECT state FROM employee WHERE id = '2' ORDER BY state", "\nCA\n"},
+	}
+	for _, tc := range testCases {
+		df, err := ctx.Sql(tc.query)
+		require.NoError(t, err)
+		require.NoError(t, ctx.Plan(df.LogicalPlan()))
+		require.Equal(t, df.Schema(), ctx.PhysicalPlan.Schema())
+		require.Equal(t, tc.expect, collect(t, ctx), tc.query)
+	}
+}
+
+func TestCtx_Sql_set_operations_partitions(t *testing.T) {
+	filename := writeNumbersCSV(t, 1000)
+
+	// the rows of the distinct plans are repartitioned by all their columns
+	ctx := NewCtx()
+	ctx.BatchSize = 64
+	ctx.TargetPartitions = 4
+	require.NoError(t, ctx.RegisterCSV("numbers", filename, datasource.CsvOptions{MinPartitionBytes: 512}))
+	testCases := []struct {
+		query  string
+		expect string
+	}{
+		{"SELECT DISTINCT parity FROM numbers ORDER BY parity", "0\n1\n"},
+		{"SELECT parity FROM numbers WHERE CAST(id AS INT) < 3 UNION SELECT parity FROM numbers ORDER BY parity", "0\n1\n"},
+		{
+			`SELECT CAST(id AS INT) / 100 AS hundreds FROM numbers
+EXCEPT SELECT CAST(id AS INT) / 100 FROM numbers WHERE CAST(id AS INT) < 500 ORDER BY hundreds`,
+			"5\n6\n7\n8\n9\n",
+		},
+	}
+	for _, tc := range testCases {
+		df, err := ctx.Sql(tc.query)
+		require.NoError(t, err)
+		require.NoError(t, ctx.Plan(df.LogicalPlan()))
+		require.Equal(t, tc.expect, collect(t, ctx), tc.query)
+	}
+
+	df, err := ctx.Sql("SELECT DISTINCT parity FROM numbers")
+	require.NoError(t, err)
+	require.NoError(t, ctx.Plan(df.LogicalPlan()))
+	require.Contains(t, physicalplan.PrettyFormat(ctx.PhysicalPlan), "HashDistinctExec\n\t\tRepartitionExec")
+}
+
+func TestCtx_Sql_window(t *testing.T) {
+	ctx := NewCtx()
+	require.NoError(t, ctx.RegisterCSV("employee", dir+"/employee.csv", datasource.CsvOptions{}))
+
+	df, err := ctx.Sql(`SELECT first_name, state, ROW_NUMBER() OVER (PARTITION BY state ORDER BY id),
+RANK() OVER (ORDER BY CAST(salary AS int) DESC), SUM(CAST(salary AS int)) OVER (PARTITION BY state ORDER BY id),
+LAG(first_name, 1, '-') OVER (ORDER BY id) FROM employee ORDER BY id`)
+	require.NoError(t, err)
+
+	require.NoError(t, ctx.Plan(df.LogicalPlan()))
+	require.Equal(t, df.Schema(), ctx.PhysicalPlan.Schema())
+	require.Equal(t, "Bill,CA,1,1,12000,-\nGregg,CO,1,4,10000,Bill\nJohn,CO,2,2,21500,Gregg\nVon,,1,2,11500,John\n", collect(t, ctx))
+	require.Equal(t, datatypes.UInt64Type, df.Schema().Fields[2].DataType)
+	require.Equal(t, datatypes.Int64Type, df.Schema().Fields[4].DataType)
+}
+
+func TestCtx_Sql_window_frames(t *testing.T) {
+	ctx := NewCtx()
+	require.NoError(t, ctx.RegisterCSV("employee", dir+"/employee.csv", datasource.CsvOptions{}))
+
+	df, err := ctx.Sql(`SELECT id,
+SUM(CAST(salary AS int)) OVER (ORDER BY id ROWS BETWEEN 1 PRECEDING AND 1 FOLLOWING),
+SUM(CAST(salary AS int)) OVER (ORDER BY CAST(id AS int) RANGE BETWEEN 1 PRECEDING AND CURRENT ROW),
+MAX(CAST(salary AS int)) OVER (ORDER BY id ROWS BETWEEN CURRENT ROW AND UNBOUNDED FOLLOWING),
+COUNT(*) OVER () FROM employee ORDER BY id`)
+	require.NoError(t, err)
+
+	require.NoError(t, ctx.Plan(df.LogicalPlan()))
+	require.Equal(t, "1,22000,12000,12000,4\n2,33500,22000,11500,4\n3,33000,21500,11500,4\n4,23000,23000,11500,4\n", collect(t, ctx))
+}
+
+func TestCtx_Sql_window_partitions(t *testing.T) {
+	filename := writeNumbersCSV(t, 1000)
+
+	// the partitions of the window are evaluated in parallel after a repartition by parity
+	ctx := NewCtx()
+	ctx.BatchSize = 64
+	ctx.TargetPartitions = 4
+	require.NoError(t, ctx.RegisterCSV("numbers", filename, datasource.CsvOptions{MinPartitionBytes: 512}))
+	df, err := ctx.Sql(`SELECT CAST(id AS INT), ROW_NUMBER() OVER (PARTITION BY parity ORDER BY CAST(id AS INT)),
+SUM(CAST(id AS INT)) OVER (PARTITION BY parity ORDER BY CAST(id AS INT) ROWS BETWEEN 1 PRECEDING AND CURRENT ROW)
+FROM numbers`)
+	require.NoError(t, err)
+	require.NoError(t, ctx.Plan(df.LogicalPlan()))
+	require.Contains(t, physicalplan.PrettyFormat(ctx.PhysicalPlan), "RepartitionExec")
+
+	rows := 0
+	for _, batch := range collectBatches(t, ctx) {
+		for i := 0; i < batch.RowCount(); i++ {
+			id := batch.Field(0).GetValue(i).(int64)
+			sum := id
+			if id > 1 {
+				sum += id - 2
+			}
+			require.Equal(t, uint64(id/2+1), batch.Field(1).GetValue(i), id)
+			require.Equal(t, sum, batch.Field(2).GetValue(i), id)
+			rows++
+		}
+	}
+	require.Equal(t, 1000, rows)
+}
+
+func TestCtx_Sql_limit(t *testing.T) {
+	ctx := NewCtx()
+	ctx.BatchSize = 1
+	require.NoError(t, ctx.RegisterCSV("employee", dir+"/employee.csv", datasource.CsvOptions{}))
+
+	df, err := ctx.Sql("SELECT id, first_name FROM employee LIMIT 2 OFFSET 1")
+	require.NoError(t, err)
+
+	require.NoError(t, ctx.Plan(df.LogicalPlan()))
+	require.Equal(t, "2,Gregg\n3,John\n", collect(t, ctx))
+}
+
+// requireGoroutines waits for the goroutines to stop, until there are at most n goroutines
+func requireGoroutines(t *testing.T, n int) {
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > n && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	require.LessOrEqual(t, runtime.NumGoroutine(), n)
+}
+
+func TestCtx_Sql_limit_stops_partitions(t *testing.T) {
+	filename := writeNumbersCSV(t, 20000)
+
+	ctx := NewCtx()
+	ctx.BatchSize = 64
+	ctx.TargetPartitions = 4
+	require.NoError(t, ctx.RegisterCSV("numbers", filename, datasource.CsvOptions{MinPartitionBytes: 512}))
+	goroutines := runtime.NumGoroutine()
+	for i := 0; i < 5; i++ {
+		df, err := ctx.Sql("SELECT id FROM numbers WHERE parity = '1' LIMIT 1")
+		require.NoError(t, err)
+		require.NoError(t, ctx.Plan(df.LogicalPlan()))
+		require.Contains(t, physicalplan.PrettyFormat(ctx.PhysicalPlan), "CoalesceExec")
+		require.Equal(t, 1, strings.Count(collect(t, ctx), "\n"))
+	}
+	// the partitions stop once the limit is reached
+	requireGoroutines(t, goroutines)
+
+	// a query which isn't drained is stopped by Close
+	df, err := ctx.Sql("SELECT id FROM numbers")
+	require.NoError(t, err)
+	require.NoError(t, ctx.Plan(df.LogicalPlan()))
+	require.True(t, ctx.Next(context.Background()))
+	ctx.Close()
+	requireGoroutines(t, goroutines)
+}
+
+func TestCtx_Sql_limit_closes_files(t *testing.T) {
+	fds, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skip("no /proc/self/fd to count the open files")
+	}
+	ctx := NewCtx()
+	ctx.BatchSize = 1
+	require.NoError(t, ctx.RegisterParquet("alltypes", dir+"/alltypes_plain.parquet"))
+	for i := 0; i < 50; i++ {
+		df, err := ctx.Sql("SELECT Id FROM alltypes LIMIT 1")
+		require.NoError(t, err)
+		require.NoError(t, ctx.Plan(df.LogicalPlan()))
+		require.Equal(t, 1, strings.Count(collect(t, ctx), "\n"))
+	}
+
+	// the file of a query which isn't drained is closed by Close
+	df, err := ctx.Sql("SELECT Id FROM alltypes")
+	require.NoError(t, err)
+	require.NoError(t, ctx.Plan(df.LogicalPlan()))
+	require.True(t, ctx.Next(context.Background()))
+	ctx.Close()
+
+	after, err := os.ReadDir("/proc/self/fd")
+	require.NoError(t, err)
+	require.Len(t, after, len(fds))
+}
+
+func TestCtx_Sql_order_by(t *testing.T) {
+	ctx := NewCtx()
+	ctx.BatchSize = 3
+	require.NoError(t, ctx.RegisterCSV("employee", dir+"/employee.csv", datasource.CsvOptions{}))
+
+	df, err := ctx.Sql("SELECT id, state FROM employee ORDER BY CAST(salary AS INT) DESC, id DESC LIMIT 3")
+	require.NoError(t, err)
+
+	require.NoError(t, ctx.Plan(df.LogicalPlan()))
+	require.Equal(t, "1,CA\n4,\n3,CO\n", collect(t, ctx))
+}
+
+func TestCtx_Sql_order_by_spill(t *testing.T) {
+	ctx := NewCtx()
+	ctx.BatchSize = 1
+	ctx.MemoryLimit = 1
+	ctx.SpillDir = t.TempDir()
+	require.NoError(t, ctx.RegisterCSV("employee", dir+"/employee.csv", datasource.CsvOptions{}))
+
+	df, err := ctx.Sql("SELECT id FROM employee ORDER BY state DESC NULLS LAST, id DESC")
+	require.NoError(t, err)
+
+	require.NoError(t, ctx.Plan(df.LogicalPlan()))
+	require.Equal(t, "3\n2\n1\n4\n", collect(t, ctx))
+}
+
+func TestCtx_Sql_group_by_batches(t *testing.T) {
+	ctx := NewCtx()
+	ctx.BatchSize = 2
+	require.NoError(t, ctx.RegisterCSV("employee", dir+"/employee.csv", datasource.CsvOptions{}))
+
+	df, err := ctx.Sql("SELECT state, MAX(CAST(salary AS double)) FROM employee GROUP BY state")
+	require.NoError(t, err)
+
+	require.NoError(t, ctx.Plan(df.LogicalPlan()))
+	batches := collectBatches(t, ctx)
+	require.Len(t, batches, 2)
+	require.Equal(t, "CA,12000\nCO,11500\n", batches[0].ToCSV())
+	require.Equal(t, ",11500\n", batches[1].ToCSV())
+}
+
+func TestCtx_Sql_group_by_spill(t *testing.T) {
+	ctx := NewCtx()
+	ctx.BatchSize = 1
+	ctx.MemoryLimit = 1
+	ctx.SpillDir = t.TempDir()
+	require.NoError(t, ctx.RegisterCSV("employee", dir+"/employee.csv", datasource.CsvOptions{}))
+
+	df, err := ctx.Sql("SELECT state, MAX(CAST(salary AS double)) FROM employee GROUP BY state ORDER BY state")
+	require.NoError(t, err)
+
+	require.NoError(t, ctx.Plan(df.LogicalPlan()))
+	require.Equal(t, ",11500\nCA,12000\nCO,11500\n", collect(t, ctx))
+}
+
+func TestCtx_Sql_error(t *testing.T) {
+	ctx := NewCtx()
+	_, err := ctx.Sql("SELECT id FROM employee")
+	require.EqualError(t, err, "no table named employee")
+
+	_, err = ctx.Sql("1 + 2")
+	require.EqualError(t, err, "only SELECT statements are supported, got: 1 + 2")
+}
+
+func TestCtx_error_types(t *testing.T) {
+	ctx := NewCtx()
+	err := ctx.RegisterCSV("missing", dir+"/missing.csv", datasource.CsvOptions{})
+	var ioErr *datatypes.IOError
+	require.True(t, errors.As(err, &ioErr))
+	_, err = ctx.Table("missing")
+	var planErr *datatypes.PlanError
+	require.True(t, errors.As(err, &planErr))
+
+	require.NoError(t, ctx.RegisterCSV("employee", dir+"/employee.csv", datasource.CsvOptions{}))
+	df, err := ctx.Table("employee")
+	require.NoError(t, err)
+	err = ctx.Plan(df.Project([]LogicalExpr{NewCol("age")}).LogicalPlan())
+	var schemaErr *datatypes.SchemaError
+	require.True(t, errors.As(err, &schemaErr))
+
+	// the cast fails when executed, the error is returned by Execute instead of a panic
+	df, err = ctx.Sql("SELECT CAST(first_name AS INT) FROM employee")
+	require.NoError(t, err)
+	require.NoError(t, ctx.Plan(df.LogicalPlan()))
+	require.True(t, ctx.Next(context.Background()))
+	_, err = ctx.Execute(context.Background())
+	var castErr *datatypes.CastError
+	require.True(t, errors.As(err, &castErr))
+	require.Equal(t, "Bill", castErr.Value)
+}
+
+func TestCtx_timeout(t *testing.T) {
+	ctx := NewCtx()
+	require.NoError(t, ctx.RegisterCSV("employee", dir+"/employee.csv", datasource.CsvOptions{}))
+	df, err := ctx.Sql("SELECT state, MAX(CAST(salary AS double)) FROM employee GROUP BY state")
+	require.NoError(t, err)
+	require.NoError(t, ctx.Plan(df.LogicalPlan()))
+
+	timeoutCtx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-timeoutCtx.Done()
+	require.True(t, ctx.Next(timeoutCtx))
+	_, err = ctx.Execute(timeoutCtx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.False(t, ctx.Next(timeoutCtx))
+
+	// the ctx of a later Next stops the query too
+	ctx.BatchSize = 1
+	require.NoError(t, ctx.Plan(df.LogicalPlan()))
+	require.True(t, ctx.Next(context.Background()))
+	_, err = ctx.Execute(context.Background())
+	require.NoError(t, err)
+	cancelledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.True(t, ctx.Next(cancelledCtx))
+	_, err = ctx.Execute(cancelledCtx)
+	require.ErrorIs(t, err, context.Canceled)
+	require.False(t, ctx.Next(context.Background()))
+}
+
+func TestCtx_Sql_partitions(t *testing.T) {
+	filename := writeNumbersCSV(t, 1000)
+
+	query := func(targetPartitions int) string {
+		ctx := NewCtx()
+		ctx.BatchSize = 64
+		ctx.TargetPartitions = targetPartitions
+		require.NoError(t, ctx.RegisterCSV("numbers", filename, datasource.CsvOptions{MinPartitionBytes: 512}))
+		df, err := ctx.Sql("SELECT parity, SUM(CAST(id AS INT)) FROM numbers WHERE id != '10' GROUP BY parity ORDER BY parity")
+		require.NoError(t, err)
+		require.NoError(t, ctx.Plan(df.LogicalPlan()))
+		if targetPartitions > 1 {
+			require.Contains(t, physicalplan.PrettyFormat(ctx.PhysicalPlan), "CoalesceExec: partitions=4")
+		}
+		return collect(t, ctx)
+	}
+	require.Equal(t, "0,249490\n1,250000\n", query(1))
+	require.Equal(t, query(1), query(4))
+}
+
+func TestCtx_Sql_statistics(t *testing.T) {
+	filename := t.TempDir() + "/numbers.csv"
+	content := "x,y\n"
+	for i := 0; i < 1000; i++ {
+		content += fmt.Sprintf("%d,%d\n", i, 3*i+1)
+	}
+	require.NoError(t, os.WriteFile(filename, []byte(content), 0644))
+
+	for _, targetPartitions := range []int{1, 4} {
+		ctx := NewCtx()
+		ctx.BatchSize = 64
+		ctx.TargetPartitions = targetPartitions
+		require.NoError(t, ctx.RegisterCSV("numbers", filename, datasource.CsvOptions{MinPartitionBytes: 512}))
+		df, err := ctx.Sql(`SELECT VARIANCE(CAST(x AS INT)), VAR_POP(CAST(x AS INT)), STDDEV_POP(CAST(x AS INT)),
+COVAR_SAMP(CAST(y AS INT), CAST(x AS INT)), CORR(CAST(y AS INT), CAST(x AS INT)) FROM numbers`)
+		require.NoError(t, err)
+		require.NoError(t, ctx.Plan(df.LogicalPlan()))
+		require.True(t, ctx.Next(context.Background()))
+		batch, err := ctx.Execute(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 1, batch.RowCount())
+
+		// the variance of 0 to n-1 is n(n+1)/12 for a sample and (n*n-1)/12 for the population
+		expect := []float64{1000 * 1001 / 12.0, 999999 / 12.0, math.Sqrt(999999 / 12.0), 3 * 1000 * 1001 / 12.0, 1}
+		for i, value := range expect {
+			require.Equal(t, datatypes.DoubleType, batch.Schema.Fields[i].DataType)
+			require.InDelta(t, value, batch.Field(i).GetValue(0), 1e-6, batch.Schema.Fields[i].Name)
+		}
+		require.False(t, ctx.Next(context.Background()))
+	}
+}
+
+func TestCtx_Sql_approx(t *testing.T) {
+	filename := t.TempDir() + "/numbers.csv"
+	content := "x\n"
+	for i := 0; i < 1000; i++ {
+		content += fmt.Sprintf("%d\n", i*7%1000)
+	}
+	require.NoError(t, os.WriteFile(filename, []byte(content), 0644))
+
+	for _, targetPartitions := range []int{1, 4} {
+		ctx := NewCtx()
+		ctx.BatchSize = 64
+		ctx.TargetPartitions = targetPartitions
+		require.NoError(t, ctx.RegisterCSV("numbers", filename, datasource.CsvOptions{MinPartitionBytes: 512}))
+		df, err := ctx.Sql(`SELECT APPROX_COUNT_DISTINCT(x), APPROX_MEDIAN(CAST(x AS INT)),
+APPROX_PERCENTILE(CAST(x AS INT), 0.9) FROM numbers`)
+		require.NoError(t, err)
+		require.NoError(t, ctx.Plan(df.LogicalPlan()))
+		require.True(t, ctx.Next(context.Background()))
+		batch, err := ctx.Execute(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, df.Schema(), batch.Schema)
+
+		require.InDelta(t, 1000, batch.Field(0).GetValue(0), 20)
+		require.InDelta(t, 499.5, batch.Field(1).GetValue(0), 5)
+		require.InDelta(t, 899.5, batch.Field(2).GetValue(0), 5)
+		require.False(t, ctx.Next(context.Background()))
+	}
+}
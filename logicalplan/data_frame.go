@@ -6,6 +6,30 @@ type DataFrame interface {
 	Project(expr []LogicalExpr) DataFrame
 	Filter(expr LogicalExpr) DataFrame
 	Aggregate(groupBy []LogicalExpr, aggExpr []AggregateExpr) DataFrame
+	// AggregateGroupingSets groups the rows once by every grouping set, a list of indexes of groupBy
+	AggregateGroupingSets(groupBy []LogicalExpr, groupingSets [][]int, aggExpr []AggregateExpr) DataFrame
+	// Join on pairs of left and right column names
+	Join(right DataFrame, joinType JoinType, on [][]string) DataFrame
+	// JoinWithFilter joins on pairs of left and right column names and on a predicate over the columns of both sides
+	JoinWithFilter(right DataFrame, joinType JoinType, on [][]string, filter LogicalExpr) DataFrame
+	// CrossJoin pairs every row with every row of right
+	CrossJoin(right DataFrame) DataFrame
+	// Sort orders the rows by the sort exprs
+	Sort(sortExprs []SortExpr) DataFrame
+	// Limit returns at most n rows
+	Limit(n int) DataFrame
+	// Offset skips the first n rows
+	Offset(n int) DataFrame
+	// Window appends the values of the window functions to the rows
+	Window(windowExprs []WindowExpr) DataFrame
+	// Distinct removes the duplicate rows
+	Distinct() DataFrame
+	// Union appends the rows of right, all keeps the duplicate rows
+	Union(right DataFrame, all bool) DataFrame
+	// Intersect returns the distinct rows which are also rows of right
+	Intersect(right DataFrame) DataFrame
+	// Except returns the distinct rows which are not rows of right
+	Except(right DataFrame) DataFrame
 
 	// Schema Returns the schema of the data that will be produced by this DataFrame.
 	Schema() datatypes.Schema
@@ -30,6 +54,61 @@ func (d DefaultDataFrame) Aggregate(groupBy []LogicalExpr, aggExpr []AggregateEx
 	return DefaultDataFrame{NewAggregate(d.plan, groupBy, aggExpr)}
 }
 
+func (d DefaultDataFrame) AggregateGroupingSets(
+	groupBy []LogicalExpr, groupingSets [][]int, aggExpr []AggregateExpr,
+) DataFrame {
+	return DefaultDataFrame{NewGroupingSetsAggregate(d.plan, groupBy, groupingSets, aggExpr)}
+}
+
+func (d DefaultDataFrame) Join(right DataFrame, joinType JoinType, on [][]string) DataFrame {
+	return DefaultDataFrame{NewJoin(d.plan, right.LogicalPlan(), joinType, on)}
+}
+
+func (d DefaultDataFrame) JoinWithFilter(right DataFrame, joinType JoinType, on [][]string, filter LogicalExpr) DataFrame {
+	return DefaultDataFrame{NewJoinWithFilter(d.plan, right.LogicalPlan(), joinType, on, filter)}
+}
+
+func (d DefaultDataFrame) CrossJoin(right DataFrame) DataFrame {
+	return DefaultDataFrame{NewJoin(d.plan, right.LogicalPlan(), CrossJoin, nil)}
+}
+
+func (d DefaultDataFrame) Sort(sortExprs []SortExpr) DataFrame {
+	return DefaultDataFrame{NewSort(d.plan, sortExprs)}
+}
+
+func (d DefaultDataFrame) Limit(n int) DataFrame {
+	// merge into an offset, so that Offset(m).Limit(n) is a single plan
+	if l, ok := d.plan.(Limit); ok && l.Limit < 0 {
+		l.Limit = n
+		return DefaultDataFrame{l}
+	}
+	return DefaultDataFrame{NewLimit(d.plan, n)}
+}
+
+func (d DefaultDataFrame) Offset(n int) DataFrame {
+	return DefaultDataFrame{NewOffset(d.plan, n)}
+}
+
+func (d DefaultDataFrame) Window(windowExprs []WindowExpr) DataFrame {
+	return DefaultDataFrame{NewWindow(d.plan, windowExprs)}
+}
+
+func (d DefaultDataFrame) Distinct() DataFrame {
+	return DefaultDataFrame{NewDistinct(d.plan)}
+}
+
+func (d DefaultDataFrame) Union(right DataFrame, all bool) DataFrame {
+	return DefaultDataFrame{NewUnion(d.plan, right.LogicalPlan(), all)}
+}
+
+func (d DefaultDataFrame) Intersect(right DataFrame) DataFrame {
+	return DefaultDataFrame{NewIntersect(d.plan, right.LogicalPlan())}
+}
+
+func (d DefaultDataFrame) Except(right DataFrame) DataFrame {
+	return DefaultDataFrame{NewExcept(d.plan, right.LogicalPlan())}
+}
+
 func (d DefaultDataFrame) Schema() datatypes.Schema {
 	return d.plan.Schema()
 }
@@ -2,17 +2,16 @@ package logicalplan
 
 import (
 	"github.com/stretchr/testify/require"
-	"query-engine/datasource"
 	"testing"
 )
 
-func csvDataFrame() DataFrame {
-	csv := datasource.NewCsvDataSource(dir+"/employee.csv", 1024)
+func csvDataFrame(t *testing.T) DataFrame {
+	csv := employeeCsv(t)
 	return NewDefaultDataFrame(NewScan("employee", csv, []string{}))
 }
 
 func Test_BuildDataFrame(t *testing.T) {
-	df := csvDataFrame()
+	df := csvDataFrame(t)
 	df = df.Filter(NewEq(NewCol("state"), NewLiteralString("CO")))
 	df = df.Project([]LogicalExpr{NewCol("id"), NewCol("first_name"), NewCol("last_name")})
 
@@ -25,7 +24,7 @@ Projection: #id, #first_name, #last_name
 }
 
 func Test_BuildDataFrame_multiplier_and_alias(t *testing.T) {
-	df := csvDataFrame()
+	df := csvDataFrame(t)
 	df = df.Filter(NewEq(NewCol("state"), NewLiteralString("CO")))
 	df = df.Project([]LogicalExpr{
 		NewCol("id"),
@@ -46,7 +45,7 @@ Selection: #bonus > 1000
 }
 
 func Test_BuildDataFrame_Aggregate(t *testing.T) {
-	df := csvDataFrame()
+	df := csvDataFrame(t)
 	df = df.Aggregate(
 		[]LogicalExpr{
 			NewCol("state"),
@@ -63,3 +62,119 @@ Aggregate: groupExpr=[#state], aggregateExpr=[MIN(#salary) MAX(#salary) COUNT(#s
 `
 	require.Equal(t, expect, PrettyFormat(df.LogicalPlan()))
 }
+
+func Test_BuildDataFrame_Aggregate_filter(t *testing.T) {
+	df := csvDataFrame(t)
+	df = df.Aggregate(
+		[]LogicalExpr{
+			NewCol("state"),
+		},
+		[]AggregateExpr{
+			NewMax(NewCol("salary")),
+			NewCount(NewCol("id")).WithFilter(NewGt(NewCol("salary"), NewLiteralLong(11000))),
+		})
+	// the aggregate results are filtered by the names of their columns, as HAVING
+	df = df.Filter(NewGt(NewCol("MAX(#salary)"), NewLiteralLong(11000)))
+
+	expect := `
+Selection: #MAX(#salary) > 11000
+	Aggregate: groupExpr=[#state], aggregateExpr=[MAX(#salary) COUNT(#id) FILTER (WHERE #salary > 11000)]
+		Scan: employee; projection=None
+`
+	require.Equal(t, expect, PrettyFormat(df.LogicalPlan()))
+	require.Equal(t, "COUNT(#id) FILTER (WHERE #salary > 11000)", df.Schema().Fields[2].Name)
+}
+
+func Test_BuildDataFrame_Join(t *testing.T) {
+	left := csvDataFrame(t)
+	right := NewDefaultDataFrame(NewScan("manager", employeeCsv(t), []string{}))
+	df := left.Join(right, LeftJoin, [][]string{{"id", "id"}, {"state", "state"}})
+
+	expect := `
+Join: type=Left, on=[[id id] [state state]]
+	Scan: employee; projection=None
+	Scan: manager; projection=None
+`
+	require.Equal(t, expect, PrettyFormat(df.LogicalPlan()))
+
+	// duplicate keys appear once
+	names := make([]string, 0)
+	for _, field := range df.Schema().Fields {
+		names = append(names, field.Name)
+	}
+	require.Equal(t, []string{"id", "first_name", "last_name", "state", "job_title", "salary", "first_name", "last_name", "job_title", "salary"}, names)
+}
+
+func Test_BuildDataFrame_JoinWithFilter(t *testing.T) {
+	left := csvDataFrame(t)
+	right := NewDefaultDataFrame(NewProjection(
+		NewScan("manager", employeeCsv(t), []string{}),
+		[]LogicalExpr{NewCol("state"), NewAlias(NewCol("salary"), "manager_salary")},
+	))
+	df := left.JoinWithFilter(right, LeftAntiJoin, [][]string{{"state", "state"}}, NewGt(NewCol("salary"), NewCol("manager_salary")))
+
+	expect := `
+Join: type=LeftAnti, on=[[state state]], filter=#salary > #manager_salary
+	Scan: employee; projection=None
+	Projection: #state, #salary as manager_salary
+		Scan: manager; projection=None
+`
+	require.Equal(t, expect, PrettyFormat(df.LogicalPlan()))
+	require.Equal(t, left.Schema(), df.Schema())
+
+	df = left.CrossJoin(right)
+	require.Equal(t, "Join: type=Cross, on=[]", df.LogicalPlan().String())
+	require.Equal(t, len(left.Schema().Fields)+2, len(df.Schema().Fields))
+}
+
+func Test_BuildDataFrame_Limit(t *testing.T) {
+	df := csvDataFrame(t).Offset(1).Limit(2)
+	expect := `
+Limit: 2, offset=1
+	Scan: employee; projection=None
+`
+	require.Equal(t, expect, PrettyFormat(df.LogicalPlan()))
+
+	df = csvDataFrame(t).Limit(2).Offset(1)
+	expect = `
+Limit: offset=1
+	Limit: 2
+		Scan: employee; projection=None
+`
+	require.Equal(t, expect, PrettyFormat(df.LogicalPlan()))
+}
+
+func Test_BuildDataFrame_Sort(t *testing.T) {
+	df := csvDataFrame(t).
+		Sort([]SortExpr{NewDesc(NewCol("salary")), NewSortExpr(NewCol("state"), true, true)}).
+		Limit(2)
+	expect := `
+Limit: 2
+	Sort: #salary DESC NULLS FIRST, #state ASC NULLS FIRST
+		Scan: employee; projection=None
+`
+	require.Equal(t, expect, PrettyFormat(df.LogicalPlan()))
+	require.Equal(t, csvDataFrame(t).Schema(), df.Schema())
+}
+
+func Test_BuildDataFrame_SetOperations(t *testing.T) {
+	states := csvDataFrame(t).Project([]LogicalExpr{NewCol("state")})
+	df := states.Union(states, true).Except(states).Intersect(states.Distinct())
+
+	expect := `
+Intersect
+	Except
+		Union: all=true
+			Projection: #state
+				Scan: employee; projection=None
+			Projection: #state
+				Scan: employee; projection=None
+		Projection: #state
+			Scan: employee; projection=None
+	Distinct
+		Projection: #state
+			Scan: employee; projection=None
+`
+	require.Equal(t, expect, PrettyFormat(df.LogicalPlan()))
+	require.Equal(t, states.Schema(), df.Schema())
+}
@@ -3,6 +3,7 @@ package logicalplan
 import (
 	"fmt"
 	"github.com/apache/arrow/go/v6/arrow"
+	"math"
 	"query-engine/datatypes"
 )
 
@@ -47,6 +48,34 @@ func NewColumnIndex(i int) ColumnIndex {
 	return ColumnIndex{i}
 }
 
+// JoinColumn Logical expression representing a reference to a column of a side of a join by name,
+// it tells apart the columns of a join filter having the same name on both sides.
+type JoinColumn struct {
+	Side JoinSide
+	Name string
+}
+
+func (c JoinColumn) ToField(input LogicalPlan) datatypes.Field {
+	if join, ok := input.(Join); ok {
+		if idx := join.FilterColumnIndex(c); idx >= 0 {
+			return join.FilterInput().Schema().Fields[idx]
+		}
+	}
+	panic(fmt.Sprintf("No column named %s", c))
+}
+
+func (c JoinColumn) String() string {
+	return fmt.Sprintf("#%s.%s", c.Side, c.Name)
+}
+
+func NewLeftCol(name string) JoinColumn {
+	return JoinColumn{LeftSide, name}
+}
+
+func NewRightCol(name string) JoinColumn {
+	return JoinColumn{RightSide, name}
+}
+
 // ---------------------------------------------Literal Expressions---------------------------------------------
 
 // LiteralString Logical expression representing a literal string value.
@@ -199,15 +228,19 @@ func NewLtEq(l, r LogicalExpr) BooleanBinaryExpr {
 	return BooleanBinaryExpr{BinaryExpr{"lteq", "<=", l, r}}
 }
 
-// MathExpr an expression return an input datatype
+// MathExpr an expression return the datatype of its operands, once they are coerced, see CoercedType
 type MathExpr struct {
 	BinaryExpr
 }
 
 func (m MathExpr) ToField(input LogicalPlan) datatypes.Field {
+	dType, ok := CoercedType(m.L, m.R, input)
+	if !ok {
+		dType = m.L.ToField(input).DataType
+	}
 	return datatypes.Field{
 		Name:     m.Name,
-		DataType: m.L.ToField(input).DataType,
+		DataType: dType,
 	}
 }
 
@@ -227,6 +260,74 @@ func NewModulus(l, r LogicalExpr) MathExpr {
 	return MathExpr{BinaryExpr{"modulus", "%", l, r}}
 }
 
+// CoercedType returns the type numeric operands of different types are coerced to, like a COUNT compared with
+// or added to a literal: a literal takes the type of the other operand when its value fits, see LiteralAs,
+// otherwise both operands take their widened type, see datatypes.WidenType. ok is false when the operands
+// are used as they are.
+func CoercedType(l, r LogicalExpr, input LogicalPlan) (dType arrow.DataType, ok bool) {
+	lType, rType := l.ToField(input).DataType, r.ToField(input).DataType
+	widened, ok := datatypes.WidenType(lType, rType)
+	if !ok || arrow.TypeEqual(lType, rType) {
+		return nil, false
+	}
+	if _, ok := LiteralAs(r, lType); ok {
+		return lType, true
+	}
+	if _, ok := LiteralAs(l, rType); ok {
+		return rType, true
+	}
+	return widened, true
+}
+
+// LiteralAs returns the value of a numeric literal as a value of a numeric dType, when it is exactly a value of dType
+func LiteralAs(expr LogicalExpr, dType arrow.DataType) (val interface{}, ok bool) {
+	switch e := expr.(type) {
+	case LiteralLong:
+		return integerAs(e.N, dType)
+	case LiteralDouble:
+		switch dType {
+		case datatypes.FloatType:
+			return float32(e.N), float64(float32(e.N)) == e.N
+		case datatypes.DoubleType:
+			return e.N, true
+		default:
+			if e.N == math.Trunc(e.N) && e.N >= math.MinInt64 && e.N < math.MaxInt64 {
+				return integerAs(int64(e.N), dType)
+			}
+		}
+	}
+	return nil, false
+}
+
+// integerAs converts n to a value of a numeric dType, ok is false when n is out of its range
+// or can't be exactly represented by a float
+func integerAs(n int64, dType arrow.DataType) (val interface{}, ok bool) {
+	switch dType {
+	case datatypes.Int8Type:
+		return int8(n), n >= math.MinInt8 && n <= math.MaxInt8
+	case datatypes.Int16Type:
+		return int16(n), n >= math.MinInt16 && n <= math.MaxInt16
+	case datatypes.Int32Type:
+		return int32(n), n >= math.MinInt32 && n <= math.MaxInt32
+	case datatypes.Int64Type:
+		return n, true
+	case datatypes.UInt8Type:
+		return uint8(n), n >= 0 && n <= math.MaxUint8
+	case datatypes.UInt16Type:
+		return uint16(n), n >= 0 && n <= math.MaxUint16
+	case datatypes.UInt32Type:
+		return uint32(n), n >= 0 && n <= math.MaxUint32
+	case datatypes.UInt64Type:
+		return uint64(n), n >= 0
+	case datatypes.FloatType:
+		return float32(n), n >= -1<<24 && n <= 1<<24
+	case datatypes.DoubleType:
+		return float64(n), n >= -1<<53 && n <= 1<<53
+	default:
+		return nil, false
+	}
+}
+
 // ---------------------------------------------Unary Expressions---------------------------------------------
 
 // UnaryExpr operate on one expr
@@ -275,6 +376,45 @@ func NewAlias(expr LogicalExpr, alias string) Alias {
 	return Alias{expr, alias}
 }
 
+// ---------------------------------------------Sort Expressions---------------------------------------------
+
+// SortExpr orders rows by an expression, either ascending or descending,
+// NullsFirst tells whether null values come before or after all the other values.
+type SortExpr struct {
+	Expr       LogicalExpr
+	Asc        bool
+	NullsFirst bool
+}
+
+func (s SortExpr) ToField(input LogicalPlan) datatypes.Field {
+	return s.Expr.ToField(input)
+}
+
+func (s SortExpr) String() string {
+	direction, nulls := "ASC", "NULLS LAST"
+	if !s.Asc {
+		direction = "DESC"
+	}
+	if s.NullsFirst {
+		nulls = "NULLS FIRST"
+	}
+	return fmt.Sprintf("%s %s %s", s.Expr, direction, nulls)
+}
+
+func NewSortExpr(expr LogicalExpr, asc bool, nullsFirst bool) SortExpr {
+	return SortExpr{expr, asc, nullsFirst}
+}
+
+// NewAsc sorts in ascending order with nulls last, as nulls are considered larger than any value
+func NewAsc(expr LogicalExpr) SortExpr {
+	return SortExpr{expr, true, false}
+}
+
+// NewDesc sorts in descending order with nulls first
+func NewDesc(expr LogicalExpr) SortExpr {
+	return SortExpr{expr, false, true}
+}
+
 // ---------------------------------------------Scalar Functions---------------------------------------------
 
 type ScalarFunction struct {
@@ -296,27 +436,112 @@ func (s ScalarFunction) String() string {
 type AggregateExpr struct {
 	Name string
 	Expr LogicalExpr
+	// Args are the inputs following Expr of the aggregates of several inputs, like the x of CORR(y, x)
+	Args []LogicalExpr
+	// Filter is the boolean predicate of FILTER (WHERE ...), only the rows for which it is true are aggregated,
+	// nil aggregates every row
+	Filter LogicalExpr
 }
 
+// ToField is the field of the aggregate result, the counts are UInt64, AVG, the statistics and the percentiles
+// are float64, STRING_AGG is a string, ARRAY_AGG a list of its input type and GROUPING is int64, the other aggregates
+// have the type of their input
 func (a AggregateExpr) ToField(input LogicalPlan) datatypes.Field {
+	switch a.Name {
+	case "COUNT", "COUNT_DISTINCT", "APPROX_COUNT_DISTINCT":
+		return datatypes.Field{Name: a.String(), DataType: datatypes.UInt64Type}
+	case "STRING_AGG":
+		return datatypes.Field{Name: a.String(), DataType: datatypes.StringType}
+	case "GROUPING":
+		return datatypes.Field{Name: a.String(), DataType: datatypes.Int64Type}
+	case "ARRAY_AGG":
+		return datatypes.Field{Name: a.String(), DataType: datatypes.NewListType(a.Expr.ToField(input).DataType)}
+	case "AVG", "VAR_SAMP", "VAR_POP", "STDDEV_SAMP", "STDDEV_POP", "COVAR_SAMP", "COVAR_POP", "CORR",
+		"APPROX_PERCENTILE", "APPROX_MEDIAN", "MEDIAN", "PERCENTILE_CONT":
+		return datatypes.Field{Name: a.String(), DataType: datatypes.DoubleType}
+	}
 	return datatypes.Field{Name: a.String(), DataType: a.Expr.ToField(input).DataType}
 }
 
 func (a AggregateExpr) String() string {
-	return fmt.Sprintf("%s(%s)", a.Name, a.Expr)
+	var str string
+	switch a.Name {
+	case "COUNT":
+		str = AggregateCountExpr{a}.String()
+	case "COUNT_DISTINCT":
+		str = AggregateCountDistinctExpr{a}.String()
+	default:
+		args := a.Expr.String()
+		for _, arg := range a.Args {
+			args += ", " + arg.String()
+		}
+		str = fmt.Sprintf("%s(%s)", a.Name, args)
+	}
+	if a.Filter != nil {
+		str += fmt.Sprintf(" FILTER (WHERE %s)", a.Filter)
+	}
+	return str
+}
+
+// Inputs returns Expr followed by the Args
+func (a AggregateExpr) Inputs() []LogicalExpr {
+	return append([]LogicalExpr{a.Expr}, a.Args...)
+}
+
+// Exprs returns the Inputs and the Filter
+func (a AggregateExpr) Exprs() []LogicalExpr {
+	if a.Filter == nil {
+		return a.Inputs()
+	}
+	return append(a.Inputs(), a.Filter)
+}
+
+// WithFilter returns the aggregate of the rows for which the boolean filter is true, as FILTER (WHERE filter)
+func (a AggregateExpr) WithFilter(filter LogicalExpr) AggregateExpr {
+	a.Filter = filter
+	return a
 }
 
 func NewSum(input LogicalExpr) AggregateExpr {
-	return AggregateExpr{"SUM", input}
+	return AggregateExpr{Name: "SUM", Expr: input}
 }
 func NewMin(input LogicalExpr) AggregateExpr {
-	return AggregateExpr{"MIN", input}
+	return AggregateExpr{Name: "MIN", Expr: input}
 }
 func NewMax(input LogicalExpr) AggregateExpr {
-	return AggregateExpr{"MAX", input}
+	return AggregateExpr{Name: "MAX", Expr: input}
 }
 func NewAvg(input LogicalExpr) AggregateExpr {
-	return AggregateExpr{"AVG", input}
+	return AggregateExpr{Name: "AVG", Expr: input}
+}
+
+// NewVariance is the sample variance VAR_SAMP, NewVariancePop the population variance VAR_POP
+func NewVariance(input LogicalExpr) AggregateExpr {
+	return AggregateExpr{Name: "VAR_SAMP", Expr: input}
+}
+func NewVariancePop(input LogicalExpr) AggregateExpr {
+	return AggregateExpr{Name: "VAR_POP", Expr: input}
+}
+
+// NewStddev is the sample standard deviation STDDEV_SAMP, NewStddevPop the population one STDDEV_POP
+func NewStddev(input LogicalExpr) AggregateExpr {
+	return AggregateExpr{Name: "STDDEV_SAMP", Expr: input}
+}
+func NewStddevPop(input LogicalExpr) AggregateExpr {
+	return AggregateExpr{Name: "STDDEV_POP", Expr: input}
+}
+
+// NewCovar is the sample covariance COVAR_SAMP of y and x, NewCovarPop the population one COVAR_POP
+func NewCovar(y, x LogicalExpr) AggregateExpr {
+	return AggregateExpr{Name: "COVAR_SAMP", Expr: y, Args: []LogicalExpr{x}}
+}
+func NewCovarPop(y, x LogicalExpr) AggregateExpr {
+	return AggregateExpr{Name: "COVAR_POP", Expr: y, Args: []LogicalExpr{x}}
+}
+
+// NewCorr is the Pearson correlation coefficient CORR of y and x
+func NewCorr(y, x LogicalExpr) AggregateExpr {
+	return AggregateExpr{Name: "CORR", Expr: y, Args: []LogicalExpr{x}}
 }
 
 type AggregateCountExpr struct {
@@ -324,7 +549,7 @@ type AggregateCountExpr struct {
 }
 
 func (a AggregateCountExpr) ToField(input LogicalPlan) datatypes.Field {
-	return datatypes.Field{Name: "COUNT", DataType: datatypes.UInt64Type}
+	return datatypes.Field{Name: a.String(), DataType: datatypes.UInt64Type}
 }
 
 func (a AggregateCountExpr) String() string {
@@ -332,7 +557,12 @@ func (a AggregateCountExpr) String() string {
 }
 
 func NewCount(input LogicalExpr) AggregateExpr {
-	return AggregateExpr{"COUNT", input}
+	return AggregateExpr{Name: "COUNT", Expr: input}
+}
+
+// NewCountStar counts the rows, as COUNT(1): the literal is never null
+func NewCountStar() AggregateExpr {
+	return NewCount(NewLiteralLong(1))
 }
 
 type AggregateCountDistinctExpr struct {
@@ -340,7 +570,7 @@ type AggregateCountDistinctExpr struct {
 }
 
 func (a AggregateCountDistinctExpr) ToField(input LogicalPlan) datatypes.Field {
-	return datatypes.Field{Name: "COUNT_DISTINCT", DataType: datatypes.UInt64Type}
+	return datatypes.Field{Name: a.String(), DataType: datatypes.UInt64Type}
 }
 
 func (a AggregateCountDistinctExpr) String() string {
@@ -348,5 +578,54 @@ func (a AggregateCountDistinctExpr) String() string {
 }
 
 func NewCountDistinct(input LogicalExpr) AggregateExpr {
-	return AggregateExpr{"COUNT_DISTINCT", input}
+	return AggregateExpr{Name: "COUNT_DISTINCT", Expr: input}
+}
+
+// NewArrayAgg collects the non null values of input into a list
+func NewArrayAgg(input LogicalExpr) AggregateExpr {
+	return AggregateExpr{Name: "ARRAY_AGG", Expr: input}
+}
+
+// NewStringAgg concatenates the non null strings of input, separator is a literal string
+func NewStringAgg(input LogicalExpr, separator LogicalExpr) AggregateExpr {
+	return AggregateExpr{Name: "STRING_AGG", Expr: input, Args: []LogicalExpr{separator}}
+}
+
+// NewGrouping tells the group values of an Aggregate by GroupingSets which are not part of the grouping set of
+// the row from null values: its bits are 1 for the group exprs left out of the grouping set and 0 for the others,
+// the bit of groupExpr is the most significant one. The group exprs are exprs of the GroupExpr of the Aggregate.
+func NewGrouping(groupExpr LogicalExpr, groupExprs ...LogicalExpr) AggregateExpr {
+	return AggregateExpr{Name: "GROUPING", Expr: groupExpr, Args: groupExprs}
+}
+
+// NewMedian is the exact median of input, interpolated between the two middle values of an even count
+func NewMedian(input LogicalExpr) AggregateExpr {
+	return AggregateExpr{Name: "MEDIAN", Expr: input}
+}
+
+// NewPercentileCont is the exact percentile of input interpolated between the values around it,
+// percentile is a literal between 0 and 1
+func NewPercentileCont(input LogicalExpr, percentile LogicalExpr) AggregateExpr {
+	return AggregateExpr{Name: "PERCENTILE_CONT", Expr: input, Args: []LogicalExpr{percentile}}
+}
+
+// NewPercentileDisc is the first value of input whose cumulative distribution is at least the percentile,
+// percentile is a literal between 0 and 1
+func NewPercentileDisc(input LogicalExpr, percentile LogicalExpr) AggregateExpr {
+	return AggregateExpr{Name: "PERCENTILE_DISC", Expr: input, Args: []LogicalExpr{percentile}}
+}
+
+// NewApproxCountDistinct estimates COUNT(DISTINCT input) with a HyperLogLog sketch
+func NewApproxCountDistinct(input LogicalExpr) AggregateExpr {
+	return AggregateExpr{Name: "APPROX_COUNT_DISTINCT", Expr: input}
+}
+
+// NewApproxPercentile estimates the percentile of input with a t-digest, percentile is a literal between 0 and 1
+func NewApproxPercentile(input LogicalExpr, percentile LogicalExpr) AggregateExpr {
+	return AggregateExpr{Name: "APPROX_PERCENTILE", Expr: input, Args: []LogicalExpr{percentile}}
+}
+
+// NewApproxMedian estimates the percentile 0.5 of input
+func NewApproxMedian(input LogicalExpr) AggregateExpr {
+	return AggregateExpr{Name: "APPROX_MEDIAN", Expr: input}
 }
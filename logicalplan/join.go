@@ -1,6 +1,7 @@
 package logicalplan
 
 import (
+	"fmt"
 	"query-engine/datatypes"
 )
 
@@ -10,25 +11,172 @@ const (
 	InnerJoin JoinType = iota
 	LeftJoin
 	RightJoin
+	// CrossJoin pairs every left row with every right row, it has no join keys
+	CrossJoin
+	// LeftSemiJoin returns the left rows having at least a matching right row, once, like EXISTS
+	LeftSemiJoin
+	// LeftAntiJoin returns the left rows without a matching right row, like NOT EXISTS
+	LeftAntiJoin
 )
 
+func (j JoinType) String() string {
+	switch j {
+	case InnerJoin:
+		return "Inner"
+	case LeftJoin:
+		return "Left"
+	case RightJoin:
+		return "Right"
+	case CrossJoin:
+		return "Cross"
+	case LeftSemiJoin:
+		return "LeftSemi"
+	case LeftAntiJoin:
+		return "LeftAnti"
+	default:
+		return fmt.Sprintf("JoinType(%d)", int(j))
+	}
+}
+
+// JoinSide is the left or the right input of a join
+type JoinSide int
+
+const (
+	LeftSide JoinSide = iota
+	RightSide
+)
+
+func (s JoinSide) String() string {
+	if s == RightSide {
+		return "right"
+	}
+	return "left"
+}
+
+// Join combines the rows of two logical plans whose join keys are equal.
 type Join struct {
-	left     LogicalPlan
-	right    LogicalPlan
-	joinType JoinType
+	Left     LogicalPlan
+	Right    LogicalPlan
+	JoinType JoinType
 
-	// on list item is a pair that contains on condition left and right fields
-	on [][]string
+	// On list item is a pair that contains on condition left and right fields
+	On [][]string
+	// Filter is a boolean predicate the pairs of rows matching the keys must also satisfy, like a.ts >= b.start,
+	// it is evaluated against the left columns followed by the right columns, see FilterInput. nil matches the pairs.
+	// A column both sides have is referred to with NewLeftCol or NewRightCol, see CheckFilter.
+	Filter LogicalExpr
 }
 
+// Schema is the left fields followed by the right fields. A key with the same name
+// on both sides appears once: from the left for inner and left joins, from the right for right joins,
+// because that side always has a value. Semi and anti joins only return the left fields.
 func (j Join) Schema() datatypes.Schema {
-	panic("implement me")
+	if j.JoinType == LeftSemiJoin || j.JoinType == LeftAntiJoin {
+		return j.Left.Schema()
+	}
+	duplicateKeys := j.DuplicateKeys()
+	fields := make([]datatypes.Field, 0)
+	for _, field := range j.Left.Schema().Fields {
+		if _, ok := duplicateKeys[field.Name]; ok && j.JoinType == RightJoin {
+			continue
+		}
+		fields = append(fields, field)
+	}
+	for _, field := range j.Right.Schema().Fields {
+		if _, ok := duplicateKeys[field.Name]; ok && j.JoinType != RightJoin {
+			continue
+		}
+		fields = append(fields, field)
+	}
+	return datatypes.Schema{Fields: fields}
+}
+
+// DuplicateKeys returns the join keys having the same name on both sides
+func (j Join) DuplicateKeys() map[string]struct{} {
+	keys := make(map[string]struct{})
+	for _, pair := range j.On {
+		if pair[0] == pair[1] {
+			keys[pair[0]] = struct{}{}
+		}
+	}
+	return keys
+}
+
+// FilterInput is the plan the Filter is evaluated against: the cross join of the inputs,
+// whose schema is all the left fields followed by all the right fields
+func (j Join) FilterInput() LogicalPlan {
+	return NewJoin(j.Left, j.Right, CrossJoin, nil)
+}
+
+// FilterColumnIndex returns the index of a column of a side in the schema of FilterInput, or -1 without such a column
+func (j Join) FilterColumnIndex(c JoinColumn) int {
+	leftSchema := j.Left.Schema()
+	if c.Side == LeftSide {
+		return leftSchema.FindFirstIndexByName(c.Name)
+	}
+	rightSchema := j.Right.Schema()
+	idx := rightSchema.FindFirstIndexByName(c.Name)
+	if idx < 0 {
+		return -1
+	}
+	return len(leftSchema.Fields) + idx
+}
+
+// CheckFilter returns a PlanError when the Filter refers by name to a column both sides have,
+// which would always be read from the left side, such a column is referred to with NewLeftCol or NewRightCol
+func (j Join) CheckFilter() error {
+	if j.Filter == nil {
+		return nil
+	}
+	names := make([]string, 0)
+	filterColumnNames(j.Filter, &names)
+	leftSchema := j.Left.Schema()
+	rightSchema := j.Right.Schema()
+	for _, name := range names {
+		if leftSchema.FindFirstIndexByName(name) >= 0 && rightSchema.FindFirstIndexByName(name) >= 0 {
+			return datatypes.NewPlanError("Join filter column %s is ambiguous, both sides have it", name)
+		}
+	}
+	return nil
+}
+
+// filterColumnNames appends the names of the columns an expression refers to by name
+func filterColumnNames(expr LogicalExpr, names *[]string) {
+	switch e := expr.(type) {
+	case Column:
+		*names = append(*names, e.Name)
+	case BooleanBinaryExpr:
+		filterColumnNames(e.L, names)
+		filterColumnNames(e.R, names)
+	case MathExpr:
+		filterColumnNames(e.L, names)
+		filterColumnNames(e.R, names)
+	case Alias:
+		filterColumnNames(e.Expr, names)
+	case CastExpr:
+		filterColumnNames(e.Expr, names)
+	case Not:
+		filterColumnNames(e.expr, names)
+	}
 }
 
 func (j Join) Children() []LogicalPlan {
-	panic("implement me")
+	return []LogicalPlan{j.Left, j.Right}
 }
 
 func (j Join) String() string {
-	panic("implement me")
+	if j.Filter != nil {
+		return fmt.Sprintf("Join: type=%s, on=%v, filter=%s", j.JoinType, j.On, j.Filter)
+	}
+	return fmt.Sprintf("Join: type=%s, on=%v", j.JoinType, j.On)
+}
+
+func NewJoin(left LogicalPlan, right LogicalPlan, joinType JoinType, on [][]string) Join {
+	return Join{left, right, joinType, on, nil}
+}
+
+// NewJoinWithFilter joins the pairs of rows whose keys are equal and which satisfy the filter,
+// a join without keys compares every pair of rows
+func NewJoinWithFilter(left LogicalPlan, right LogicalPlan, joinType JoinType, on [][]string, filter LogicalExpr) Join {
+	return Join{left, right, joinType, on, filter}
 }
@@ -98,6 +98,9 @@ type Aggregate struct {
 	Input     LogicalPlan
 	GroupExpr []LogicalExpr
 	AggExpr   []AggregateExpr
+	// GroupingSets groups the rows once by every grouping set, a list of indexes of GroupExpr, nil groups
+	// by all the GroupExpr. The group values which are not part of a grouping set are null, see NewGrouping.
+	GroupingSets [][]int
 }
 
 func (a Aggregate) Schema() datatypes.Schema {
@@ -118,30 +121,123 @@ func (a Aggregate) Children() []LogicalPlan {
 }
 
 func (a Aggregate) String() string {
-	return fmt.Sprintf("Aggregate: groupExpr=%v, aggregateExpr=%v", a.GroupExpr, a.AggExpr)
+	if a.GroupingSets == nil {
+		return fmt.Sprintf("Aggregate: groupExpr=%v, aggregateExpr=%v", a.GroupExpr, a.AggExpr)
+	}
+	sets := make([]string, len(a.GroupingSets))
+	for i, set := range a.GroupingSets {
+		exprs := make([]string, len(set))
+		for j, idx := range set {
+			exprs[j] = fmt.Sprint(idx)
+			if idx >= 0 && idx < len(a.GroupExpr) {
+				exprs[j] = a.GroupExpr[idx].String()
+			}
+		}
+		sets[i] = "(" + strings.Join(exprs, ", ") + ")"
+	}
+	return fmt.Sprintf("Aggregate: groupExpr=%v, groupingSets=[%s], aggregateExpr=%v",
+		a.GroupExpr, strings.Join(sets, " "), a.AggExpr)
 }
 
 func NewAggregate(input LogicalPlan, groupExpr []LogicalExpr, aggExpr []AggregateExpr) Aggregate {
-	return Aggregate{input, groupExpr, aggExpr}
+	return Aggregate{input, groupExpr, aggExpr, nil}
+}
+
+// NewGroupingSetsAggregate groups the rows by every grouping set of groupingSets, see RollupSets and CubeSets
+func NewGroupingSetsAggregate(
+	input LogicalPlan, groupExpr []LogicalExpr, groupingSets [][]int, aggExpr []AggregateExpr,
+) Aggregate {
+	return Aggregate{input, groupExpr, aggExpr, groupingSets}
+}
+
+// RollupSets are the grouping sets of ROLLUP over n group exprs: all of them, then without the last one,
+// and so on down to the empty set of the grand total
+func RollupSets(n int) [][]int {
+	sets := make([][]int, 0, n+1)
+	for size := n; size >= 0; size-- {
+		set := make([]int, size)
+		for i := range set {
+			set[i] = i
+		}
+		sets = append(sets, set)
+	}
+	return sets
+}
+
+// CubeSets are the grouping sets of CUBE over n group exprs: every subset of them, from all of them to none
+func CubeSets(n int) [][]int {
+	sets := make([][]int, 0, 1<<n)
+	// the bits of mask are the group exprs left out of the set
+	for mask := 0; mask < 1<<n; mask++ {
+		set := make([]int, 0, n)
+		for i := 0; i < n; i++ {
+			if mask&(1<<(n-1-i)) == 0 {
+				set = append(set, i)
+			}
+		}
+		sets = append(sets, set)
+	}
+	return sets
+}
+
+// Sort orders all the rows of its input by a list of sort expressions,
+// later expressions break the ties of the earlier ones.
+type Sort struct {
+	Input     LogicalPlan
+	SortExprs []SortExpr
+}
+
+func (s Sort) Schema() datatypes.Schema {
+	return s.Input.Schema()
+}
+
+func (s Sort) Children() []LogicalPlan {
+	return []LogicalPlan{s.Input}
+}
+
+func (s Sort) String() string {
+	exprStrList := make([]string, len(s.SortExprs))
+	for i, expr := range s.SortExprs {
+		exprStrList[i] = expr.String()
+	}
+	return fmt.Sprintf("Sort: %s", strings.Join(exprStrList, ", "))
 }
 
+func NewSort(input LogicalPlan, sortExprs []SortExpr) Sort {
+	return Sort{input, sortExprs}
+}
+
+// Limit skips the first Offset rows of its input, then returns at most Limit rows.
+// A negative Limit returns all the remaining rows.
 type Limit struct {
-	input LogicalPlan
-	limit int
+	Input  LogicalPlan
+	Offset int
+	Limit  int
 }
 
 func (l Limit) Schema() datatypes.Schema {
-	return l.input.Schema()
+	return l.Input.Schema()
 }
 
 func (l Limit) Children() []LogicalPlan {
-	return []LogicalPlan{l.input}
+	return []LogicalPlan{l.Input}
 }
 
 func (l Limit) String() string {
-	return fmt.Sprintf("Limit: %d", l.limit)
+	switch {
+	case l.Offset == 0:
+		return fmt.Sprintf("Limit: %d", l.Limit)
+	case l.Limit < 0:
+		return fmt.Sprintf("Limit: offset=%d", l.Offset)
+	default:
+		return fmt.Sprintf("Limit: %d, offset=%d", l.Limit, l.Offset)
+	}
 }
 
 func NewLimit(input LogicalPlan, limit int) Limit {
-	return Limit{input, limit}
+	return Limit{input, 0, limit}
+}
+
+func NewOffset(input LogicalPlan, offset int) Limit {
+	return Limit{input, offset, -1}
 }
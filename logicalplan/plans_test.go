@@ -9,8 +9,14 @@ import (
 
 const dir = "../testdata"
 
+func employeeCsv(t *testing.T) *datasource.CsvDataSource {
+	csv, err := datasource.NewCsvDataSource(dir+"/employee.csv", 1024)
+	require.NoError(t, err)
+	return csv
+}
+
 func Test_BuildLogicalPlans(t *testing.T) {
-	csv := datasource.NewCsvDataSource(dir+"/employee.csv", 1024)
+	csv := employeeCsv(t)
 
 	scan := NewScan("employee", csv, []string{})
 	eq := NewEq(NewCol("state"), NewLiteralString("CO"))
@@ -28,7 +34,7 @@ Projection: #id, #first_name, #last_name
 }
 
 func Test_BuildLogicalPlans_Aggregate(t *testing.T) {
-	csv := datasource.NewCsvDataSource(dir+"/employee.csv", 1024)
+	csv := employeeCsv(t)
 
 	scan := NewScan("employee", csv, []string{})
 	groupExpr := []LogicalExpr{NewCol("state")}
@@ -42,3 +48,75 @@ Aggregate: groupExpr=[#state], aggregateExpr=[MAX(CAST(#salary AS int32))]
 
 	require.Equal(t, expect, PrettyFormat(plan))
 }
+
+func Test_BuildLogicalPlans_GroupingSets(t *testing.T) {
+	csv := employeeCsv(t)
+
+	scan := NewScan("employee", csv, []string{})
+	groupExpr := []LogicalExpr{NewCol("state"), NewCol("job_title")}
+	aggExpr := []AggregateExpr{NewGrouping(NewCol("state"), NewCol("job_title"))}
+	plan := NewGroupingSetsAggregate(scan, groupExpr, CubeSets(2), aggExpr)
+
+	expect := `
+Aggregate: groupExpr=[#state #job_title], groupingSets=[(#state, #job_title) (#state) (#job_title) ()], aggregateExpr=[GROUPING(#state, #job_title)]
+	Scan: employee; projection=None
+`
+	require.Equal(t, expect, PrettyFormat(plan))
+	require.Equal(t, datatypes.Int64Type, plan.Schema().Fields[2].DataType)
+
+	require.Equal(t, [][]int{{0, 1, 2}, {0, 1}, {0}, {}}, RollupSets(3))
+	require.Equal(t, [][]int{{}}, CubeSets(0))
+}
+
+func Test_Join_Schema(t *testing.T) {
+	csv := employeeCsv(t)
+	left := NewProjection(NewScan("employee", csv, []string{}), []LogicalExpr{NewCol("id"), NewCol("state")})
+	right := NewProjection(NewScan("employee", csv, []string{}), []LogicalExpr{NewCol("state"), NewAlias(NewCol("id"), "manager_id")})
+
+	testCases := []struct {
+		joinType JoinType
+		on       [][]string
+		expect   []string
+	}{
+		{InnerJoin, [][]string{{"state", "state"}}, []string{"id", "state", "manager_id"}},
+		{LeftJoin, [][]string{{"state", "state"}}, []string{"id", "state", "manager_id"}},
+		{RightJoin, [][]string{{"state", "state"}}, []string{"id", "state", "manager_id"}},
+		{InnerJoin, [][]string{{"id", "manager_id"}}, []string{"id", "state", "state", "manager_id"}},
+		{LeftSemiJoin, [][]string{{"state", "state"}}, []string{"id", "state"}},
+		{LeftAntiJoin, [][]string{{"state", "state"}}, []string{"id", "state"}},
+		{CrossJoin, nil, []string{"id", "state", "state", "manager_id"}},
+	}
+	for _, tc := range testCases {
+		schema := NewJoin(left, right, tc.joinType, tc.on).Schema()
+		names := make([]string, len(schema.Fields))
+		for i, field := range schema.Fields {
+			names[i] = field.Name
+		}
+		require.Equal(t, tc.expect, names)
+	}
+}
+
+func Test_SetSchema(t *testing.T) {
+	scan := NewScan("employee", employeeCsv(t), []string{})
+	left := NewProjection(scan, []LogicalExpr{NewCol("id"), NewCast(NewCol("salary"), datatypes.Int8Type)})
+	right := NewProjection(scan, []LogicalExpr{NewCast(NewCol("id"), datatypes.Int64Type), NewCast(NewCol("salary"), datatypes.DoubleType)})
+
+	schema, err := SetSchema(UnionOperator, left, right)
+	require.Error(t, err)
+	require.Equal(t, "Union can't combine column id of type utf8 with id of type int64", err.Error())
+
+	left = NewProjection(scan, []LogicalExpr{NewCast(NewCol("id"), datatypes.Int8Type), NewCast(NewCol("salary"), datatypes.Int8Type)})
+	schema, err = SetSchema(IntersectOperator, left, right)
+	require.NoError(t, err)
+	require.Equal(t, []datatypes.Field{
+		{Name: "id", DataType: datatypes.Int64Type},
+		{Name: "salary", DataType: datatypes.DoubleType},
+	}, schema.Fields)
+	require.Equal(t, schema, NewIntersect(left, right).Schema())
+
+	_, err = SetSchema(ExceptOperator, left, scan)
+	require.Error(t, err)
+	require.Equal(t, "Except expects the same number of columns on both sides, got 2 and 6", err.Error())
+	// the left schema when the sides can't be combined
+	require.Equal(t, left.Schema(), NewExcept(left, scan).Schema())
+}
@@ -0,0 +1,146 @@
+package logicalplan
+
+import (
+	"fmt"
+	"query-engine/datatypes"
+)
+
+type SetOperator int
+
+const (
+	UnionOperator SetOperator = iota
+	IntersectOperator
+	ExceptOperator
+)
+
+func (s SetOperator) String() string {
+	switch s {
+	case UnionOperator:
+		return "Union"
+	case IntersectOperator:
+		return "Intersect"
+	case ExceptOperator:
+		return "Except"
+	default:
+		return fmt.Sprintf("SetOperator(%d)", int(s))
+	}
+}
+
+// SetSchema is the schema of a set operation over left and right: the names of the left columns,
+// with the types of the left and right columns at the same position widened, see datatypes.WidenType.
+// Both sides must have the same number of columns.
+func SetSchema(op SetOperator, left, right LogicalPlan) (datatypes.Schema, error) {
+	leftFields, rightFields := left.Schema().Fields, right.Schema().Fields
+	if len(leftFields) != len(rightFields) {
+		return datatypes.Schema{}, datatypes.NewSchemaError(
+			"%s expects the same number of columns on both sides, got %d and %d", op, len(leftFields), len(rightFields))
+	}
+	fields := make([]datatypes.Field, len(leftFields))
+	for i, field := range leftFields {
+		dataType, ok := datatypes.WidenType(field.DataType, rightFields[i].DataType)
+		if !ok {
+			return datatypes.Schema{}, datatypes.NewSchemaError("%s can't combine column %s of type %s with %s of type %s",
+				op, field.Name, field.DataType, rightFields[i].Name, rightFields[i].DataType)
+		}
+		fields[i] = datatypes.Field{Name: field.Name, DataType: dataType}
+	}
+	return datatypes.Schema{Fields: fields}, nil
+}
+
+// setSchema is the SetSchema, or the left schema when the sides can't be combined,
+// the error is returned by the planners
+func setSchema(op SetOperator, left, right LogicalPlan) datatypes.Schema {
+	schema, err := SetSchema(op, left, right)
+	if err != nil {
+		return left.Schema()
+	}
+	return schema
+}
+
+// Distinct removes the duplicate rows of its input, nulls are equal to each other.
+type Distinct struct {
+	Input LogicalPlan
+}
+
+func (d Distinct) Schema() datatypes.Schema {
+	return d.Input.Schema()
+}
+
+func (d Distinct) Children() []LogicalPlan {
+	return []LogicalPlan{d.Input}
+}
+
+func (d Distinct) String() string {
+	return "Distinct"
+}
+
+func NewDistinct(input LogicalPlan) Distinct {
+	return Distinct{input}
+}
+
+// Union returns the rows of Left followed by the rows of Right, without the duplicate rows unless All.
+type Union struct {
+	Left  LogicalPlan
+	Right LogicalPlan
+	All   bool
+}
+
+func (u Union) Schema() datatypes.Schema {
+	return setSchema(UnionOperator, u.Left, u.Right)
+}
+
+func (u Union) Children() []LogicalPlan {
+	return []LogicalPlan{u.Left, u.Right}
+}
+
+func (u Union) String() string {
+	return fmt.Sprintf("Union: all=%t", u.All)
+}
+
+func NewUnion(left LogicalPlan, right LogicalPlan, all bool) Union {
+	return Union{left, right, all}
+}
+
+// Intersect returns the distinct rows of Left which are also rows of Right.
+type Intersect struct {
+	Left  LogicalPlan
+	Right LogicalPlan
+}
+
+func (i Intersect) Schema() datatypes.Schema {
+	return setSchema(IntersectOperator, i.Left, i.Right)
+}
+
+func (i Intersect) Children() []LogicalPlan {
+	return []LogicalPlan{i.Left, i.Right}
+}
+
+func (i Intersect) String() string {
+	return "Intersect"
+}
+
+func NewIntersect(left LogicalPlan, right LogicalPlan) Intersect {
+	return Intersect{left, right}
+}
+
+// Except returns the distinct rows of Left which are not rows of Right.
+type Except struct {
+	Left  LogicalPlan
+	Right LogicalPlan
+}
+
+func (e Except) Schema() datatypes.Schema {
+	return setSchema(ExceptOperator, e.Left, e.Right)
+}
+
+func (e Except) Children() []LogicalPlan {
+	return []LogicalPlan{e.Left, e.Right}
+}
+
+func (e Except) String() string {
+	return "Except"
+}
+
+func NewExcept(left LogicalPlan, right LogicalPlan) Except {
+	return Except{left, right}
+}
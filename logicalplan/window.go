@@ -0,0 +1,241 @@
+package logicalplan
+
+import (
+	"fmt"
+	"query-engine/datatypes"
+	"strings"
+)
+
+type FrameUnits int
+
+const (
+	// RowsFrame bounds the frame by a number of rows around the current row
+	RowsFrame FrameUnits = iota
+	// RangeFrame bounds the frame by the distance of the ORDER BY value to the one of the current row,
+	// CURRENT ROW includes the peers of the current row, the rows with the same ORDER BY values
+	RangeFrame
+)
+
+func (f FrameUnits) String() string {
+	switch f {
+	case RowsFrame:
+		return "ROWS"
+	case RangeFrame:
+		return "RANGE"
+	default:
+		return fmt.Sprintf("FrameUnits(%d)", int(f))
+	}
+}
+
+type FrameBoundType int
+
+const (
+	UnboundedPreceding FrameBoundType = iota
+	Preceding
+	CurrentRow
+	Following
+	UnboundedFollowing
+)
+
+// FrameBound is a start or an end of a window frame, Offset is the n of n PRECEDING and n FOLLOWING
+type FrameBound struct {
+	Type   FrameBoundType
+	Offset int64
+}
+
+func (f FrameBound) String() string {
+	switch f.Type {
+	case UnboundedPreceding:
+		return "UNBOUNDED PRECEDING"
+	case Preceding:
+		return fmt.Sprintf("%d PRECEDING", f.Offset)
+	case CurrentRow:
+		return "CURRENT ROW"
+	case Following:
+		return fmt.Sprintf("%d FOLLOWING", f.Offset)
+	case UnboundedFollowing:
+		return "UNBOUNDED FOLLOWING"
+	default:
+		return fmt.Sprintf("FrameBound(%d)", int(f.Type))
+	}
+}
+
+// WindowFrame is the rows of the partition an aggregate window function is computed over, from Start to End
+type WindowFrame struct {
+	Units FrameUnits
+	Start FrameBound
+	End   FrameBound
+}
+
+func (w WindowFrame) String() string {
+	return fmt.Sprintf("%s BETWEEN %s AND %s", w.Units, w.Start, w.End)
+}
+
+func NewWindowFrame(units FrameUnits, start, end FrameBound) *WindowFrame {
+	return &WindowFrame{units, start, end}
+}
+
+// WindowExpr is a window function: the rows of the input are split into partitions by the values of PartitionBy,
+// every partition is ordered by OrderBy, then the function computes a value for every row of its partition.
+// The ranking functions are UInt64, LAG and LEAD have the type of their input and the aggregates have the type
+// of their AggregateExpr.
+type WindowExpr struct {
+	Name string
+	// Args are the inputs of the function, like the input, the offset and the default of LAG
+	Args        []LogicalExpr
+	PartitionBy []LogicalExpr
+	OrderBy     []SortExpr
+	// Frame of the aggregates, nil is the default frame, see WindowFrame
+	Frame *WindowFrame
+}
+
+func (w WindowExpr) ToField(input LogicalPlan) datatypes.Field {
+	switch w.Name {
+	case "ROW_NUMBER", "RANK", "DENSE_RANK":
+		return datatypes.Field{Name: w.String(), DataType: datatypes.UInt64Type}
+	case "LAG", "LEAD":
+		return datatypes.Field{Name: w.String(), DataType: w.Args[0].ToField(input).DataType}
+	}
+	return datatypes.Field{Name: w.String(), DataType: w.Aggregate().ToField(input).DataType}
+}
+
+func (w WindowExpr) String() string {
+	args := make([]string, len(w.Args))
+	for i, arg := range w.Args {
+		args[i] = arg.String()
+	}
+	over := make([]string, 0)
+	if len(w.PartitionBy) > 0 {
+		partitionBy := make([]string, len(w.PartitionBy))
+		for i, expr := range w.PartitionBy {
+			partitionBy[i] = expr.String()
+		}
+		over = append(over, "PARTITION BY "+strings.Join(partitionBy, ", "))
+	}
+	if len(w.OrderBy) > 0 {
+		orderBy := make([]string, len(w.OrderBy))
+		for i, expr := range w.OrderBy {
+			orderBy[i] = expr.String()
+		}
+		over = append(over, "ORDER BY "+strings.Join(orderBy, ", "))
+	}
+	if w.Frame != nil {
+		over = append(over, w.Frame.String())
+	}
+	return fmt.Sprintf("%s(%s) OVER (%s)", w.Name, strings.Join(args, ", "), strings.Join(over, " "))
+}
+
+// Aggregate is the AggregateExpr of an aggregate window function
+func (w WindowExpr) Aggregate() AggregateExpr {
+	if len(w.Args) == 0 {
+		return AggregateExpr{Name: w.Name}
+	}
+	return AggregateExpr{Name: w.Name, Expr: w.Args[0], Args: w.Args[1:]}
+}
+
+// IsAggregate tells whether the function is an aggregate computed over a frame
+func (w WindowExpr) IsAggregate() bool {
+	switch w.Name {
+	case "ROW_NUMBER", "RANK", "DENSE_RANK", "LAG", "LEAD":
+		return false
+	}
+	return true
+}
+
+// WindowFrame returns the Frame, or the default one: from the start of the partition to the peers
+// of the current row with an ORDER BY, otherwise the whole partition
+func (w WindowExpr) WindowFrame() WindowFrame {
+	if w.Frame != nil {
+		return *w.Frame
+	}
+	if len(w.OrderBy) > 0 {
+		return WindowFrame{RangeFrame, FrameBound{Type: UnboundedPreceding}, FrameBound{Type: CurrentRow}}
+	}
+	return WindowFrame{RowsFrame, FrameBound{Type: UnboundedPreceding}, FrameBound{Type: UnboundedFollowing}}
+}
+
+// Exprs returns the Args, the PartitionBy and the OrderBy exprs
+func (w WindowExpr) Exprs() []LogicalExpr {
+	exprs := append([]LogicalExpr{}, w.Args...)
+	exprs = append(exprs, w.PartitionBy...)
+	for _, expr := range w.OrderBy {
+		exprs = append(exprs, expr.Expr)
+	}
+	return exprs
+}
+
+// Over returns the window function computed over the partitions of partitionBy ordered by orderBy,
+// frame is nil for the default frame
+func (w WindowExpr) Over(partitionBy []LogicalExpr, orderBy []SortExpr, frame *WindowFrame) WindowExpr {
+	w.PartitionBy, w.OrderBy, w.Frame = partitionBy, orderBy, frame
+	return w
+}
+
+// NewRowNumber numbers the rows of a partition from 1
+func NewRowNumber() WindowExpr {
+	return WindowExpr{Name: "ROW_NUMBER"}
+}
+
+// NewRank is 1 plus the number of rows before the peers of the row, so that there are gaps after peers
+func NewRank() WindowExpr {
+	return WindowExpr{Name: "RANK"}
+}
+
+// NewDenseRank numbers the groups of peers from 1 without gaps
+func NewDenseRank() WindowExpr {
+	return WindowExpr{Name: "DENSE_RANK"}
+}
+
+// NewLag is the input value offset rows before the row, or defaultValue outside the partition,
+// defaultValue is a literal of the input type, or nil for null
+func NewLag(input LogicalExpr, offset int64, defaultValue LogicalExpr) WindowExpr {
+	return WindowExpr{Name: "LAG", Args: offsetArgs(input, offset, defaultValue)}
+}
+
+// NewLead is the input value offset rows after the row, see NewLag
+func NewLead(input LogicalExpr, offset int64, defaultValue LogicalExpr) WindowExpr {
+	return WindowExpr{Name: "LEAD", Args: offsetArgs(input, offset, defaultValue)}
+}
+
+func offsetArgs(input LogicalExpr, offset int64, defaultValue LogicalExpr) []LogicalExpr {
+	if defaultValue == nil {
+		return []LogicalExpr{input, NewLiteralLong(offset)}
+	}
+	return []LogicalExpr{input, NewLiteralLong(offset), defaultValue}
+}
+
+// NewWindowAggregate computes an aggregate over the frame of every row
+func NewWindowAggregate(aggregate AggregateExpr) WindowExpr {
+	return WindowExpr{Name: aggregate.Name, Args: aggregate.Inputs()}
+}
+
+// Window appends the values of window functions to the rows of its input.
+type Window struct {
+	Input       LogicalPlan
+	WindowExprs []WindowExpr
+}
+
+// Schema is the input fields followed by the fields of the window functions
+func (w Window) Schema() datatypes.Schema {
+	fields := append([]datatypes.Field{}, w.Input.Schema().Fields...)
+	for _, expr := range w.WindowExprs {
+		fields = append(fields, expr.ToField(w.Input))
+	}
+	return datatypes.Schema{Fields: fields}
+}
+
+func (w Window) Children() []LogicalPlan {
+	return []LogicalPlan{w.Input}
+}
+
+func (w Window) String() string {
+	exprStrList := make([]string, len(w.WindowExprs))
+	for i, expr := range w.WindowExprs {
+		exprStrList[i] = expr.String()
+	}
+	return fmt.Sprintf("Window: %s", strings.Join(exprStrList, ", "))
+}
+
+func NewWindow(input LogicalPlan, windowExprs []WindowExpr) Window {
+	return Window{input, windowExprs}
+}
@@ -0,0 +1,99 @@
+package optimizer
+
+import (
+	"query-engine/datatypes"
+	. "query-engine/logicalplan"
+)
+
+// checkColumns returns a SchemaError for the first column missing from the input of the plan referencing it,
+// or for the sides of a set plan which can't be combined.
+// The plan is checked bottom up, so that the schema of an input is only computed once its own columns are checked.
+func checkColumns(plan LogicalPlan) error {
+	for _, child := range plan.Children() {
+		if err := checkColumns(child); err != nil {
+			return err
+		}
+	}
+	switch castPlan := plan.(type) {
+	case Projection:
+		return checkExprColumns(castPlan.Exprs, castPlan.Input)
+	case Selection:
+		return checkExprColumns([]LogicalExpr{castPlan.Expr}, castPlan.Input)
+	case Aggregate:
+		exprs := append([]LogicalExpr{}, castPlan.GroupExpr...)
+		for _, ae := range castPlan.AggExpr {
+			exprs = append(exprs, ae.Exprs()...)
+		}
+		return checkExprColumns(exprs, castPlan.Input)
+	case Window:
+		exprs := make([]LogicalExpr, 0)
+		for _, we := range castPlan.WindowExprs {
+			exprs = append(exprs, we.Exprs()...)
+		}
+		return checkExprColumns(exprs, castPlan.Input)
+	case Sort:
+		exprs := make([]LogicalExpr, len(castPlan.SortExprs))
+		for i, se := range castPlan.SortExprs {
+			exprs[i] = se.Expr
+		}
+		return checkExprColumns(exprs, castPlan.Input)
+	case Join:
+		for _, pair := range castPlan.On {
+			if err := checkExprColumns([]LogicalExpr{NewCol(pair[0])}, castPlan.Left); err != nil {
+				return err
+			}
+			if err := checkExprColumns([]LogicalExpr{NewCol(pair[1])}, castPlan.Right); err != nil {
+				return err
+			}
+		}
+		if castPlan.Filter != nil {
+			if err := checkExprColumns([]LogicalExpr{castPlan.Filter}, castPlan.FilterInput()); err != nil {
+				return err
+			}
+			return castPlan.CheckFilter()
+		}
+	case Union:
+		_, err := SetSchema(UnionOperator, castPlan.Left, castPlan.Right)
+		return err
+	case Intersect:
+		_, err := SetSchema(IntersectOperator, castPlan.Left, castPlan.Right)
+		return err
+	case Except:
+		_, err := SetSchema(ExceptOperator, castPlan.Left, castPlan.Right)
+		return err
+	}
+	return nil
+}
+
+func checkExprColumns(exprs []LogicalExpr, input LogicalPlan) error {
+	schema := input.Schema()
+	for _, expr := range exprs {
+		var err error
+		switch e := expr.(type) {
+		case Column:
+			if schema.FindFirstIndexByName(e.Name) < 0 {
+				return datatypes.NewSchemaError("No column named: %s", e.Name)
+			}
+		case ColumnIndex:
+			if e.Index < 0 || e.Index >= len(schema.Fields) {
+				return datatypes.NewSchemaError("Column index %d out of range of %d columns", e.Index, len(schema.Fields))
+			}
+		case JoinColumn:
+			if join, ok := input.(Join); !ok || join.FilterColumnIndex(e) < 0 {
+				return datatypes.NewSchemaError("No column named: %s", e.Name)
+			}
+		case BooleanBinaryExpr:
+			err = checkExprColumns([]LogicalExpr{e.L, e.R}, input)
+		case MathExpr:
+			err = checkExprColumns([]LogicalExpr{e.L, e.R}, input)
+		case Alias:
+			err = checkExprColumns([]LogicalExpr{e.Expr}, input)
+		case CastExpr:
+			err = checkExprColumns([]LogicalExpr{e.Expr}, input)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,7 +1,7 @@
 package optimizer
 
 import (
-	"fmt"
+	"query-engine/datatypes"
 	. "query-engine/logicalplan"
 )
 
@@ -13,79 +13,239 @@ func NewOptimizer() Optimizer {
 	return Optimizer{rules: []Rule{ProjectionPushDownRule{}}}
 }
 
-func (o Optimizer) Optimize(plan LogicalPlan) LogicalPlan {
+// Optimize checks the columns referenced by the plan then applies the rules in order
+func (o Optimizer) Optimize(plan LogicalPlan) (LogicalPlan, error) {
+	if err := checkColumns(plan); err != nil {
+		return nil, err
+	}
 	iterPlan := plan
 	for _, rule := range o.rules {
-		iterPlan = rule.optimize(iterPlan)
+		var err error
+		iterPlan, err = rule.optimize(iterPlan)
+		if err != nil {
+			return nil, err
+		}
 	}
-	return iterPlan
+	return iterPlan, nil
 }
 
 type Rule interface {
-	optimize(plan LogicalPlan) LogicalPlan
+	optimize(plan LogicalPlan) (LogicalPlan, error)
 }
 
 type ProjectionPushDownRule struct{}
 
-func (p ProjectionPushDownRule) optimize(plan LogicalPlan) LogicalPlan {
-	accCols := make([]string, 0)
+func (p ProjectionPushDownRule) optimize(plan LogicalPlan) (LogicalPlan, error) {
+	// all the output columns of the root plan are required
+	accCols := p.allCols(plan)
 	return p.pushDown(plan, &accCols)
 }
 
-func (p ProjectionPushDownRule) pushDown(plan LogicalPlan, accCols *[]string) LogicalPlan {
+// allCols returns the names of all the output columns of the plan
+func (p ProjectionPushDownRule) allCols(plan LogicalPlan) []string {
+	cols := make([]string, 0)
+	for _, field := range plan.Schema().Fields {
+		cols = append(cols, field.Name)
+	}
+	return cols
+}
+
+// pushDownAll pushes down all the output columns of the plan, as they are all compared by a distinct or set plan
+func (p ProjectionPushDownRule) pushDownAll(plan LogicalPlan) (LogicalPlan, error) {
+	cols := p.allCols(plan)
+	return p.pushDown(plan, &cols)
+}
+
+func (p ProjectionPushDownRule) pushDown(plan LogicalPlan, accCols *[]string) (LogicalPlan, error) {
 	switch castPlan := plan.(type) {
 	case Projection:
-		p.extractColsForAllExpr(castPlan.Exprs, castPlan.Input, accCols)
-		input := p.pushDown(castPlan.Input, accCols)
-		return NewProjection(input, castPlan.Exprs)
+		// the input only needs the columns referenced by the projection exprs,
+		// columns required by the parent plans are produced by this projection
+		pjCols := make([]string, 0)
+		if err := p.extractColsForAllExpr(castPlan.Exprs, castPlan.Input, &pjCols); err != nil {
+			return nil, err
+		}
+		input, err := p.pushDown(castPlan.Input, &pjCols)
+		if err != nil {
+			return nil, err
+		}
+		return NewProjection(input, castPlan.Exprs), nil
 	case Selection:
-		p.extractCols(castPlan.Expr, castPlan.Input, accCols)
-		input := p.pushDown(castPlan.Input, accCols)
-		return NewSelection(input, castPlan.Expr)
+		if err := p.extractCols(castPlan.Expr, castPlan.Input, accCols); err != nil {
+			return nil, err
+		}
+		input, err := p.pushDown(castPlan.Input, accCols)
+		if err != nil {
+			return nil, err
+		}
+		return NewSelection(input, castPlan.Expr), nil
 	case Aggregate:
-		p.extractColsForAllExpr(castPlan.GroupExpr, castPlan.Input, accCols)
+		// same as projection, the aggregate output is not read from its input
+		aggCols := make([]string, 0)
+		if err := p.extractColsForAllExpr(castPlan.GroupExpr, castPlan.Input, &aggCols); err != nil {
+			return nil, err
+		}
 		aggExprs := make([]LogicalExpr, 0)
 		for _, ae := range castPlan.AggExpr {
-			aggExprs = append(aggExprs, ae.Expr)
+			aggExprs = append(aggExprs, ae.Exprs()...)
+		}
+		if err := p.extractColsForAllExpr(aggExprs, castPlan.Input, &aggCols); err != nil {
+			return nil, err
+		}
+		input, err := p.pushDown(castPlan.Input, &aggCols)
+		if err != nil {
+			return nil, err
+		}
+		return NewGroupingSetsAggregate(input, castPlan.GroupExpr, castPlan.GroupingSets, castPlan.AggExpr), nil
+	case Sort:
+		sortExprs := make([]LogicalExpr, len(castPlan.SortExprs))
+		for i, se := range castPlan.SortExprs {
+			sortExprs[i] = se.Expr
+		}
+		if err := p.extractColsForAllExpr(sortExprs, castPlan.Input, accCols); err != nil {
+			return nil, err
+		}
+		input, err := p.pushDown(castPlan.Input, accCols)
+		if err != nil {
+			return nil, err
+		}
+		return NewSort(input, castPlan.SortExprs), nil
+	case Window:
+		// the window values are produced by this plan, the input needs the other required columns
+		// and the columns referenced by the window exprs
+		inputSchema := castPlan.Input.Schema()
+		winCols := make([]string, 0)
+		for _, col := range *accCols {
+			if inputSchema.FindFirstIndexByName(col) >= 0 {
+				winCols = append(winCols, col)
+			}
 		}
-		p.extractColsForAllExpr(aggExprs, castPlan.Input, accCols)
-		input := p.pushDown(castPlan.Input, accCols)
-		return NewAggregate(input, castPlan.GroupExpr, castPlan.AggExpr)
+		for _, we := range castPlan.WindowExprs {
+			if err := p.extractColsForAllExpr(we.Exprs(), castPlan.Input, &winCols); err != nil {
+				return nil, err
+			}
+		}
+		input, err := p.pushDown(castPlan.Input, &winCols)
+		if err != nil {
+			return nil, err
+		}
+		return NewWindow(input, castPlan.WindowExprs), nil
+	case Limit:
+		input, err := p.pushDown(castPlan.Input, accCols)
+		if err != nil {
+			return nil, err
+		}
+		castPlan.Input = input
+		return castPlan, nil
+	case Join:
+		// split the required columns by side, each side also needs its join keys and the columns of the filter
+		leftCols := make([]string, 0)
+		rightCols := make([]string, 0)
+		leftSchema := castPlan.Left.Schema()
+		rightSchema := castPlan.Right.Schema()
+		joinCols := append([]string{}, *accCols...)
+		if castPlan.Filter != nil {
+			if err := p.extractCols(castPlan.Filter, castPlan.FilterInput(), &joinCols); err != nil {
+				return nil, err
+			}
+		}
+		for _, col := range joinCols {
+			if leftSchema.FindFirstIndexByName(col) >= 0 {
+				leftCols = append(leftCols, col)
+			}
+			if rightSchema.FindFirstIndexByName(col) >= 0 {
+				rightCols = append(rightCols, col)
+			}
+		}
+		for _, pair := range castPlan.On {
+			leftCols = append(leftCols, pair[0])
+			rightCols = append(rightCols, pair[1])
+		}
+		left, err := p.pushDown(castPlan.Left, &leftCols)
+		if err != nil {
+			return nil, err
+		}
+		right, err := p.pushDown(castPlan.Right, &rightCols)
+		if err != nil {
+			return nil, err
+		}
+		return NewJoinWithFilter(left, right, castPlan.JoinType, castPlan.On, castPlan.Filter), nil
+	case Distinct:
+		input, err := p.pushDownAll(castPlan.Input)
+		if err != nil {
+			return nil, err
+		}
+		return NewDistinct(input), nil
+	case Union:
+		left, right, err := p.pushDownSides(castPlan.Left, castPlan.Right)
+		if err != nil {
+			return nil, err
+		}
+		return NewUnion(left, right, castPlan.All), nil
+	case Intersect:
+		left, right, err := p.pushDownSides(castPlan.Left, castPlan.Right)
+		if err != nil {
+			return nil, err
+		}
+		return NewIntersect(left, right), nil
+	case Except:
+		left, right, err := p.pushDownSides(castPlan.Left, castPlan.Right)
+		if err != nil {
+			return nil, err
+		}
+		return NewExcept(left, right), nil
 	case Scan:
 		// the bottom logical plan
-		return NewScan(castPlan.Path, castPlan.DataSource, p.distinctCols(*accCols))
+		return NewScan(castPlan.Path, castPlan.DataSource, p.distinctCols(*accCols)), nil
 	default:
-		panic(fmt.Sprintf("ProjectionPushDownRule not support plan: %s", castPlan))
+		return nil, datatypes.NewPlanError("ProjectionPushDownRule not support plan: %s", castPlan)
 	}
 }
 
-func (p ProjectionPushDownRule) extractColsForAllExpr(expr []LogicalExpr, input LogicalPlan, accCols *[]string) {
+// pushDownSides pushes down all the columns of both sides of a set plan, the columns are matched by position
+func (p ProjectionPushDownRule) pushDownSides(left, right LogicalPlan) (LogicalPlan, LogicalPlan, error) {
+	left, err := p.pushDownAll(left)
+	if err != nil {
+		return nil, nil, err
+	}
+	right, err = p.pushDownAll(right)
+	if err != nil {
+		return nil, nil, err
+	}
+	return left, right, nil
+}
+
+func (p ProjectionPushDownRule) extractColsForAllExpr(expr []LogicalExpr, input LogicalPlan, accCols *[]string) error {
 	for _, e := range expr {
-		p.extractCols(e, input, accCols)
+		if err := p.extractCols(e, input, accCols); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-func (p ProjectionPushDownRule) extractCols(expr LogicalExpr, input LogicalPlan, accCols *[]string) {
+func (p ProjectionPushDownRule) extractCols(expr LogicalExpr, input LogicalPlan, accCols *[]string) error {
 	switch e := expr.(type) {
 	case ColumnIndex:
 		*accCols = append(*accCols, input.Schema().Fields[e.Index].Name)
 	case Column:
 		*accCols = append(*accCols, e.Name)
+	case JoinColumn:
+		*accCols = append(*accCols, e.Name)
 	case BooleanBinaryExpr:
-		p.extractCols(e.L, input, accCols)
-		p.extractCols(e.R, input, accCols)
+		return p.extractColsForAllExpr([]LogicalExpr{e.L, e.R}, input, accCols)
 	case MathExpr:
-		p.extractCols(e.L, input, accCols)
-		p.extractCols(e.R, input, accCols)
+		return p.extractColsForAllExpr([]LogicalExpr{e.L, e.R}, input, accCols)
 	case Alias:
-		p.extractCols(e.Expr, input, accCols)
+		return p.extractCols(e.Expr, input, accCols)
 	case CastExpr:
-		p.extractCols(e.Expr, input, accCols)
+		return p.extractCols(e.Expr, input, accCols)
 	case LiteralString, LiteralLong, LiteralFloat, LiteralDouble:
 		// do nothing
 	default:
-		panic(fmt.Sprintf("extractCols not support expr: %s", e))
+		return datatypes.NewPlanError("extractCols not support expr: %s", e)
 	}
+	return nil
 }
 
 func (p ProjectionPushDownRule) distinctCols(accCols []string) []string {
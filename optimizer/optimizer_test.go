@@ -1,6 +1,7 @@
 package optimizer
 
 import (
+	"errors"
 	"github.com/stretchr/testify/require"
 	. "query-engine/datasource"
 	"query-engine/datatypes"
@@ -10,8 +11,14 @@ import (
 
 const dir = "../testdata"
 
+func employeeCsv(t *testing.T) *CsvDataSource {
+	csv, err := NewCsvDataSource(dir+"/employee.csv", 1024)
+	require.NoError(t, err)
+	return csv
+}
+
 func TestOptimizer_pushDown(t *testing.T) {
-	csv := NewCsvDataSource(dir+"/employee.csv", 1024)
+	csv := employeeCsv(t)
 	scan := NewScan("employee", csv, []string{})
 	plan := NewProjection(scan, []LogicalExpr{NewCol("id"), NewCol("first_name"), NewCol("last_name")})
 
@@ -25,12 +32,13 @@ Projection: #id, #first_name, #last_name
 Projection: #id, #first_name, #last_name
 	Scan: employee; projection=[id first_name last_name]
 `
-	optimizedPlan := NewOptimizer().Optimize(plan)
+	optimizedPlan, err := NewOptimizer().Optimize(plan)
+	require.NoError(t, err)
 	require.Equal(t, afterPlan, PrettyFormat(optimizedPlan))
 }
 
 func TestOptimizer_pushDown_with_selection(t *testing.T) {
-	csv := NewCsvDataSource(dir+"/employee.csv", 1024)
+	csv := employeeCsv(t)
 	scan := NewScan("employee", csv, []string{})
 	eq := NewEq(NewCol("state"), NewLiteralString("CO"))
 	selection := NewSelection(scan, eq)
@@ -48,12 +56,13 @@ Projection: #id, #first_name, #last_name
 	Selection: #state = 'CO'
 		Scan: employee; projection=[id first_name last_name state]
 `
-	optimizedPlan := NewOptimizer().Optimize(plan)
+	optimizedPlan, err := NewOptimizer().Optimize(plan)
+	require.NoError(t, err)
 	require.Equal(t, afterPlan, PrettyFormat(optimizedPlan))
 }
 
 func TestOptimizer_pushDown_with_aggregate(t *testing.T) {
-	csv := NewCsvDataSource(dir+"/employee.csv", 1024)
+	csv := employeeCsv(t)
 	scan := NewScan("employee", csv, []string{})
 	groupExpr := []LogicalExpr{NewCol("state")}
 	aggExpr := []AggregateExpr{NewMax(NewCast(NewCol("salary"), datatypes.Int32Type))}
@@ -69,6 +78,199 @@ Aggregate: groupExpr=[#state], aggregateExpr=[MAX(CAST(#salary AS int32))]
 Aggregate: groupExpr=[#state], aggregateExpr=[MAX(CAST(#salary AS int32))]
 	Scan: employee; projection=[state salary]
 `
-	optimizedPlan := NewOptimizer().Optimize(plan)
+	optimizedPlan, err := NewOptimizer().Optimize(plan)
+	require.NoError(t, err)
+	require.Equal(t, afterPlan, PrettyFormat(optimizedPlan))
+}
+
+func TestOptimizer_pushDown_with_grouping_sets(t *testing.T) {
+	csv := employeeCsv(t)
+	scan := NewScan("employee", csv, []string{})
+	groupExpr := []LogicalExpr{NewCol("state"), NewCol("job_title")}
+	aggExpr := []AggregateExpr{NewMax(NewCol("salary")), NewGrouping(NewCol("job_title"))}
+	plan := NewGroupingSetsAggregate(scan, groupExpr, RollupSets(2), aggExpr)
+
+	// the grouping sets are kept
+	afterPlan := `
+Aggregate: groupExpr=[#state #job_title], groupingSets=[(#state, #job_title) (#state) ()], aggregateExpr=[MAX(#salary) GROUPING(#job_title)]
+	Scan: employee; projection=[state job_title salary]
+`
+	optimizedPlan, err := NewOptimizer().Optimize(plan)
+	require.NoError(t, err)
+	require.Equal(t, afterPlan, PrettyFormat(optimizedPlan))
+}
+
+func TestOptimizer_pushDown_with_aggregate_filter(t *testing.T) {
+	csv := employeeCsv(t)
+	scan := NewScan("employee", csv, []string{})
+	aggExpr := []AggregateExpr{NewMax(NewCol("salary")).WithFilter(NewEq(NewCol("job_title"), NewLiteralString("Driver")))}
+	plan := NewSelection(NewAggregate(scan, []LogicalExpr{NewCol("state")}, aggExpr), NewGt(NewColumnIndex(1), NewLiteralLong(0)))
+
+	// the columns of the filter are read along with the inputs of the aggregate
+	afterPlan := `
+Selection: #1 > 0
+	Aggregate: groupExpr=[#state], aggregateExpr=[MAX(#salary) FILTER (WHERE #job_title = 'Driver')]
+		Scan: employee; projection=[state salary job_title]
+`
+	optimizedPlan, err := NewOptimizer().Optimize(plan)
+	require.NoError(t, err)
+	require.Equal(t, afterPlan, PrettyFormat(optimizedPlan))
+}
+
+func TestOptimizer_pushDown_with_join(t *testing.T) {
+	left := NewScan("employee", employeeCsv(t), []string{})
+	right := NewProjection(
+		NewScan("manager", employeeCsv(t), []string{}),
+		[]LogicalExpr{NewAlias(NewCol("id"), "manager_id"), NewCol("state"), NewAlias(NewCol("first_name"), "manager_name")},
+	)
+	join := NewJoin(left, right, InnerJoin, [][]string{{"state", "state"}})
+	plan := NewProjection(join, []LogicalExpr{NewCol("first_name"), NewCol("manager_name")})
+
+	afterPlan := `
+Projection: #first_name, #manager_name
+	Join: type=Inner, on=[[state state]]
+		Scan: employee; projection=[first_name state]
+		Projection: #id as manager_id, #state, #first_name as manager_name
+			Scan: manager; projection=[id state first_name]
+`
+	optimizedPlan, err := NewOptimizer().Optimize(plan)
+	require.NoError(t, err)
 	require.Equal(t, afterPlan, PrettyFormat(optimizedPlan))
 }
+
+func TestOptimizer_pushDown_with_join_filter(t *testing.T) {
+	left := NewScan("employee", employeeCsv(t), []string{})
+	right := NewProjection(
+		NewScan("manager", employeeCsv(t), []string{}),
+		[]LogicalExpr{NewAlias(NewCol("id"), "manager_id"), NewAlias(NewCol("salary"), "manager_salary")},
+	)
+	join := NewJoinWithFilter(left, right, LeftSemiJoin, nil, NewLt(NewCol("salary"), NewCol("manager_salary")))
+	plan := NewProjection(join, []LogicalExpr{NewCol("first_name")})
+
+	// the filter columns are read from both sides even though the semi join only returns the left columns
+	afterPlan := `
+Projection: #first_name
+	Join: type=LeftSemi, on=[], filter=#salary < #manager_salary
+		Scan: employee; projection=[first_name salary]
+		Projection: #id as manager_id, #salary as manager_salary
+			Scan: manager; projection=[id salary]
+`
+	optimizedPlan, err := NewOptimizer().Optimize(plan)
+	require.NoError(t, err)
+	require.Equal(t, afterPlan, PrettyFormat(optimizedPlan))
+}
+
+func TestOptimizer_join_filter_columns_of_both_sides(t *testing.T) {
+	left := NewScan("employee", employeeCsv(t), []string{})
+	right := NewScan("manager", employeeCsv(t), []string{})
+	join := NewJoinWithFilter(left, right, LeftSemiJoin, nil, NewLt(NewLeftCol("salary"), NewRightCol("salary")))
+	plan := NewProjection(join, []LogicalExpr{NewCol("first_name")})
+
+	afterPlan := `
+Projection: #first_name
+	Join: type=LeftSemi, on=[], filter=#left.salary < #right.salary
+		Scan: employee; projection=[first_name salary]
+		Scan: manager; projection=[first_name salary]
+`
+	optimizedPlan, err := NewOptimizer().Optimize(plan)
+	require.NoError(t, err)
+	require.Equal(t, afterPlan, PrettyFormat(optimizedPlan))
+
+	// a name of both sides doesn't tell which side to read
+	join = NewJoinWithFilter(left, right, LeftSemiJoin, nil, NewLt(NewCol("salary"), NewRightCol("salary")))
+	_, err = NewOptimizer().Optimize(NewProjection(join, []LogicalExpr{NewCol("first_name")}))
+	var planErr *datatypes.PlanError
+	require.True(t, errors.As(err, &planErr))
+	require.Equal(t, "Join filter column salary is ambiguous, both sides have it", err.Error())
+}
+
+func TestOptimizer_pushDown_with_window(t *testing.T) {
+	csv := employeeCsv(t)
+	rank := NewRank().Over([]LogicalExpr{NewCol("state")}, []SortExpr{NewDesc(NewCol("salary"))}, nil)
+	window := NewWindow(NewScan("employee", csv, []string{}), []WindowExpr{rank})
+	plan := NewProjection(window, []LogicalExpr{NewCol("first_name"), NewCol(rank.String())})
+
+	// the window values are not read from the scan
+	afterPlan := `
+Projection: #first_name, #RANK() OVER (PARTITION BY #state ORDER BY #salary DESC NULLS FIRST)
+	Window: RANK() OVER (PARTITION BY #state ORDER BY #salary DESC NULLS FIRST)
+		Scan: employee; projection=[first_name state salary]
+`
+	optimizedPlan, err := NewOptimizer().Optimize(plan)
+	require.NoError(t, err)
+	require.Equal(t, afterPlan, PrettyFormat(optimizedPlan))
+}
+
+func TestOptimizer_pushDown_with_set_operations(t *testing.T) {
+	csv := employeeCsv(t)
+	states := NewProjection(NewScan("employee", csv, []string{}), []LogicalExpr{NewCol("state")})
+	managers := NewProjection(
+		NewSelection(NewScan("manager", csv, []string{}), NewEq(NewCol("job_title"), NewLiteralString("Manager"))),
+		[]LogicalExpr{NewCol("state")},
+	)
+	union := NewUnion(NewDistinct(NewScan("state", csv, []string{"state"})), managers, false)
+	plan := NewProjection(NewExcept(union, states), []LogicalExpr{NewCol("state")})
+
+	// every side keeps all its columns, as they are compared by position
+	afterPlan := `
+Projection: #state
+	Except
+		Union: all=false
+			Distinct
+				Scan: state; projection=[state]
+			Projection: #state
+				Selection: #job_title = 'Manager'
+					Scan: manager; projection=[state job_title]
+		Projection: #state
+			Scan: employee; projection=[state]
+`
+	optimizedPlan, err := NewOptimizer().Optimize(plan)
+	require.NoError(t, err)
+	require.Equal(t, afterPlan, PrettyFormat(optimizedPlan))
+}
+
+func TestOptimizer_set_schema(t *testing.T) {
+	scan := NewScan("employee", employeeCsv(t), []string{})
+	ids := NewProjection(scan, []LogicalExpr{NewCast(NewCol("id"), datatypes.Int64Type)})
+
+	_, err := NewOptimizer().Optimize(NewIntersect(scan, ids))
+	var schemaErr *datatypes.SchemaError
+	require.True(t, errors.As(err, &schemaErr))
+	require.Equal(t, "Intersect expects the same number of columns on both sides, got 6 and 1", err.Error())
+
+	_, err = NewOptimizer().Optimize(NewUnion(NewProjection(scan, []LogicalExpr{NewCol("state")}), ids, true))
+	require.True(t, errors.As(err, &schemaErr))
+	require.Equal(t, "Union can't combine column state of type utf8 with id of type int64", err.Error())
+}
+
+func TestOptimizer_pushDown_keeps_root_columns(t *testing.T) {
+	csv := employeeCsv(t)
+	plan := NewSelection(NewScan("employee", csv, []string{}), NewEq(NewCol("state"), NewLiteralString("CO")))
+
+	afterPlan := `
+Selection: #state = 'CO'
+	Scan: employee; projection=[id first_name last_name state job_title salary]
+`
+	optimizedPlan, err := NewOptimizer().Optimize(plan)
+	require.NoError(t, err)
+	require.Equal(t, afterPlan, PrettyFormat(optimizedPlan))
+}
+
+func TestOptimizer_unknown_column(t *testing.T) {
+	scan := NewScan("employee", employeeCsv(t), []string{})
+	testCases := []LogicalPlan{
+		NewProjection(scan, []LogicalExpr{NewCol("id"), NewCol("age")}),
+		NewProjection(NewSelection(scan, NewEq(NewCol("age"), NewLiteralLong(1))), []LogicalExpr{NewCol("id")}),
+		NewAggregate(scan, []LogicalExpr{NewCol("state")}, []AggregateExpr{NewMax(NewCol("age"))}),
+		NewJoin(scan, scan, InnerJoin, [][]string{{"id", "age"}}),
+		NewJoinWithFilter(scan, scan, InnerJoin, nil, NewEq(NewCol("id"), NewCol("age"))),
+		NewJoinWithFilter(scan, scan, InnerJoin, nil, NewEq(NewLeftCol("id"), NewRightCol("age"))),
+		NewWindow(scan, []WindowExpr{NewRowNumber().Over([]LogicalExpr{NewCol("age")}, nil, nil)}),
+	}
+	for _, plan := range testCases {
+		_, err := NewOptimizer().Optimize(plan)
+		var schemaErr *datatypes.SchemaError
+		require.True(t, errors.As(err, &schemaErr), PrettyFormat(plan))
+		require.Equal(t, "No column named: age", err.Error())
+	}
+}
@@ -1,8 +1,15 @@
 package exprs
 
 import (
+	"bytes"
+	"encoding/gob"
 	"fmt"
+	"math"
+	"query-engine/datatypes"
 	"query-engine/physicalplan"
+	"reflect"
+	"sort"
+	"strings"
 )
 
 // ---------------------------------------------Aggregate Expressions---------------------------------------------
@@ -10,11 +17,73 @@ import (
 type AggregateExpr interface {
 	InputExpr() physicalplan.PhysicalExpr
 	CreateAccumulator() Accumulator
+	// StateFields returns the fields of the accumulator State, field is the field of the aggregate result
+	StateFields(field datatypes.Field) []datatypes.Field
 }
 
+// MultiInputAggregateExpr is an AggregateExpr of several inputs, like CORR(y, x), InputExpr is the first one.
+// Its accumulator is given the []interface{} of the values of all the inputs.
+type MultiInputAggregateExpr interface {
+	AggregateExpr
+	InputExprs() []physicalplan.PhysicalExpr
+}
+
+// InputExprs returns the inputs of an aggregate expr, see MultiInputAggregateExpr
+func InputExprs(expr AggregateExpr) []physicalplan.PhysicalExpr {
+	if filtered, ok := expr.(FilteredAggregateExpr); ok {
+		return InputExprs(filtered.AggregateExpr)
+	}
+	if multi, ok := expr.(MultiInputAggregateExpr); ok {
+		return multi.InputExprs()
+	}
+	return []physicalplan.PhysicalExpr{expr.InputExpr()}
+}
+
+// BufferingAggregateExpr is an AggregateExpr whose accumulators keep sizable states, like the values of the
+// exact percentiles or the registers of a HyperLogLog sketch, so that the aggregation accounts for their memory.
+// ValueSize estimates the bytes kept for an input value, GroupSize the bytes of the accumulator of a group.
+type BufferingAggregateExpr interface {
+	AggregateExpr
+	ValueSize() int64
+	GroupSize() int64
+}
+
+// FilteredAggregateExpr is an AggregateExpr with the boolean predicate of FILTER (WHERE ...), the aggregation
+// only accumulates the rows for which the predicate is true. Its accumulators are the ones of the AggregateExpr,
+// so that the states of the partial aggregation are merged as the ones of the AggregateExpr.
+type FilteredAggregateExpr struct {
+	AggregateExpr
+	filter physicalplan.PhysicalExpr
+}
+
+func NewFilteredAggregateExpr(expr AggregateExpr, filter physicalplan.PhysicalExpr) FilteredAggregateExpr {
+	return FilteredAggregateExpr{expr, filter}
+}
+
+func (f FilteredAggregateExpr) Filter() physicalplan.PhysicalExpr {
+	return f.filter
+}
+
+func (f FilteredAggregateExpr) String() string {
+	return fmt.Sprintf("%s FILTER (WHERE %s)", f.AggregateExpr, f.filter)
+}
+
+// Accumulator aggregates the values of a group. A two-phase aggregation accumulates the values of
+// every partition into partial accumulators, then merges their states into the final accumulators.
 type Accumulator interface {
-	Accumulate(val interface{})
+	// Accumulate a value of the input expr, nil values are ignored, see MultiInputAggregateExpr for several inputs
+	Accumulate(val interface{}) error
 	FinalValue() interface{}
+	// State returns the intermediate state, one value for each of the StateFields of the aggregate expr,
+	// or the error of encoding it
+	State() ([]interface{}, error)
+	// Merge the State of an accumulator of the same aggregate expr
+	Merge(state []interface{}) error
+}
+
+// valueStateFields is the state of the aggregates keeping a single value of the result type, like SUM
+func valueStateFields(field datatypes.Field) []datatypes.Field {
+	return []datatypes.Field{{Name: field.Name, DataType: field.DataType}}
 }
 
 type SumExpr struct {
@@ -33,6 +102,10 @@ func (s SumExpr) CreateAccumulator() Accumulator {
 	return &SumAccumulator{}
 }
 
+func (s SumExpr) StateFields(field datatypes.Field) []datatypes.Field {
+	return valueStateFields(field)
+}
+
 func (s SumExpr) String() string {
 	return fmt.Sprintf("SUM(%s)", s.expr)
 }
@@ -41,7 +114,7 @@ type SumAccumulator struct {
 	val interface{}
 }
 
-func (s *SumAccumulator) Accumulate(val interface{}) {
+func (s *SumAccumulator) Accumulate(val interface{}) error {
 	if val != nil {
 		if s.val == nil {
 			s.val = val
@@ -68,16 +141,25 @@ func (s *SumAccumulator) Accumulate(val interface{}) {
 			case float64:
 				s.val = v + val.(float64)
 			default:
-				panic(fmt.Sprintf("Sum is not implemented for type: %T", v))
+				return datatypes.NewSchemaError("Sum is not implemented for type: %T", v)
 			}
 		}
 	}
+	return nil
 }
 
 func (s *SumAccumulator) FinalValue() interface{} {
 	return s.val
 }
 
+func (s *SumAccumulator) State() ([]interface{}, error) {
+	return []interface{}{s.val}, nil
+}
+
+func (s *SumAccumulator) Merge(state []interface{}) error {
+	return s.Accumulate(state[0])
+}
+
 type MaxExpr struct {
 	expr physicalplan.PhysicalExpr
 }
@@ -94,6 +176,10 @@ func (m MaxExpr) CreateAccumulator() Accumulator {
 	return &MaxAccumulator{}
 }
 
+func (m MaxExpr) StateFields(field datatypes.Field) []datatypes.Field {
+	return valueStateFields(field)
+}
+
 func (m MaxExpr) String() string {
 	return fmt.Sprintf("MAX(%s)", m.expr)
 }
@@ -102,7 +188,7 @@ type MaxAccumulator struct {
 	val interface{}
 }
 
-func (m *MaxAccumulator) Accumulate(val interface{}) {
+func (m *MaxAccumulator) Accumulate(val interface{}) error {
 	if val != nil {
 		if m.val == nil {
 			m.val = val
@@ -130,19 +216,28 @@ func (m *MaxAccumulator) Accumulate(val interface{}) {
 			case float64:
 				isMax = val.(float64) > v
 			default:
-				panic(fmt.Sprintf("Max is not implemented for type: %T", v))
+				return datatypes.NewSchemaError("Max is not implemented for type: %T", v)
 			}
 			if isMax {
 				m.val = val
 			}
 		}
 	}
+	return nil
 }
 
 func (m *MaxAccumulator) FinalValue() interface{} {
 	return m.val
 }
 
+func (m *MaxAccumulator) State() ([]interface{}, error) {
+	return []interface{}{m.val}, nil
+}
+
+func (m *MaxAccumulator) Merge(state []interface{}) error {
+	return m.Accumulate(state[0])
+}
+
 type MinExpr struct {
 	expr physicalplan.PhysicalExpr
 }
@@ -159,6 +254,10 @@ func (m MinExpr) CreateAccumulator() Accumulator {
 	return &MinAccumulator{}
 }
 
+func (m MinExpr) StateFields(field datatypes.Field) []datatypes.Field {
+	return valueStateFields(field)
+}
+
 func (m MinExpr) String() string {
 	return fmt.Sprintf("MIN(%s)", m.expr)
 }
@@ -167,7 +266,7 @@ type MinAccumulator struct {
 	val interface{}
 }
 
-func (m *MinAccumulator) Accumulate(val interface{}) {
+func (m *MinAccumulator) Accumulate(val interface{}) error {
 	if val != nil {
 		if m.val == nil {
 			m.val = val
@@ -195,15 +294,894 @@ func (m *MinAccumulator) Accumulate(val interface{}) {
 			case float64:
 				isMin = val.(float64) < v
 			default:
-				panic(fmt.Sprintf("Min is not implemented for type: %T", v))
+				return datatypes.NewSchemaError("Min is not implemented for type: %T", v)
 			}
 			if isMin {
 				m.val = val
 			}
 		}
 	}
+	return nil
 }
 
 func (m *MinAccumulator) FinalValue() interface{} {
 	return m.val
 }
+
+func (m *MinAccumulator) State() ([]interface{}, error) {
+	return []interface{}{m.val}, nil
+}
+
+func (m *MinAccumulator) Merge(state []interface{}) error {
+	return m.Accumulate(state[0])
+}
+
+type CountExpr struct {
+	expr physicalplan.PhysicalExpr
+}
+
+// NewCountExpr counts the non null values of expr, COUNT(*) counts a literal which is never null
+func NewCountExpr(expr physicalplan.PhysicalExpr) CountExpr {
+	return CountExpr{expr}
+}
+
+func (c CountExpr) InputExpr() physicalplan.PhysicalExpr {
+	return c.expr
+}
+
+func (c CountExpr) CreateAccumulator() Accumulator {
+	return &CountAccumulator{}
+}
+
+func (c CountExpr) StateFields(field datatypes.Field) []datatypes.Field {
+	return valueStateFields(field)
+}
+
+func (c CountExpr) String() string {
+	return fmt.Sprintf("COUNT(%s)", c.expr)
+}
+
+type CountAccumulator struct {
+	count uint64
+}
+
+func (c *CountAccumulator) Accumulate(val interface{}) error {
+	if val != nil {
+		c.count++
+	}
+	return nil
+}
+
+// FinalValue is 0 for a group without non null values, unlike the other aggregates
+func (c *CountAccumulator) FinalValue() interface{} {
+	return c.count
+}
+
+func (c *CountAccumulator) State() ([]interface{}, error) {
+	return []interface{}{c.count}, nil
+}
+
+func (c *CountAccumulator) Merge(state []interface{}) error {
+	count, ok := state[0].(uint64)
+	if !ok {
+		return datatypes.NewSchemaError("Count state must be uint64, got: %T", state[0])
+	}
+	c.count += count
+	return nil
+}
+
+type AvgExpr struct {
+	expr physicalplan.PhysicalExpr
+}
+
+// NewAvgExpr averages the numeric values of expr as a float64, whatever their type
+func NewAvgExpr(expr physicalplan.PhysicalExpr) AvgExpr {
+	return AvgExpr{expr}
+}
+
+func (a AvgExpr) InputExpr() physicalplan.PhysicalExpr {
+	return a.expr
+}
+
+func (a AvgExpr) CreateAccumulator() Accumulator {
+	return &AvgAccumulator{}
+}
+
+// StateFields are the sum and the count of the values
+func (a AvgExpr) StateFields(field datatypes.Field) []datatypes.Field {
+	return []datatypes.Field{
+		{Name: field.Name + "[sum]", DataType: datatypes.DoubleType},
+		{Name: field.Name + "[count]", DataType: datatypes.UInt64Type},
+	}
+}
+
+func (a AvgExpr) String() string {
+	return fmt.Sprintf("AVG(%s)", a.expr)
+}
+
+type AvgAccumulator struct {
+	sum   float64
+	count uint64
+}
+
+func (a *AvgAccumulator) Accumulate(val interface{}) error {
+	if val == nil {
+		return nil
+	}
+	v, err := toFloat64("Avg", val)
+	if err != nil {
+		return err
+	}
+	a.sum += v
+	a.count++
+	return nil
+}
+
+// FinalValue is nil for a group without non null values
+func (a *AvgAccumulator) FinalValue() interface{} {
+	if a.count == 0 {
+		return nil
+	}
+	return a.sum / float64(a.count)
+}
+
+func (a *AvgAccumulator) State() ([]interface{}, error) {
+	return []interface{}{a.sum, a.count}, nil
+}
+
+func (a *AvgAccumulator) Merge(state []interface{}) error {
+	sum, sumOk := state[0].(float64)
+	count, countOk := state[1].(uint64)
+	if !sumOk || !countOk {
+		return datatypes.NewSchemaError("Avg state must be float64 and uint64, got: %T and %T", state[0], state[1])
+	}
+	a.sum += sum
+	a.count += count
+	return nil
+}
+
+type CountDistinctExpr struct {
+	expr physicalplan.PhysicalExpr
+}
+
+// NewCountDistinctExpr counts the distinct non null values of expr
+func NewCountDistinctExpr(expr physicalplan.PhysicalExpr) CountDistinctExpr {
+	return CountDistinctExpr{expr}
+}
+
+func (c CountDistinctExpr) InputExpr() physicalplan.PhysicalExpr {
+	return c.expr
+}
+
+func (c CountDistinctExpr) CreateAccumulator() Accumulator {
+	return &CountDistinctAccumulator{values: make(map[interface{}]struct{})}
+}
+
+// StateFields is the set of distinct values, encoded as a string
+func (c CountDistinctExpr) StateFields(field datatypes.Field) []datatypes.Field {
+	return []datatypes.Field{{Name: field.Name + "[values]", DataType: datatypes.StringType}}
+}
+
+// ValueSize is the size of a map entry of an interface value, the duplicates are counted too
+func (c CountDistinctExpr) ValueSize() int64 {
+	return 40
+}
+
+func (c CountDistinctExpr) GroupSize() int64 {
+	return 0
+}
+
+func (c CountDistinctExpr) String() string {
+	return fmt.Sprintf("COUNT(DISTINCT %s)", c.expr)
+}
+
+type CountDistinctAccumulator struct {
+	values map[interface{}]struct{}
+	// NaN != NaN, so that the NaN are not kept in values, all the NaN of a float type are a single value
+	nan32, nan64 bool
+}
+
+func (c *CountDistinctAccumulator) Accumulate(val interface{}) error {
+	switch v := val.(type) {
+	case nil:
+		return nil
+	case float32:
+		if v != v {
+			c.nan32 = true
+			return nil
+		}
+	case float64:
+		if v != v {
+			c.nan64 = true
+			return nil
+		}
+	case bool, int8, int16, int32, int64, uint8, uint16, uint32, uint64, string:
+	default:
+		return datatypes.NewSchemaError("Count distinct is not implemented for type: %T", v)
+	}
+	c.values[val] = struct{}{}
+	return nil
+}
+
+func (c *CountDistinctAccumulator) FinalValue() interface{} {
+	count := uint64(len(c.values))
+	if c.nan32 {
+		count++
+	}
+	if c.nan64 {
+		count++
+	}
+	return count
+}
+
+// State encodes the distinct values, see encodeValues
+func (c *CountDistinctAccumulator) State() ([]interface{}, error) {
+	values := make([]interface{}, 0, len(c.values)+2)
+	for val := range c.values {
+		values = append(values, val)
+	}
+	if c.nan32 {
+		values = append(values, float32(math.NaN()))
+	}
+	if c.nan64 {
+		values = append(values, math.NaN())
+	}
+	encoded, err := encodeValues("Count distinct", values)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{encoded}, nil
+}
+
+func (c *CountDistinctAccumulator) Merge(state []interface{}) error {
+	values, err := decodeValues("Count distinct", state[0])
+	if err != nil {
+		return err
+	}
+	for _, val := range values {
+		if err := c.Accumulate(val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeValues gob encodes the values of the state of an accumulator, gob keeps the type of the values
+// of an interface slice. A type gob doesn't know, like a list, is an error, name is the aggregate in its message.
+func encodeValues(name string, values []interface{}) (string, error) {
+	buf := new(bytes.Buffer)
+	if err := gob.NewEncoder(buf).Encode(values); err != nil {
+		return "", datatypes.NewSchemaError("can't encode %s state: %s", strings.ToLower(name), err)
+	}
+	return buf.String(), nil
+}
+
+// decodeValues decodes the state encoded by encodeValues, name is the aggregate in the error message
+func decodeValues(name string, state interface{}) ([]interface{}, error) {
+	encoded, ok := state.(string)
+	if !ok {
+		return nil, datatypes.NewSchemaError("%s state must be string, got: %T", name, state)
+	}
+	var values []interface{}
+	if err := gob.NewDecoder(strings.NewReader(encoded)).Decode(&values); err != nil {
+		return nil, datatypes.NewSchemaError("invalid %s state: %s", strings.ToLower(name), err)
+	}
+	return values, nil
+}
+
+// PercentileExpr is the exact percentile of the numeric values of expr, either interpolated between
+// the two closest values like PERCENTILE_CONT and MEDIAN, or the closest value like PERCENTILE_DISC
+type PercentileExpr struct {
+	expr       physicalplan.PhysicalExpr
+	percentile float64
+	discrete   bool
+}
+
+// NewPercentileContExpr is PERCENTILE_CONT, a float64 interpolated between the values around the percentile,
+// percentile is between 0 and 1, MEDIAN is the percentile 0.5
+func NewPercentileContExpr(expr physicalplan.PhysicalExpr, percentile float64) PercentileExpr {
+	return PercentileExpr{expr: expr, percentile: percentile}
+}
+
+// NewPercentileDiscExpr is PERCENTILE_DISC, the first value whose cumulative distribution is at least percentile,
+// it has the type of the values
+func NewPercentileDiscExpr(expr physicalplan.PhysicalExpr, percentile float64) PercentileExpr {
+	return PercentileExpr{expr: expr, percentile: percentile, discrete: true}
+}
+
+func (p PercentileExpr) InputExpr() physicalplan.PhysicalExpr {
+	return p.expr
+}
+
+func (p PercentileExpr) CreateAccumulator() Accumulator {
+	return &PercentileAccumulator{percentile: p.percentile, discrete: p.discrete}
+}
+
+// StateFields are the buffered values, encoded as a string
+func (p PercentileExpr) StateFields(field datatypes.Field) []datatypes.Field {
+	return []datatypes.Field{{Name: field.Name + "[values]", DataType: datatypes.StringType}}
+}
+
+// ValueSize is the size of an interface value holding a number
+func (p PercentileExpr) ValueSize() int64 {
+	return 24
+}
+
+func (p PercentileExpr) GroupSize() int64 {
+	return 0
+}
+
+func (p PercentileExpr) String() string {
+	if p.discrete {
+		return fmt.Sprintf("PERCENTILE_DISC(%s, %v)", p.expr, p.percentile)
+	}
+	return fmt.Sprintf("PERCENTILE_CONT(%s, %v)", p.expr, p.percentile)
+}
+
+// PercentileAccumulator buffers the values of a group, which are sorted once the percentile is computed
+type PercentileAccumulator struct {
+	percentile float64
+	discrete   bool
+
+	values []interface{}
+}
+
+// Accumulate buffers a numeric value, the values of a group must have the same type
+func (p *PercentileAccumulator) Accumulate(val interface{}) error {
+	if val == nil {
+		return nil
+	}
+	if _, err := toFloat64("Percentile", val); err != nil {
+		return err
+	}
+	if len(p.values) > 0 && reflect.TypeOf(p.values[0]) != reflect.TypeOf(val) {
+		return datatypes.NewSchemaError("Percentile values must have the same type, got: %T and %T", p.values[0], val)
+	}
+	p.values = append(p.values, val)
+	return nil
+}
+
+// FinalValue is nil without values, NaN values are sorted after the other values
+func (p *PercentileAccumulator) FinalValue() interface{} {
+	if len(p.values) == 0 {
+		return nil
+	}
+	sort.Slice(p.values, func(i, j int) bool { return datatypes.Compare(p.values[i], p.values[j]) < 0 })
+	n := len(p.values)
+	if p.discrete {
+		idx := int(math.Ceil(p.percentile*float64(n))) - 1
+		if idx < 0 {
+			idx = 0
+		}
+		return p.values[idx]
+	}
+
+	pos := p.percentile * float64(n-1)
+	lo, hi := int(math.Floor(pos)), int(math.Ceil(pos))
+	// the values are numeric, see Accumulate
+	low, _ := toFloat64("Percentile", p.values[lo])
+	high, _ := toFloat64("Percentile", p.values[hi])
+	if lo == hi {
+		return low
+	}
+	return low + (pos-float64(lo))*(high-low)
+}
+
+func (p *PercentileAccumulator) State() ([]interface{}, error) {
+	encoded, err := encodeValues("Percentile", p.values)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{encoded}, nil
+}
+
+func (p *PercentileAccumulator) Merge(state []interface{}) error {
+	values, err := decodeValues("Percentile", state[0])
+	if err != nil {
+		return err
+	}
+	for _, val := range values {
+		if err := p.Accumulate(val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type ArrayAggExpr struct {
+	expr physicalplan.PhysicalExpr
+}
+
+// NewArrayAggExpr collects the non null values of expr into a list, see datatypes.NewListType
+func NewArrayAggExpr(expr physicalplan.PhysicalExpr) ArrayAggExpr {
+	return ArrayAggExpr{expr}
+}
+
+func (a ArrayAggExpr) InputExpr() physicalplan.PhysicalExpr {
+	return a.expr
+}
+
+func (a ArrayAggExpr) CreateAccumulator() Accumulator {
+	return &ArrayAggAccumulator{}
+}
+
+func (a ArrayAggExpr) StateFields(field datatypes.Field) []datatypes.Field {
+	return valueStateFields(field)
+}
+
+// ValueSize is the size of an interface value in the list
+func (a ArrayAggExpr) ValueSize() int64 {
+	return 24
+}
+
+func (a ArrayAggExpr) GroupSize() int64 {
+	return 0
+}
+
+func (a ArrayAggExpr) String() string {
+	return fmt.Sprintf("ARRAY_AGG(%s)", a.expr)
+}
+
+type ArrayAggAccumulator struct {
+	values []interface{}
+}
+
+func (a *ArrayAggAccumulator) Accumulate(val interface{}) error {
+	if val != nil {
+		a.values = append(a.values, val)
+	}
+	return nil
+}
+
+// FinalValue is nil for a group without non null values
+func (a *ArrayAggAccumulator) FinalValue() interface{} {
+	if len(a.values) == 0 {
+		return nil
+	}
+	return a.values
+}
+
+func (a *ArrayAggAccumulator) State() ([]interface{}, error) {
+	return []interface{}{a.FinalValue()}, nil
+}
+
+func (a *ArrayAggAccumulator) Merge(state []interface{}) error {
+	if state[0] == nil {
+		return nil
+	}
+	values, ok := state[0].([]interface{})
+	if !ok {
+		return datatypes.NewSchemaError("Array agg state must be a list, got: %T", state[0])
+	}
+	a.values = append(a.values, values...)
+	return nil
+}
+
+type StringAggExpr struct {
+	expr      physicalplan.PhysicalExpr
+	separator string
+}
+
+// NewStringAggExpr concatenates the non null strings of expr, separated by separator
+func NewStringAggExpr(expr physicalplan.PhysicalExpr, separator string) StringAggExpr {
+	return StringAggExpr{expr: expr, separator: separator}
+}
+
+func (s StringAggExpr) InputExpr() physicalplan.PhysicalExpr {
+	return s.expr
+}
+
+func (s StringAggExpr) CreateAccumulator() Accumulator {
+	return &StringAggAccumulator{separator: s.separator}
+}
+
+func (s StringAggExpr) StateFields(field datatypes.Field) []datatypes.Field {
+	return valueStateFields(field)
+}
+
+// ValueSize is the size of a short string and its separator
+func (s StringAggExpr) ValueSize() int64 {
+	return 16 + int64(len(s.separator))
+}
+
+func (s StringAggExpr) GroupSize() int64 {
+	return 0
+}
+
+func (s StringAggExpr) String() string {
+	return fmt.Sprintf("STRING_AGG(%s, '%s')", s.expr, s.separator)
+}
+
+type StringAggAccumulator struct {
+	separator string
+
+	builder  strings.Builder
+	hasValue bool
+}
+
+func (s *StringAggAccumulator) Accumulate(val interface{}) error {
+	if val == nil {
+		return nil
+	}
+	str, ok := val.(string)
+	if !ok {
+		return datatypes.NewSchemaError("String agg is not implemented for type: %T", val)
+	}
+	if s.hasValue {
+		s.builder.WriteString(s.separator)
+	}
+	s.builder.WriteString(str)
+	s.hasValue = true
+	return nil
+}
+
+// FinalValue is nil for a group without non null values
+func (s *StringAggAccumulator) FinalValue() interface{} {
+	if !s.hasValue {
+		return nil
+	}
+	return s.builder.String()
+}
+
+// State is the concatenation of the strings, concatenating the states is the concatenation of all the strings
+func (s *StringAggAccumulator) State() ([]interface{}, error) {
+	return []interface{}{s.FinalValue()}, nil
+}
+
+func (s *StringAggAccumulator) Merge(state []interface{}) error {
+	return s.Accumulate(state[0])
+}
+
+// GroupingExpr is the GROUPING of groupExprs in an aggregation by grouping sets: expr is the index of
+// the grouping set of the rows, which is the same for all the rows of a group, values is the GROUPING value
+// of every grouping set
+type GroupingExpr struct {
+	expr       physicalplan.PhysicalExpr
+	groupExprs []physicalplan.PhysicalExpr
+	values     []int64
+}
+
+func NewGroupingExpr(expr physicalplan.PhysicalExpr, groupExprs []physicalplan.PhysicalExpr, values []int64) GroupingExpr {
+	return GroupingExpr{expr, groupExprs, values}
+}
+
+func (g GroupingExpr) InputExpr() physicalplan.PhysicalExpr {
+	return g.expr
+}
+
+func (g GroupingExpr) CreateAccumulator() Accumulator {
+	return &GroupingAccumulator{values: g.values}
+}
+
+// StateFields is the index of the grouping set
+func (g GroupingExpr) StateFields(field datatypes.Field) []datatypes.Field {
+	return []datatypes.Field{{Name: field.Name, DataType: datatypes.Int64Type}}
+}
+
+func (g GroupingExpr) String() string {
+	groupExprs := make([]string, len(g.groupExprs))
+	for i, expr := range g.groupExprs {
+		groupExprs[i] = fmt.Sprint(expr)
+	}
+	return fmt.Sprintf("GROUPING(%s)", strings.Join(groupExprs, ", "))
+}
+
+type GroupingAccumulator struct {
+	values []int64
+	// set is the index of the grouping set, ok is set once a row is accumulated
+	set int64
+	ok  bool
+}
+
+func (g *GroupingAccumulator) Accumulate(val interface{}) error {
+	if val == nil {
+		return nil
+	}
+	set, ok := val.(int64)
+	if !ok || set < 0 || set >= int64(len(g.values)) {
+		return datatypes.NewSchemaError("Grouping expects the index of a grouping set, got: %v", val)
+	}
+	g.set, g.ok = set, true
+	return nil
+}
+
+func (g *GroupingAccumulator) FinalValue() interface{} {
+	if !g.ok {
+		return nil
+	}
+	return g.values[g.set]
+}
+
+func (g *GroupingAccumulator) State() ([]interface{}, error) {
+	if !g.ok {
+		return []interface{}{nil}, nil
+	}
+	return []interface{}{g.set}, nil
+}
+
+func (g *GroupingAccumulator) Merge(state []interface{}) error {
+	return g.Accumulate(state[0])
+}
+
+// VarianceExpr is the sample or population variance of expr, or its standard deviation
+type VarianceExpr struct {
+	expr       physicalplan.PhysicalExpr
+	population bool
+	stddev     bool
+}
+
+// NewVarianceExpr is VAR_SAMP, or VAR_POP for the population variance
+func NewVarianceExpr(expr physicalplan.PhysicalExpr, population bool) VarianceExpr {
+	return VarianceExpr{expr: expr, population: population}
+}
+
+// NewStddevExpr is STDDEV_SAMP, or STDDEV_POP for the population standard deviation
+func NewStddevExpr(expr physicalplan.PhysicalExpr, population bool) VarianceExpr {
+	return VarianceExpr{expr: expr, population: population, stddev: true}
+}
+
+func (v VarianceExpr) InputExpr() physicalplan.PhysicalExpr {
+	return v.expr
+}
+
+func (v VarianceExpr) CreateAccumulator() Accumulator {
+	return &VarianceAccumulator{population: v.population, stddev: v.stddev}
+}
+
+// StateFields are the count, the mean and the sum of the squared differences to the mean
+func (v VarianceExpr) StateFields(field datatypes.Field) []datatypes.Field {
+	return []datatypes.Field{
+		{Name: field.Name + "[count]", DataType: datatypes.UInt64Type},
+		{Name: field.Name + "[mean]", DataType: datatypes.DoubleType},
+		{Name: field.Name + "[m2]", DataType: datatypes.DoubleType},
+	}
+}
+
+func (v VarianceExpr) String() string {
+	return fmt.Sprintf("%s(%s)", statisticName(v.stddev, "STDDEV", "VAR", v.population), v.expr)
+}
+
+// VarianceAccumulator updates the mean and the sum of the squared differences to the mean of every value
+// with the Welford algorithm, which does not lose the precision of the variance of large close values
+type VarianceAccumulator struct {
+	population bool
+	stddev     bool
+
+	count uint64
+	mean  float64
+	m2    float64
+}
+
+func (v *VarianceAccumulator) Accumulate(val interface{}) error {
+	if val == nil {
+		return nil
+	}
+	x, err := toFloat64("Variance", val)
+	if err != nil {
+		return err
+	}
+	v.count++
+	delta := x - v.mean
+	v.mean += delta / float64(v.count)
+	v.m2 += delta * (x - v.mean)
+	return nil
+}
+
+// FinalValue is nil without values, or with a single value for the sample variance
+func (v *VarianceAccumulator) FinalValue() interface{} {
+	variance, ok := varianceOf(v.m2, v.count, v.population)
+	if !ok {
+		return nil
+	}
+	if v.stddev {
+		return math.Sqrt(variance)
+	}
+	return variance
+}
+
+func (v *VarianceAccumulator) State() ([]interface{}, error) {
+	return []interface{}{v.count, v.mean, v.m2}, nil
+}
+
+// Merge combines the moments of two sets of values, see Chan et al. parallel algorithm
+func (v *VarianceAccumulator) Merge(state []interface{}) error {
+	count, countOk := state[0].(uint64)
+	mean, meanOk := state[1].(float64)
+	m2, m2Ok := state[2].(float64)
+	if !countOk || !meanOk || !m2Ok {
+		return datatypes.NewSchemaError("Variance state must be uint64, float64 and float64, got: %T, %T and %T",
+			state[0], state[1], state[2])
+	}
+	if count == 0 {
+		return nil
+	}
+	total := float64(v.count + count)
+	delta := mean - v.mean
+	v.mean += delta * float64(count) / total
+	v.m2 += m2 + delta*delta*float64(v.count)*float64(count)/total
+	v.count += count
+	return nil
+}
+
+// CovarianceExpr is the sample or population covariance of y and x, or their correlation coefficient
+type CovarianceExpr struct {
+	y, x        physicalplan.PhysicalExpr
+	population  bool
+	correlation bool
+}
+
+// NewCovarianceExpr is COVAR_SAMP(y, x), or COVAR_POP(y, x) for the population covariance
+func NewCovarianceExpr(y, x physicalplan.PhysicalExpr, population bool) CovarianceExpr {
+	return CovarianceExpr{y: y, x: x, population: population}
+}
+
+// NewCorrExpr is CORR(y, x), the Pearson correlation coefficient
+func NewCorrExpr(y, x physicalplan.PhysicalExpr) CovarianceExpr {
+	return CovarianceExpr{y: y, x: x, correlation: true}
+}
+
+func (c CovarianceExpr) InputExpr() physicalplan.PhysicalExpr {
+	return c.y
+}
+
+func (c CovarianceExpr) InputExprs() []physicalplan.PhysicalExpr {
+	return []physicalplan.PhysicalExpr{c.y, c.x}
+}
+
+func (c CovarianceExpr) CreateAccumulator() Accumulator {
+	return &CovarianceAccumulator{population: c.population, correlation: c.correlation}
+}
+
+// StateFields are the count, the means of y and x, the sum of the products of their differences to the means,
+// and the sums of their squared differences to the means
+func (c CovarianceExpr) StateFields(field datatypes.Field) []datatypes.Field {
+	fields := []datatypes.Field{{Name: field.Name + "[count]", DataType: datatypes.UInt64Type}}
+	for _, name := range []string{"mean_y", "mean_x", "c2", "m2_y", "m2_x"} {
+		fields = append(fields, datatypes.Field{Name: field.Name + "[" + name + "]", DataType: datatypes.DoubleType})
+	}
+	return fields
+}
+
+func (c CovarianceExpr) String() string {
+	if c.correlation {
+		return fmt.Sprintf("CORR(%s, %s)", c.y, c.x)
+	}
+	return fmt.Sprintf("%s(%s, %s)", statisticName(false, "", "COVAR", c.population), c.y, c.x)
+}
+
+// CovarianceAccumulator is the VarianceAccumulator of the pairs of values, the rows with a nil value are ignored
+type CovarianceAccumulator struct {
+	population  bool
+	correlation bool
+
+	count        uint64
+	meanY, meanX float64
+	c2           float64
+	m2Y, m2X     float64
+}
+
+func (c *CovarianceAccumulator) Accumulate(val interface{}) error {
+	pair, ok := val.([]interface{})
+	if !ok || len(pair) != 2 {
+		return datatypes.NewSchemaError("Covariance expects the values of 2 inputs, got: %v", val)
+	}
+	if pair[0] == nil || pair[1] == nil {
+		return nil
+	}
+	y, err := toFloat64("Covariance", pair[0])
+	if err != nil {
+		return err
+	}
+	x, err := toFloat64("Covariance", pair[1])
+	if err != nil {
+		return err
+	}
+	c.count++
+	n := float64(c.count)
+	deltaY, deltaX := y-c.meanY, x-c.meanX
+	c.meanY += deltaY / n
+	c.meanX += deltaX / n
+	c.c2 += deltaX * (y - c.meanY)
+	c.m2Y += deltaY * (y - c.meanY)
+	c.m2X += deltaX * (x - c.meanX)
+	return nil
+}
+
+// FinalValue is nil when the covariance is, or for the correlation of constant values
+func (c *CovarianceAccumulator) FinalValue() interface{} {
+	if c.correlation {
+		if c.count == 0 || c.m2Y == 0 || c.m2X == 0 {
+			return nil
+		}
+		return c.c2 / math.Sqrt(c.m2Y*c.m2X)
+	}
+	covariance, ok := varianceOf(c.c2, c.count, c.population)
+	if !ok {
+		return nil
+	}
+	return covariance
+}
+
+func (c *CovarianceAccumulator) State() ([]interface{}, error) {
+	return []interface{}{c.count, c.meanY, c.meanX, c.c2, c.m2Y, c.m2X}, nil
+}
+
+func (c *CovarianceAccumulator) Merge(state []interface{}) error {
+	count, ok := state[0].(uint64)
+	moments := make([]float64, 5)
+	for i := range moments {
+		var momentOk bool
+		moments[i], momentOk = state[i+1].(float64)
+		ok = ok && momentOk
+	}
+	if !ok {
+		return datatypes.NewSchemaError("Covariance state must be uint64 followed by 5 float64, got: %v", state)
+	}
+	if count == 0 {
+		return nil
+	}
+	total := float64(c.count + count)
+	weight := float64(c.count) * float64(count) / total
+	deltaY, deltaX := moments[0]-c.meanY, moments[1]-c.meanX
+	c.meanY += deltaY * float64(count) / total
+	c.meanX += deltaX * float64(count) / total
+	c.c2 += moments[2] + deltaY*deltaX*weight
+	c.m2Y += moments[3] + deltaY*deltaY*weight
+	c.m2X += moments[4] + deltaX*deltaX*weight
+	c.count += count
+	return nil
+}
+
+// varianceOf divides the sum of the squared differences to the mean by the count, or the count - 1
+// for a sample, it returns false when there are not enough values
+func varianceOf(m2 float64, count uint64, population bool) (float64, bool) {
+	if population {
+		if count == 0 {
+			return 0, false
+		}
+		return m2 / float64(count), true
+	}
+	if count < 2 {
+		return 0, false
+	}
+	return m2 / float64(count-1), true
+}
+
+// statisticName returns the SQL name of a sample or population statistic
+func statisticName(stddev bool, stddevName, name string, population bool) string {
+	if stddev {
+		name = stddevName
+	}
+	if population {
+		return name + "_POP"
+	}
+	return name + "_SAMP"
+}
+
+// toFloat64 converts the numeric input of a statistical aggregate, name is the aggregate in the error message
+func toFloat64(name string, val interface{}) (float64, error) {
+	switch v := val.(type) {
+	case int8:
+		return float64(v), nil
+	case int16:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case uint8:
+		return float64(v), nil
+	case uint16:
+		return float64(v), nil
+	case uint32:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case float32:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	default:
+		return 0, datatypes.NewSchemaError("%s is not implemented for type: %T", name, v)
+	}
+}
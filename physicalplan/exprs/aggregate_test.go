@@ -1,30 +1,312 @@
 package exprs
 
 import (
+	"errors"
+	"fmt"
 	"github.com/stretchr/testify/require"
+	"math"
+	"query-engine/datatypes"
 	"testing"
 )
 
 func TestAggregate_Min(t *testing.T) {
 	accumulator := NewMinExpr(NewColumnIndexExpr(0)).CreateAccumulator()
-	accumulator.Accumulate(int8(10))
-	accumulator.Accumulate(int8(3))
-	accumulator.Accumulate(int8(5))
+	require.NoError(t, accumulator.Accumulate(int8(10)))
+	require.NoError(t, accumulator.Accumulate(int8(3)))
+	require.NoError(t, accumulator.Accumulate(int8(5)))
 	require.Equal(t, int8(3), accumulator.FinalValue())
 }
 
 func TestAggregate_Max(t *testing.T) {
 	accumulator := NewMaxExpr(NewColumnIndexExpr(0)).CreateAccumulator()
-	accumulator.Accumulate(int8(10))
-	accumulator.Accumulate(int8(3))
-	accumulator.Accumulate(int8(5))
+	require.NoError(t, accumulator.Accumulate(int8(10)))
+	require.NoError(t, accumulator.Accumulate(int8(3)))
+	require.NoError(t, accumulator.Accumulate(int8(5)))
 	require.Equal(t, int8(10), accumulator.FinalValue())
 }
 
 func TestAggregate_Sum(t *testing.T) {
 	accumulator := NewSumExpr(NewColumnIndexExpr(0)).CreateAccumulator()
-	accumulator.Accumulate(int8(10))
-	accumulator.Accumulate(int8(3))
-	accumulator.Accumulate(int8(5))
+	require.NoError(t, accumulator.Accumulate(int8(10)))
+	require.NoError(t, accumulator.Accumulate(int8(3)))
+	require.NoError(t, accumulator.Accumulate(int8(5)))
 	require.Equal(t, int8(18), accumulator.FinalValue())
 }
+
+func TestAggregate_Sum_unsupported_type(t *testing.T) {
+	accumulator := NewSumExpr(NewColumnIndexExpr(0)).CreateAccumulator()
+	require.NoError(t, accumulator.Accumulate("10"))
+	err := accumulator.Accumulate("20")
+	var schemaErr *datatypes.SchemaError
+	require.True(t, errors.As(err, &schemaErr))
+}
+
+// requireState returns the state of an accumulator which can be encoded
+func requireState(t *testing.T, acc Accumulator) []interface{} {
+	state, err := acc.State()
+	require.NoError(t, err)
+	return state
+}
+
+func TestAggregate_Merge(t *testing.T) {
+	for _, expr := range []AggregateExpr{
+		NewMinExpr(NewColumnIndexExpr(0)), NewMaxExpr(NewColumnIndexExpr(0)), NewSumExpr(NewColumnIndexExpr(0)),
+		NewCountExpr(NewColumnIndexExpr(0)), NewAvgExpr(NewColumnIndexExpr(0)), NewCountDistinctExpr(NewColumnIndexExpr(0)),
+		NewPercentileContExpr(NewColumnIndexExpr(0), 0.3), NewPercentileDiscExpr(NewColumnIndexExpr(0), 0.3),
+	} {
+		whole := expr.CreateAccumulator()
+		partials := []Accumulator{expr.CreateAccumulator(), expr.CreateAccumulator(), expr.CreateAccumulator()}
+		for i, v := range []int64{10, 3, 5, 8, -2} {
+			require.NoError(t, whole.Accumulate(v))
+			require.NoError(t, partials[i%2].Accumulate(v))
+		}
+
+		// the third partial has no value
+		final := expr.CreateAccumulator()
+		for _, partial := range partials {
+			require.Len(t, requireState(t, partial), len(expr.StateFields(datatypes.Field{Name: "a", DataType: datatypes.Int64Type})))
+			require.NoError(t, final.Merge(requireState(t, partial)))
+		}
+		require.Equal(t, whole.FinalValue(), final.FinalValue(), expr)
+	}
+}
+
+func TestAggregate_Count(t *testing.T) {
+	accumulator := NewCountExpr(NewColumnIndexExpr(0)).CreateAccumulator()
+	require.Equal(t, uint64(0), accumulator.FinalValue())
+	require.NoError(t, accumulator.Accumulate("a"))
+	require.NoError(t, accumulator.Accumulate(nil))
+	require.NoError(t, accumulator.Accumulate("a"))
+	require.Equal(t, uint64(2), accumulator.FinalValue())
+}
+
+func TestAggregate_Avg(t *testing.T) {
+	accumulator := NewAvgExpr(NewColumnIndexExpr(0)).CreateAccumulator()
+	require.Nil(t, accumulator.FinalValue())
+	require.NoError(t, accumulator.Accumulate(int32(10)))
+	require.NoError(t, accumulator.Accumulate(nil))
+	require.NoError(t, accumulator.Accumulate(int32(5)))
+	require.Equal(t, 7.5, accumulator.FinalValue())
+
+	err := accumulator.Accumulate("10")
+	var schemaErr *datatypes.SchemaError
+	require.True(t, errors.As(err, &schemaErr))
+}
+
+func TestAggregate_CountDistinct(t *testing.T) {
+	accumulator := NewCountDistinctExpr(NewColumnIndexExpr(0)).CreateAccumulator()
+	for _, v := range []interface{}{1.5, nil, 1.5, math.NaN(), math.NaN(), 0.0, math.Copysign(0, -1)} {
+		require.NoError(t, accumulator.Accumulate(v))
+	}
+	require.Equal(t, uint64(3), accumulator.FinalValue())
+
+	// the values keep their type
+	accumulator = NewCountDistinctExpr(NewColumnIndexExpr(0)).CreateAccumulator()
+	for _, v := range []interface{}{int32(1), int64(1), "1", int32(1)} {
+		require.NoError(t, accumulator.Accumulate(v))
+	}
+	require.Equal(t, uint64(3), accumulator.FinalValue())
+	final := NewCountDistinctExpr(NewColumnIndexExpr(0)).CreateAccumulator()
+	require.NoError(t, final.Merge(requireState(t, accumulator)))
+	require.NoError(t, final.Merge(requireState(t, accumulator)))
+	require.Equal(t, uint64(3), final.FinalValue())
+
+	var schemaErr *datatypes.SchemaError
+	require.True(t, errors.As(final.Merge([]interface{}{"invalid"}), &schemaErr))
+
+	// a type gob doesn't know can't be encoded
+	_, err := encodeValues("Count distinct", []interface{}{struct{}{}})
+	require.True(t, errors.As(err, &schemaErr))
+	require.Contains(t, err.Error(), "can't encode count distinct state")
+}
+
+func TestAggregate_Variance(t *testing.T) {
+	values := []interface{}{int64(2), int64(4), nil, int64(4), int64(4), int64(5), int64(5), int64(7), int64(9)}
+	testCases := []struct {
+		expr   AggregateExpr
+		expect float64
+	}{
+		{NewVarianceExpr(NewColumnIndexExpr(0), false), 32.0 / 7},
+		{NewVarianceExpr(NewColumnIndexExpr(0), true), 4},
+		{NewStddevExpr(NewColumnIndexExpr(0), false), math.Sqrt(32.0 / 7)},
+		{NewStddevExpr(NewColumnIndexExpr(0), true), 2},
+	}
+	for _, tc := range testCases {
+		accumulator := tc.expr.CreateAccumulator()
+		for _, v := range values {
+			require.NoError(t, accumulator.Accumulate(v))
+		}
+		require.InDelta(t, tc.expect, accumulator.FinalValue(), 1e-12, tc.expr)
+	}
+
+	// the variance of large close values keeps its precision
+	accumulator := NewVarianceExpr(NewColumnIndexExpr(0), false).CreateAccumulator()
+	for _, v := range []float64{1e9 + 4, 1e9 + 7, 1e9 + 13, 1e9 + 16} {
+		require.NoError(t, accumulator.Accumulate(v))
+	}
+	require.Equal(t, 30.0, accumulator.FinalValue())
+
+	// the sample variance of a single value is null
+	accumulator = NewVarianceExpr(NewColumnIndexExpr(0), false).CreateAccumulator()
+	require.NoError(t, accumulator.Accumulate(1.0))
+	require.Nil(t, accumulator.FinalValue())
+	require.Equal(t, "VAR_SAMP(#0)", NewVarianceExpr(NewColumnIndexExpr(0), false).String())
+	require.Equal(t, "STDDEV_POP(#0)", NewStddevExpr(NewColumnIndexExpr(0), true).String())
+}
+
+func TestAggregate_Covariance(t *testing.T) {
+	y, x := NewColumnIndexExpr(0), NewColumnIndexExpr(1)
+	rows := [][]interface{}{{3.0, int32(1)}, {5.0, int32(2)}, {nil, int32(3)}, {9.0, int32(4)}, {4.0, nil}, {11.0, int32(5)}}
+	testCases := []struct {
+		expr   AggregateExpr
+		expect interface{}
+	}{
+		{NewCovarianceExpr(y, x, false), 20.0 / 3},
+		{NewCovarianceExpr(y, x, true), 5.0},
+		{NewCorrExpr(y, x), 1.0},
+	}
+	for _, tc := range testCases {
+		accumulator := tc.expr.CreateAccumulator()
+		for _, row := range rows {
+			require.NoError(t, accumulator.Accumulate(row))
+		}
+		require.InDelta(t, tc.expect, accumulator.FinalValue(), 1e-12, tc.expr)
+	}
+
+	// the correlation of a constant is null
+	accumulator := NewCorrExpr(y, x).CreateAccumulator()
+	require.NoError(t, accumulator.Accumulate([]interface{}{1.0, 1.0}))
+	require.NoError(t, accumulator.Accumulate([]interface{}{1.0, 2.0}))
+	require.Nil(t, accumulator.FinalValue())
+
+	var schemaErr *datatypes.SchemaError
+	require.True(t, errors.As(accumulator.Accumulate(1.0), &schemaErr))
+	require.Equal(t, "COVAR_SAMP(#0, #1)", NewCovarianceExpr(y, x, false).String())
+	require.Len(t, InputExprs(NewCorrExpr(y, x)), 2)
+}
+
+func TestAggregate_Statistics_Merge(t *testing.T) {
+	for _, expr := range []AggregateExpr{
+		NewVarianceExpr(NewColumnIndexExpr(0), false), NewStddevExpr(NewColumnIndexExpr(0), true),
+		NewCovarianceExpr(NewColumnIndexExpr(0), NewColumnIndexExpr(1), false), NewCorrExpr(NewColumnIndexExpr(0), NewColumnIndexExpr(1)),
+	} {
+		_, multi := expr.(MultiInputAggregateExpr)
+		whole := expr.CreateAccumulator()
+		partials := []Accumulator{expr.CreateAccumulator(), expr.CreateAccumulator(), expr.CreateAccumulator()}
+		for i, v := range []int64{10, 3, 5, 8, -2, 7} {
+			var val interface{} = v
+			if multi {
+				val = []interface{}{v, float64(i * i)}
+			}
+			require.NoError(t, whole.Accumulate(val))
+			require.NoError(t, partials[i%2].Accumulate(val))
+		}
+
+		// the third partial has no value
+		final := expr.CreateAccumulator()
+		for _, partial := range partials {
+			require.Len(t, requireState(t, partial), len(expr.StateFields(datatypes.Field{Name: "a", DataType: datatypes.DoubleType})))
+			require.NoError(t, final.Merge(requireState(t, partial)))
+		}
+		require.InDelta(t, whole.FinalValue(), final.FinalValue(), 1e-9, expr)
+	}
+}
+
+func TestAggregate_Percentile(t *testing.T) {
+	// the values 1 to 4 of every numeric type
+	typed := []func(int) interface{}{
+		func(v int) interface{} { return int8(v) },
+		func(v int) interface{} { return int16(v) },
+		func(v int) interface{} { return int32(v) },
+		func(v int) interface{} { return int64(v) },
+		func(v int) interface{} { return uint8(v) },
+		func(v int) interface{} { return uint16(v) },
+		func(v int) interface{} { return uint32(v) },
+		func(v int) interface{} { return uint64(v) },
+		func(v int) interface{} { return float32(v) },
+		func(v int) interface{} { return float64(v) },
+	}
+	for _, typ := range typed {
+		testCases := []struct {
+			expr   AggregateExpr
+			expect interface{}
+		}{
+			{NewPercentileContExpr(NewColumnIndexExpr(0), 0.5), 2.5},
+			{NewPercentileContExpr(NewColumnIndexExpr(0), 0.1), 1.3},
+			{NewPercentileContExpr(NewColumnIndexExpr(0), 1), 4.0},
+			{NewPercentileDiscExpr(NewColumnIndexExpr(0), 0.5), typ(2)},
+			{NewPercentileDiscExpr(NewColumnIndexExpr(0), 0.51), typ(3)},
+			{NewPercentileDiscExpr(NewColumnIndexExpr(0), 0), typ(1)},
+		}
+		for _, tc := range testCases {
+			accumulator := tc.expr.CreateAccumulator()
+			for _, v := range []interface{}{typ(3), nil, typ(1), typ(4), typ(2)} {
+				require.NoError(t, accumulator.Accumulate(v))
+			}
+			if f, ok := tc.expect.(float64); ok {
+				require.InDelta(t, f, accumulator.FinalValue(), 1e-12, tc.expr)
+			} else {
+				require.Equal(t, tc.expect, accumulator.FinalValue(), tc.expr)
+			}
+		}
+	}
+
+	accumulator := NewPercentileContExpr(NewColumnIndexExpr(0), 0.5).CreateAccumulator()
+	require.Nil(t, accumulator.FinalValue())
+	require.NoError(t, accumulator.Accumulate(int64(1)))
+	var schemaErr *datatypes.SchemaError
+	require.True(t, errors.As(accumulator.Accumulate(int32(1)), &schemaErr))
+	require.True(t, errors.As(accumulator.Accumulate("1"), &schemaErr))
+	require.Equal(t, "PERCENTILE_DISC(#0, 0.5)", NewPercentileDiscExpr(NewColumnIndexExpr(0), 0.5).String())
+}
+
+func TestAggregate_ArrayAgg(t *testing.T) {
+	expr := NewArrayAggExpr(NewColumnIndexExpr(0))
+	accumulator := expr.CreateAccumulator()
+	require.Nil(t, accumulator.FinalValue())
+	for _, v := range []interface{}{"b", nil, "a", "b"} {
+		require.NoError(t, accumulator.Accumulate(v))
+	}
+	require.Equal(t, []interface{}{"b", "a", "b"}, accumulator.FinalValue())
+
+	final := expr.CreateAccumulator()
+	require.NoError(t, final.Merge(requireState(t, accumulator)))
+	require.NoError(t, final.Merge(requireState(t, expr.CreateAccumulator())))
+	require.NoError(t, final.Merge([]interface{}{[]interface{}{"c"}}))
+	require.Equal(t, []interface{}{"b", "a", "b", "c"}, final.FinalValue())
+
+	var schemaErr *datatypes.SchemaError
+	require.True(t, errors.As(final.Merge([]interface{}{"c"}), &schemaErr))
+}
+
+func TestAggregate_StringAgg(t *testing.T) {
+	expr := NewStringAggExpr(NewColumnIndexExpr(0), ", ")
+	accumulator := expr.CreateAccumulator()
+	require.Nil(t, accumulator.FinalValue())
+	for _, v := range []interface{}{"b", nil, "", "a"} {
+		require.NoError(t, accumulator.Accumulate(v))
+	}
+	require.Equal(t, "b, , a", accumulator.FinalValue())
+
+	final := expr.CreateAccumulator()
+	require.NoError(t, final.Merge(requireState(t, expr.CreateAccumulator())))
+	require.NoError(t, final.Merge(requireState(t, accumulator)))
+	require.NoError(t, final.Merge([]interface{}{"c"}))
+	require.Equal(t, "b, , a, c", final.FinalValue())
+
+	var schemaErr *datatypes.SchemaError
+	require.True(t, errors.As(final.Accumulate(int64(1)), &schemaErr))
+	require.Equal(t, "STRING_AGG(#0, ', ')", expr.String())
+}
+
+func TestAggregate_Filtered(t *testing.T) {
+	y, x := NewColumnIndexExpr(0), NewColumnIndexExpr(1)
+	filter := NewGtExpr(NewColumnIndexExpr(2), NewLiteralLongExpr(0))
+	expr := NewFilteredAggregateExpr(NewCorrExpr(y, x), filter)
+
+	// the inputs and the states are the ones of the filtered aggregate, the filter is evaluated by the aggregation
+	require.Equal(t, InputExprs(NewCorrExpr(y, x)), InputExprs(expr))
+	require.Equal(t, "#2 > 0", fmt.Sprint(expr.Filter()))
+	require.Equal(t, "CORR(#0, #1) FILTER (WHERE #2 > 0)", expr.String())
+	require.Len(t, InputExprs(NewFilteredAggregateExpr(NewSumExpr(y), filter)), 1)
+}
@@ -0,0 +1,373 @@
+package exprs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"query-engine/datatypes"
+	"query-engine/physicalplan"
+	"sort"
+)
+
+// ---------------------------------------------Approximate Aggregates---------------------------------------------
+
+// hllPrecision is the number of bits of the hash selecting a register, the 4096 registers of a group
+// have a standard error of 1.04 / sqrt(4096), about 1.6%
+const hllPrecision = 12
+
+type ApproxCountDistinctExpr struct {
+	expr physicalplan.PhysicalExpr
+}
+
+// NewApproxCountDistinctExpr estimates the number of distinct non null values of expr with a HyperLogLog sketch
+func NewApproxCountDistinctExpr(expr physicalplan.PhysicalExpr) ApproxCountDistinctExpr {
+	return ApproxCountDistinctExpr{expr}
+}
+
+func (a ApproxCountDistinctExpr) InputExpr() physicalplan.PhysicalExpr {
+	return a.expr
+}
+
+func (a ApproxCountDistinctExpr) CreateAccumulator() Accumulator {
+	return &HyperLogLogAccumulator{registers: make([]byte, 1<<hllPrecision)}
+}
+
+// StateFields are the registers of the sketch, one byte each
+func (a ApproxCountDistinctExpr) StateFields(field datatypes.Field) []datatypes.Field {
+	return []datatypes.Field{{Name: field.Name + "[registers]", DataType: datatypes.StringType}}
+}
+
+// ValueSize is 0, the registers don't grow with the values
+func (a ApproxCountDistinctExpr) ValueSize() int64 {
+	return 0
+}
+
+// GroupSize is the size of the registers
+func (a ApproxCountDistinctExpr) GroupSize() int64 {
+	return 1 << hllPrecision
+}
+
+func (a ApproxCountDistinctExpr) String() string {
+	return fmt.Sprintf("APPROX_COUNT_DISTINCT(%s)", a.expr)
+}
+
+// HyperLogLogAccumulator keeps, in the register selected by the first bits of the hash of every value,
+// the max position of the first 1 bit of the rest of the hash. Merging two sketches keeps the max of
+// every register, so that the merged sketch is the sketch of all the values.
+type HyperLogLogAccumulator struct {
+	registers []byte
+}
+
+func (h *HyperLogLogAccumulator) Accumulate(val interface{}) error {
+	if val == nil {
+		return nil
+	}
+	hash, err := hashValue(val)
+	if err != nil {
+		return err
+	}
+	idx := hash >> (64 - hllPrecision)
+	rank := byte(bits.LeadingZeros64(hash<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+	return nil
+}
+
+// FinalValue is the HyperLogLog estimate, the small cardinalities are estimated by linear counting
+func (h *HyperLogLogAccumulator) FinalValue() interface{} {
+	m := float64(len(h.registers))
+	sum, zeros := 0.0, 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(math.Round(estimate))
+}
+
+func (h *HyperLogLogAccumulator) State() ([]interface{}, error) {
+	return []interface{}{string(h.registers)}, nil
+}
+
+func (h *HyperLogLogAccumulator) Merge(state []interface{}) error {
+	registers, ok := state[0].(string)
+	if !ok || len(registers) != len(h.registers) {
+		return datatypes.NewSchemaError("HyperLogLog state must be a string of %d registers, got: %T", len(h.registers), state[0])
+	}
+	for i := 0; i < len(registers); i++ {
+		if registers[i] > h.registers[i] {
+			h.registers[i] = registers[i]
+		}
+	}
+	return nil
+}
+
+// hashValue hashes a value along with its type, the NaN of a float type have the same hash, as do 0 and -0
+func hashValue(val interface{}) (uint64, error) {
+	var buf [9]byte
+	switch v := val.(type) {
+	case bool:
+		buf[0] = 1
+		if v {
+			buf[1] = 1
+		}
+	case int8:
+		buf[0] = 2
+		binary.BigEndian.PutUint64(buf[1:], uint64(v))
+	case int16:
+		buf[0] = 3
+		binary.BigEndian.PutUint64(buf[1:], uint64(v))
+	case int32:
+		buf[0] = 4
+		binary.BigEndian.PutUint64(buf[1:], uint64(v))
+	case int64:
+		buf[0] = 5
+		binary.BigEndian.PutUint64(buf[1:], uint64(v))
+	case uint8:
+		buf[0] = 6
+		binary.BigEndian.PutUint64(buf[1:], uint64(v))
+	case uint16:
+		buf[0] = 7
+		binary.BigEndian.PutUint64(buf[1:], uint64(v))
+	case uint32:
+		buf[0] = 8
+		binary.BigEndian.PutUint64(buf[1:], uint64(v))
+	case uint64:
+		buf[0] = 9
+		binary.BigEndian.PutUint64(buf[1:], v)
+	case float32:
+		buf[0] = 10
+		f := float64(v)
+		if f != f {
+			f = math.NaN()
+		}
+		binary.BigEndian.PutUint64(buf[1:], math.Float64bits(f+0))
+	case float64:
+		buf[0] = 11
+		if v != v {
+			v = math.NaN()
+		}
+		binary.BigEndian.PutUint64(buf[1:], math.Float64bits(v+0))
+	case string:
+		h := fnv.New64a()
+		_, _ = h.Write([]byte{12})
+		_, _ = h.Write([]byte(v))
+		return mix64(h.Sum64()), nil
+	default:
+		return 0, datatypes.NewSchemaError("Approx count distinct is not implemented for type: %T", val)
+	}
+	h := fnv.New64a()
+	_, _ = h.Write(buf[:])
+	return mix64(h.Sum64()), nil
+}
+
+// mix64 is the murmur3 finalizer, it spreads the bits of the fnv hash, whose high bits are poorly mixed
+func mix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// tdigestCompression bounds the number of centroids of a t-digest to about compression / 2 * pi,
+// the larger it is, the more accurate the percentiles
+const tdigestCompression = 100
+
+type ApproxPercentileExpr struct {
+	expr       physicalplan.PhysicalExpr
+	percentile float64
+}
+
+// NewApproxPercentileExpr estimates the percentile of the numeric values of expr with a t-digest,
+// percentile is between 0 and 1, APPROX_MEDIAN is the percentile 0.5
+func NewApproxPercentileExpr(expr physicalplan.PhysicalExpr, percentile float64) ApproxPercentileExpr {
+	return ApproxPercentileExpr{expr: expr, percentile: percentile}
+}
+
+func (a ApproxPercentileExpr) InputExpr() physicalplan.PhysicalExpr {
+	return a.expr
+}
+
+func (a ApproxPercentileExpr) CreateAccumulator() Accumulator {
+	return &TDigestAccumulator{percentile: a.percentile}
+}
+
+// StateFields are the min and max values followed by the centroids of the digest, see TDigestAccumulator State
+func (a ApproxPercentileExpr) StateFields(field datatypes.Field) []datatypes.Field {
+	return []datatypes.Field{{Name: field.Name + "[digest]", DataType: datatypes.StringType}}
+}
+
+func (a ApproxPercentileExpr) String() string {
+	return fmt.Sprintf("APPROX_PERCENTILE(%s, %v)", a.expr, a.percentile)
+}
+
+type centroid struct {
+	mean   float64
+	weight float64
+}
+
+// TDigestAccumulator summarizes the values by centroids, the centroids of the values close to the min
+// or the max have small weights, so that the extreme percentiles are accurate. The values are buffered
+// and merged into the centroids once the buffer is full. NaN values are ignored.
+type TDigestAccumulator struct {
+	percentile float64
+
+	centroids []centroid
+	buffer    []centroid
+	min, max  float64
+}
+
+func (t *TDigestAccumulator) Accumulate(val interface{}) error {
+	if val == nil {
+		return nil
+	}
+	v, err := toFloat64("Approx percentile", val)
+	if err != nil {
+		return err
+	}
+	if v == v {
+		t.add(centroid{mean: v, weight: 1}, v, v)
+	}
+	return nil
+}
+
+func (t *TDigestAccumulator) add(c centroid, min, max float64) {
+	if len(t.centroids) == 0 && len(t.buffer) == 0 {
+		t.min, t.max = min, max
+	}
+	t.min = math.Min(t.min, min)
+	t.max = math.Max(t.max, max)
+	t.buffer = append(t.buffer, c)
+	if len(t.buffer) >= 5*tdigestCompression {
+		t.compress()
+	}
+}
+
+// compress merges the buffer into the centroids: a centroid absorbs its sorted neighbours until its weight
+// would span more than one unit of the scale function k(q) = compression / 2pi * asin(2q - 1) of the percentiles
+func (t *TDigestAccumulator) compress() {
+	if len(t.buffer) == 0 {
+		return
+	}
+	all := append(t.buffer, t.centroids...)
+	sort.Slice(all, func(i, j int) bool { return all[i].mean < all[j].mean })
+	total := 0.0
+	for _, c := range all {
+		total += c.weight
+	}
+
+	merged := make([]centroid, 0, len(t.centroids)+1)
+	current := all[0]
+	weightSoFar := 0.0
+	limit := total * tdigestQuantile(tdigestScale(0)+1)
+	for _, c := range all[1:] {
+		if weightSoFar+current.weight+c.weight <= limit {
+			current.weight += c.weight
+			current.mean += (c.mean - current.mean) * c.weight / current.weight
+			continue
+		}
+		weightSoFar += current.weight
+		merged = append(merged, current)
+		limit = total * tdigestQuantile(tdigestScale(weightSoFar/total)+1)
+		current = c
+	}
+	t.centroids = append(merged, current)
+	t.buffer = t.buffer[:0]
+}
+
+func tdigestScale(q float64) float64 {
+	return tdigestCompression / (2 * math.Pi) * math.Asin(2*q-1)
+}
+
+// tdigestQuantile is the inverse of tdigestScale, a scale past the last unit is the percentile 1
+func tdigestQuantile(k float64) float64 {
+	angle := k * 2 * math.Pi / tdigestCompression
+	if angle >= math.Pi/2 {
+		return 1
+	}
+	return (math.Sin(angle) + 1) / 2
+}
+
+// FinalValue interpolates between the centers of the centroids around the percentile,
+// the first and last centroids are interpolated with the min and max values. It is nil without values.
+func (t *TDigestAccumulator) FinalValue() interface{} {
+	t.compress()
+	if len(t.centroids) == 0 {
+		return nil
+	}
+	if len(t.centroids) == 1 {
+		return t.centroids[0].mean
+	}
+	total := 0.0
+	for _, c := range t.centroids {
+		total += c.weight
+	}
+	target := t.percentile * total
+
+	first, last := t.centroids[0], t.centroids[len(t.centroids)-1]
+	if target < first.weight/2 {
+		return t.min + (first.mean-t.min)*target/(first.weight/2)
+	}
+	if target > total-last.weight/2 {
+		return last.mean + (t.max-last.mean)*(target-(total-last.weight/2))/(last.weight/2)
+	}
+	center := first.weight / 2
+	for i := 1; i < len(t.centroids); i++ {
+		prev, c := t.centroids[i-1], t.centroids[i]
+		next := center + (prev.weight+c.weight)/2
+		if target <= next {
+			return prev.mean + (c.mean-prev.mean)*(target-center)/(next-center)
+		}
+		center = next
+	}
+	return last.mean
+}
+
+// State encodes the min and max values followed by the mean and weight of every centroid, as big endian float64
+func (t *TDigestAccumulator) State() ([]interface{}, error) {
+	t.compress()
+	buf := make([]byte, 0, 16*(len(t.centroids)+1))
+	if len(t.centroids) > 0 {
+		buf = appendFloat64(buf, t.min)
+		buf = appendFloat64(buf, t.max)
+	}
+	for _, c := range t.centroids {
+		buf = appendFloat64(buf, c.mean)
+		buf = appendFloat64(buf, c.weight)
+	}
+	return []interface{}{string(buf)}, nil
+}
+
+func (t *TDigestAccumulator) Merge(state []interface{}) error {
+	digest, ok := state[0].(string)
+	if !ok || len(digest)%16 != 0 {
+		return datatypes.NewSchemaError("t-digest state must be a string of float64 pairs, got: %T", state[0])
+	}
+	if len(digest) == 0 {
+		return nil
+	}
+	values := make([]float64, len(digest)/8)
+	for i := range values {
+		values[i] = math.Float64frombits(binary.BigEndian.Uint64([]byte(digest[8*i : 8*i+8])))
+	}
+	for i := 2; i < len(values); i += 2 {
+		t.add(centroid{mean: values[i], weight: values[i+1]}, values[0], values[1])
+	}
+	return nil
+}
+
+func appendFloat64(buf []byte, f float64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], math.Float64bits(f))
+	return append(buf, b[:]...)
+}
@@ -0,0 +1,75 @@
+package exprs
+
+import (
+	"errors"
+	"github.com/stretchr/testify/require"
+	"query-engine/datatypes"
+	"testing"
+)
+
+func TestApproxCountDistinct(t *testing.T) {
+	expr := NewApproxCountDistinctExpr(NewColumnIndexExpr(0))
+	whole := expr.CreateAccumulator()
+	partials := []Accumulator{expr.CreateAccumulator(), expr.CreateAccumulator()}
+	for i := 0; i < 200000; i++ {
+		v := int64(i % 100000)
+		require.NoError(t, whole.Accumulate(v))
+		require.NoError(t, partials[i%2].Accumulate(v))
+	}
+	require.InEpsilon(t, 100000, whole.FinalValue(), 0.05)
+
+	// merging the sketches of the partitions is the sketch of all the values
+	final := expr.CreateAccumulator()
+	for _, partial := range partials {
+		require.NoError(t, final.Merge(requireState(t, partial)))
+	}
+	require.Equal(t, whole.FinalValue(), final.FinalValue())
+
+	// small counts are close to exact, the values keep their type
+	accumulator := expr.CreateAccumulator()
+	for _, v := range []interface{}{int32(1), int64(1), "1", nil, "1", 0.0, -0.0, 2.5} {
+		require.NoError(t, accumulator.Accumulate(v))
+	}
+	require.Equal(t, uint64(5), accumulator.FinalValue())
+	require.Equal(t, uint64(0), expr.CreateAccumulator().FinalValue())
+
+	var schemaErr *datatypes.SchemaError
+	require.True(t, errors.As(accumulator.Merge([]interface{}{"short"}), &schemaErr))
+	require.True(t, errors.As(accumulator.Accumulate([]interface{}{1}), &schemaErr))
+}
+
+func TestApproxPercentile(t *testing.T) {
+	expr := NewApproxPercentileExpr(NewColumnIndexExpr(0), 0.5)
+	accumulator := expr.CreateAccumulator()
+	require.Nil(t, accumulator.FinalValue())
+	for _, v := range []interface{}{int32(5), int32(1), nil, int32(3), int32(2), int32(4)} {
+		require.NoError(t, accumulator.Accumulate(v))
+	}
+	require.Equal(t, 3.0, accumulator.FinalValue())
+
+	for _, percentile := range []float64{0.01, 0.5, 0.9, 0.99} {
+		expr := NewApproxPercentileExpr(NewColumnIndexExpr(0), percentile)
+		whole := expr.CreateAccumulator()
+		partials := []Accumulator{expr.CreateAccumulator(), expr.CreateAccumulator(), expr.CreateAccumulator()}
+		for i := 0; i < 100000; i++ {
+			// the values 1 to 100000 in a scrambled order
+			v := float64(i*7919%100000 + 1)
+			require.NoError(t, whole.Accumulate(v))
+			require.NoError(t, partials[i%2].Accumulate(v))
+		}
+		// the error of the rank of the estimate is small, so that the extreme percentiles are accurate
+		require.InDelta(t, percentile*100000, whole.FinalValue(), 0.002*100000, expr)
+
+		// the third partial has no value
+		final := expr.CreateAccumulator()
+		for _, partial := range partials {
+			require.NoError(t, final.Merge(requireState(t, partial)))
+		}
+		require.InDelta(t, percentile*100000, final.FinalValue(), 0.002*100000, expr)
+	}
+
+	var schemaErr *datatypes.SchemaError
+	require.True(t, errors.As(accumulator.Accumulate("1"), &schemaErr))
+	require.True(t, errors.As(accumulator.Merge([]interface{}{"odd"}), &schemaErr))
+	require.Equal(t, "APPROX_PERCENTILE(#0, 0.5)", expr.String())
+}
@@ -1,16 +1,22 @@
 package exprs
 
 import (
+	"errors"
 	"fmt"
 	"github.com/apache/arrow/go/v6/arrow"
 	"github.com/apache/arrow/go/v6/arrow/memory"
+	"math"
 	"query-engine/datatypes"
 	"query-engine/physicalplan"
 )
 
 // ---------------------------------------------Binary Expressions---------------------------------------------
 
-type BinaryExprEvalFunc = func(lData, rData interface{}, arrowType arrow.DataType) interface{}
+// BinaryExprEvalFunc evaluates two non-null values of the same arrowType
+type BinaryExprEvalFunc = func(lData, rData interface{}, arrowType arrow.DataType) (interface{}, error)
+
+// ErrDivisionByZero is returned when an integer is divided by zero or taken modulo zero
+var ErrDivisionByZero = errors.New("division by zero")
 
 type BinaryExpr struct {
 	name     string
@@ -23,86 +29,140 @@ func (b BinaryExpr) String() string {
 	return fmt.Sprintf("%s %s %s", b.l, b.op, b.r)
 }
 
+// evaluateOperands evaluates both sides, which must have the same size and type
+func (b BinaryExpr) evaluateOperands(input datatypes.RecordBatch) (datatypes.ColumnArray, datatypes.ColumnArray, error) {
+	ll, err := b.l.Evaluate(input)
+	if err != nil {
+		return nil, nil, err
+	}
+	rr, err := b.r.Evaluate(input)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ll.Size() != rr.Size() || ll.GetType() != rr.GetType() {
+		return nil, nil, datatypes.NewSchemaError(
+			"Cannot evaluate values of different size and type: %s %s %s", ll.GetType(), b.op, rr.GetType())
+	}
+	return ll, rr, nil
+}
+
+// binaryEvaluate applies evalFunc row by row, the result is null when any side is null
+func (b BinaryExpr) binaryEvaluate(l, r datatypes.ColumnArray, resultType arrow.DataType) (datatypes.ColumnArray, error) {
+	builder := datatypes.NewArrowArrayBuilder(memory.NewGoAllocator(), resultType)
+	for i := 0; i < l.Size(); i++ {
+		lData, rData := l.GetValue(i), r.GetValue(i)
+		if lData == nil || rData == nil {
+			builder.Append(nil)
+			continue
+		}
+		evalRes, err := b.evalFunc(lData, rData, l.GetType())
+		if err != nil {
+			return nil, err
+		}
+		builder.Append(evalRes)
+	}
+	return builder.Build(), nil
+}
+
 // -----------------Boolean Expressions-----------------
 
 type BooleanExpr struct {
 	BinaryExpr
 }
 
-func (b BooleanExpr) Evaluate(input datatypes.RecordBatch) datatypes.ColumnArray {
-	ll := b.l.Evaluate(input)
-	rr := b.r.Evaluate(input)
-	if ll.Size() != rr.Size() || ll.GetType() != rr.GetType() {
-		panic("Cannot compare values of different size and type")
+func (b BooleanExpr) Evaluate(input datatypes.RecordBatch) (datatypes.ColumnArray, error) {
+	ll, rr, err := b.evaluateOperands(input)
+	if err != nil {
+		return nil, err
+	}
+	if res, ok := b.kernel(ll, rr); ok {
+		return res, nil
 	}
-	return b.binaryEvaluate(ll, rr)
+	return b.binaryEvaluate(ll, rr, datatypes.BooleanType)
 }
 
-func (b BooleanExpr) binaryEvaluate(l, r datatypes.ColumnArray) datatypes.ColumnArray {
-	builder := datatypes.NewArrowArrayBuilder(memory.NewGoAllocator(), datatypes.BooleanType)
-	for i := 0; i < l.Size(); i++ {
-		evalRes := b.evalFunc(l.GetValue(i), r.GetValue(i), l.GetType())
-		builder.Append(evalRes)
+// kernel evaluates the expression with a typed kernel when there is one for the operands
+func (b BooleanExpr) kernel(l, r datatypes.ColumnArray) (datatypes.ColumnArray, bool) {
+	switch b.op {
+	case "AND", "OR":
+		return logicalKernel(b.op, l, r)
+	default:
+		return compareKernel(b.op, l, r)
 	}
-	return builder.Build()
 }
 
-var AndEvalFunc = func(lData, rData interface{}, arrowType arrow.DataType) interface{} {
-	return toBool(lData, arrowType) && toBool(rData, arrowType)
+var AndEvalFunc = func(lData, rData interface{}, arrowType arrow.DataType) (interface{}, error) {
+	l, err := toBool(lData, arrowType)
+	if err != nil {
+		return nil, err
+	}
+	r, err := toBool(rData, arrowType)
+	if err != nil {
+		return nil, err
+	}
+	return l && r, nil
 }
 
 func NewAndExpr(l, r physicalplan.PhysicalExpr) BooleanExpr {
 	return BooleanExpr{BinaryExpr{"and", "AND", l, r, AndEvalFunc}}
 }
 
-var OrEvalFunc = func(lData, rData interface{}, arrowType arrow.DataType) interface{} {
-	return toBool(lData, arrowType) || toBool(rData, arrowType)
+var OrEvalFunc = func(lData, rData interface{}, arrowType arrow.DataType) (interface{}, error) {
+	l, err := toBool(lData, arrowType)
+	if err != nil {
+		return nil, err
+	}
+	r, err := toBool(rData, arrowType)
+	if err != nil {
+		return nil, err
+	}
+	return l || r, nil
 }
 
 func NewOrExpr(l, r physicalplan.PhysicalExpr) BooleanExpr {
 	return BooleanExpr{BinaryExpr{"or", "OR", l, r, OrEvalFunc}}
 }
 
-func toBool(data interface{}, arrowType arrow.DataType) bool {
+func toBool(data interface{}, arrowType arrow.DataType) (bool, error) {
 	switch arrowType {
 	case datatypes.BooleanType:
-		return data.(bool)
+		return data.(bool), nil
 	case datatypes.Int8Type, datatypes.Int16Type, datatypes.Int32Type, datatypes.Int64Type,
 		datatypes.UInt8Type, datatypes.UInt16Type, datatypes.UInt32Type, datatypes.UInt64Type:
-		return data == 1
+		return data == 1, nil
 	default:
-		panic(fmt.Sprintf("invalid toBool data: %v", data))
+		return false, datatypes.NewSchemaError("Unsupported data type in boolean expression: %s", arrowType)
 	}
 }
 
-var EqEvalFunc = func(lData, rData interface{}, arrowType arrow.DataType) interface{} {
+var EqEvalFunc = func(lData, rData interface{}, arrowType arrow.DataType) (interface{}, error) {
 	switch arrowType {
 	case datatypes.BooleanType:
-		return lData.(bool) == rData.(bool)
+		return lData.(bool) == rData.(bool), nil
 	case datatypes.Int8Type:
-		return lData.(int8) == rData.(int8)
+		return lData.(int8) == rData.(int8), nil
 	case datatypes.Int16Type:
-		return lData.(int16) == rData.(int16)
+		return lData.(int16) == rData.(int16), nil
 	case datatypes.Int32Type:
-		return lData.(int32) == rData.(int32)
+		return lData.(int32) == rData.(int32), nil
 	case datatypes.Int64Type:
-		return lData.(int64) == rData.(int64)
+		return lData.(int64) == rData.(int64), nil
 	case datatypes.UInt8Type:
-		return lData.(uint8) == rData.(uint8)
+		return lData.(uint8) == rData.(uint8), nil
 	case datatypes.UInt16Type:
-		return lData.(uint16) == rData.(uint16)
+		return lData.(uint16) == rData.(uint16), nil
 	case datatypes.UInt32Type:
-		return lData.(uint32) == rData.(uint32)
+		return lData.(uint32) == rData.(uint32), nil
 	case datatypes.UInt64Type:
-		return lData.(uint64) == rData.(uint64)
+		return lData.(uint64) == rData.(uint64), nil
 	case datatypes.FloatType:
-		return lData.(float32) == rData.(float32)
+		return lData.(float32) == rData.(float32), nil
 	case datatypes.DoubleType:
-		return lData.(float64) == rData.(float64)
+		return lData.(float64) == rData.(float64), nil
 	case datatypes.StringType:
-		return lData.(string) == rData.(string)
+		return lData.(string) == rData.(string), nil
 	default:
-		panic(fmt.Sprintf("boolEvaluate invliad type: %T", lData))
+		return nil, datatypes.NewSchemaError("Unsupported data type in comparison: %s", arrowType)
 	}
 }
 
@@ -110,34 +170,34 @@ func NewEqExpr(l, r physicalplan.PhysicalExpr) BooleanExpr {
 	return BooleanExpr{BinaryExpr{"eq", "=", l, r, EqEvalFunc}}
 }
 
-var NeqEvalFunc = func(lData, rData interface{}, arrowType arrow.DataType) interface{} {
+var NeqEvalFunc = func(lData, rData interface{}, arrowType arrow.DataType) (interface{}, error) {
 	switch arrowType {
 	case datatypes.BooleanType:
-		return lData.(bool) != rData.(bool)
+		return lData.(bool) != rData.(bool), nil
 	case datatypes.Int8Type:
-		return lData.(int8) != rData.(int8)
+		return lData.(int8) != rData.(int8), nil
 	case datatypes.Int16Type:
-		return lData.(int16) != rData.(int16)
+		return lData.(int16) != rData.(int16), nil
 	case datatypes.Int32Type:
-		return lData.(int32) != rData.(int32)
+		return lData.(int32) != rData.(int32), nil
 	case datatypes.Int64Type:
-		return lData.(int64) != rData.(int64)
+		return lData.(int64) != rData.(int64), nil
 	case datatypes.UInt8Type:
-		return lData.(uint8) != rData.(uint8)
+		return lData.(uint8) != rData.(uint8), nil
 	case datatypes.UInt16Type:
-		return lData.(uint16) != rData.(uint16)
+		return lData.(uint16) != rData.(uint16), nil
 	case datatypes.UInt32Type:
-		return lData.(uint32) != rData.(uint32)
+		return lData.(uint32) != rData.(uint32), nil
 	case datatypes.UInt64Type:
-		return lData.(uint64) != rData.(uint64)
+		return lData.(uint64) != rData.(uint64), nil
 	case datatypes.FloatType:
-		return lData.(float32) != rData.(float32)
+		return lData.(float32) != rData.(float32), nil
 	case datatypes.DoubleType:
-		return lData.(float64) != rData.(float64)
+		return lData.(float64) != rData.(float64), nil
 	case datatypes.StringType:
-		return lData.(string) != rData.(string)
+		return lData.(string) != rData.(string), nil
 	default:
-		panic(fmt.Sprintf("boolEvaluate invliad type: %T", lData))
+		return nil, datatypes.NewSchemaError("Unsupported data type in comparison: %s", arrowType)
 	}
 }
 
@@ -145,32 +205,32 @@ func NewNeqExpr(l, r physicalplan.PhysicalExpr) BooleanExpr {
 	return BooleanExpr{BinaryExpr{"neq", "!=", l, r, NeqEvalFunc}}
 }
 
-var LtEvalFunc = func(lData, rData interface{}, arrowType arrow.DataType) interface{} {
+var LtEvalFunc = func(lData, rData interface{}, arrowType arrow.DataType) (interface{}, error) {
 	switch arrowType {
 	case datatypes.Int8Type:
-		return lData.(int8) < rData.(int8)
+		return lData.(int8) < rData.(int8), nil
 	case datatypes.Int16Type:
-		return lData.(int16) < rData.(int16)
+		return lData.(int16) < rData.(int16), nil
 	case datatypes.Int32Type:
-		return lData.(int32) < rData.(int32)
+		return lData.(int32) < rData.(int32), nil
 	case datatypes.Int64Type:
-		return lData.(int64) < rData.(int64)
+		return lData.(int64) < rData.(int64), nil
 	case datatypes.UInt8Type:
-		return lData.(uint8) < rData.(uint8)
+		return lData.(uint8) < rData.(uint8), nil
 	case datatypes.UInt16Type:
-		return lData.(uint16) < rData.(uint16)
+		return lData.(uint16) < rData.(uint16), nil
 	case datatypes.UInt32Type:
-		return lData.(uint32) < rData.(uint32)
+		return lData.(uint32) < rData.(uint32), nil
 	case datatypes.UInt64Type:
-		return lData.(uint64) < rData.(uint64)
+		return lData.(uint64) < rData.(uint64), nil
 	case datatypes.FloatType:
-		return lData.(float32) < rData.(float32)
+		return lData.(float32) < rData.(float32), nil
 	case datatypes.DoubleType:
-		return lData.(float64) < rData.(float64)
+		return lData.(float64) < rData.(float64), nil
 	case datatypes.StringType:
-		return lData.(string) < rData.(string)
+		return lData.(string) < rData.(string), nil
 	default:
-		panic(fmt.Sprintf("boolEvaluate invliad type: %T", lData))
+		return nil, datatypes.NewSchemaError("Unsupported data type in comparison: %s", arrowType)
 	}
 }
 
@@ -178,32 +238,32 @@ func NewLtExpr(l, r physicalplan.PhysicalExpr) BooleanExpr {
 	return BooleanExpr{BinaryExpr{"lt", "<", l, r, LtEvalFunc}}
 }
 
-var LtEqEvalFunc = func(lData, rData interface{}, arrowType arrow.DataType) interface{} {
+var LtEqEvalFunc = func(lData, rData interface{}, arrowType arrow.DataType) (interface{}, error) {
 	switch arrowType {
 	case datatypes.Int8Type:
-		return lData.(int8) <= rData.(int8)
+		return lData.(int8) <= rData.(int8), nil
 	case datatypes.Int16Type:
-		return lData.(int16) <= rData.(int16)
+		return lData.(int16) <= rData.(int16), nil
 	case datatypes.Int32Type:
-		return lData.(int32) <= rData.(int32)
+		return lData.(int32) <= rData.(int32), nil
 	case datatypes.Int64Type:
-		return lData.(int64) <= rData.(int64)
+		return lData.(int64) <= rData.(int64), nil
 	case datatypes.UInt8Type:
-		return lData.(uint8) <= rData.(uint8)
+		return lData.(uint8) <= rData.(uint8), nil
 	case datatypes.UInt16Type:
-		return lData.(uint16) <= rData.(uint16)
+		return lData.(uint16) <= rData.(uint16), nil
 	case datatypes.UInt32Type:
-		return lData.(uint32) <= rData.(uint32)
+		return lData.(uint32) <= rData.(uint32), nil
 	case datatypes.UInt64Type:
-		return lData.(uint64) <= rData.(uint64)
+		return lData.(uint64) <= rData.(uint64), nil
 	case datatypes.FloatType:
-		return lData.(float32) <= rData.(float32)
+		return lData.(float32) <= rData.(float32), nil
 	case datatypes.DoubleType:
-		return lData.(float64) <= rData.(float64)
+		return lData.(float64) <= rData.(float64), nil
 	case datatypes.StringType:
-		return lData.(string) <= rData.(string)
+		return lData.(string) <= rData.(string), nil
 	default:
-		panic(fmt.Sprintf("boolEvaluate invliad type: %T", lData))
+		return nil, datatypes.NewSchemaError("Unsupported data type in comparison: %s", arrowType)
 	}
 }
 
@@ -211,32 +271,32 @@ func NewLtEqExpr(l, r physicalplan.PhysicalExpr) BooleanExpr {
 	return BooleanExpr{BinaryExpr{"lteq", "<=", l, r, LtEqEvalFunc}}
 }
 
-var GtEvalFunc = func(lData, rData interface{}, arrowType arrow.DataType) interface{} {
+var GtEvalFunc = func(lData, rData interface{}, arrowType arrow.DataType) (interface{}, error) {
 	switch arrowType {
 	case datatypes.Int8Type:
-		return lData.(int8) > rData.(int8)
+		return lData.(int8) > rData.(int8), nil
 	case datatypes.Int16Type:
-		return lData.(int16) > rData.(int16)
+		return lData.(int16) > rData.(int16), nil
 	case datatypes.Int32Type:
-		return lData.(int32) > rData.(int32)
+		return lData.(int32) > rData.(int32), nil
 	case datatypes.Int64Type:
-		return lData.(int64) > rData.(int64)
+		return lData.(int64) > rData.(int64), nil
 	case datatypes.UInt8Type:
-		return lData.(uint8) > rData.(uint8)
+		return lData.(uint8) > rData.(uint8), nil
 	case datatypes.UInt16Type:
-		return lData.(uint16) > rData.(uint16)
+		return lData.(uint16) > rData.(uint16), nil
 	case datatypes.UInt32Type:
-		return lData.(uint32) > rData.(uint32)
+		return lData.(uint32) > rData.(uint32), nil
 	case datatypes.UInt64Type:
-		return lData.(uint64) > rData.(uint64)
+		return lData.(uint64) > rData.(uint64), nil
 	case datatypes.FloatType:
-		return lData.(float32) > rData.(float32)
+		return lData.(float32) > rData.(float32), nil
 	case datatypes.DoubleType:
-		return lData.(float64) > rData.(float64)
+		return lData.(float64) > rData.(float64), nil
 	case datatypes.StringType:
-		return lData.(string) > rData.(string)
+		return lData.(string) > rData.(string), nil
 	default:
-		panic(fmt.Sprintf("boolEvaluate invliad type: %T", lData))
+		return nil, datatypes.NewSchemaError("Unsupported data type in comparison: %s", arrowType)
 	}
 }
 
@@ -244,32 +304,32 @@ func NewGtExpr(l, r physicalplan.PhysicalExpr) BooleanExpr {
 	return BooleanExpr{BinaryExpr{"gt", ">", l, r, GtEvalFunc}}
 }
 
-var GtEqEvalFunc = func(lData, rData interface{}, arrowType arrow.DataType) interface{} {
+var GtEqEvalFunc = func(lData, rData interface{}, arrowType arrow.DataType) (interface{}, error) {
 	switch arrowType {
 	case datatypes.Int8Type:
-		return lData.(int8) >= rData.(int8)
+		return lData.(int8) >= rData.(int8), nil
 	case datatypes.Int16Type:
-		return lData.(int16) >= rData.(int16)
+		return lData.(int16) >= rData.(int16), nil
 	case datatypes.Int32Type:
-		return lData.(int32) >= rData.(int32)
+		return lData.(int32) >= rData.(int32), nil
 	case datatypes.Int64Type:
-		return lData.(int64) >= rData.(int64)
+		return lData.(int64) >= rData.(int64), nil
 	case datatypes.UInt8Type:
-		return lData.(uint8) >= rData.(uint8)
+		return lData.(uint8) >= rData.(uint8), nil
 	case datatypes.UInt16Type:
-		return lData.(uint16) >= rData.(uint16)
+		return lData.(uint16) >= rData.(uint16), nil
 	case datatypes.UInt32Type:
-		return lData.(uint32) >= rData.(uint32)
+		return lData.(uint32) >= rData.(uint32), nil
 	case datatypes.UInt64Type:
-		return lData.(uint64) >= rData.(uint64)
+		return lData.(uint64) >= rData.(uint64), nil
 	case datatypes.FloatType:
-		return lData.(float32) >= rData.(float32)
+		return lData.(float32) >= rData.(float32), nil
 	case datatypes.DoubleType:
-		return lData.(float64) >= rData.(float64)
+		return lData.(float64) >= rData.(float64), nil
 	case datatypes.StringType:
-		return lData.(string) >= rData.(string)
+		return lData.(string) >= rData.(string), nil
 	default:
-		panic(fmt.Sprintf("boolEvaluate invliad type: %T", lData))
+		return nil, datatypes.NewSchemaError("Unsupported data type in comparison: %s", arrowType)
 	}
 }
 
@@ -283,48 +343,41 @@ type MathExpr struct {
 	BinaryExpr
 }
 
-func (m MathExpr) Evaluate(input datatypes.RecordBatch) datatypes.ColumnArray {
-	ll := m.l.Evaluate(input)
-	rr := m.r.Evaluate(input)
-	if ll.Size() != rr.Size() || ll.GetType() != rr.GetType() {
-		panic("Cannot compare values of different size and type")
+func (m MathExpr) Evaluate(input datatypes.RecordBatch) (datatypes.ColumnArray, error) {
+	ll, rr, err := m.evaluateOperands(input)
+	if err != nil {
+		return nil, err
 	}
-	return m.binaryEvaluate(ll, rr)
-}
-
-func (m MathExpr) binaryEvaluate(l, r datatypes.ColumnArray) datatypes.ColumnArray {
-	builder := datatypes.NewArrowArrayBuilder(memory.NewGoAllocator(), l.GetType())
-	for i := 0; i < l.Size(); i++ {
-		evalRes := m.evalFunc(l.GetValue(i), r.GetValue(i), l.GetType())
-		builder.Append(evalRes)
+	if res, ok, err := mathKernel(m.op, ll, rr); ok {
+		return res, err
 	}
-	return builder.Build()
+	return m.binaryEvaluate(ll, rr, ll.GetType())
 }
 
-var AddEvalFunc = func(lData, rData interface{}, arrowType arrow.DataType) interface{} {
+var AddEvalFunc = func(lData, rData interface{}, arrowType arrow.DataType) (interface{}, error) {
 	switch arrowType {
 	case datatypes.Int8Type:
-		return lData.(int8) + rData.(int8)
+		return lData.(int8) + rData.(int8), nil
 	case datatypes.Int16Type:
-		return lData.(int16) + rData.(int16)
+		return lData.(int16) + rData.(int16), nil
 	case datatypes.Int32Type:
-		return lData.(int32) + rData.(int32)
+		return lData.(int32) + rData.(int32), nil
 	case datatypes.Int64Type:
-		return lData.(int64) + rData.(int64)
+		return lData.(int64) + rData.(int64), nil
 	case datatypes.UInt8Type:
-		return lData.(uint8) + rData.(uint8)
+		return lData.(uint8) + rData.(uint8), nil
 	case datatypes.UInt16Type:
-		return lData.(uint16) + rData.(uint16)
+		return lData.(uint16) + rData.(uint16), nil
 	case datatypes.UInt32Type:
-		return lData.(uint32) + rData.(uint32)
+		return lData.(uint32) + rData.(uint32), nil
 	case datatypes.UInt64Type:
-		return lData.(uint64) + rData.(uint64)
+		return lData.(uint64) + rData.(uint64), nil
 	case datatypes.FloatType:
-		return lData.(float32) + rData.(float32)
+		return lData.(float32) + rData.(float32), nil
 	case datatypes.DoubleType:
-		return lData.(float64) + rData.(float64)
+		return lData.(float64) + rData.(float64), nil
 	default:
-		panic(fmt.Sprintf("Unsupported data type in math expression: %s", arrowType))
+		return nil, datatypes.NewSchemaError("Unsupported data type in math expression: %s", arrowType)
 	}
 }
 
@@ -332,30 +385,30 @@ func NewAddExpr(l, r physicalplan.PhysicalExpr) MathExpr {
 	return MathExpr{BinaryExpr{"add", "+", l, r, AddEvalFunc}}
 }
 
-var SubtractEvalFunc = func(lData, rData interface{}, arrowType arrow.DataType) interface{} {
+var SubtractEvalFunc = func(lData, rData interface{}, arrowType arrow.DataType) (interface{}, error) {
 	switch arrowType {
 	case datatypes.Int8Type:
-		return lData.(int8) - rData.(int8)
+		return lData.(int8) - rData.(int8), nil
 	case datatypes.Int16Type:
-		return lData.(int16) - rData.(int16)
+		return lData.(int16) - rData.(int16), nil
 	case datatypes.Int32Type:
-		return lData.(int32) - rData.(int32)
+		return lData.(int32) - rData.(int32), nil
 	case datatypes.Int64Type:
-		return lData.(int64) - rData.(int64)
+		return lData.(int64) - rData.(int64), nil
 	case datatypes.UInt8Type:
-		return lData.(uint8) - rData.(uint8)
+		return lData.(uint8) - rData.(uint8), nil
 	case datatypes.UInt16Type:
-		return lData.(uint16) - rData.(uint16)
+		return lData.(uint16) - rData.(uint16), nil
 	case datatypes.UInt32Type:
-		return lData.(uint32) - rData.(uint32)
+		return lData.(uint32) - rData.(uint32), nil
 	case datatypes.UInt64Type:
-		return lData.(uint64) - rData.(uint64)
+		return lData.(uint64) - rData.(uint64), nil
 	case datatypes.FloatType:
-		return lData.(float32) - rData.(float32)
+		return lData.(float32) - rData.(float32), nil
 	case datatypes.DoubleType:
-		return lData.(float64) - rData.(float64)
+		return lData.(float64) - rData.(float64), nil
 	default:
-		panic(fmt.Sprintf("Unsupported data type in math expression: %s", arrowType))
+		return nil, datatypes.NewSchemaError("Unsupported data type in math expression: %s", arrowType)
 	}
 }
 
@@ -363,30 +416,30 @@ func NewSubtractExpr(l, r physicalplan.PhysicalExpr) MathExpr {
 	return MathExpr{BinaryExpr{"subtract", "-", l, r, SubtractEvalFunc}}
 }
 
-var MultiplyEvalFunc = func(lData, rData interface{}, arrowType arrow.DataType) interface{} {
+var MultiplyEvalFunc = func(lData, rData interface{}, arrowType arrow.DataType) (interface{}, error) {
 	switch arrowType {
 	case datatypes.Int8Type:
-		return lData.(int8) * rData.(int8)
+		return lData.(int8) * rData.(int8), nil
 	case datatypes.Int16Type:
-		return lData.(int16) * rData.(int16)
+		return lData.(int16) * rData.(int16), nil
 	case datatypes.Int32Type:
-		return lData.(int32) * rData.(int32)
+		return lData.(int32) * rData.(int32), nil
 	case datatypes.Int64Type:
-		return lData.(int64) * rData.(int64)
+		return lData.(int64) * rData.(int64), nil
 	case datatypes.UInt8Type:
-		return lData.(uint8) * rData.(uint8)
+		return lData.(uint8) * rData.(uint8), nil
 	case datatypes.UInt16Type:
-		return lData.(uint16) * rData.(uint16)
+		return lData.(uint16) * rData.(uint16), nil
 	case datatypes.UInt32Type:
-		return lData.(uint32) * rData.(uint32)
+		return lData.(uint32) * rData.(uint32), nil
 	case datatypes.UInt64Type:
-		return lData.(uint64) * rData.(uint64)
+		return lData.(uint64) * rData.(uint64), nil
 	case datatypes.FloatType:
-		return lData.(float32) * rData.(float32)
+		return lData.(float32) * rData.(float32), nil
 	case datatypes.DoubleType:
-		return lData.(float64) * rData.(float64)
+		return lData.(float64) * rData.(float64), nil
 	default:
-		panic(fmt.Sprintf("Unsupported data type in math expression: %s", arrowType))
+		return nil, datatypes.NewSchemaError("Unsupported data type in math expression: %s", arrowType)
 	}
 }
 
@@ -394,33 +447,94 @@ func NewMultiplyExpr(l, r physicalplan.PhysicalExpr) MathExpr {
 	return MathExpr{BinaryExpr{"multiply", "*", l, r, MultiplyEvalFunc}}
 }
 
-var DivideEvalFunc = func(lData, rData interface{}, arrowType arrow.DataType) interface{} {
+var DivideEvalFunc = func(lData, rData interface{}, arrowType arrow.DataType) (interface{}, error) {
+	if isZeroInteger(rData) {
+		return nil, ErrDivisionByZero
+	}
 	switch arrowType {
 	case datatypes.Int8Type:
-		return lData.(int8) / rData.(int8)
+		return lData.(int8) / rData.(int8), nil
 	case datatypes.Int16Type:
-		return lData.(int16) / rData.(int16)
+		return lData.(int16) / rData.(int16), nil
 	case datatypes.Int32Type:
-		return lData.(int32) / rData.(int32)
+		return lData.(int32) / rData.(int32), nil
 	case datatypes.Int64Type:
-		return lData.(int64) / rData.(int64)
+		return lData.(int64) / rData.(int64), nil
 	case datatypes.UInt8Type:
-		return lData.(uint8) / rData.(uint8)
+		return lData.(uint8) / rData.(uint8), nil
 	case datatypes.UInt16Type:
-		return lData.(uint16) / rData.(uint16)
+		return lData.(uint16) / rData.(uint16), nil
 	case datatypes.UInt32Type:
-		return lData.(uint32) / rData.(uint32)
+		return lData.(uint32) / rData.(uint32), nil
 	case datatypes.UInt64Type:
-		return lData.(uint64) / rData.(uint64)
+		return lData.(uint64) / rData.(uint64), nil
 	case datatypes.FloatType:
-		return lData.(float32) / rData.(float32)
+		return lData.(float32) / rData.(float32), nil
 	case datatypes.DoubleType:
-		return lData.(float64) / rData.(float64)
+		return lData.(float64) / rData.(float64), nil
 	default:
-		panic(fmt.Sprintf("Unsupported data type in math expression: %s", arrowType))
+		return nil, datatypes.NewSchemaError("Unsupported data type in math expression: %s", arrowType)
 	}
 }
 
 func NewDivideExpr(l, r physicalplan.PhysicalExpr) MathExpr {
 	return MathExpr{BinaryExpr{"divide", "/", l, r, DivideEvalFunc}}
 }
+
+// ModulusEvalFunc returns the remainder with the sign of the dividend, like Go and most SQL databases
+var ModulusEvalFunc = func(lData, rData interface{}, arrowType arrow.DataType) (interface{}, error) {
+	if isZeroInteger(rData) {
+		return nil, ErrDivisionByZero
+	}
+	switch arrowType {
+	case datatypes.Int8Type:
+		return lData.(int8) % rData.(int8), nil
+	case datatypes.Int16Type:
+		return lData.(int16) % rData.(int16), nil
+	case datatypes.Int32Type:
+		return lData.(int32) % rData.(int32), nil
+	case datatypes.Int64Type:
+		return lData.(int64) % rData.(int64), nil
+	case datatypes.UInt8Type:
+		return lData.(uint8) % rData.(uint8), nil
+	case datatypes.UInt16Type:
+		return lData.(uint16) % rData.(uint16), nil
+	case datatypes.UInt32Type:
+		return lData.(uint32) % rData.(uint32), nil
+	case datatypes.UInt64Type:
+		return lData.(uint64) % rData.(uint64), nil
+	case datatypes.FloatType:
+		return float32(math.Mod(float64(lData.(float32)), float64(rData.(float32)))), nil
+	case datatypes.DoubleType:
+		return math.Mod(lData.(float64), rData.(float64)), nil
+	default:
+		return nil, datatypes.NewSchemaError("Unsupported data type in math expression: %s", arrowType)
+	}
+}
+
+func NewModulusExpr(l, r physicalplan.PhysicalExpr) MathExpr {
+	return MathExpr{BinaryExpr{"modulus", "%", l, r, ModulusEvalFunc}}
+}
+
+func isZeroInteger(data interface{}) bool {
+	switch v := data.(type) {
+	case int8:
+		return v == 0
+	case int16:
+		return v == 0
+	case int32:
+		return v == 0
+	case int64:
+		return v == 0
+	case uint8:
+		return v == 0
+	case uint16:
+		return v == 0
+	case uint32:
+		return v == 0
+	case uint64:
+		return v == 0
+	default:
+		return false
+	}
+}
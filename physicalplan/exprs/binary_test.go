@@ -1,6 +1,7 @@
 package exprs
 
 import (
+	"errors"
 	"fmt"
 	"github.com/apache/arrow/go/v6/arrow/memory"
 	"github.com/stretchr/testify/require"
@@ -30,7 +31,8 @@ func TestBooleanExpr_AndExpr(t *testing.T) {
 	andExpr := NewAndExpr(eqExpr, gtExpr)
 
 	expect := []bool{true, false, false}
-	evalRes := andExpr.Evaluate(recordBatch)
+	evalRes, err := andExpr.Evaluate(recordBatch)
+	require.NoError(t, err)
 	for i := 0; i < len(expect); i++ {
 		require.Equal(t, expect[i], evalRes.GetValue(i), fmt.Sprintf("current index : %d", i))
 	}
@@ -58,8 +60,52 @@ func TestMathExpr_Expr(t *testing.T) {
 	lastExpr := NewSubtractExpr(multiplyExpr, NewLiteralLongExpr(1))
 
 	expect := []int64{3, 7, 11}
-	evalRes := lastExpr.Evaluate(recordBatch)
+	evalRes, err := lastExpr.Evaluate(recordBatch)
+	require.NoError(t, err)
 	for i := 0; i < len(expect); i++ {
 		require.Equal(t, expect[i], evalRes.GetValue(i), fmt.Sprintf("current index : %d", i))
 	}
 }
+
+func TestMathExpr_modulus(t *testing.T) {
+	iBuilder := datatypes.NewArrowArrayBuilder(memory.NewGoAllocator(), datatypes.Int64Type)
+	iBuilder.AppendValues(int64(7), int64(-7), nil)
+	dBuilder := datatypes.NewArrowArrayBuilder(memory.NewGoAllocator(), datatypes.DoubleType)
+	dBuilder.AppendValues(7.5, -7.5, 1.0)
+	recordBatch := datatypes.RecordBatch{
+		Schema: datatypes.Schema{Fields: []datatypes.Field{
+			{Name: "i", DataType: datatypes.Int64Type}, {Name: "d", DataType: datatypes.DoubleType},
+		}},
+		Fields: []datatypes.ColumnArray{iBuilder.Build(), dBuilder.Build()},
+	}
+
+	// the remainder has the sign of the dividend
+	res, err := NewModulusExpr(NewColumnIndexExpr(0), NewLiteralLongExpr(3)).Evaluate(recordBatch)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{int64(1), int64(-1), nil}, []interface{}{res.GetValue(0), res.GetValue(1), res.GetValue(2)})
+
+	res, err = NewModulusExpr(NewColumnIndexExpr(1), NewLiteralDoubleExpr(2)).Evaluate(recordBatch)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{1.5, -1.5, 1.0}, []interface{}{res.GetValue(0), res.GetValue(1), res.GetValue(2)})
+	require.Equal(t, "#1 % 2", NewModulusExpr(NewColumnIndexExpr(1), NewLiteralDoubleExpr(2)).String())
+}
+
+func TestMathExpr_divide_by_zero(t *testing.T) {
+	aBuilder := datatypes.NewArrowArrayBuilder(memory.NewGoAllocator(), datatypes.Int64Type)
+	schema := datatypes.Schema{Fields: []datatypes.Field{{Name: "Num", DataType: datatypes.Int64Type}}}
+	aBuilder.AppendValues(int64(1), int64(2))
+	recordBatch := datatypes.RecordBatch{
+		Schema: schema,
+		Fields: []datatypes.ColumnArray{aBuilder.Build()},
+	}
+
+	_, err := NewDivideExpr(NewColumnIndexExpr(0), NewLiteralLongExpr(0)).Evaluate(recordBatch)
+	require.True(t, errors.Is(err, ErrDivisionByZero))
+
+	_, err = NewModulusExpr(NewColumnIndexExpr(0), NewLiteralLongExpr(0)).Evaluate(recordBatch)
+	require.True(t, errors.Is(err, ErrDivisionByZero))
+
+	_, err = NewAddExpr(NewColumnIndexExpr(1), NewLiteralLongExpr(1)).Evaluate(recordBatch)
+	var schemaErr *datatypes.SchemaError
+	require.True(t, errors.As(err, &schemaErr))
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/apache/arrow/go/v6/arrow"
 	"github.com/apache/arrow/go/v6/arrow/memory"
+	"math"
 	"query-engine/datatypes"
 	"query-engine/physicalplan"
 	"strconv"
@@ -20,121 +21,125 @@ func (c Cast) String() string {
 	return fmt.Sprintf("CAST(%s AS %s)", c.expr, c.dType)
 }
 
-func (c Cast) Evaluate(input datatypes.RecordBatch) datatypes.ColumnArray {
-	columnArray := c.expr.Evaluate(input)
+// Evaluate casts every value of the input column, a value which can't be cast fails with a CastError
+func (c Cast) Evaluate(input datatypes.RecordBatch) (datatypes.ColumnArray, error) {
+	columnArray, err := c.expr.Evaluate(input)
+	if err != nil {
+		return nil, err
+	}
+	switch c.dType {
+	case datatypes.Int8Type, datatypes.Int64Type, datatypes.FloatType, datatypes.DoubleType, datatypes.StringType:
+	default:
+		return nil, &datatypes.CastError{Value: columnArray.GetType(), DataType: c.dType}
+	}
+
 	builder := datatypes.NewArrowArrayBuilder(memory.NewGoAllocator(), c.dType)
+	for i := 0; i < columnArray.Size(); i++ {
+		v := columnArray.GetValue(i)
+		if v == nil {
+			builder.Append(nil)
+			continue
+		}
+		castValue, err := c.castValue(v)
+		if err != nil {
+			return nil, err
+		}
+		builder.Append(castValue)
+	}
+	return builder.Build(), nil
+}
 
+func (c Cast) castValue(v interface{}) (interface{}, error) {
 	switch c.dType {
 	case datatypes.Int8Type:
-		for i := 0; i < columnArray.Size(); i++ {
-			v := columnArray.GetValue(i)
-			if v == nil {
-				builder.Append(nil)
-			} else {
-				var castValue int8
-				switch vv := v.(type) {
-				case int, int16, int32, int64:
-					castValue = v.(int8)
-				case string:
-					castValue = int8(c.strToInt64(vv))
-				default:
-					panic(fmt.Sprintf("Cannot cast value:%v to int8", vv))
-				}
-				builder.Append(castValue)
-			}
-		}
+		n, err := c.toInt64(v, 8)
+		return int8(n), err
 	case datatypes.Int64Type:
-		for i := 0; i < columnArray.Size(); i++ {
-			v := columnArray.GetValue(i)
-			if v == nil {
-				builder.Append(nil)
-			} else {
-				var castValue int64
-				switch vv := v.(type) {
-				case int, int8, int16, int32:
-					castValue = v.(int64)
-				case string:
-					castValue = int64(c.strToInt64(vv))
-				default:
-					panic(fmt.Sprintf("Cannot cast value:%v to int64", vv))
-				}
-				builder.Append(castValue)
-			}
-		}
+		return c.toInt64(v, 64)
 	case datatypes.FloatType:
-		for i := 0; i < columnArray.Size(); i++ {
-			v := columnArray.GetValue(i)
-			if v == nil {
-				builder.Append(nil)
-			} else {
-				var castValue float32
-				switch vv := v.(type) {
-				case int, int8, int16, int32:
-					castValue = v.(float32)
-				case string:
-					castValue = c.strToFloat32(vv)
-				default:
-					panic(fmt.Sprintf("Cannot cast value:%v to float", vv))
-				}
-				builder.Append(castValue)
-			}
-		}
+		f, err := c.toFloat64(v, 32)
+		return float32(f), err
 	case datatypes.DoubleType:
-		for i := 0; i < columnArray.Size(); i++ {
-			v := columnArray.GetValue(i)
-			if v == nil {
-				builder.Append(nil)
-			} else {
-				var castValue float64
-				switch vv := v.(type) {
-				case int, int8, int16, int32:
-					castValue = v.(float64)
-				case string:
-					castValue = c.strToFloat64(vv)
-				default:
-					panic(fmt.Sprintf("Cannot cast value:%v to double", vv))
-				}
-				builder.Append(castValue)
-			}
-		}
-	case datatypes.StringType:
-		for i := 0; i < columnArray.Size(); i++ {
-			v := columnArray.GetValue(i)
-			if v == nil {
-				builder.Append(nil)
-			} else {
-				builder.Append(fmt.Sprint(v))
-			}
-		}
+		return c.toFloat64(v, 64)
 	default:
-		panic(fmt.Sprintf("Unsupport type:%v cast", c.dType))
+		return fmt.Sprint(v), nil
 	}
-
-	return builder.Build()
 }
 
-func (c Cast) strToInt64(v string) int {
-	vv, err := strconv.Atoi(v)
-	if err != nil {
-		panic(fmt.Sprintf("Cast %s to int err: %v", v, err))
+// toInt64 converts a numeric value or parses a string, the result must fit in bitSize bits
+func (c Cast) toInt64(v interface{}, bitSize int) (int64, error) {
+	var n int64
+	switch vv := v.(type) {
+	case int8:
+		n = int64(vv)
+	case int16:
+		n = int64(vv)
+	case int32:
+		n = int64(vv)
+	case int64:
+		n = vv
+	case uint8:
+		n = int64(vv)
+	case uint16:
+		n = int64(vv)
+	case uint32:
+		n = int64(vv)
+	case uint64:
+		if vv > math.MaxInt64 {
+			return 0, &datatypes.CastError{Value: v, DataType: c.dType, Err: strconv.ErrRange}
+		}
+		n = int64(vv)
+	case float32:
+		n = int64(vv)
+	case float64:
+		n = int64(vv)
+	case string:
+		parsed, err := strconv.ParseInt(vv, 10, bitSize)
+		if err != nil {
+			return 0, &datatypes.CastError{Value: v, DataType: c.dType, Err: err}
+		}
+		return parsed, nil
+	default:
+		return 0, &datatypes.CastError{Value: v, DataType: c.dType}
 	}
-	return vv
-}
-
-func (c Cast) strToFloat32(v string) float32 {
-	vv, err := strconv.ParseFloat(v, 32)
-	if err != nil {
-		panic(fmt.Sprintf("Cast %s to float32 err: %v", v, err))
+	if bitSize == 8 && (n < math.MinInt8 || n > math.MaxInt8) {
+		return 0, &datatypes.CastError{Value: v, DataType: c.dType, Err: strconv.ErrRange}
 	}
-	return float32(vv)
+	return n, nil
 }
 
-func (c Cast) strToFloat64(v string) float64 {
-	vv, err := strconv.ParseFloat(v, 64)
-	if err != nil {
-		panic(fmt.Sprintf("Cast %s to float64 err: %v", v, err))
+// toFloat64 converts a numeric value or parses a string as a float of bitSize bits
+func (c Cast) toFloat64(v interface{}, bitSize int) (float64, error) {
+	switch vv := v.(type) {
+	case int8:
+		return float64(vv), nil
+	case int16:
+		return float64(vv), nil
+	case int32:
+		return float64(vv), nil
+	case int64:
+		return float64(vv), nil
+	case uint8:
+		return float64(vv), nil
+	case uint16:
+		return float64(vv), nil
+	case uint32:
+		return float64(vv), nil
+	case uint64:
+		return float64(vv), nil
+	case float32:
+		return float64(vv), nil
+	case float64:
+		return vv, nil
+	case string:
+		f, err := strconv.ParseFloat(vv, bitSize)
+		if err != nil {
+			return 0, &datatypes.CastError{Value: v, DataType: c.dType, Err: err}
+		}
+		return f, nil
+	default:
+		return 0, &datatypes.CastError{Value: v, DataType: c.dType}
 	}
-	return vv
 }
 
 func NewCastExpr(expr physicalplan.PhysicalExpr, dType arrow.DataType) Cast {
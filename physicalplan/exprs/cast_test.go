@@ -1,6 +1,7 @@
 package exprs
 
 import (
+	"errors"
 	"github.com/apache/arrow/go/v6/arrow/memory"
 	"github.com/stretchr/testify/require"
 	"query-engine/datatypes"
@@ -17,7 +18,8 @@ func TestCastExpr_int8_to_string(t *testing.T) {
 	}
 
 	expr := NewCastExpr(NewColumnIndexExpr(0), datatypes.StringType)
-	result := expr.Evaluate(recordBatch)
+	result, err := expr.Evaluate(recordBatch)
+	require.NoError(t, err)
 
 	expect := []string{"1", "2", "-1"}
 	for i := 0; i < len(expect); i++ {
@@ -35,10 +37,28 @@ func TestCastExpr_string_to_int8(t *testing.T) {
 	}
 
 	expr := NewCastExpr(NewColumnIndexExpr(0), datatypes.Int8Type)
-	result := expr.Evaluate(recordBatch)
+	result, err := expr.Evaluate(recordBatch)
+	require.NoError(t, err)
 
 	expect := []int8{int8(1), int8(2), int8(-1)}
 	for i := 0; i < len(expect); i++ {
 		require.Equal(t, expect[i], result.GetValue(i))
 	}
 }
+
+func TestCastExpr_invalid_string_to_int8(t *testing.T) {
+	aBuilder := datatypes.NewArrowArrayBuilder(memory.NewGoAllocator(), datatypes.StringType)
+	schema := datatypes.Schema{Fields: []datatypes.Field{{Name: "Id", DataType: datatypes.StringType}}}
+	aBuilder.AppendValues("1", "300", "a")
+	recordBatch := datatypes.RecordBatch{
+		Schema: schema,
+		Fields: []datatypes.ColumnArray{aBuilder.Build()},
+	}
+
+	expr := NewCastExpr(NewColumnIndexExpr(0), datatypes.Int8Type)
+	_, err := expr.Evaluate(recordBatch)
+	var castErr *datatypes.CastError
+	require.True(t, errors.As(err, &castErr))
+	require.Equal(t, "300", castErr.Value)
+	require.Equal(t, datatypes.Int8Type, castErr.DataType)
+}
@@ -12,8 +12,11 @@ type ColumnIndexExpr struct {
 	index int
 }
 
-func (c ColumnIndexExpr) Evaluate(input datatypes.RecordBatch) datatypes.ColumnArray {
-	return input.Field(c.index)
+func (c ColumnIndexExpr) Evaluate(input datatypes.RecordBatch) (datatypes.ColumnArray, error) {
+	if c.index < 0 || c.index >= input.ColumnCount() {
+		return nil, datatypes.NewSchemaError("Column index %d out of range of %d columns", c.index, input.ColumnCount())
+	}
+	return input.Field(c.index), nil
 }
 
 func (c ColumnIndexExpr) String() string {
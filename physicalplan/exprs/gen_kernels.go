@@ -0,0 +1,187 @@
+//go:build ignore
+// +build ignore
+
+// gen_kernels generates kernels.gen.go, the type-specialised loops of the binary expression kernels.
+package main
+
+import (
+	"bytes"
+	"go/format"
+	"log"
+	"os"
+	"text/template"
+)
+
+type kernelType struct {
+	// Name is the arrow array name, like Int64 for array.Int64
+	Name string
+	// GoType is the type of the values
+	GoType string
+	// DataType is the datatypes variable of the arrow type
+	DataType string
+	// Integer divisions fail on a zero divisor
+	Integer bool
+}
+
+var numericTypes = []kernelType{
+	{Name: "Int8", GoType: "int8", DataType: "Int8Type", Integer: true},
+	{Name: "Int16", GoType: "int16", DataType: "Int16Type", Integer: true},
+	{Name: "Int32", GoType: "int32", DataType: "Int32Type", Integer: true},
+	{Name: "Int64", GoType: "int64", DataType: "Int64Type", Integer: true},
+	{Name: "Uint8", GoType: "uint8", DataType: "UInt8Type", Integer: true},
+	{Name: "Uint16", GoType: "uint16", DataType: "UInt16Type", Integer: true},
+	{Name: "Uint32", GoType: "uint32", DataType: "UInt32Type", Integer: true},
+	{Name: "Uint64", GoType: "uint64", DataType: "UInt64Type", Integer: true},
+	{Name: "Float32", GoType: "float32", DataType: "FloatType"},
+	{Name: "Float64", GoType: "float64", DataType: "DoubleType"},
+}
+
+var stringType = kernelType{Name: "String", GoType: "string", DataType: "StringType"}
+
+var compareOps = []struct{ Op, GoOp string }{
+	{"=", "=="}, {"!=", "!="}, {"<", "<"}, {"<=", "<="}, {">", ">"}, {">=", ">="},
+}
+
+var mathOps = []string{"+", "-", "*"}
+
+const kernelsTemplate = `// Code generated by gen_kernels.go. DO NOT EDIT.
+
+package exprs
+
+import (
+	"github.com/apache/arrow/go/v6/arrow/array"
+	"github.com/apache/arrow/go/v6/arrow/memory"
+	"query-engine/datatypes"
+)
+
+// compareKernel compares two columns of the same type, ok is false when there is no kernel for the type or op
+func compareKernel(op string, l, r datatypes.ColumnArray) (result datatypes.ColumnArray, ok bool) {
+	var out []bool
+	switch l.GetType() {
+{{- range .Compare}}
+	case datatypes.{{.DataType}}:
+		lv, lok := {{.GoType}}Values(l)
+		rv, rok := {{.GoType}}Values(r)
+		if !lok || !rok {
+			return nil, false
+		}
+		out, ok = compare{{.Name}}(op, lv, rv)
+{{- end}}
+	}
+	if !ok {
+		return nil, false
+	}
+	return newBooleanColumn(out, validity(l, r)), true
+}
+
+// mathKernel applies an arithmetic operator to two columns of the same type,
+// ok is false when there is no kernel for the type or op
+func mathKernel(op string, l, r datatypes.ColumnArray) (result datatypes.ColumnArray, ok bool, err error) {
+	switch l.GetType() {
+{{- range .Numeric}}
+	case datatypes.{{.DataType}}:
+		lv, lok := {{.GoType}}Values(l)
+		rv, rok := {{.GoType}}Values(r)
+		if !lok || !rok {
+			return nil, false, nil
+		}
+		return math{{.Name}}(op, lv, rv, validity(l, r))
+{{- end}}
+	}
+	return nil, false, nil
+}
+{{range .Numeric}}
+// {{.GoType}}Values returns the values of a {{.GoType}} column, a literal is repeated for every row
+func {{.GoType}}Values(c datatypes.ColumnArray) ([]{{.GoType}}, bool) {
+	switch v := c.(type) {
+	case *datatypes.ArrowFieldArray:
+		arr, ok := v.Array().(*array.{{.Name}})
+		if !ok {
+			return nil, false
+		}
+		return arr.{{.Name}}Values(), true
+	case datatypes.LiteralValueArray:
+		value, ok := v.GetValue(0).({{.GoType}})
+		if !ok {
+			return nil, false
+		}
+		values := make([]{{.GoType}}, v.Size())
+		for i := range values {
+			values[i] = value
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+func math{{.Name}}(op string, l, r []{{.GoType}}, valid []bool) (datatypes.ColumnArray, bool, error) {
+	out := make([]{{.GoType}}, len(l))
+	r = r[:len(l)]
+	switch op {
+{{- range $.MathOps}}
+	case "{{.}}":
+		for i, x := range l {
+			out[i] = x {{.}} r[i]
+		}
+{{- end}}
+	case "/":
+		for i, x := range l {
+{{- if .Integer}}
+			if r[i] == 0 {
+				// the values of null rows are undefined, only a non-null zero fails
+				if valid == nil || valid[i] {
+					return nil, true, ErrDivisionByZero
+				}
+				continue
+			}
+{{- end}}
+			out[i] = x / r[i]
+		}
+	default:
+		return nil, false, nil
+	}
+	builder := array.New{{.Name}}Builder(memory.NewGoAllocator())
+	defer builder.Release()
+	builder.AppendValues(out, valid)
+	return datatypes.NewArrowFieldArray(builder.NewArray()), true, nil
+}
+{{end}}
+{{- range .Compare}}
+func compare{{.Name}}(op string, l, r []{{.GoType}}) ([]bool, bool) {
+	out := make([]bool, len(l))
+	r = r[:len(l)]
+	switch op {
+{{- range $.CompareOps}}
+	case "{{.Op}}":
+		for i, x := range l {
+			out[i] = x {{.GoOp}} r[i]
+		}
+{{- end}}
+	default:
+		return nil, false
+	}
+	return out, true
+}
+{{end -}}
+`
+
+func main() {
+	tmpl := template.Must(template.New("kernels").Parse(kernelsTemplate))
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, map[string]interface{}{
+		"Numeric":    numericTypes,
+		"Compare":    append(append([]kernelType{}, numericTypes...), stringType),
+		"CompareOps": compareOps,
+		"MathOps":    mathOps,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatalf("format generated kernels: %v\n%s", err, buf.String())
+	}
+	if err := os.WriteFile("kernels.gen.go", src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,1125 @@
+// Code generated by gen_kernels.go. DO NOT EDIT.
+
+package exprs
+
+import (
+	"github.com/apache/arrow/go/v6/arrow/array"
+	"github.com/apache/arrow/go/v6/arrow/memory"
+	"query-engine/datatypes"
+)
+
+// compareKernel compares two columns of the same type, ok is false when there is no kernel for the type or op
+func compareKernel(op string, l, r datatypes.ColumnArray) (result datatypes.ColumnArray, ok bool) {
+	var out []bool
+	switch l.GetType() {
+	case datatypes.Int8Type:
+		lv, lok := int8Values(l)
+		rv, rok := int8Values(r)
+		if !lok || !rok {
+			return nil, false
+		}
+		out, ok = compareInt8(op, lv, rv)
+	case datatypes.Int16Type:
+		lv, lok := int16Values(l)
+		rv, rok := int16Values(r)
+		if !lok || !rok {
+			return nil, false
+		}
+		out, ok = compareInt16(op, lv, rv)
+	case datatypes.Int32Type:
+		lv, lok := int32Values(l)
+		rv, rok := int32Values(r)
+		if !lok || !rok {
+			return nil, false
+		}
+		out, ok = compareInt32(op, lv, rv)
+	case datatypes.Int64Type:
+		lv, lok := int64Values(l)
+		rv, rok := int64Values(r)
+		if !lok || !rok {
+			return nil, false
+		}
+		out, ok = compareInt64(op, lv, rv)
+	case datatypes.UInt8Type:
+		lv, lok := uint8Values(l)
+		rv, rok := uint8Values(r)
+		if !lok || !rok {
+			return nil, false
+		}
+		out, ok = compareUint8(op, lv, rv)
+	case datatypes.UInt16Type:
+		lv, lok := uint16Values(l)
+		rv, rok := uint16Values(r)
+		if !lok || !rok {
+			return nil, false
+		}
+		out, ok = compareUint16(op, lv, rv)
+	case datatypes.UInt32Type:
+		lv, lok := uint32Values(l)
+		rv, rok := uint32Values(r)
+		if !lok || !rok {
+			return nil, false
+		}
+		out, ok = compareUint32(op, lv, rv)
+	case datatypes.UInt64Type:
+		lv, lok := uint64Values(l)
+		rv, rok := uint64Values(r)
+		if !lok || !rok {
+			return nil, false
+		}
+		out, ok = compareUint64(op, lv, rv)
+	case datatypes.FloatType:
+		lv, lok := float32Values(l)
+		rv, rok := float32Values(r)
+		if !lok || !rok {
+			return nil, false
+		}
+		out, ok = compareFloat32(op, lv, rv)
+	case datatypes.DoubleType:
+		lv, lok := float64Values(l)
+		rv, rok := float64Values(r)
+		if !lok || !rok {
+			return nil, false
+		}
+		out, ok = compareFloat64(op, lv, rv)
+	case datatypes.StringType:
+		lv, lok := stringValues(l)
+		rv, rok := stringValues(r)
+		if !lok || !rok {
+			return nil, false
+		}
+		out, ok = compareString(op, lv, rv)
+	}
+	if !ok {
+		return nil, false
+	}
+	return newBooleanColumn(out, validity(l, r)), true
+}
+
+// mathKernel applies an arithmetic operator to two columns of the same type,
+// ok is false when there is no kernel for the type or op
+func mathKernel(op string, l, r datatypes.ColumnArray) (result datatypes.ColumnArray, ok bool, err error) {
+	switch l.GetType() {
+	case datatypes.Int8Type:
+		lv, lok := int8Values(l)
+		rv, rok := int8Values(r)
+		if !lok || !rok {
+			return nil, false, nil
+		}
+		return mathInt8(op, lv, rv, validity(l, r))
+	case datatypes.Int16Type:
+		lv, lok := int16Values(l)
+		rv, rok := int16Values(r)
+		if !lok || !rok {
+			return nil, false, nil
+		}
+		return mathInt16(op, lv, rv, validity(l, r))
+	case datatypes.Int32Type:
+		lv, lok := int32Values(l)
+		rv, rok := int32Values(r)
+		if !lok || !rok {
+			return nil, false, nil
+		}
+		return mathInt32(op, lv, rv, validity(l, r))
+	case datatypes.Int64Type:
+		lv, lok := int64Values(l)
+		rv, rok := int64Values(r)
+		if !lok || !rok {
+			return nil, false, nil
+		}
+		return mathInt64(op, lv, rv, validity(l, r))
+	case datatypes.UInt8Type:
+		lv, lok := uint8Values(l)
+		rv, rok := uint8Values(r)
+		if !lok || !rok {
+			return nil, false, nil
+		}
+		return mathUint8(op, lv, rv, validity(l, r))
+	case datatypes.UInt16Type:
+		lv, lok := uint16Values(l)
+		rv, rok := uint16Values(r)
+		if !lok || !rok {
+			return nil, false, nil
+		}
+		return mathUint16(op, lv, rv, validity(l, r))
+	case datatypes.UInt32Type:
+		lv, lok := uint32Values(l)
+		rv, rok := uint32Values(r)
+		if !lok || !rok {
+			return nil, false, nil
+		}
+		return mathUint32(op, lv, rv, validity(l, r))
+	case datatypes.UInt64Type:
+		lv, lok := uint64Values(l)
+		rv, rok := uint64Values(r)
+		if !lok || !rok {
+			return nil, false, nil
+		}
+		return mathUint64(op, lv, rv, validity(l, r))
+	case datatypes.FloatType:
+		lv, lok := float32Values(l)
+		rv, rok := float32Values(r)
+		if !lok || !rok {
+			return nil, false, nil
+		}
+		return mathFloat32(op, lv, rv, validity(l, r))
+	case datatypes.DoubleType:
+		lv, lok := float64Values(l)
+		rv, rok := float64Values(r)
+		if !lok || !rok {
+			return nil, false, nil
+		}
+		return mathFloat64(op, lv, rv, validity(l, r))
+	}
+	return nil, false, nil
+}
+
+// int8Values returns the values of a int8 column, a literal is repeated for every row
+func int8Values(c datatypes.ColumnArray) ([]int8, bool) {
+	switch v := c.(type) {
+	case *datatypes.ArrowFieldArray:
+		arr, ok := v.Array().(*array.Int8)
+		if !ok {
+			return nil, false
+		}
+		return arr.Int8Values(), true
+	case datatypes.LiteralValueArray:
+		value, ok := v.GetValue(0).(int8)
+		if !ok {
+			return nil, false
+		}
+		values := make([]int8, v.Size())
+		for i := range values {
+			values[i] = value
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+func mathInt8(op string, l, r []int8, valid []bool) (datatypes.ColumnArray, bool, error) {
+	out := make([]int8, len(l))
+	r = r[:len(l)]
+	switch op {
+	case "+":
+		for i, x := range l {
+			out[i] = x + r[i]
+		}
+	case "-":
+		for i, x := range l {
+			out[i] = x - r[i]
+		}
+	case "*":
+		for i, x := range l {
+			out[i] = x * r[i]
+		}
+	case "/":
+		for i, x := range l {
+			if r[i] == 0 {
+				// the values of null rows are undefined, only a non-null zero fails
+				if valid == nil || valid[i] {
+					return nil, true, ErrDivisionByZero
+				}
+				continue
+			}
+			out[i] = x / r[i]
+		}
+	default:
+		return nil, false, nil
+	}
+	builder := array.NewInt8Builder(memory.NewGoAllocator())
+	defer builder.Release()
+	builder.AppendValues(out, valid)
+	return datatypes.NewArrowFieldArray(builder.NewArray()), true, nil
+}
+
+// int16Values returns the values of a int16 column, a literal is repeated for every row
+func int16Values(c datatypes.ColumnArray) ([]int16, bool) {
+	switch v := c.(type) {
+	case *datatypes.ArrowFieldArray:
+		arr, ok := v.Array().(*array.Int16)
+		if !ok {
+			return nil, false
+		}
+		return arr.Int16Values(), true
+	case datatypes.LiteralValueArray:
+		value, ok := v.GetValue(0).(int16)
+		if !ok {
+			return nil, false
+		}
+		values := make([]int16, v.Size())
+		for i := range values {
+			values[i] = value
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+func mathInt16(op string, l, r []int16, valid []bool) (datatypes.ColumnArray, bool, error) {
+	out := make([]int16, len(l))
+	r = r[:len(l)]
+	switch op {
+	case "+":
+		for i, x := range l {
+			out[i] = x + r[i]
+		}
+	case "-":
+		for i, x := range l {
+			out[i] = x - r[i]
+		}
+	case "*":
+		for i, x := range l {
+			out[i] = x * r[i]
+		}
+	case "/":
+		for i, x := range l {
+			if r[i] == 0 {
+				// the values of null rows are undefined, only a non-null zero fails
+				if valid == nil || valid[i] {
+					return nil, true, ErrDivisionByZero
+				}
+				continue
+			}
+			out[i] = x / r[i]
+		}
+	default:
+		return nil, false, nil
+	}
+	builder := array.NewInt16Builder(memory.NewGoAllocator())
+	defer builder.Release()
+	builder.AppendValues(out, valid)
+	return datatypes.NewArrowFieldArray(builder.NewArray()), true, nil
+}
+
+// int32Values returns the values of a int32 column, a literal is repeated for every row
+func int32Values(c datatypes.ColumnArray) ([]int32, bool) {
+	switch v := c.(type) {
+	case *datatypes.ArrowFieldArray:
+		arr, ok := v.Array().(*array.Int32)
+		if !ok {
+			return nil, false
+		}
+		return arr.Int32Values(), true
+	case datatypes.LiteralValueArray:
+		value, ok := v.GetValue(0).(int32)
+		if !ok {
+			return nil, false
+		}
+		values := make([]int32, v.Size())
+		for i := range values {
+			values[i] = value
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+func mathInt32(op string, l, r []int32, valid []bool) (datatypes.ColumnArray, bool, error) {
+	out := make([]int32, len(l))
+	r = r[:len(l)]
+	switch op {
+	case "+":
+		for i, x := range l {
+			out[i] = x + r[i]
+		}
+	case "-":
+		for i, x := range l {
+			out[i] = x - r[i]
+		}
+	case "*":
+		for i, x := range l {
+			out[i] = x * r[i]
+		}
+	case "/":
+		for i, x := range l {
+			if r[i] == 0 {
+				// the values of null rows are undefined, only a non-null zero fails
+				if valid == nil || valid[i] {
+					return nil, true, ErrDivisionByZero
+				}
+				continue
+			}
+			out[i] = x / r[i]
+		}
+	default:
+		return nil, false, nil
+	}
+	builder := array.NewInt32Builder(memory.NewGoAllocator())
+	defer builder.Release()
+	builder.AppendValues(out, valid)
+	return datatypes.NewArrowFieldArray(builder.NewArray()), true, nil
+}
+
+// int64Values returns the values of a int64 column, a literal is repeated for every row
+func int64Values(c datatypes.ColumnArray) ([]int64, bool) {
+	switch v := c.(type) {
+	case *datatypes.ArrowFieldArray:
+		arr, ok := v.Array().(*array.Int64)
+		if !ok {
+			return nil, false
+		}
+		return arr.Int64Values(), true
+	case datatypes.LiteralValueArray:
+		value, ok := v.GetValue(0).(int64)
+		if !ok {
+			return nil, false
+		}
+		values := make([]int64, v.Size())
+		for i := range values {
+			values[i] = value
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+func mathInt64(op string, l, r []int64, valid []bool) (datatypes.ColumnArray, bool, error) {
+	out := make([]int64, len(l))
+	r = r[:len(l)]
+	switch op {
+	case "+":
+		for i, x := range l {
+			out[i] = x + r[i]
+		}
+	case "-":
+		for i, x := range l {
+			out[i] = x - r[i]
+		}
+	case "*":
+		for i, x := range l {
+			out[i] = x * r[i]
+		}
+	case "/":
+		for i, x := range l {
+			if r[i] == 0 {
+				// the values of null rows are undefined, only a non-null zero fails
+				if valid == nil || valid[i] {
+					return nil, true, ErrDivisionByZero
+				}
+				continue
+			}
+			out[i] = x / r[i]
+		}
+	default:
+		return nil, false, nil
+	}
+	builder := array.NewInt64Builder(memory.NewGoAllocator())
+	defer builder.Release()
+	builder.AppendValues(out, valid)
+	return datatypes.NewArrowFieldArray(builder.NewArray()), true, nil
+}
+
+// uint8Values returns the values of a uint8 column, a literal is repeated for every row
+func uint8Values(c datatypes.ColumnArray) ([]uint8, bool) {
+	switch v := c.(type) {
+	case *datatypes.ArrowFieldArray:
+		arr, ok := v.Array().(*array.Uint8)
+		if !ok {
+			return nil, false
+		}
+		return arr.Uint8Values(), true
+	case datatypes.LiteralValueArray:
+		value, ok := v.GetValue(0).(uint8)
+		if !ok {
+			return nil, false
+		}
+		values := make([]uint8, v.Size())
+		for i := range values {
+			values[i] = value
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+func mathUint8(op string, l, r []uint8, valid []bool) (datatypes.ColumnArray, bool, error) {
+	out := make([]uint8, len(l))
+	r = r[:len(l)]
+	switch op {
+	case "+":
+		for i, x := range l {
+			out[i] = x + r[i]
+		}
+	case "-":
+		for i, x := range l {
+			out[i] = x - r[i]
+		}
+	case "*":
+		for i, x := range l {
+			out[i] = x * r[i]
+		}
+	case "/":
+		for i, x := range l {
+			if r[i] == 0 {
+				// the values of null rows are undefined, only a non-null zero fails
+				if valid == nil || valid[i] {
+					return nil, true, ErrDivisionByZero
+				}
+				continue
+			}
+			out[i] = x / r[i]
+		}
+	default:
+		return nil, false, nil
+	}
+	builder := array.NewUint8Builder(memory.NewGoAllocator())
+	defer builder.Release()
+	builder.AppendValues(out, valid)
+	return datatypes.NewArrowFieldArray(builder.NewArray()), true, nil
+}
+
+// uint16Values returns the values of a uint16 column, a literal is repeated for every row
+func uint16Values(c datatypes.ColumnArray) ([]uint16, bool) {
+	switch v := c.(type) {
+	case *datatypes.ArrowFieldArray:
+		arr, ok := v.Array().(*array.Uint16)
+		if !ok {
+			return nil, false
+		}
+		return arr.Uint16Values(), true
+	case datatypes.LiteralValueArray:
+		value, ok := v.GetValue(0).(uint16)
+		if !ok {
+			return nil, false
+		}
+		values := make([]uint16, v.Size())
+		for i := range values {
+			values[i] = value
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+func mathUint16(op string, l, r []uint16, valid []bool) (datatypes.ColumnArray, bool, error) {
+	out := make([]uint16, len(l))
+	r = r[:len(l)]
+	switch op {
+	case "+":
+		for i, x := range l {
+			out[i] = x + r[i]
+		}
+	case "-":
+		for i, x := range l {
+			out[i] = x - r[i]
+		}
+	case "*":
+		for i, x := range l {
+			out[i] = x * r[i]
+		}
+	case "/":
+		for i, x := range l {
+			if r[i] == 0 {
+				// the values of null rows are undefined, only a non-null zero fails
+				if valid == nil || valid[i] {
+					return nil, true, ErrDivisionByZero
+				}
+				continue
+			}
+			out[i] = x / r[i]
+		}
+	default:
+		return nil, false, nil
+	}
+	builder := array.NewUint16Builder(memory.NewGoAllocator())
+	defer builder.Release()
+	builder.AppendValues(out, valid)
+	return datatypes.NewArrowFieldArray(builder.NewArray()), true, nil
+}
+
+// uint32Values returns the values of a uint32 column, a literal is repeated for every row
+func uint32Values(c datatypes.ColumnArray) ([]uint32, bool) {
+	switch v := c.(type) {
+	case *datatypes.ArrowFieldArray:
+		arr, ok := v.Array().(*array.Uint32)
+		if !ok {
+			return nil, false
+		}
+		return arr.Uint32Values(), true
+	case datatypes.LiteralValueArray:
+		value, ok := v.GetValue(0).(uint32)
+		if !ok {
+			return nil, false
+		}
+		values := make([]uint32, v.Size())
+		for i := range values {
+			values[i] = value
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+func mathUint32(op string, l, r []uint32, valid []bool) (datatypes.ColumnArray, bool, error) {
+	out := make([]uint32, len(l))
+	r = r[:len(l)]
+	switch op {
+	case "+":
+		for i, x := range l {
+			out[i] = x + r[i]
+		}
+	case "-":
+		for i, x := range l {
+			out[i] = x - r[i]
+		}
+	case "*":
+		for i, x := range l {
+			out[i] = x * r[i]
+		}
+	case "/":
+		for i, x := range l {
+			if r[i] == 0 {
+				// the values of null rows are undefined, only a non-null zero fails
+				if valid == nil || valid[i] {
+					return nil, true, ErrDivisionByZero
+				}
+				continue
+			}
+			out[i] = x / r[i]
+		}
+	default:
+		return nil, false, nil
+	}
+	builder := array.NewUint32Builder(memory.NewGoAllocator())
+	defer builder.Release()
+	builder.AppendValues(out, valid)
+	return datatypes.NewArrowFieldArray(builder.NewArray()), true, nil
+}
+
+// uint64Values returns the values of a uint64 column, a literal is repeated for every row
+func uint64Values(c datatypes.ColumnArray) ([]uint64, bool) {
+	switch v := c.(type) {
+	case *datatypes.ArrowFieldArray:
+		arr, ok := v.Array().(*array.Uint64)
+		if !ok {
+			return nil, false
+		}
+		return arr.Uint64Values(), true
+	case datatypes.LiteralValueArray:
+		value, ok := v.GetValue(0).(uint64)
+		if !ok {
+			return nil, false
+		}
+		values := make([]uint64, v.Size())
+		for i := range values {
+			values[i] = value
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+func mathUint64(op string, l, r []uint64, valid []bool) (datatypes.ColumnArray, bool, error) {
+	out := make([]uint64, len(l))
+	r = r[:len(l)]
+	switch op {
+	case "+":
+		for i, x := range l {
+			out[i] = x + r[i]
+		}
+	case "-":
+		for i, x := range l {
+			out[i] = x - r[i]
+		}
+	case "*":
+		for i, x := range l {
+			out[i] = x * r[i]
+		}
+	case "/":
+		for i, x := range l {
+			if r[i] == 0 {
+				// the values of null rows are undefined, only a non-null zero fails
+				if valid == nil || valid[i] {
+					return nil, true, ErrDivisionByZero
+				}
+				continue
+			}
+			out[i] = x / r[i]
+		}
+	default:
+		return nil, false, nil
+	}
+	builder := array.NewUint64Builder(memory.NewGoAllocator())
+	defer builder.Release()
+	builder.AppendValues(out, valid)
+	return datatypes.NewArrowFieldArray(builder.NewArray()), true, nil
+}
+
+// float32Values returns the values of a float32 column, a literal is repeated for every row
+func float32Values(c datatypes.ColumnArray) ([]float32, bool) {
+	switch v := c.(type) {
+	case *datatypes.ArrowFieldArray:
+		arr, ok := v.Array().(*array.Float32)
+		if !ok {
+			return nil, false
+		}
+		return arr.Float32Values(), true
+	case datatypes.LiteralValueArray:
+		value, ok := v.GetValue(0).(float32)
+		if !ok {
+			return nil, false
+		}
+		values := make([]float32, v.Size())
+		for i := range values {
+			values[i] = value
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+func mathFloat32(op string, l, r []float32, valid []bool) (datatypes.ColumnArray, bool, error) {
+	out := make([]float32, len(l))
+	r = r[:len(l)]
+	switch op {
+	case "+":
+		for i, x := range l {
+			out[i] = x + r[i]
+		}
+	case "-":
+		for i, x := range l {
+			out[i] = x - r[i]
+		}
+	case "*":
+		for i, x := range l {
+			out[i] = x * r[i]
+		}
+	case "/":
+		for i, x := range l {
+			out[i] = x / r[i]
+		}
+	default:
+		return nil, false, nil
+	}
+	builder := array.NewFloat32Builder(memory.NewGoAllocator())
+	defer builder.Release()
+	builder.AppendValues(out, valid)
+	return datatypes.NewArrowFieldArray(builder.NewArray()), true, nil
+}
+
+// float64Values returns the values of a float64 column, a literal is repeated for every row
+func float64Values(c datatypes.ColumnArray) ([]float64, bool) {
+	switch v := c.(type) {
+	case *datatypes.ArrowFieldArray:
+		arr, ok := v.Array().(*array.Float64)
+		if !ok {
+			return nil, false
+		}
+		return arr.Float64Values(), true
+	case datatypes.LiteralValueArray:
+		value, ok := v.GetValue(0).(float64)
+		if !ok {
+			return nil, false
+		}
+		values := make([]float64, v.Size())
+		for i := range values {
+			values[i] = value
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+func mathFloat64(op string, l, r []float64, valid []bool) (datatypes.ColumnArray, bool, error) {
+	out := make([]float64, len(l))
+	r = r[:len(l)]
+	switch op {
+	case "+":
+		for i, x := range l {
+			out[i] = x + r[i]
+		}
+	case "-":
+		for i, x := range l {
+			out[i] = x - r[i]
+		}
+	case "*":
+		for i, x := range l {
+			out[i] = x * r[i]
+		}
+	case "/":
+		for i, x := range l {
+			out[i] = x / r[i]
+		}
+	default:
+		return nil, false, nil
+	}
+	builder := array.NewFloat64Builder(memory.NewGoAllocator())
+	defer builder.Release()
+	builder.AppendValues(out, valid)
+	return datatypes.NewArrowFieldArray(builder.NewArray()), true, nil
+}
+
+func compareInt8(op string, l, r []int8) ([]bool, bool) {
+	out := make([]bool, len(l))
+	r = r[:len(l)]
+	switch op {
+	case "=":
+		for i, x := range l {
+			out[i] = x == r[i]
+		}
+	case "!=":
+		for i, x := range l {
+			out[i] = x != r[i]
+		}
+	case "<":
+		for i, x := range l {
+			out[i] = x < r[i]
+		}
+	case "<=":
+		for i, x := range l {
+			out[i] = x <= r[i]
+		}
+	case ">":
+		for i, x := range l {
+			out[i] = x > r[i]
+		}
+	case ">=":
+		for i, x := range l {
+			out[i] = x >= r[i]
+		}
+	default:
+		return nil, false
+	}
+	return out, true
+}
+
+func compareInt16(op string, l, r []int16) ([]bool, bool) {
+	out := make([]bool, len(l))
+	r = r[:len(l)]
+	switch op {
+	case "=":
+		for i, x := range l {
+			out[i] = x == r[i]
+		}
+	case "!=":
+		for i, x := range l {
+			out[i] = x != r[i]
+		}
+	case "<":
+		for i, x := range l {
+			out[i] = x < r[i]
+		}
+	case "<=":
+		for i, x := range l {
+			out[i] = x <= r[i]
+		}
+	case ">":
+		for i, x := range l {
+			out[i] = x > r[i]
+		}
+	case ">=":
+		for i, x := range l {
+			out[i] = x >= r[i]
+		}
+	default:
+		return nil, false
+	}
+	return out, true
+}
+
+func compareInt32(op string, l, r []int32) ([]bool, bool) {
+	out := make([]bool, len(l))
+	r = r[:len(l)]
+	switch op {
+	case "=":
+		for i, x := range l {
+			out[i] = x == r[i]
+		}
+	case "!=":
+		for i, x := range l {
+			out[i] = x != r[i]
+		}
+	case "<":
+		for i, x := range l {
+			out[i] = x < r[i]
+		}
+	case "<=":
+		for i, x := range l {
+			out[i] = x <= r[i]
+		}
+	case ">":
+		for i, x := range l {
+			out[i] = x > r[i]
+		}
+	case ">=":
+		for i, x := range l {
+			out[i] = x >= r[i]
+		}
+	default:
+		return nil, false
+	}
+	return out, true
+}
+
+func compareInt64(op string, l, r []int64) ([]bool, bool) {
+	out := make([]bool, len(l))
+	r = r[:len(l)]
+	switch op {
+	case "=":
+		for i, x := range l {
+			out[i] = x == r[i]
+		}
+	case "!=":
+		for i, x := range l {
+			out[i] = x != r[i]
+		}
+	case "<":
+		for i, x := range l {
+			out[i] = x < r[i]
+		}
+	case "<=":
+		for i, x := range l {
+			out[i] = x <= r[i]
+		}
+	case ">":
+		for i, x := range l {
+			out[i] = x > r[i]
+		}
+	case ">=":
+		for i, x := range l {
+			out[i] = x >= r[i]
+		}
+	default:
+		return nil, false
+	}
+	return out, true
+}
+
+func compareUint8(op string, l, r []uint8) ([]bool, bool) {
+	out := make([]bool, len(l))
+	r = r[:len(l)]
+	switch op {
+	case "=":
+		for i, x := range l {
+			out[i] = x == r[i]
+		}
+	case "!=":
+		for i, x := range l {
+			out[i] = x != r[i]
+		}
+	case "<":
+		for i, x := range l {
+			out[i] = x < r[i]
+		}
+	case "<=":
+		for i, x := range l {
+			out[i] = x <= r[i]
+		}
+	case ">":
+		for i, x := range l {
+			out[i] = x > r[i]
+		}
+	case ">=":
+		for i, x := range l {
+			out[i] = x >= r[i]
+		}
+	default:
+		return nil, false
+	}
+	return out, true
+}
+
+func compareUint16(op string, l, r []uint16) ([]bool, bool) {
+	out := make([]bool, len(l))
+	r = r[:len(l)]
+	switch op {
+	case "=":
+		for i, x := range l {
+			out[i] = x == r[i]
+		}
+	case "!=":
+		for i, x := range l {
+			out[i] = x != r[i]
+		}
+	case "<":
+		for i, x := range l {
+			out[i] = x < r[i]
+		}
+	case "<=":
+		for i, x := range l {
+			out[i] = x <= r[i]
+		}
+	case ">":
+		for i, x := range l {
+			out[i] = x > r[i]
+		}
+	case ">=":
+		for i, x := range l {
+			out[i] = x >= r[i]
+		}
+	default:
+		return nil, false
+	}
+	return out, true
+}
+
+func compareUint32(op string, l, r []uint32) ([]bool, bool) {
+	out := make([]bool, len(l))
+	r = r[:len(l)]
+	switch op {
+	case "=":
+		for i, x := range l {
+			out[i] = x == r[i]
+		}
+	case "!=":
+		for i, x := range l {
+			out[i] = x != r[i]
+		}
+	case "<":
+		for i, x := range l {
+			out[i] = x < r[i]
+		}
+	case "<=":
+		for i, x := range l {
+			out[i] = x <= r[i]
+		}
+	case ">":
+		for i, x := range l {
+			out[i] = x > r[i]
+		}
+	case ">=":
+		for i, x := range l {
+			out[i] = x >= r[i]
+		}
+	default:
+		return nil, false
+	}
+	return out, true
+}
+
+func compareUint64(op string, l, r []uint64) ([]bool, bool) {
+	out := make([]bool, len(l))
+	r = r[:len(l)]
+	switch op {
+	case "=":
+		for i, x := range l {
+			out[i] = x == r[i]
+		}
+	case "!=":
+		for i, x := range l {
+			out[i] = x != r[i]
+		}
+	case "<":
+		for i, x := range l {
+			out[i] = x < r[i]
+		}
+	case "<=":
+		for i, x := range l {
+			out[i] = x <= r[i]
+		}
+	case ">":
+		for i, x := range l {
+			out[i] = x > r[i]
+		}
+	case ">=":
+		for i, x := range l {
+			out[i] = x >= r[i]
+		}
+	default:
+		return nil, false
+	}
+	return out, true
+}
+
+func compareFloat32(op string, l, r []float32) ([]bool, bool) {
+	out := make([]bool, len(l))
+	r = r[:len(l)]
+	switch op {
+	case "=":
+		for i, x := range l {
+			out[i] = x == r[i]
+		}
+	case "!=":
+		for i, x := range l {
+			out[i] = x != r[i]
+		}
+	case "<":
+		for i, x := range l {
+			out[i] = x < r[i]
+		}
+	case "<=":
+		for i, x := range l {
+			out[i] = x <= r[i]
+		}
+	case ">":
+		for i, x := range l {
+			out[i] = x > r[i]
+		}
+	case ">=":
+		for i, x := range l {
+			out[i] = x >= r[i]
+		}
+	default:
+		return nil, false
+	}
+	return out, true
+}
+
+func compareFloat64(op string, l, r []float64) ([]bool, bool) {
+	out := make([]bool, len(l))
+	r = r[:len(l)]
+	switch op {
+	case "=":
+		for i, x := range l {
+			out[i] = x == r[i]
+		}
+	case "!=":
+		for i, x := range l {
+			out[i] = x != r[i]
+		}
+	case "<":
+		for i, x := range l {
+			out[i] = x < r[i]
+		}
+	case "<=":
+		for i, x := range l {
+			out[i] = x <= r[i]
+		}
+	case ">":
+		for i, x := range l {
+			out[i] = x > r[i]
+		}
+	case ">=":
+		for i, x := range l {
+			out[i] = x >= r[i]
+		}
+	default:
+		return nil, false
+	}
+	return out, true
+}
+
+func compareString(op string, l, r []string) ([]bool, bool) {
+	out := make([]bool, len(l))
+	r = r[:len(l)]
+	switch op {
+	case "=":
+		for i, x := range l {
+			out[i] = x == r[i]
+		}
+	case "!=":
+		for i, x := range l {
+			out[i] = x != r[i]
+		}
+	case "<":
+		for i, x := range l {
+			out[i] = x < r[i]
+		}
+	case "<=":
+		for i, x := range l {
+			out[i] = x <= r[i]
+		}
+	case ">":
+		for i, x := range l {
+			out[i] = x > r[i]
+		}
+	case ">=":
+		for i, x := range l {
+			out[i] = x >= r[i]
+		}
+	default:
+		return nil, false
+	}
+	return out, true
+}
@@ -0,0 +1,133 @@
+package exprs
+
+//go:generate go run gen_kernels.go
+
+import (
+	"github.com/apache/arrow/go/v6/arrow/array"
+	"github.com/apache/arrow/go/v6/arrow/memory"
+	"query-engine/datatypes"
+)
+
+// ---------------------------------------------Kernels---------------------------------------------
+// Kernels evaluate a binary expression over whole columns, reading the typed arrow buffers instead of
+// boxing every value in an interface{}. The type-specialised loops live in kernels.gen.go.
+// A kernel reports ok=false for types or operands it does not handle, the caller then falls back to
+// the row by row evalFunc.
+
+// validity returns the rows where both sides are non-null, nil means that every row is valid
+func validity(l, r datatypes.ColumnArray) []bool {
+	if !hasNulls(l) && !hasNulls(r) {
+		return nil
+	}
+	valid := make([]bool, l.Size())
+	for i := range valid {
+		valid[i] = isValid(l, i) && isValid(r, i)
+	}
+	return valid
+}
+
+func hasNulls(c datatypes.ColumnArray) bool {
+	switch v := c.(type) {
+	case *datatypes.ArrowFieldArray:
+		return v.Array().NullN() > 0
+	default:
+		return c.Size() > 0 && c.GetValue(0) == nil
+	}
+}
+
+func isValid(c datatypes.ColumnArray, i int) bool {
+	switch v := c.(type) {
+	case *datatypes.ArrowFieldArray:
+		return v.Array().IsValid(i)
+	default:
+		return c.GetValue(i) != nil
+	}
+}
+
+// stringValues returns the values of a string column, a literal is repeated for every row
+func stringValues(c datatypes.ColumnArray) ([]string, bool) {
+	switch v := c.(type) {
+	case *datatypes.ArrowFieldArray:
+		arr, ok := v.Array().(*array.String)
+		if !ok {
+			return nil, false
+		}
+		values := make([]string, arr.Len())
+		for i := range values {
+			values[i] = arr.Value(i)
+		}
+		return values, true
+	case datatypes.LiteralValueArray:
+		value, ok := v.GetValue(0).(string)
+		if !ok {
+			return nil, false
+		}
+		values := make([]string, v.Size())
+		for i := range values {
+			values[i] = value
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+// boolValues returns the values of a boolean column, a literal is repeated for every row
+func boolValues(c datatypes.ColumnArray) ([]bool, bool) {
+	switch v := c.(type) {
+	case *datatypes.ArrowFieldArray:
+		arr, ok := v.Array().(*array.Boolean)
+		if !ok {
+			return nil, false
+		}
+		values := make([]bool, arr.Len())
+		for i := range values {
+			values[i] = arr.Value(i)
+		}
+		return values, true
+	case datatypes.LiteralValueArray:
+		value, ok := v.GetValue(0).(bool)
+		if !ok {
+			return nil, false
+		}
+		values := make([]bool, v.Size())
+		for i := range values {
+			values[i] = value
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+// logicalKernel applies AND or OR to two boolean columns, the result is null when any side is null
+func logicalKernel(op string, l, r datatypes.ColumnArray) (datatypes.ColumnArray, bool) {
+	if l.GetType() != datatypes.BooleanType {
+		return nil, false
+	}
+	lv, lok := boolValues(l)
+	rv, rok := boolValues(r)
+	if !lok || !rok {
+		return nil, false
+	}
+	out := make([]bool, len(lv))
+	rv = rv[:len(lv)]
+	switch op {
+	case "AND":
+		for i, x := range lv {
+			out[i] = x && rv[i]
+		}
+	case "OR":
+		for i, x := range lv {
+			out[i] = x || rv[i]
+		}
+	default:
+		return nil, false
+	}
+	return newBooleanColumn(out, validity(l, r)), true
+}
+
+func newBooleanColumn(values []bool, valid []bool) datatypes.ColumnArray {
+	builder := array.NewBooleanBuilder(memory.NewGoAllocator())
+	defer builder.Release()
+	builder.AppendValues(values, valid)
+	return datatypes.NewArrowFieldArray(builder.NewArray())
+}
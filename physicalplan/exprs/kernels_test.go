@@ -0,0 +1,207 @@
+package exprs
+
+import (
+	"errors"
+	"fmt"
+	"github.com/apache/arrow/go/v6/arrow"
+	"github.com/apache/arrow/go/v6/arrow/memory"
+	"github.com/stretchr/testify/require"
+	"query-engine/datatypes"
+	"testing"
+)
+
+func buildColumn(dataType arrow.DataType, values ...interface{}) datatypes.ColumnArray {
+	builder := datatypes.NewArrowArrayBuilder(memory.NewGoAllocator(), dataType)
+	for _, v := range values {
+		builder.Append(v)
+	}
+	return builder.Build()
+}
+
+func requireSameColumn(t *testing.T, expect, actual datatypes.ColumnArray, msg string) {
+	require.Equal(t, expect.GetType(), actual.GetType(), msg)
+	require.Equal(t, expect.Size(), actual.Size(), msg)
+	for i := 0; i < expect.Size(); i++ {
+		require.Equal(t, expect.GetValue(i), actual.GetValue(i), fmt.Sprintf("%s, index %d", msg, i))
+	}
+}
+
+func TestKernels_match_row_evaluation(t *testing.T) {
+	columns := []struct {
+		l, r datatypes.ColumnArray
+	}{
+		{buildColumn(datatypes.Int8Type, int8(1), int8(-2), nil, int8(4)), buildColumn(datatypes.Int8Type, int8(1), int8(3), int8(3), nil)},
+		{buildColumn(datatypes.Int32Type, int32(1), int32(-2), nil, int32(4)), buildColumn(datatypes.Int32Type, int32(1), int32(3), int32(3), nil)},
+		{buildColumn(datatypes.Int64Type, int64(1), int64(-2), nil, int64(4)), buildColumn(datatypes.Int64Type, int64(1), int64(3), int64(3), nil)},
+		{buildColumn(datatypes.UInt16Type, uint16(1), uint16(2), nil, uint16(4)), buildColumn(datatypes.UInt16Type, uint16(1), uint16(3), uint16(3), nil)},
+		{buildColumn(datatypes.UInt64Type, uint64(1), uint64(7), uint64(3), uint64(4)), buildColumn(datatypes.UInt64Type, uint64(1), uint64(3), uint64(3), uint64(2))},
+		{buildColumn(datatypes.FloatType, float32(1.5), float32(-2), nil, float32(4)), buildColumn(datatypes.FloatType, float32(1.5), float32(3), float32(3), nil)},
+		{buildColumn(datatypes.DoubleType, 1.5, -2.0, nil, 4.0), buildColumn(datatypes.DoubleType, 1.5, 3.0, 3.0, 0.0)},
+		{buildColumn(datatypes.Int64Type, int64(1), int64(-2), nil), datatypes.NewLiteralValueArray(datatypes.Int64Type, int64(-2), 3)},
+		{datatypes.NewLiteralValueArray(datatypes.DoubleType, 2.5, 3), buildColumn(datatypes.DoubleType, 1.5, 2.5, 3.5)},
+		{buildColumn(datatypes.Int64Type, int64(1), int64(2), int64(3)).Slice(1, 3), buildColumn(datatypes.Int64Type, int64(3), nil, int64(2)).Slice(1, 3)},
+	}
+	compares := []BinaryExpr{
+		NewEqExpr(nil, nil).BinaryExpr, NewNeqExpr(nil, nil).BinaryExpr, NewLtExpr(nil, nil).BinaryExpr,
+		NewLtEqExpr(nil, nil).BinaryExpr, NewGtExpr(nil, nil).BinaryExpr, NewGtEqExpr(nil, nil).BinaryExpr,
+	}
+	maths := []BinaryExpr{
+		NewAddExpr(nil, nil).BinaryExpr, NewSubtractExpr(nil, nil).BinaryExpr,
+		NewMultiplyExpr(nil, nil).BinaryExpr, NewDivideExpr(nil, nil).BinaryExpr,
+	}
+
+	for _, c := range columns {
+		for _, b := range compares {
+			msg := fmt.Sprintf("%s %s", c.l.GetType(), b.op)
+			expect, err := b.binaryEvaluate(c.l, c.r, datatypes.BooleanType)
+			require.NoError(t, err, msg)
+			actual, ok := compareKernel(b.op, c.l, c.r)
+			require.True(t, ok, msg)
+			requireSameColumn(t, expect, actual, msg)
+		}
+		for _, b := range maths {
+			msg := fmt.Sprintf("%s %s", c.l.GetType(), b.op)
+			expect, err := b.binaryEvaluate(c.l, c.r, c.l.GetType())
+			require.NoError(t, err, msg)
+			actual, ok, err := mathKernel(b.op, c.l, c.r)
+			require.NoError(t, err, msg)
+			require.True(t, ok, msg)
+			requireSameColumn(t, expect, actual, msg)
+		}
+	}
+}
+
+func TestKernels_strings_and_booleans(t *testing.T) {
+	l := buildColumn(datatypes.StringType, "CA", "CO", nil, "")
+	r := buildColumn(datatypes.StringType, "CO", "CO", "CA", "")
+	for _, b := range []BinaryExpr{NewEqExpr(nil, nil).BinaryExpr, NewLtExpr(nil, nil).BinaryExpr, NewGtEqExpr(nil, nil).BinaryExpr} {
+		expect, err := b.binaryEvaluate(l, r, datatypes.BooleanType)
+		require.NoError(t, err)
+		actual, ok := compareKernel(b.op, l, r)
+		require.True(t, ok)
+		requireSameColumn(t, expect, actual, b.op)
+	}
+
+	bl := buildColumn(datatypes.BooleanType, true, true, false, nil)
+	br := buildColumn(datatypes.BooleanType, true, false, false, true)
+	for _, b := range []BinaryExpr{NewAndExpr(nil, nil).BinaryExpr, NewOrExpr(nil, nil).BinaryExpr} {
+		expect, err := b.binaryEvaluate(bl, br, datatypes.BooleanType)
+		require.NoError(t, err)
+		actual, ok := logicalKernel(b.op, bl, br)
+		require.True(t, ok)
+		requireSameColumn(t, expect, actual, b.op)
+	}
+}
+
+func TestKernels_fallback(t *testing.T) {
+	// a null literal has no typed values, the row by row path handles it
+	l := buildColumn(datatypes.Int64Type, int64(1), int64(2))
+	_, ok := compareKernel("=", l, datatypes.NewLiteralValueArray(datatypes.Int64Type, nil, 2))
+	require.False(t, ok)
+
+	// AND over integers keeps its row by row semantics
+	_, ok = logicalKernel("AND", l, l)
+	require.False(t, ok)
+}
+
+func TestKernels_divide_by_zero(t *testing.T) {
+	l := buildColumn(datatypes.Int32Type, int32(4), int32(6))
+
+	// a zero divisor on a null row is not an error
+	res, ok, err := mathKernel("/", l, buildColumn(datatypes.Int32Type, int32(2), nil))
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, int32(2), res.GetValue(0))
+	require.Nil(t, res.GetValue(1))
+
+	_, _, err = mathKernel("/", l, buildColumn(datatypes.Int32Type, int32(2), int32(0)))
+	require.True(t, errors.Is(err, ErrDivisionByZero))
+}
+
+// ---------------------------------------------Benchmarks---------------------------------------------
+// Each benchmark runs the kernel against the row by row evalFunc path on the same columns.
+
+const benchmarkRows = 8192
+
+func benchmarkColumns(dataType arrow.DataType) (datatypes.ColumnArray, datatypes.ColumnArray) {
+	lb := datatypes.NewArrowArrayBuilder(memory.NewGoAllocator(), dataType)
+	rb := datatypes.NewArrowArrayBuilder(memory.NewGoAllocator(), dataType)
+	for i := 0; i < benchmarkRows; i++ {
+		switch dataType {
+		case datatypes.Int64Type:
+			lb.Append(int64(i))
+			rb.Append(int64(benchmarkRows - i))
+		case datatypes.DoubleType:
+			lb.Append(float64(i) / 3)
+			rb.Append(float64(benchmarkRows-i) / 7)
+		case datatypes.StringType:
+			lb.Append(fmt.Sprintf("value-%d", i))
+			rb.Append(fmt.Sprintf("value-%d", benchmarkRows-i))
+		}
+	}
+	return lb.Build(), rb.Build()
+}
+
+func benchmarkCompare(b *testing.B, expr BinaryExpr, dataType arrow.DataType) {
+	l, r := benchmarkColumns(dataType)
+	b.Run("kernel", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, ok := compareKernel(expr.op, l, r); !ok {
+				b.Fatal("no kernel")
+			}
+		}
+	})
+	b.Run("row", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := expr.binaryEvaluate(l, r, datatypes.BooleanType); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func benchmarkMath(b *testing.B, expr BinaryExpr, dataType arrow.DataType) {
+	l, r := benchmarkColumns(dataType)
+	b.Run("kernel", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, ok, err := mathKernel(expr.op, l, r); !ok || err != nil {
+				b.Fatal("no kernel", err)
+			}
+		}
+	})
+	b.Run("row", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := expr.binaryEvaluate(l, r, dataType); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkEq_Int64(b *testing.B) {
+	benchmarkCompare(b, NewEqExpr(nil, nil).BinaryExpr, datatypes.Int64Type)
+}
+
+func BenchmarkGt_Int64(b *testing.B) {
+	benchmarkCompare(b, NewGtExpr(nil, nil).BinaryExpr, datatypes.Int64Type)
+}
+
+func BenchmarkGt_Float64(b *testing.B) {
+	benchmarkCompare(b, NewGtExpr(nil, nil).BinaryExpr, datatypes.DoubleType)
+}
+
+func BenchmarkEq_String(b *testing.B) {
+	benchmarkCompare(b, NewEqExpr(nil, nil).BinaryExpr, datatypes.StringType)
+}
+
+func BenchmarkAdd_Int64(b *testing.B) {
+	benchmarkMath(b, NewAddExpr(nil, nil).BinaryExpr, datatypes.Int64Type)
+}
+
+func BenchmarkMultiply_Float64(b *testing.B) {
+	benchmarkMath(b, NewMultiplyExpr(nil, nil).BinaryExpr, datatypes.DoubleType)
+}
+
+func BenchmarkDivide_Int64(b *testing.B) {
+	benchmarkMath(b, NewDivideExpr(nil, nil).BinaryExpr, datatypes.Int64Type)
+}
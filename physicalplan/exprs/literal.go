@@ -2,6 +2,7 @@ package exprs
 
 import (
 	"fmt"
+	"github.com/apache/arrow/go/v6/arrow"
 	"query-engine/datatypes"
 )
 
@@ -11,8 +12,8 @@ type LiteralLongExpr struct {
 	val int64
 }
 
-func (l LiteralLongExpr) Evaluate(input datatypes.RecordBatch) datatypes.ColumnArray {
-	return datatypes.NewLiteralValueArray(datatypes.Int64Type, l.val, input.RowCount())
+func (l LiteralLongExpr) Evaluate(input datatypes.RecordBatch) (datatypes.ColumnArray, error) {
+	return datatypes.NewLiteralValueArray(datatypes.Int64Type, l.val, input.RowCount()), nil
 }
 
 func (l LiteralLongExpr) String() string {
@@ -27,8 +28,8 @@ type LiteralDoubleExpr struct {
 	val float64
 }
 
-func (l LiteralDoubleExpr) Evaluate(input datatypes.RecordBatch) datatypes.ColumnArray {
-	return datatypes.NewLiteralValueArray(datatypes.DoubleType, l.val, input.RowCount())
+func (l LiteralDoubleExpr) Evaluate(input datatypes.RecordBatch) (datatypes.ColumnArray, error) {
+	return datatypes.NewLiteralValueArray(datatypes.DoubleType, l.val, input.RowCount()), nil
 }
 
 func (l LiteralDoubleExpr) String() string {
@@ -39,12 +40,30 @@ func NewLiteralDoubleExpr(val float64) LiteralDoubleExpr {
 	return LiteralDoubleExpr{val}
 }
 
+// LiteralValueExpr is a literal of any type, like a numeric literal coerced to the type of a column
+type LiteralValueExpr struct {
+	val   interface{}
+	dType arrow.DataType
+}
+
+func (l LiteralValueExpr) Evaluate(input datatypes.RecordBatch) (datatypes.ColumnArray, error) {
+	return datatypes.NewLiteralValueArray(l.dType, l.val, input.RowCount()), nil
+}
+
+func (l LiteralValueExpr) String() string {
+	return fmt.Sprint(l.val)
+}
+
+func NewLiteralValueExpr(val interface{}, dType arrow.DataType) LiteralValueExpr {
+	return LiteralValueExpr{val, dType}
+}
+
 type LiteralStringExpr struct {
 	val string
 }
 
-func (l LiteralStringExpr) Evaluate(input datatypes.RecordBatch) datatypes.ColumnArray {
-	return datatypes.NewLiteralValueArray(datatypes.StringType, l.val, input.RowCount())
+func (l LiteralStringExpr) Evaluate(input datatypes.RecordBatch) (datatypes.ColumnArray, error) {
+	return datatypes.NewLiteralValueArray(datatypes.StringType, l.val, input.RowCount()), nil
 }
 
 func (l LiteralStringExpr) String() string {
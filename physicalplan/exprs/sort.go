@@ -0,0 +1,59 @@
+package exprs
+
+import (
+	"fmt"
+	"query-engine/datatypes"
+	"query-engine/physicalplan"
+)
+
+// ---------------------------------------------Sort Expressions---------------------------------------------
+
+// SortExpr a sort key, the direction and the position of nulls decide how values of the expr are ordered
+type SortExpr struct {
+	expr       physicalplan.PhysicalExpr
+	asc        bool
+	nullsFirst bool
+}
+
+func NewSortExpr(expr physicalplan.PhysicalExpr, asc bool, nullsFirst bool) SortExpr {
+	return SortExpr{expr, asc, nullsFirst}
+}
+
+func (s SortExpr) InputExpr() physicalplan.PhysicalExpr {
+	return s.expr
+}
+
+// Compare orders two values of the sort key, it returns a negative number when l comes first,
+// a positive number when r comes first and 0 when they are equal.
+// Nulls are placed according to nullsFirst whatever the direction.
+func (s SortExpr) Compare(l, r interface{}) int {
+	switch {
+	case l == nil && r == nil:
+		return 0
+	case l == nil:
+		if s.nullsFirst {
+			return -1
+		}
+		return 1
+	case r == nil:
+		if s.nullsFirst {
+			return 1
+		}
+		return -1
+	}
+	if s.asc {
+		return datatypes.Compare(l, r)
+	}
+	return datatypes.Compare(r, l)
+}
+
+func (s SortExpr) String() string {
+	direction, nulls := "ASC", "NULLS LAST"
+	if !s.asc {
+		direction = "DESC"
+	}
+	if s.nullsFirst {
+		nulls = "NULLS FIRST"
+	}
+	return fmt.Sprintf("%s %s %s", s.expr, direction, nulls)
+}
@@ -0,0 +1,27 @@
+package exprs
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestSortExpr_Compare(t *testing.T) {
+	col := NewColumnIndexExpr(0)
+	testCases := []struct {
+		expr   SortExpr
+		l, r   interface{}
+		expect int
+	}{
+		{NewSortExpr(col, true, false), int64(1), int64(2), -1},
+		{NewSortExpr(col, false, false), int64(1), int64(2), 1},
+		{NewSortExpr(col, true, false), nil, int64(2), 1},
+		{NewSortExpr(col, true, true), nil, int64(2), -1},
+		{NewSortExpr(col, false, true), "a", nil, 1},
+		{NewSortExpr(col, false, false), "a", nil, -1},
+		{NewSortExpr(col, false, true), nil, nil, 0},
+		{NewSortExpr(col, false, true), "a", "a", 0},
+	}
+	for _, tc := range testCases {
+		require.Equal(t, tc.expect, tc.expr.Compare(tc.l, tc.r), "%s: %v vs %v", tc.expr, tc.l, tc.r)
+	}
+}
@@ -0,0 +1,372 @@
+package exprs
+
+import (
+	"fmt"
+	"query-engine/physicalplan"
+	"sort"
+)
+
+// ---------------------------------------------Window Expressions---------------------------------------------
+
+// WindowExpr is a window function, it computes a value for every row of a partition of rows
+// sorted by the order keys of the window
+type WindowExpr interface {
+	InputExprs() []physicalplan.PhysicalExpr
+	// Evaluate returns the values of all the rows of a partition
+	Evaluate(partition *WindowPartition) ([]interface{}, error)
+	String() string
+}
+
+// WindowPartition holds the rows of a partition sorted by the order keys
+type WindowPartition struct {
+	// Inputs are the values of the InputExprs of a window expr, Inputs[i][row] is the value of the i-th input
+	Inputs [][]interface{}
+	// OrderKeys are the values of the order keys of every row, OrderBy are the sort exprs of the keys
+	OrderKeys [][]interface{}
+	OrderBy   []SortExpr
+
+	// peerStart and peerEnd are the first row and one past the last row of the peers of every row,
+	// the rows with the same order keys
+	peerStart []int
+	peerEnd   []int
+}
+
+func NewWindowPartition(inputs [][]interface{}, orderKeys [][]interface{}, orderBy []SortExpr) *WindowPartition {
+	return &WindowPartition{Inputs: inputs, OrderKeys: orderKeys, OrderBy: orderBy}
+}
+
+func (w *WindowPartition) Len() int {
+	return len(w.OrderKeys)
+}
+
+// peers returns the first row and one past the last row of the peers of a row
+func (w *WindowPartition) peers(row int) (int, int) {
+	if w.peerStart == nil {
+		n := w.Len()
+		w.peerStart, w.peerEnd = make([]int, n), make([]int, n)
+		start := 0
+		for i := 1; i <= n; i++ {
+			if i < n && w.comparePeers(w.OrderKeys[i-1], w.OrderKeys[i]) == 0 {
+				continue
+			}
+			for j := start; j < i; j++ {
+				w.peerStart[j], w.peerEnd[j] = start, i
+			}
+			start = i
+		}
+	}
+	return w.peerStart[row], w.peerEnd[row]
+}
+
+func (w *WindowPartition) comparePeers(l, r []interface{}) int {
+	for i, expr := range w.OrderBy {
+		if c := expr.Compare(l[i], r[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+type FrameUnits int
+
+const (
+	RowsFrame FrameUnits = iota
+	// RangeFrame offsets are distances of the value of the single numeric order key
+	RangeFrame
+)
+
+type FrameBoundType int
+
+const (
+	UnboundedPreceding FrameBoundType = iota
+	Preceding
+	CurrentRow
+	Following
+	UnboundedFollowing
+)
+
+type FrameBound struct {
+	Type   FrameBoundType
+	Offset int64
+}
+
+func (f FrameBound) String() string {
+	switch f.Type {
+	case UnboundedPreceding:
+		return "UNBOUNDED PRECEDING"
+	case Preceding:
+		return fmt.Sprintf("%d PRECEDING", f.Offset)
+	case CurrentRow:
+		return "CURRENT ROW"
+	case Following:
+		return fmt.Sprintf("%d FOLLOWING", f.Offset)
+	default:
+		return "UNBOUNDED FOLLOWING"
+	}
+}
+
+// WindowFrame is the rows of the partition an aggregate is computed over for every row, from Start to End
+type WindowFrame struct {
+	Units FrameUnits
+	Start FrameBound
+	End   FrameBound
+}
+
+func NewWindowFrame(units FrameUnits, start, end FrameBound) WindowFrame {
+	return WindowFrame{units, start, end}
+}
+
+func (f WindowFrame) String() string {
+	units := "ROWS"
+	if f.Units == RangeFrame {
+		units = "RANGE"
+	}
+	return fmt.Sprintf("%s BETWEEN %s AND %s", units, f.Start, f.End)
+}
+
+// bounds returns the first row and one past the last row of the frame of a row, end is start for an empty frame
+func (f WindowFrame) bounds(partition *WindowPartition, row int) (int, int, error) {
+	start, err := f.bound(partition, row, f.Start, true)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := f.bound(partition, row, f.End, false)
+	if err != nil {
+		return 0, 0, err
+	}
+	if end < start {
+		end = start
+	}
+	return start, end, nil
+}
+
+// bound returns the row where the frame starts, or one past the row where it ends
+func (f WindowFrame) bound(partition *WindowPartition, row int, bound FrameBound, start bool) (int, error) {
+	n := partition.Len()
+	offset := bound.Offset
+	switch bound.Type {
+	case UnboundedPreceding:
+		return 0, nil
+	case UnboundedFollowing:
+		return n, nil
+	case Preceding:
+		offset = -offset
+	case CurrentRow:
+		offset = 0
+	}
+
+	if f.Units == RowsFrame {
+		pos := int64(row) + offset
+		if !start {
+			pos++
+		}
+		switch {
+		case pos < 0:
+			return 0, nil
+		case pos > int64(n):
+			return n, nil
+		}
+		return int(pos), nil
+	}
+
+	peerStart, peerEnd := partition.peers(row)
+	if bound.Type == CurrentRow || partition.OrderKeys[row][0] == nil {
+		// the peers of a null order key are the other nulls
+		if start {
+			return peerStart, nil
+		}
+		return peerEnd, nil
+	}
+	// the values are sorted along the direction of the key: a descending key is negated
+	key := partition.OrderBy[0]
+	position := func(val interface{}) (float64, error) {
+		v, err := toFloat64("RANGE", val)
+		if !key.asc {
+			v = -v
+		}
+		return v, err
+	}
+	current, err := position(partition.OrderKeys[row][0])
+	if err != nil {
+		return 0, err
+	}
+	target := current + float64(offset)
+	// the first row at or past the target for a start, past the target for an end,
+	// nulls are before all the values when they come first
+	var searchErr error
+	idx := sort.Search(n, func(i int) bool {
+		val := partition.OrderKeys[i][0]
+		if val == nil {
+			return !key.nullsFirst
+		}
+		v, err := position(val)
+		if err != nil {
+			searchErr = err
+		}
+		if start {
+			return v >= target
+		}
+		return v > target
+	})
+	return idx, searchErr
+}
+
+// RowNumberExpr numbers the rows of a partition from 1
+type RowNumberExpr struct{}
+
+func NewRowNumberExpr() RowNumberExpr {
+	return RowNumberExpr{}
+}
+
+func (r RowNumberExpr) InputExprs() []physicalplan.PhysicalExpr {
+	return nil
+}
+
+func (r RowNumberExpr) Evaluate(partition *WindowPartition) ([]interface{}, error) {
+	values := make([]interface{}, partition.Len())
+	for i := range values {
+		values[i] = uint64(i + 1)
+	}
+	return values, nil
+}
+
+func (r RowNumberExpr) String() string {
+	return "ROW_NUMBER()"
+}
+
+// RankExpr is the rank of the peers of a row, the rank of the first peers is 1. Dense ranks number the peers
+// without gaps, otherwise the rank is 1 plus the number of rows before the peers.
+type RankExpr struct {
+	dense bool
+}
+
+func NewRankExpr() RankExpr {
+	return RankExpr{false}
+}
+
+func NewDenseRankExpr() RankExpr {
+	return RankExpr{true}
+}
+
+func (r RankExpr) InputExprs() []physicalplan.PhysicalExpr {
+	return nil
+}
+
+func (r RankExpr) Evaluate(partition *WindowPartition) ([]interface{}, error) {
+	values := make([]interface{}, partition.Len())
+	rank := uint64(0)
+	for i := range values {
+		peerStart, _ := partition.peers(i)
+		if peerStart == i {
+			rank++
+		}
+		if r.dense {
+			values[i] = rank
+		} else {
+			values[i] = uint64(peerStart + 1)
+		}
+	}
+	return values, nil
+}
+
+func (r RankExpr) String() string {
+	if r.dense {
+		return "DENSE_RANK()"
+	}
+	return "RANK()"
+}
+
+// OffsetExpr is the input value of the row offset rows after the current row, or the default value when
+// the row is outside the partition. LAG has a negative offset, LEAD a positive one.
+type OffsetExpr struct {
+	expr         physicalplan.PhysicalExpr
+	offset       int64
+	defaultValue interface{}
+}
+
+func NewLagExpr(expr physicalplan.PhysicalExpr, offset int64, defaultValue interface{}) OffsetExpr {
+	return OffsetExpr{expr, -offset, defaultValue}
+}
+
+func NewLeadExpr(expr physicalplan.PhysicalExpr, offset int64, defaultValue interface{}) OffsetExpr {
+	return OffsetExpr{expr, offset, defaultValue}
+}
+
+func (o OffsetExpr) InputExprs() []physicalplan.PhysicalExpr {
+	return []physicalplan.PhysicalExpr{o.expr}
+}
+
+func (o OffsetExpr) Evaluate(partition *WindowPartition) ([]interface{}, error) {
+	values := make([]interface{}, partition.Len())
+	for i := range values {
+		row := int64(i) + o.offset
+		if row < 0 || row >= int64(len(values)) {
+			values[i] = o.defaultValue
+			continue
+		}
+		values[i] = partition.Inputs[0][row]
+	}
+	return values, nil
+}
+
+func (o OffsetExpr) String() string {
+	if o.offset < 0 {
+		return fmt.Sprintf("LAG(%s, %d, %v)", o.expr, -o.offset, o.defaultValue)
+	}
+	return fmt.Sprintf("LEAD(%s, %d, %v)", o.expr, o.offset, o.defaultValue)
+}
+
+// AggregateWindowExpr computes an aggregate over the frame of every row. A frame starting at the start
+// of the partition only grows from a row to the next, so that a single accumulator is updated with the rows
+// entering the frame, otherwise the aggregate of every row is computed over the rows of its frame.
+type AggregateWindowExpr struct {
+	aggExpr AggregateExpr
+	frame   WindowFrame
+}
+
+func NewAggregateWindowExpr(aggExpr AggregateExpr, frame WindowFrame) AggregateWindowExpr {
+	return AggregateWindowExpr{aggExpr, frame}
+}
+
+func (a AggregateWindowExpr) InputExprs() []physicalplan.PhysicalExpr {
+	return InputExprs(a.aggExpr)
+}
+
+func (a AggregateWindowExpr) Evaluate(partition *WindowPartition) ([]interface{}, error) {
+	values := make([]interface{}, partition.Len())
+	var acc Accumulator
+	// next is the first row not accumulated into acc
+	next := 0
+	for i := range values {
+		start, end, err := a.frame.bounds(partition, i)
+		if err != nil {
+			return nil, err
+		}
+		if a.frame.Start.Type != UnboundedPreceding || acc == nil {
+			acc, next = a.aggExpr.CreateAccumulator(), start
+		}
+		for ; next < end; next++ {
+			if err := acc.Accumulate(a.value(partition, next)); err != nil {
+				return nil, err
+			}
+		}
+		values[i] = acc.FinalValue()
+	}
+	return values, nil
+}
+
+// value returns the input value of a row, or the []interface{} of the values of several inputs
+func (a AggregateWindowExpr) value(partition *WindowPartition, row int) interface{} {
+	if len(partition.Inputs) == 1 {
+		return partition.Inputs[0][row]
+	}
+	values := make([]interface{}, len(partition.Inputs))
+	for i, input := range partition.Inputs {
+		values[i] = input[row]
+	}
+	return values
+}
+
+func (a AggregateWindowExpr) String() string {
+	return fmt.Sprintf("%s %s", a.aggExpr, a.frame)
+}
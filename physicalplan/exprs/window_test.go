@@ -0,0 +1,135 @@
+package exprs
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func windowPartition(inputs []interface{}, orderKeys []interface{}, orderBy SortExpr) *WindowPartition {
+	keys := make([][]interface{}, len(orderKeys))
+	for i, key := range orderKeys {
+		keys[i] = []interface{}{key}
+	}
+	return NewWindowPartition([][]interface{}{inputs}, keys, []SortExpr{orderBy})
+}
+
+func TestWindow_Rank(t *testing.T) {
+	orderKeys := []interface{}{int64(1), int64(2), int64(2), int64(3), nil, nil}
+	partition := windowPartition(nil, orderKeys, NewSortExpr(NewColumnIndexExpr(0), true, false))
+
+	for _, test := range []struct {
+		expr   WindowExpr
+		expect []interface{}
+	}{
+		{NewRowNumberExpr(), []interface{}{uint64(1), uint64(2), uint64(3), uint64(4), uint64(5), uint64(6)}},
+		{NewRankExpr(), []interface{}{uint64(1), uint64(2), uint64(2), uint64(4), uint64(5), uint64(5)}},
+		{NewDenseRankExpr(), []interface{}{uint64(1), uint64(2), uint64(2), uint64(3), uint64(4), uint64(4)}},
+	} {
+		values, err := test.expr.Evaluate(partition)
+		require.NoError(t, err)
+		require.Equal(t, test.expect, values, test.expr.String())
+	}
+}
+
+func TestWindow_LagLead(t *testing.T) {
+	inputs := []interface{}{"a", "b", nil, "d"}
+	partition := windowPartition(inputs, make([]interface{}, len(inputs)), NewSortExpr(NewColumnIndexExpr(0), true, false))
+
+	lag := NewLagExpr(NewColumnIndexExpr(0), 1, "-")
+	values, err := lag.Evaluate(partition)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{"-", "a", "b", nil}, values)
+	require.Equal(t, "LAG(#0, 1, -)", lag.String())
+
+	values, err = NewLeadExpr(NewColumnIndexExpr(0), 2, nil).Evaluate(partition)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{nil, "d", nil, nil}, values)
+
+	values, err = NewLeadExpr(NewColumnIndexExpr(0), 0, nil).Evaluate(partition)
+	require.NoError(t, err)
+	require.Equal(t, inputs, values)
+}
+
+func TestWindow_Aggregate_frames(t *testing.T) {
+	asc := NewSortExpr(NewColumnIndexExpr(0), true, false)
+	desc := NewSortExpr(NewColumnIndexExpr(0), false, true)
+	unboundedPreceding := FrameBound{Type: UnboundedPreceding}
+	unboundedFollowing := FrameBound{Type: UnboundedFollowing}
+	currentRow := FrameBound{Type: CurrentRow}
+	preceding := func(n int64) FrameBound { return FrameBound{Type: Preceding, Offset: n} }
+	following := func(n int64) FrameBound { return FrameBound{Type: Following, Offset: n} }
+
+	for _, test := range []struct {
+		name      string
+		frame     WindowFrame
+		orderBy   SortExpr
+		orderKeys []interface{}
+		expect    []interface{}
+	}{
+		{
+			name:      "running rows",
+			frame:     NewWindowFrame(RowsFrame, unboundedPreceding, currentRow),
+			orderBy:   asc,
+			orderKeys: []interface{}{int64(1), int64(2), int64(2), int64(4)},
+			expect:    []interface{}{int64(1), int64(3), int64(5), int64(9)},
+		},
+		{
+			name:      "running range includes the peers",
+			frame:     NewWindowFrame(RangeFrame, unboundedPreceding, currentRow),
+			orderBy:   asc,
+			orderKeys: []interface{}{int64(1), int64(2), int64(2), int64(4)},
+			expect:    []interface{}{int64(1), int64(5), int64(5), int64(9)},
+		},
+		{
+			name:      "sliding rows",
+			frame:     NewWindowFrame(RowsFrame, preceding(1), following(1)),
+			orderBy:   asc,
+			orderKeys: []interface{}{int64(1), int64(2), int64(2), int64(4)},
+			expect:    []interface{}{int64(3), int64(5), int64(8), int64(6)},
+		},
+		{
+			name:      "rows before the current one",
+			frame:     NewWindowFrame(RowsFrame, preceding(2), preceding(1)),
+			orderBy:   asc,
+			orderKeys: []interface{}{int64(1), int64(2), int64(2), int64(4)},
+			expect:    []interface{}{nil, int64(1), int64(3), int64(4)},
+		},
+		{
+			name:      "whole partition",
+			frame:     NewWindowFrame(RowsFrame, unboundedPreceding, unboundedFollowing),
+			orderBy:   asc,
+			orderKeys: []interface{}{int64(1), int64(2), int64(2), int64(4)},
+			expect:    []interface{}{int64(9), int64(9), int64(9), int64(9)},
+		},
+		{
+			name:      "range offsets",
+			frame:     NewWindowFrame(RangeFrame, preceding(1), following(0)),
+			orderBy:   asc,
+			orderKeys: []interface{}{int64(1), int64(2), int64(2), int64(4), nil},
+			expect:    []interface{}{int64(1), int64(5), int64(5), int64(4), nil},
+		},
+		{
+			name:      "descending range offsets",
+			frame:     NewWindowFrame(RangeFrame, preceding(1), currentRow),
+			orderBy:   desc,
+			orderKeys: []interface{}{nil, int64(4), int64(2), int64(2), int64(1)},
+			expect:    []interface{}{nil, int64(4), int64(4), int64(4), int64(5)},
+		},
+	} {
+		// the order keys are summed, the frame of a null key is the other nulls
+		partition := windowPartition(test.orderKeys, test.orderKeys, test.orderBy)
+		values, err := NewAggregateWindowExpr(NewSumExpr(NewColumnIndexExpr(0)), test.frame).Evaluate(partition)
+		require.NoError(t, err)
+		require.Equal(t, test.expect, values, test.name)
+	}
+}
+
+func TestWindow_Aggregate_range_of_strings(t *testing.T) {
+	frame := NewWindowFrame(RangeFrame, FrameBound{Type: Preceding, Offset: 1}, FrameBound{Type: CurrentRow})
+	partition := windowPartition([]interface{}{"a", "b"}, []interface{}{"a", "b"},
+		NewSortExpr(NewColumnIndexExpr(0), true, false))
+	expr := NewAggregateWindowExpr(NewMaxExpr(NewColumnIndexExpr(0)), frame)
+	_, err := expr.Evaluate(partition)
+	require.Error(t, err)
+	require.Equal(t, "MAX(#0) RANGE BETWEEN 1 PRECEDING AND CURRENT ROW", expr.String())
+}
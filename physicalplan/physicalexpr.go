@@ -6,5 +6,5 @@ import "query-engine/datatypes"
 type PhysicalExpr interface {
 	// Evaluate the expression against an input RecordBatch and
 	// produce a column of data as output.
-	Evaluate(input datatypes.RecordBatch) datatypes.ColumnArray
+	Evaluate(input datatypes.RecordBatch) (datatypes.ColumnArray, error)
 }
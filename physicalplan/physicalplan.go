@@ -1,27 +1,78 @@
 package physicalplan
 
 import (
+	"context"
 	"fmt"
 	"query-engine/datatypes"
 )
 
 // PhysicalPlan represents an executable piece of code that will produce data.
+// A plan checks its ctx between the batches it reads, so that a cancelled query stops at the next batch,
+// and the plans running their inputs in goroutines, like an exchange, stop them once ctx is done:
+// a query stopped before the end, like by a limit, must cancel its ctx.
 type PhysicalPlan interface {
 	// Schema Returns the schema of the data that will be produced by this physical plan.
 	Schema() datatypes.Schema
 
 	// Execute a physical plan and produce a series of record batches.
-	Execute() datatypes.RecordBatch
+	// Once ctx is done, the ctx error is returned.
+	Execute(ctx context.Context) (datatypes.RecordBatch, error)
 
-	// Next prepares the next recordBatch for reading with Execute method
-	Next() bool
+	// Next prepares the next recordBatch for reading with Execute method,
+	// when preparing fails or ctx is done, it returns true so that the error is returned by Execute
+	Next(ctx context.Context) bool
 
 	// Children Returns the children (inputs) of this physical plan.
 	Children() []PhysicalPlan
 
+	// Close releases the resources of the plan and of its inputs, like open files and spill files,
+	// once its batches are all read or its consumer stops early. It can be called several times,
+	// Next isn't called once the plan is closed.
+	Close()
+
+	// OutputPartitioning Returns how the output rows are split into partitions,
+	// a plan instance produces one partition, the other ones are produced by sibling instances.
+	OutputPartitioning() Partitioning
+
+	// OutputOrdering Returns the exprs the rows of a partition are sorted by, so that the rows with equal values
+	// of a prefix of the exprs are adjacent, whatever the direction. It is nil when the order is unknown.
+	OutputOrdering() []PhysicalExpr
+
 	String() string
 }
 
+// Partitioning describes how the rows of a plan are split into partitions,
+// each partition is read by its own plan instance, so that the partitions run in parallel.
+type Partitioning struct {
+	// Count is the number of partitions
+	Count int
+	// Exprs are the keys of a hash partitioning, the rows with equal keys are in the same partition.
+	// Without Exprs, a row can be in any partition.
+	Exprs []PhysicalExpr
+}
+
+// SinglePartition is the partitioning of a plan producing all the rows
+func SinglePartition() Partitioning {
+	return Partitioning{Count: 1}
+}
+
+// UnknownPartitioning splits the rows into count partitions in any way, like by byte ranges of a file
+func UnknownPartitioning(count int) Partitioning {
+	return Partitioning{Count: count}
+}
+
+// HashPartitioning splits the rows into count partitions by the hash of exprs
+func HashPartitioning(exprs []PhysicalExpr, count int) Partitioning {
+	return Partitioning{Count: count, Exprs: exprs}
+}
+
+func (p Partitioning) String() string {
+	if len(p.Exprs) == 0 {
+		return fmt.Sprintf("%d", p.Count)
+	}
+	return fmt.Sprintf("Hash(%v, %d)", p.Exprs, p.Count)
+}
+
 // PrettyFormat Format a physical plan in human-readable form
 func PrettyFormat(plan PhysicalPlan) string {
 	return "\n" + format(plan, 0)
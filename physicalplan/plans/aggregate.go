@@ -1,16 +1,45 @@
 package plans
 
 import (
+	"context"
 	"fmt"
 	"github.com/apache/arrow/go/v6/arrow/memory"
+	"hash/fnv"
+	"os"
 	"query-engine/datatypes"
 	"query-engine/physicalplan"
 	"query-engine/physicalplan/exprs"
 )
 
-type HashAggregateExec struct {
-	// input plan to scan datasource and produce recordBatch
-	input physicalplan.PhysicalPlan
+// AggregateMode is the phase of a two-phase aggregation run by a HashAggregateExec
+type AggregateMode int
+
+const (
+	// SingleAggregate aggregates the input values into the final values
+	SingleAggregate AggregateMode = iota
+	// PartialAggregate aggregates the values of a partition into the accumulator states,
+	// the output has the group keys followed by the StateFields of every aggregate expr
+	PartialAggregate
+	// FinalAggregate merges the accumulator states of the partial aggregation into the final values,
+	// the input is the output of the partial aggregation, so that the group keys are its first columns
+	FinalAggregate
+)
+
+func (m AggregateMode) String() string {
+	switch m {
+	case PartialAggregate:
+		return "partial"
+	case FinalAggregate:
+		return "final"
+	default:
+		return "single"
+	}
+}
+
+// aggregation holds the exprs of an aggregation phase along with the schemas of its values and states,
+// it is shared by HashAggregateExec and SortAggregateExec
+type aggregation struct {
+	mode AggregateMode
 
 	// groupExpr to evaluate recordBatch and produce grouping keys. eg: Col.
 	groupExpr []physicalplan.PhysicalExpr
@@ -21,111 +50,614 @@ type HashAggregateExec struct {
 
 	// schema represents groupExprs and aggExprs
 	schema datatypes.Schema
+	// stateSchema represents groupExprs and the accumulator states of aggExprs,
+	// it is the output schema in partial mode, the input schema in final mode and the schema of the spill files
+	stateSchema datatypes.Schema
+	// stateColumns are the columns of stateSchema holding the accumulator state of every aggExpr
+	stateColumns [][]int
+	// inputExprs are the inputs of all the aggExpr, inputColumns are the ones of every aggExpr,
+	// see exprs.MultiInputAggregateExpr
+	inputExprs   []physicalplan.PhysicalExpr
+	inputColumns [][]int
+	// filterColumns are the columns of the inputExprs holding the predicate of every aggExpr,
+	// -1 for the aggExpr accumulating every row, see exprs.FilteredAggregateExpr
+	filterColumns []int
+	// valueSize is the estimated bytes kept by the accumulators of a group for every input row,
+	// buffering tells the aggExpr which keep their values, groupSize is the estimated bytes of
+	// the accumulators of a group, see exprs.BufferingAggregateExpr
+	valueSize int64
+	buffering []bool
+	groupSize int64
+}
+
+// newAggregation creates a phase of a two-phase aggregation, in final mode groupExpr are the key columns
+// of the partial output. schema is the schema of the final values in every mode.
+func newAggregation(
+	mode AggregateMode, groupExpr []physicalplan.PhysicalExpr, aggExpr []exprs.AggregateExpr, schema datatypes.Schema,
+) aggregation {
+	a := aggregation{mode: mode, groupExpr: groupExpr, aggExpr: aggExpr, schema: schema}
+	a.inputColumns = make([][]int, len(aggExpr))
+	a.filterColumns = make([]int, len(aggExpr))
+	a.buffering = make([]bool, len(aggExpr))
+	for i, expr := range aggExpr {
+		a.filterColumns[i] = -1
+		if filtered, ok := expr.(exprs.FilteredAggregateExpr); ok {
+			a.filterColumns[i] = len(a.inputExprs)
+			a.inputExprs = append(a.inputExprs, filtered.Filter())
+			expr = filtered.AggregateExpr
+		}
+		for _, input := range exprs.InputExprs(expr) {
+			a.inputColumns[i] = append(a.inputColumns[i], len(a.inputExprs))
+			a.inputExprs = append(a.inputExprs, input)
+		}
+		if buffering, ok := expr.(exprs.BufferingAggregateExpr); ok {
+			a.valueSize += buffering.ValueSize()
+			a.buffering[i] = buffering.ValueSize() > 0
+			a.groupSize += buffering.GroupSize()
+		}
+	}
+
+	// the states are only known once the schema has the fields of every expr
+	if len(schema.Fields) < len(groupExpr)+len(aggExpr) {
+		return a
+	}
+	fields := append([]datatypes.Field{}, schema.Fields[:len(groupExpr)]...)
+	a.stateColumns = make([][]int, len(aggExpr))
+	for i, expr := range aggExpr {
+		for _, field := range expr.StateFields(schema.Fields[len(groupExpr)+i]) {
+			a.stateColumns[i] = append(a.stateColumns[i], len(fields))
+			fields = append(fields, field)
+		}
+	}
+	a.stateSchema = datatypes.Schema{Fields: fields}
+	return a
+}
+
+// outputSchema is the schema of the final values, or of the states in partial mode
+func (a *aggregation) outputSchema() datatypes.Schema {
+	if a.mode == PartialAggregate {
+		return a.stateSchema
+	}
+	return a.schema
+}
+
+// evaluate returns the group key columns and the columns of the inputExprs of a batch. To merge states,
+// the batch has the stateSchema: the keys are its first columns and the inputs are all its columns.
+func (a *aggregation) evaluate(
+	recordBatch datatypes.RecordBatch, merge bool,
+) ([]datatypes.ColumnArray, []datatypes.ColumnArray, error) {
+	if merge {
+		return recordBatch.Fields[:len(a.groupExpr)], recordBatch.Fields, nil
+	}
+
+	// get needed grouping key columns
+	groupKeyColumnArray := make([]datatypes.ColumnArray, len(a.groupExpr))
+	for i, expr := range a.groupExpr {
+		var err error
+		groupKeyColumnArray[i], err = expr.Evaluate(recordBatch)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// get needed to be aggregated key columns
+	aggKeyColumnArray := make([]datatypes.ColumnArray, len(a.inputExprs))
+	for i, expr := range a.inputExprs {
+		var err error
+		aggKeyColumnArray[i], err = expr.Evaluate(recordBatch)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return groupKeyColumnArray, aggKeyColumnArray, nil
+}
+
+func (a *aggregation) newAccumulators() []exprs.Accumulator {
+	accs := make([]exprs.Accumulator, len(a.aggExpr))
+	for i, expr := range a.aggExpr {
+		accs[i] = expr.CreateAccumulator()
+	}
+	return accs
+}
+
+// update accumulates the input values of a row, or merges the states of a row, see evaluate.
+// The rows filtered out of an aggExpr are not accumulated, the merged states are the ones of the accumulated rows.
+func (a *aggregation) update(accs []exprs.Accumulator, inputs []datatypes.ColumnArray, rowIdx int, merge bool) error {
+	for i, acc := range accs {
+		if !merge && a.filterColumns[i] >= 0 && inputs[a.filterColumns[i]].GetValue(rowIdx) != true {
+			continue
+		}
+		if !merge && len(a.inputColumns[i]) == 1 {
+			if err := acc.Accumulate(inputs[a.inputColumns[i][0]].GetValue(rowIdx)); err != nil {
+				return err
+			}
+			continue
+		}
+		if !merge {
+			values := make([]interface{}, len(a.inputColumns[i]))
+			for j, col := range a.inputColumns[i] {
+				values[j] = inputs[col].GetValue(rowIdx)
+			}
+			if err := acc.Accumulate(values); err != nil {
+				return err
+			}
+			continue
+		}
+		state := make([]interface{}, len(a.stateColumns[i]))
+		for j, col := range a.stateColumns[i] {
+			state[j] = inputs[col].GetValue(rowIdx)
+		}
+		if err := acc.Merge(state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *aggregation) format(name string) string {
+	if a.mode != SingleAggregate {
+		return fmt.Sprintf("%s: mode=%s, groupExpr=%v, aggExpr=%v", name, a.mode, a.groupExpr, a.aggExpr)
+	}
+	return fmt.Sprintf("%s: groupExpr=%v, aggExpr=%v", name, a.groupExpr, a.aggExpr)
+}
+
+func newBuilders(schema datatypes.Schema, capacity int) []datatypes.ArrowArrayBuilder {
+	builders := make([]datatypes.ArrowArrayBuilder, len(schema.Fields))
+	for i, field := range schema.Fields {
+		builders[i] = datatypes.NewArrowArrayBuilder(memory.NewGoAllocator(), field.DataType)
+		builders[i].Reserve(capacity)
+	}
+	return builders
+}
+
+func buildBatch(schema datatypes.Schema, builders []datatypes.ArrowArrayBuilder) datatypes.RecordBatch {
+	fields := make([]datatypes.ColumnArray, len(builders))
+	for i := range builders {
+		fields[i] = builders[i].Build()
+	}
+	return datatypes.RecordBatch{Schema: schema, Fields: fields}
+}
+
+// appendGroup appends the group values followed by the final values, or the states.
+// Nothing is appended when a state can't be encoded.
+func appendGroup(builders []datatypes.ArrowArrayBuilder, values []interface{}, accs []exprs.Accumulator, states bool) error {
+	row := append([]interface{}{}, values...)
+	for _, acc := range accs {
+		if !states {
+			row = append(row, acc.FinalValue())
+			continue
+		}
+		state, err := acc.State()
+		if err != nil {
+			return err
+		}
+		row = append(row, state...)
+	}
+	for i, value := range row {
+		builders[i].Append(value)
+	}
+	return nil
+}
 
-	// finished aggregation calculation
-	done bool
+// spillPartitions is the number of partitions the groups are spilled to, once the memory limit is exceeded,
+// spillPartitionBits are the bits of the hash of the group keys choosing the partition
+const (
+	spillPartitionBits = 4
+	spillPartitions    = 1 << spillPartitionBits
+)
+
+// maxSpillLevel is how many times a spilled partition exceeding the memory limit is split again,
+// the partitions of the last level are merged in memory, like the ones holding a single large group
+const maxSpillLevel = 4
+
+// spilledPartition is a spill file of the groups of a partition, level is how many times it was split
+type spilledPartition struct {
+	path  string
+	level int
+}
+
+// HashAggregateExec groups the input rows by the hash of the group keys. The first Next consumes the input,
+// then the groups are returned in batches of batchSize rows. Whenever the groups exceed memoryLimit bytes,
+// the accumulator states of the groups are spilled to spillPartitions Arrow IPC files by the hash of the group keys,
+// and the groups are released. Once the input is consumed, the remaining groups are spilled too, then every
+// partition is read back and its states are merged, one partition at a time as its groups are returned.
+// A partition whose merged groups exceed memoryLimit is split again by other bits of the hash, up to maxSpillLevel.
+type HashAggregateExec struct {
+	// input plan to scan datasource and produce recordBatch
+	input physicalplan.PhysicalPlan
+
+	aggregation
+
+	// batchSize is the max rows of an output batch, 0 or less returns all the groups in a single batch
+	batchSize int
+	// memoryLimit is the max bytes of the groups, 0 or less means no limit
+	memoryLimit int64
+	// spillDir is where the groups are spilled, the default temp directory when empty
+	spillDir string
+	// tempDir holds the spill files of the partitions, once the groups were spilled
+	tempDir      string
+	spillWriters []*spillWriter
+	// spillPaths are the spilled partitions left to merge once the input is consumed
+	spillPaths []spilledPartition
+
+	// aggregated is set once the input is consumed
+	aggregated bool
+	// table holds the groups being returned, cursor is the next group to return
+	table  *groupTable
+	cursor int
+	// emitted is set once a batch is returned, so that no groups return a single empty batch
+	emitted bool
+
+	// batch prepared by Next, or the error of preparing it
+	batch datatypes.RecordBatch
+	err   error
+}
+
+// groupTable is a hash table of the groups keyed by the binary row key of their group values,
+// see appendRowKey. The groups are kept in the order they were found.
+type groupTable struct {
+	// index is the group of every row key
+	index map[string]int
+	// keys and accs are the row key and the accumulators of every group
+	keys [][]byte
+	accs [][]exprs.Accumulator
+	// memUsed is the estimated size of the groups in bytes
+	memUsed int64
+
+	// row and buf are reused to build the row key of every input row
+	row []interface{}
+	buf []byte
+}
+
+func newGroupTable() *groupTable {
+	return &groupTable{index: make(map[string]int)}
+}
+
+// values returns the group values of a group
+func (t *groupTable) values(group int) ([]interface{}, error) {
+	return decodeRowKey(string(t.keys[group]))
 }
 
 func NewHashAggregateExec(input physicalplan.PhysicalPlan, groupExpr []physicalplan.PhysicalExpr, aggExpr []exprs.AggregateExpr, schema datatypes.Schema) *HashAggregateExec {
-	return &HashAggregateExec{input, groupExpr, aggExpr, schema, false}
+	return NewHashAggregateExecWithMode(input, SingleAggregate, groupExpr, aggExpr, schema, 0, 0, "")
+}
+
+// NewHashAggregateExecWithMode creates a phase of a two-phase aggregation, which returns batches of batchSize groups
+// and spills its groups to spillDir once they exceed memoryLimit bytes. In final mode groupExpr are the key columns
+// of the partial output. schema is the schema of the final values in every mode, the partial output schema
+// has the states instead.
+func NewHashAggregateExecWithMode(
+	input physicalplan.PhysicalPlan, mode AggregateMode,
+	groupExpr []physicalplan.PhysicalExpr, aggExpr []exprs.AggregateExpr, schema datatypes.Schema,
+	batchSize int, memoryLimit int64, spillDir string,
+) *HashAggregateExec {
+	return &HashAggregateExec{
+		input:       input,
+		aggregation: newAggregation(mode, groupExpr, aggExpr, schema),
+		batchSize:   batchSize,
+		memoryLimit: memoryLimit,
+		spillDir:    spillDir,
+	}
 }
 
 func (h *HashAggregateExec) Schema() datatypes.Schema {
-	return h.schema
+	return h.outputSchema()
 }
 
-func (h *HashAggregateExec) Execute() datatypes.RecordBatch {
-	row2AccMap := make(map[string][]exprs.Accumulator)
-	rowHash2row := make(map[string][]interface{})
-	rowGroupKeys := make([]string, 0)
+func (h *HashAggregateExec) Execute(ctx context.Context) (datatypes.RecordBatch, error) {
+	return h.batch, h.err
+}
 
-	for h.input.Next() {
-		recordBatch := h.input.Execute()
-		// get needed grouping key columns
-		groupKeyColumnArray := make([]datatypes.ColumnArray, len(h.groupExpr))
-		for i, expr := range h.groupExpr {
-			groupKeyColumnArray[i] = expr.Evaluate(recordBatch)
+// Next returns true when a batch or an error is ready, a failed or cancelled aggregation returns no more batches
+func (h *HashAggregateExec) Next(ctx context.Context) bool {
+	if h.err != nil {
+		h.cleanup()
+		return false
+	}
+	if !h.aggregated {
+		h.aggregated = true
+		if h.err = h.aggregate(ctx); h.err != nil {
+			return true
 		}
+	} else if h.err = ctx.Err(); h.err != nil {
+		return true
+	}
 
-		// get needed to be aggregated key columns
-		aggKeyColumnArray := make([]datatypes.ColumnArray, len(h.aggExpr))
-		for i, expr := range h.aggExpr {
-			aggKeyColumnArray[i] = expr.InputExpr().Evaluate(recordBatch)
+	// the groups of the spilled partitions are merged once the previous partition is returned
+	for h.cursor >= len(h.table.keys) && len(h.spillPaths) > 0 {
+		path := h.spillPaths[0]
+		h.spillPaths = h.spillPaths[1:]
+		if h.table, h.err = h.mergePartition(path.path, path.level); h.err != nil {
+			return true
 		}
+		h.cursor = 0
+	}
+	if h.cursor >= len(h.table.keys) && h.emitted {
+		h.cleanup()
+		return false
+	}
 
-		for rowIdx := 0; rowIdx < recordBatch.RowCount(); rowIdx++ {
-			row := make([]interface{}, len(groupKeyColumnArray))
-			for colIdx := 0; colIdx < len(groupKeyColumnArray); colIdx++ {
-				row[colIdx] = groupKeyColumnArray[colIdx].GetValue(rowIdx)
-			}
+	end := len(h.table.keys)
+	if h.batchSize > 0 && h.cursor+h.batchSize < end {
+		end = h.cursor + h.batchSize
+	}
+	h.batch, h.err = h.buildGroups(h.table, h.cursor, end)
+	h.cursor = end
+	h.emitted = true
+	return true
+}
 
-			groupKey := h.encodeCols(row)
-			accs, ok := row2AccMap[groupKey]
-			if !ok {
-				rowGroupKeys = append(rowGroupKeys, groupKey)
+func (h *HashAggregateExec) Children() []physicalplan.PhysicalPlan {
+	return []physicalplan.PhysicalPlan{h.input}
+}
 
-				accumulators := make([]exprs.Accumulator, len(h.aggExpr))
-				for i, expr := range h.aggExpr {
-					accumulators[i] = expr.CreateAccumulator()
-				}
-				row2AccMap[groupKey] = accumulators
-				accs = row2AccMap[groupKey]
+// Close removes the spill files, like when the consumer stops before the last group
+func (h *HashAggregateExec) Close() {
+	h.cleanup()
+	h.input.Close()
+}
 
-				rowHash2row[groupKey] = row
-			}
+func (h *HashAggregateExec) OutputPartitioning() physicalplan.Partitioning {
+	return physicalplan.UnknownPartitioning(h.input.OutputPartitioning().Count)
+}
+
+// OutputOrdering is unknown, as the spilled groups are returned by partition
+func (h *HashAggregateExec) OutputOrdering() []physicalplan.PhysicalExpr {
+	return nil
+}
+
+func (h *HashAggregateExec) String() string {
+	return h.format("HashAggregateExec")
+}
 
-			// perform accumulation
-			for i, acc := range accs {
-				value := aggKeyColumnArray[i].GetValue(rowIdx)
-				acc.Accumulate(value)
+// aggregate consumes the input, once the groups were spilled the remaining groups are spilled too
+func (h *HashAggregateExec) aggregate(ctx context.Context) error {
+	table := newGroupTable()
+	for h.input.Next(ctx) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		recordBatch, err := h.input.Execute(ctx)
+		if err != nil {
+			return err
+		}
+		if err := h.updateBatch(table, recordBatch, h.mode == FinalAggregate); err != nil {
+			return err
+		}
+		if h.memoryLimit > 0 && table.memUsed > h.memoryLimit {
+			if err := h.spill(table, 0); err != nil {
+				return err
 			}
+			table = newGroupTable()
 		}
 	}
 
-	builders := make([]datatypes.ArrowArrayBuilder, 0)
-	for _, field := range h.schema.Fields {
-		builders = append(builders, datatypes.NewArrowArrayBuilder(memory.NewGoAllocator(), field.DataType))
+	h.table = table
+	if h.tempDir == "" {
+		// without GROUP BY the values are aggregated over a single group, even without input rows,
+		// the partial aggregations have no group so that the final one has a single group
+		if len(h.groupExpr) == 0 && len(table.keys) == 0 && h.mode != PartialAggregate {
+			_, err := h.findGroup(table, nil, 0)
+			return err
+		}
+		return nil
+	}
+	if len(table.keys) > 0 {
+		if err := h.spill(table, 0); err != nil {
+			return err
+		}
+		h.table = newGroupTable()
 	}
+	return h.closeSpillWriters(0)
+}
 
-	for _, rowGroupKey := range rowGroupKeys {
-		cols := rowHash2row[rowGroupKey]
-		for i := 0; i < len(h.groupExpr); i++ {
-			builders[i].Append(cols[i])
+// closeSpillWriters closes the spill files of the partitions of a level, so that they are merged next
+func (h *HashAggregateExec) closeSpillWriters(level int) error {
+	for p, writer := range h.spillWriters {
+		if writer == nil {
+			continue
 		}
-		accumulators := row2AccMap[rowGroupKey]
-		for i := 0; i < len(h.aggExpr); i++ {
-			builders[i+len(h.groupExpr)].Append(accumulators[i].FinalValue())
+		h.spillWriters[p] = nil
+		path, err := writer.close()
+		if err != nil {
+			return err
 		}
+		h.spillPaths = append(h.spillPaths, spilledPartition{path: path, level: level})
 	}
+	return nil
+}
 
-	fields := make([]datatypes.ColumnArray, len(builders))
-	for i := 0; i < len(fields); i++ {
-		fields[i] = builders[i].Build()
+// updateBatch accumulates the input values of a batch into the groups, or merges the states of a batch of stateSchema
+func (h *HashAggregateExec) updateBatch(table *groupTable, recordBatch datatypes.RecordBatch, merge bool) error {
+	groupKeyColumnArray, inputs, err := h.evaluate(recordBatch, merge)
+	if err != nil {
+		return err
 	}
-	// create result batch containing final aggregate values
-	h.done = true
-	return datatypes.RecordBatch{
-		Schema: h.schema,
-		Fields: fields,
+	for rowIdx := 0; rowIdx < recordBatch.RowCount(); rowIdx++ {
+		accs, err := h.findGroup(table, groupKeyColumnArray, rowIdx)
+		if err != nil {
+			return err
+		}
+		if err := h.update(accs, inputs, rowIdx, merge); err != nil {
+			return err
+		}
+	}
+	if h.valueSize > 0 {
+		table.memUsed += h.bufferedSize(recordBatch.RowCount(), inputs, merge)
 	}
+	return nil
 }
 
-func (h *HashAggregateExec) Next() bool {
-	return !h.done
+// bufferedSize estimates the bytes of the values kept by the accumulators for the rows of a batch,
+// the merged state of a buffering accumulator is about the size of its values
+func (h *HashAggregateExec) bufferedSize(rows int, inputs []datatypes.ColumnArray, merge bool) int64 {
+	if !merge {
+		return h.valueSize * int64(rows)
+	}
+	size := int64(0)
+	for i := range h.aggExpr {
+		if !h.buffering[i] {
+			continue
+		}
+		for _, col := range h.stateColumns[i] {
+			for rowIdx := 0; rowIdx < rows; rowIdx++ {
+				if state, ok := inputs[col].GetValue(rowIdx).(string); ok {
+					size += int64(len(state))
+				}
+			}
+		}
+	}
+	return size
 }
 
-func (h *HashAggregateExec) Children() []physicalplan.PhysicalPlan {
-	return []physicalplan.PhysicalPlan{h.input}
+// findGroup returns the accumulators of the group of a row, a new group is added when there is none
+func (h *HashAggregateExec) findGroup(
+	table *groupTable, groupKeyColumnArray []datatypes.ColumnArray, rowIdx int,
+) ([]exprs.Accumulator, error) {
+	table.row = table.row[:0]
+	for _, column := range groupKeyColumnArray {
+		table.row = append(table.row, column.GetValue(rowIdx))
+	}
+	var err error
+	if table.buf, err = appendRowKey(table.buf[:0], table.row); err != nil {
+		return nil, err
+	}
+	if group, ok := table.index[string(table.buf)]; ok {
+		return table.accs[group], nil
+	}
+
+	key := append([]byte{}, table.buf...)
+	accs := h.newAccumulators()
+	table.index[string(key)] = len(table.keys)
+	table.keys = append(table.keys, key)
+	table.accs = append(table.accs, accs)
+	table.memUsed += groupMemorySize(key, len(accs)) + h.groupSize
+	return accs, nil
 }
 
-func (h *HashAggregateExec) String() string {
-	return fmt.Sprintf("HashAggregateExec: groupExpr=%v, aggExpr=%v", h.groupExpr, h.aggExpr)
+// buildGroups builds the groups from start to end
+func (h *HashAggregateExec) buildGroups(table *groupTable, start, end int) (datatypes.RecordBatch, error) {
+	schema := h.Schema()
+	builders := newBuilders(schema, end-start)
+	for group := start; group < end; group++ {
+		values, err := table.values(group)
+		if err != nil {
+			return datatypes.RecordBatch{}, err
+		}
+		if err := appendGroup(builders, values, table.accs[group], h.mode == PartialAggregate); err != nil {
+			return datatypes.RecordBatch{}, err
+		}
+	}
+	return buildBatch(schema, builders), nil
 }
 
-func (h *HashAggregateExec) encodeCols(cols []interface{}) string {
-	res := ""
-	for _, col := range cols {
-		res += fmt.Sprint(col)
+// spill writes the accumulator states of the groups to the spill file of their partition, every level
+// partitions the groups by other bits of the hash of their keys
+func (h *HashAggregateExec) spill(table *groupTable, level int) error {
+	if h.tempDir == "" {
+		tempDir, err := os.MkdirTemp(h.spillDir, "aggregate-")
+		if err != nil {
+			return datatypes.NewIOError(err, "create aggregate spill dir")
+		}
+		h.tempDir = tempDir
+	}
+	if h.spillWriters == nil {
+		h.spillWriters = make([]*spillWriter, spillPartitions)
+	}
+
+	builders := make([][]datatypes.ArrowArrayBuilder, spillPartitions)
+	for group, accs := range table.accs {
+		values, err := table.values(group)
+		if err != nil {
+			return err
+		}
+		hash := fnv.New64a()
+		hash.Write(table.keys[group])
+		p := (hash.Sum64() >> (spillPartitionBits * level)) % spillPartitions
+		if builders[p] == nil {
+			builders[p] = newBuilders(h.stateSchema, 0)
+		}
+		if err := appendGroup(builders[p], values, accs, true); err != nil {
+			return err
+		}
+	}
+
+	for p, partitionBuilders := range builders {
+		if partitionBuilders == nil {
+			continue
+		}
+		if h.spillWriters[p] == nil {
+			writer, err := newSpillWriter(h.tempDir, h.stateSchema)
+			if err != nil {
+				return err
+			}
+			h.spillWriters[p] = writer
+		}
+		if err := h.spillWriters[p].write(buildBatch(h.stateSchema, partitionBuilders)); err != nil {
+			return err
+		}
 	}
-	return res
+	return nil
+}
+
+// mergePartition merges the states of the groups of a spilled partition in memory. Once the groups exceed
+// the memory limit, the partition is split into the partitions of the next level, which are merged later,
+// and no groups are returned.
+func (h *HashAggregateExec) mergePartition(path string, level int) (*groupTable, error) {
+	reader, err := openSpillFile(path, h.stateSchema)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.close()
+
+	table := newGroupTable()
+	split := false
+	for {
+		batch, ok, err := reader.read()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		if err := h.updateBatch(table, batch, true); err != nil {
+			return nil, err
+		}
+		if h.memoryLimit > 0 && table.memUsed > h.memoryLimit && level < maxSpillLevel {
+			if err := h.spill(table, level+1); err != nil {
+				return nil, err
+			}
+			table = newGroupTable()
+			split = true
+		}
+	}
+	if !split {
+		return table, nil
+	}
+	if len(table.keys) > 0 {
+		if err := h.spill(table, level+1); err != nil {
+			return nil, err
+		}
+	}
+	return newGroupTable(), h.closeSpillWriters(level + 1)
+}
+
+// cleanup closes the spill files left open by a failed aggregation and removes them, along with the groups
+func (h *HashAggregateExec) cleanup() {
+	h.table = newGroupTable()
+	h.spillPaths = nil
+	for _, writer := range h.spillWriters {
+		if writer != nil {
+			_, _ = writer.close()
+		}
+	}
+	h.spillWriters = nil
+	if h.tempDir != "" && os.RemoveAll(h.tempDir) == nil {
+		h.tempDir = ""
+	}
+}
+
+// groupMemorySize estimates the bytes of a group: its row key, accumulators and index entry
+func groupMemorySize(key []byte, accumulators int) int64 {
+	return int64(2*len(key)) + 96 + int64(accumulators)*48
 }
@@ -2,12 +2,16 @@ package plans
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
+	"fmt"
 	"github.com/stretchr/testify/require"
+	"os"
 	"query-engine/datasource"
 	"query-engine/datatypes"
 	"query-engine/physicalplan"
 	"query-engine/physicalplan/exprs"
+	"sort"
 	"testing"
 )
 
@@ -33,7 +37,8 @@ func TestHashAggregateExec_encode_decode(t *testing.T) {
 }
 
 func TestHashAggregateExec(t *testing.T) {
-	pds := datasource.NewParquetDataSource(filename, 10)
+	pds, err := datasource.NewParquetDataSource(filename, 10)
+	require.NoError(t, err)
 	headers := []string{"Id", "Bool_col", "Tinyint_col", "Smallint_col", "Int_col", "Bigint_col", "Float_col", "Double_col", "Date_string_col", "String_col", "Timestamp_col"}
 	for i, header := range headers {
 		require.Equal(t, header, pds.Schema().Fields[i].Name)
@@ -50,7 +55,9 @@ func TestHashAggregateExec(t *testing.T) {
 
 	plan := NewHashAggregateExec(scan, groupExpr, aggExpr, schema)
 
-	result := plan.Execute()
+	require.True(t, plan.Next(context.Background()))
+	result, err := plan.Execute(context.Background())
+	require.NoError(t, err)
 	require.Equal(t, 2, result.RowCount())
 
 	field0 := []bool{true, false}
@@ -68,3 +75,349 @@ HashAggregateExec: groupExpr=[#1], aggExpr=[MAX(#0) MIN(#0)]
 `
 	require.Equal(t, planFormat, physicalplan.PrettyFormat(plan))
 }
+
+func TestHashAggregateExec_two_phase(t *testing.T) {
+	groupExpr := []physicalplan.PhysicalExpr{exprs.NewColumnIndexExpr(1)}
+	aggExpr := []exprs.AggregateExpr{
+		exprs.NewMaxExpr(exprs.NewColumnIndexExpr(0)), exprs.NewSumExpr(exprs.NewColumnIndexExpr(0)),
+	}
+	schema := datatypes.Schema{Fields: []datatypes.Field{
+		{Name: "Bool_col", DataType: datatypes.BooleanType},
+		{Name: "Max(Id)", DataType: datatypes.Int32Type},
+		{Name: "Sum(Id)", DataType: datatypes.Int32Type},
+	}}
+
+	// every partition scans the whole file
+	partitions := parquetPartitions(t, 2, []string{"Id", "Bool_col"})
+	for i, input := range partitions {
+		partitions[i] = NewHashAggregateExecWithMode(input, PartialAggregate, groupExpr, aggExpr, schema, 0, 0, "")
+	}
+	require.Equal(t, "true,6,12\nfalse,7,16\n", collect(t, partitions[0]))
+
+	finalGroupExpr := []physicalplan.PhysicalExpr{exprs.NewColumnIndexExpr(0)}
+	plan := NewHashAggregateExecWithMode(
+		NewCoalesceExec(partitions[1:]), FinalAggregate, finalGroupExpr, aggExpr, schema, 0, 0, "")
+	require.Equal(t, "true,6,12\nfalse,7,16\n", collect(t, plan))
+
+	partitions = parquetPartitions(t, 2, []string{"Id", "Bool_col"})
+	for i, input := range partitions {
+		partitions[i] = NewHashAggregateExecWithMode(input, PartialAggregate, groupExpr, aggExpr, schema, 0, 0, "")
+	}
+	plan = NewHashAggregateExecWithMode(
+		NewCoalesceExec(partitions), FinalAggregate, finalGroupExpr, aggExpr, schema, 0, 0, "")
+	require.Equal(t, []string{"false,7,32", "true,6,24"}, sortedRows(collect(t, plan)))
+	require.Equal(t, "HashAggregateExec: mode=final, groupExpr=[#0], aggExpr=[MAX(#0) SUM(#0)]", plan.String())
+}
+
+func TestHashAggregateExec_no_group_by_empty_input(t *testing.T) {
+	aggExpr := []exprs.AggregateExpr{exprs.NewCountExpr(exprs.NewColumnIndexExpr(0)), exprs.NewSumExpr(exprs.NewColumnIndexExpr(0))}
+	schema := datatypes.Schema{Fields: []datatypes.Field{
+		{Name: "COUNT(#id)", DataType: datatypes.UInt64Type},
+		{Name: "SUM(#id)", DataType: datatypes.Int64Type},
+	}}
+	empty := func() ScanExec {
+		return memScan(datatypes.Schema{Fields: []datatypes.Field{{Name: "id", DataType: datatypes.Int64Type}}}, []interface{}{})
+	}
+
+	// the aggregation without GROUP BY returns a single row even without input rows
+	plan := NewHashAggregateExec(empty(), nil, aggExpr, schema)
+	require.Equal(t, "0,null\n", collect(t, plan))
+
+	// the partial aggregations have no group, the final one returns the single row
+	partial := NewHashAggregateExecWithMode(empty(), PartialAggregate, nil, aggExpr, schema, 0, 0, "")
+	require.Equal(t, "", collect(t, partial))
+	partitions := []physicalplan.PhysicalPlan{
+		NewHashAggregateExecWithMode(empty(), PartialAggregate, nil, aggExpr, schema, 0, 0, ""),
+		NewHashAggregateExecWithMode(empty(), PartialAggregate, nil, aggExpr, schema, 0, 0, ""),
+	}
+	plan = NewHashAggregateExecWithMode(NewCoalesceExec(partitions), FinalAggregate, nil, aggExpr, schema, 0, 0, "")
+	require.Equal(t, "0,null\n", collect(t, plan))
+
+	// a GROUP BY returns no group
+	plan = NewHashAggregateExec(empty(), []physicalplan.PhysicalExpr{exprs.NewColumnIndexExpr(0)}, aggExpr[:1], datatypes.Schema{
+		Fields: []datatypes.Field{{Name: "id", DataType: datatypes.Int64Type}, schema.Fields[0]},
+	})
+	require.Equal(t, "", collect(t, plan))
+}
+
+// failingStateExpr is an aggregate whose state can't be encoded
+type failingStateExpr struct {
+	exprs.AggregateExpr
+}
+
+func (f failingStateExpr) CreateAccumulator() exprs.Accumulator {
+	return failingStateAccumulator{f.AggregateExpr.CreateAccumulator()}
+}
+
+type failingStateAccumulator struct {
+	exprs.Accumulator
+}
+
+func (f failingStateAccumulator) State() ([]interface{}, error) {
+	return nil, datatypes.NewSchemaError("can't encode state")
+}
+
+func TestHashAggregateExec_state_error(t *testing.T) {
+	aggExpr := []exprs.AggregateExpr{failingStateExpr{exprs.NewCountExpr(exprs.NewColumnIndexExpr(0))}}
+	schema := datatypes.Schema{Fields: []datatypes.Field{
+		{Name: "Bool_col", DataType: datatypes.BooleanType},
+		{Name: "COUNT(#Id)", DataType: datatypes.UInt64Type},
+	}}
+	groupExpr := []physicalplan.PhysicalExpr{exprs.NewColumnIndexExpr(1)}
+
+	// the partial output and the spill files have the states
+	for _, memoryLimit := range []int64{0, 1} {
+		input := parquetScan(t, 3, []string{"Id", "Bool_col"})
+		plan := NewHashAggregateExecWithMode(input, PartialAggregate, groupExpr, aggExpr, schema, 0, memoryLimit, t.TempDir())
+		require.True(t, plan.Next(context.Background()))
+		_, err := plan.Execute(context.Background())
+		require.EqualError(t, err, "can't encode state")
+		require.False(t, plan.Next(context.Background()))
+	}
+}
+
+func TestHashAggregateExec_group_keys(t *testing.T) {
+	schema := datatypes.Schema{Fields: []datatypes.Field{
+		{Name: "a", DataType: datatypes.StringType},
+		{Name: "b", DataType: datatypes.StringType},
+		{Name: "value", DataType: datatypes.Int64Type},
+	}}
+	scan := memScan(schema,
+		[]interface{}{"1", "11", nil, "<nil>", "1", nil},
+		[]interface{}{"11", "1", "x", "x", "11", "x"},
+		[]interface{}{int64(1), int64(2), int64(3), int64(4), int64(5), int64(6)},
+	)
+	groupExpr := []physicalplan.PhysicalExpr{exprs.NewColumnIndexExpr(0), exprs.NewColumnIndexExpr(1)}
+	aggExpr := []exprs.AggregateExpr{exprs.NewSumExpr(exprs.NewColumnIndexExpr(2))}
+	schema.Fields[2].Name = "Sum(value)"
+
+	plan := NewHashAggregateExec(scan, groupExpr, aggExpr, schema)
+	require.True(t, plan.Next(context.Background()))
+	result, err := plan.Execute(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 4, result.RowCount())
+	expect := [][]interface{}{{"1", "11", int64(6)}, {"11", "1", int64(2)}, {nil, "x", int64(9)}, {"<nil>", "x", int64(4)}}
+	for i, row := range expect {
+		for j, value := range row {
+			require.Equal(t, value, result.Field(j).GetValue(i), "row %d, column %d", i, j)
+		}
+	}
+}
+
+func TestHashAggregateExec_spill(t *testing.T) {
+	groupExpr := []physicalplan.PhysicalExpr{exprs.NewColumnIndexExpr(0), exprs.NewColumnIndexExpr(1)}
+	aggExpr := []exprs.AggregateExpr{
+		exprs.NewMaxExpr(exprs.NewColumnIndexExpr(0)), exprs.NewSumExpr(exprs.NewColumnIndexExpr(0)),
+	}
+	schema := datatypes.Schema{Fields: []datatypes.Field{
+		{Name: "Id", DataType: datatypes.Int32Type},
+		{Name: "Bool_col", DataType: datatypes.BooleanType},
+		{Name: "Max(Id)", DataType: datatypes.Int32Type},
+		{Name: "Sum(Id)", DataType: datatypes.Int32Type},
+	}}
+	expect := []string{
+		"0,true,0,0", "1,false,1,1", "2,true,2,2", "3,false,3,3",
+		"4,true,4,4", "5,false,5,5", "6,true,6,6", "7,false,7,7",
+	}
+
+	inMemory := NewHashAggregateExec(parquetScan(t, 3, []string{"Id", "Bool_col"}), groupExpr, aggExpr, schema)
+	require.Equal(t, expect, sortedRows(collect(t, inMemory)))
+
+	// a limit of 1 byte spills the groups after every batch
+	spillDir := t.TempDir()
+	spilled := NewHashAggregateExecWithMode(
+		parquetScan(t, 3, []string{"Id", "Bool_col"}), SingleAggregate, groupExpr, aggExpr, schema, 0, 1, spillDir)
+	require.Equal(t, expect, sortedRows(collect(t, spilled)))
+
+	// the partial and final aggregations spill the states
+	partitions := parquetPartitions(t, 2, []string{"Id", "Bool_col"})
+	for i, input := range partitions {
+		partitions[i] = NewHashAggregateExecWithMode(input, PartialAggregate, groupExpr, aggExpr, schema, 0, 1, spillDir)
+	}
+	finalGroupExpr := []physicalplan.PhysicalExpr{exprs.NewColumnIndexExpr(0), exprs.NewColumnIndexExpr(1)}
+	final := NewHashAggregateExecWithMode(
+		NewCoalesceExec(partitions), FinalAggregate, finalGroupExpr, aggExpr, schema, 0, 1, spillDir)
+	require.Equal(t, []string{
+		"0,true,0,0", "1,false,1,2", "2,true,2,4", "3,false,3,6",
+		"4,true,4,8", "5,false,5,10", "6,true,6,12", "7,false,7,14",
+	}, sortedRows(collect(t, final)))
+
+	// the spill files are removed once the aggregation is done
+	entries, err := os.ReadDir(spillDir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestHashAggregateExec_spill_split_partitions(t *testing.T) {
+	schema := datatypes.Schema{Fields: []datatypes.Field{
+		{Name: "key", DataType: datatypes.Int64Type},
+		{Name: "value", DataType: datatypes.Int64Type},
+	}}
+	keys, values := make([]interface{}, 1000), make([]interface{}, 1000)
+	expect := make([]string, 1000)
+	for i := range keys {
+		keys[i], values[i] = int64(i), int64(2*i)
+		expect[i] = fmt.Sprintf("%d,%d", i, 2*i)
+	}
+	sort.Strings(expect)
+	groupExpr := []physicalplan.PhysicalExpr{exprs.NewColumnIndexExpr(0)}
+	aggExpr := []exprs.AggregateExpr{exprs.NewSumExpr(exprs.NewColumnIndexExpr(1))}
+
+	// every spilled partition holds about 60 groups, over the limit, so it is split again before its merge
+	spillDir := t.TempDir()
+	memoryLimit := int64(4000)
+	plan := NewHashAggregateExecWithMode(
+		memScan(schema, keys, values), SingleAggregate, groupExpr, aggExpr, schema, 0, memoryLimit, spillDir)
+	res := ""
+	for plan.Next(context.Background()) {
+		require.LessOrEqual(t, plan.table.memUsed, memoryLimit)
+		batch, err := plan.Execute(context.Background())
+		require.NoError(t, err)
+		res += batch.ToCSV()
+	}
+	require.Equal(t, expect, sortedRows(res))
+	entries, err := os.ReadDir(spillDir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestHashAggregateExec_close_removes_spill_files(t *testing.T) {
+	groupExpr := []physicalplan.PhysicalExpr{exprs.NewColumnIndexExpr(0)}
+	aggExpr := []exprs.AggregateExpr{exprs.NewMaxExpr(exprs.NewColumnIndexExpr(1))}
+	schema := datatypes.Schema{Fields: []datatypes.Field{
+		{Name: "Id", DataType: datatypes.Int32Type},
+		{Name: "Max(Bool_col)", DataType: datatypes.BooleanType},
+	}}
+
+	// the consumer stops after the first batch, like a LIMIT
+	spillDir := t.TempDir()
+	plan := NewHashAggregateExecWithMode(parquetScan(t, 2, []string{"Id", "Bool_col"}),
+		SingleAggregate, groupExpr, aggExpr, schema, 1, 1, spillDir)
+	require.True(t, plan.Next(context.Background()))
+	entries, err := os.ReadDir(spillDir)
+	require.NoError(t, err)
+	require.NotEmpty(t, entries)
+	plan.Close()
+	plan.Close()
+	entries, err = os.ReadDir(spillDir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestHashAggregateExec_batches(t *testing.T) {
+	groupExpr := []physicalplan.PhysicalExpr{exprs.NewColumnIndexExpr(0)}
+	aggExpr := []exprs.AggregateExpr{exprs.NewMaxExpr(exprs.NewColumnIndexExpr(1))}
+	schema := datatypes.Schema{Fields: []datatypes.Field{
+		{Name: "Id", DataType: datatypes.Int32Type},
+		{Name: "Max(Bool_col)", DataType: datatypes.BooleanType},
+	}}
+	expect := []string{"0,true", "1,false", "2,true", "3,false", "4,true", "5,false", "6,true", "7,false"}
+
+	for _, memoryLimit := range []int64{0, 1} {
+		plan := NewHashAggregateExecWithMode(parquetScan(t, 2, []string{"Id", "Bool_col"}),
+			SingleAggregate, groupExpr, aggExpr, schema, 3, memoryLimit, t.TempDir())
+		res := ""
+		batches := collectBatches(t, plan)
+		for _, batch := range batches {
+			require.LessOrEqual(t, batch.RowCount(), 3)
+			res += batch.ToCSV()
+		}
+		require.Equal(t, expect, sortedRows(res))
+		if memoryLimit == 0 {
+			require.Len(t, batches, 3)
+		}
+	}
+
+	// an empty input returns a single empty batch
+	empty := memScan(datatypes.Schema{Fields: []datatypes.Field{
+		{Name: "Id", DataType: datatypes.Int32Type},
+		{Name: "Bool_col", DataType: datatypes.BooleanType},
+	}}, []interface{}{}, []interface{}{})
+	plan := NewHashAggregateExecWithMode(empty, SingleAggregate, groupExpr, aggExpr, schema, 3, 0, "")
+	require.True(t, plan.Next(context.Background()))
+	batch, err := plan.Execute(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 0, batch.RowCount())
+	require.False(t, plan.Next(context.Background()))
+}
+
+func TestHashAggregateExec_spill_buffered_values(t *testing.T) {
+	schema := datatypes.Schema{Fields: []datatypes.Field{
+		{Name: "key", DataType: datatypes.StringType},
+		{Name: "value", DataType: datatypes.Int64Type},
+	}}
+	keys, values := make([]interface{}, 100), make([]interface{}, 100)
+	for i := range keys {
+		keys[i], values[i] = "a", int64(i)
+	}
+	groupExpr := []physicalplan.PhysicalExpr{exprs.NewColumnIndexExpr(0)}
+
+	tests := []struct {
+		aggExpr exprs.AggregateExpr
+		field   datatypes.Field
+		expect  string
+	}{
+		{
+			exprs.NewPercentileContExpr(exprs.NewColumnIndexExpr(1), 0.5),
+			datatypes.Field{Name: "PERCENTILE_CONT(value, 0.5)", DataType: datatypes.DoubleType},
+			"a,49.5\n",
+		},
+		{
+			exprs.NewCountDistinctExpr(exprs.NewColumnIndexExpr(1)),
+			datatypes.Field{Name: "COUNT(DISTINCT value)", DataType: datatypes.UInt64Type},
+			"a,100\n",
+		},
+		{
+			exprs.NewApproxCountDistinctExpr(exprs.NewColumnIndexExpr(1)),
+			datatypes.Field{Name: "APPROX_COUNT_DISTINCT(value)", DataType: datatypes.UInt64Type},
+			"a,100\n",
+		},
+	}
+	for _, test := range tests {
+		outputSchema := datatypes.Schema{Fields: []datatypes.Field{schema.Fields[0], test.field}}
+
+		// the single group is smaller than the limit, its buffered values or registers are not
+		plan := NewHashAggregateExecWithMode(memScan(schema, keys, values), SingleAggregate,
+			groupExpr, []exprs.AggregateExpr{test.aggExpr}, outputSchema, 0, 1000, t.TempDir())
+		require.True(t, plan.Next(context.Background()))
+		require.NotEmpty(t, plan.tempDir, test.field.Name)
+		batch, err := plan.Execute(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, test.expect, batch.ToCSV())
+	}
+}
+
+func TestHashAggregateExec_filter(t *testing.T) {
+	groupExpr := []physicalplan.PhysicalExpr{exprs.NewColumnIndexExpr(0)}
+	aggExpr := []exprs.AggregateExpr{
+		exprs.NewSumExpr(exprs.NewColumnIndexExpr(1)),
+		exprs.NewFilteredAggregateExpr(exprs.NewSumExpr(exprs.NewColumnIndexExpr(1)),
+			exprs.NewGtExpr(exprs.NewColumnIndexExpr(1), exprs.NewLiteralLongExpr(2))),
+		exprs.NewFilteredAggregateExpr(exprs.NewCountExpr(exprs.NewColumnIndexExpr(1)),
+			exprs.NewNeqExpr(exprs.NewColumnIndexExpr(0), exprs.NewLiteralStringExpr("CO"))),
+	}
+	schema := datatypes.Schema{Fields: []datatypes.Field{
+		{Name: "state", DataType: datatypes.StringType},
+		{Name: "SUM(salary)", DataType: datatypes.Int64Type},
+		{Name: "SUM(salary) FILTER (WHERE salary > 2)", DataType: datatypes.Int64Type},
+		{Name: "COUNT(salary) FILTER (WHERE state != 'CO')", DataType: datatypes.UInt64Type},
+	}}
+
+	// the rows of a null predicate are filtered out, a group without rows has the value of an empty aggregate
+	plan := NewHashAggregateExec(sortedStateScan(), groupExpr, aggExpr, schema)
+	require.Equal(t, []string{"CA,3,null,2", "CO,12,12,0", "null,6,6,0"}, sortedRows(collect(t, plan)))
+	require.Equal(t, "HashAggregateExec: groupExpr=[#0], aggExpr=[SUM(#1) SUM(#1) FILTER (WHERE #1 > 2) "+
+		"COUNT(#1) FILTER (WHERE #0 != 'CO')]", plan.String())
+
+	sorted := NewSortAggregateExec(sortedStateScan(), SingleAggregate, groupExpr, aggExpr, schema, 0)
+	require.Equal(t, "CA,3,null,2\nCO,12,12,0\nnull,6,6,0\n", collect(t, sorted))
+
+	// the partial states are the ones of the filtered rows, the final aggregation merges them unfiltered
+	partitions := []physicalplan.PhysicalPlan{
+		NewHashAggregateExecWithMode(sortedStateScan(), PartialAggregate, groupExpr, aggExpr, schema, 0, 0, ""),
+		NewHashAggregateExecWithMode(sortedStateScan(), PartialAggregate, groupExpr, aggExpr, schema, 0, 0, ""),
+	}
+	final := NewHashAggregateExecWithMode(
+		NewCoalesceExec(partitions), FinalAggregate, groupExpr, aggExpr, schema, 0, 0, "")
+	require.Equal(t, []string{"CA,6,null,4", "CO,24,24,0", "null,12,12,0"}, sortedRows(collect(t, final)))
+}
@@ -0,0 +1,135 @@
+package plans
+
+import (
+	"context"
+	"fmt"
+	"query-engine/datatypes"
+	"query-engine/physicalplan"
+	"sync"
+)
+
+// CoalesceExec merges the partitions of its inputs into a single partition: the first Next starts
+// a goroutine for every input, and the batches are returned in the order the goroutines produce them,
+// so that the order of the rows across partitions isn't kept.
+type CoalesceExec struct {
+	inputs []physicalplan.PhysicalPlan
+
+	// results of the input goroutines, closed once they are all done
+	results chan exchangeResult
+	// cancel stops the input goroutines
+	cancel context.CancelFunc
+
+	// batch prepared by Next, or the error of preparing it
+	batch datatypes.RecordBatch
+	err   error
+}
+
+// exchangeResult is a batch, or the error of producing it, sent by an input goroutine
+type exchangeResult struct {
+	batch datatypes.RecordBatch
+	err   error
+}
+
+// closePlans closes every plan
+func closePlans(plans []physicalplan.PhysicalPlan) {
+	for _, plan := range plans {
+		plan.Close()
+	}
+}
+
+func NewCoalesceExec(inputs []physicalplan.PhysicalPlan) *CoalesceExec {
+	return &CoalesceExec{inputs: inputs}
+}
+
+func (c *CoalesceExec) Schema() datatypes.Schema {
+	return c.inputs[0].Schema()
+}
+
+func (c *CoalesceExec) Execute(ctx context.Context) (datatypes.RecordBatch, error) {
+	return c.batch, c.err
+}
+
+// Next waits for a batch of any input, once an input fails the error is returned by Execute
+// and the other inputs are cancelled.
+func (c *CoalesceExec) Next(ctx context.Context) bool {
+	if c.err != nil {
+		return false
+	}
+	if c.results == nil {
+		c.start(ctx)
+	}
+	select {
+	case result, ok := <-c.results:
+		if !ok {
+			c.cancel()
+			return false
+		}
+		c.batch, c.err = result.batch, result.err
+		if c.err != nil {
+			c.cancel()
+		}
+		return true
+	case <-ctx.Done():
+		c.cancel()
+		c.err = ctx.Err()
+		return true
+	}
+}
+
+func (c *CoalesceExec) Children() []physicalplan.PhysicalPlan {
+	return c.inputs
+}
+
+// Close stops the input goroutines and waits for them, every goroutine closes its input
+func (c *CoalesceExec) Close() {
+	if c.results == nil {
+		closePlans(c.inputs)
+		return
+	}
+	c.cancel()
+	for range c.results {
+	}
+}
+
+func (c *CoalesceExec) OutputPartitioning() physicalplan.Partitioning {
+	return physicalplan.SinglePartition()
+}
+
+// OutputOrdering is unknown, as the batches of the partitions are interleaved
+func (c *CoalesceExec) OutputOrdering() []physicalplan.PhysicalExpr {
+	return nil
+}
+
+func (c *CoalesceExec) String() string {
+	return fmt.Sprintf("CoalesceExec: partitions=%d", len(c.inputs))
+}
+
+func (c *CoalesceExec) start(ctx context.Context) {
+	inputCtx, cancel := context.WithCancel(ctx)
+	c.cancel = cancel
+	c.results = make(chan exchangeResult, len(c.inputs))
+
+	var wg sync.WaitGroup
+	wg.Add(len(c.inputs))
+	for _, input := range c.inputs {
+		go func(input physicalplan.PhysicalPlan) {
+			defer wg.Done()
+			defer input.Close()
+			for input.Next(inputCtx) {
+				batch, err := input.Execute(inputCtx)
+				select {
+				case c.results <- exchangeResult{batch: batch, err: err}:
+				case <-inputCtx.Done():
+					return
+				}
+				if err != nil {
+					return
+				}
+			}
+		}(input)
+	}
+	go func() {
+		wg.Wait()
+		close(c.results)
+	}()
+}
@@ -0,0 +1,65 @@
+package plans
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"query-engine/datatypes"
+	"query-engine/physicalplan"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// sortedRows returns the csv rows in order, as the order of the rows across partitions isn't kept
+func sortedRows(csv string) []string {
+	rows := strings.Split(strings.TrimSuffix(csv, "\n"), "\n")
+	sort.Strings(rows)
+	return rows
+}
+
+func parquetPartitions(t *testing.T, n int, projection []string) []physicalplan.PhysicalPlan {
+	partitions := make([]physicalplan.PhysicalPlan, n)
+	for i := range partitions {
+		partitions[i] = parquetScan(t, 3, projection)
+	}
+	return partitions
+}
+
+func TestCoalesceExec(t *testing.T) {
+	plan := NewCoalesceExec(parquetPartitions(t, 3, []string{"Id"}))
+	require.Equal(t, physicalplan.SinglePartition(), plan.OutputPartitioning())
+
+	expect := make([]string, 0)
+	for _, id := range []string{"0", "1", "2", "3", "4", "5", "6", "7"} {
+		expect = append(expect, id, id, id)
+	}
+	require.Equal(t, expect, sortedRows(collect(t, plan)))
+	require.False(t, plan.Next(context.Background()))
+}
+
+func TestCoalesceExec_error(t *testing.T) {
+	partitions := parquetPartitions(t, 2, []string{"Id"})
+	partitions = append(partitions, parquetScan(t, 3, []string{"Missing"}))
+	plan := NewCoalesceExec(partitions)
+
+	var err error
+	for err == nil && plan.Next(context.Background()) {
+		_, err = plan.Execute(context.Background())
+	}
+	var schemaErr *datatypes.SchemaError
+	require.True(t, errors.As(err, &schemaErr))
+	require.False(t, plan.Next(context.Background()))
+}
+
+func TestCoalesceExec_cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	plan := NewCoalesceExec(parquetPartitions(t, 2, []string{"Id"}))
+
+	var err error
+	for err == nil && plan.Next(ctx) {
+		_, err = plan.Execute(ctx)
+	}
+	require.ErrorIs(t, err, context.Canceled)
+}
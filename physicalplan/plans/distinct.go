@@ -0,0 +1,77 @@
+package plans
+
+import (
+	"context"
+	"query-engine/datatypes"
+	"query-engine/physicalplan"
+)
+
+// HashDistinctExec streams the rows of its input which were not returned before, the rows returned so far
+// are kept in a hash set. The rows are compared on all the columns, nulls are equal to each other.
+// The duplicates are only removed within a partition, so that the input must be partitioned by all its columns.
+type HashDistinctExec struct {
+	input physicalplan.PhysicalPlan
+	seen  *rowSet
+
+	// batch prepared by Next, or the error of preparing it
+	batch datatypes.RecordBatch
+	err   error
+}
+
+func NewHashDistinctExec(input physicalplan.PhysicalPlan) *HashDistinctExec {
+	return &HashDistinctExec{input: input, seen: newRowSet()}
+}
+
+func (h *HashDistinctExec) Schema() datatypes.Schema {
+	return h.input.Schema()
+}
+
+func (h *HashDistinctExec) Execute(ctx context.Context) (datatypes.RecordBatch, error) {
+	return h.batch, h.err
+}
+
+// Next filters the rows of the next input batch, as the seen rows must be updated once per batch
+func (h *HashDistinctExec) Next(ctx context.Context) bool {
+	if h.err != nil || !h.input.Next(ctx) {
+		return false
+	}
+	batch, err := h.input.Execute(ctx)
+	if err != nil {
+		h.err = err
+		return true
+	}
+	rows := make([]int, 0)
+	for rowIdx := 0; rowIdx < batch.RowCount(); rowIdx++ {
+		added, err := h.seen.add(batch, rowIdx)
+		if err != nil {
+			h.err = err
+			return true
+		}
+		if added {
+			rows = append(rows, rowIdx)
+		}
+	}
+	h.batch = takeRows(batch, rows)
+	return true
+}
+
+func (h *HashDistinctExec) Children() []physicalplan.PhysicalPlan {
+	return []physicalplan.PhysicalPlan{h.input}
+}
+
+func (h *HashDistinctExec) Close() {
+	h.input.Close()
+}
+
+func (h *HashDistinctExec) OutputPartitioning() physicalplan.Partitioning {
+	return h.input.OutputPartitioning()
+}
+
+// OutputOrdering is the ordering of the input, as the first row of every duplicate is kept in place
+func (h *HashDistinctExec) OutputOrdering() []physicalplan.PhysicalExpr {
+	return h.input.OutputOrdering()
+}
+
+func (h *HashDistinctExec) String() string {
+	return "HashDistinctExec"
+}
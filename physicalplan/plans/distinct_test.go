@@ -0,0 +1,28 @@
+package plans
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"query-engine/datatypes"
+	"testing"
+)
+
+func TestHashDistinctExec(t *testing.T) {
+	schema := datatypes.Schema{Fields: []datatypes.Field{
+		{Name: "state", DataType: datatypes.StringType},
+		{Name: "salary", DataType: datatypes.Int64Type},
+	}}
+	input := memScan(schema,
+		[]interface{}{"CA", "CO", "CA", nil, "CO", nil},
+		[]interface{}{int64(1), int64(2), int64(1), nil, int64(3), nil},
+	)
+
+	// the input returns a row per batch, the duplicates span several batches and the nulls are equal
+	plan := NewHashDistinctExec(input)
+	require.Equal(t, "CA,1\nCO,2\nnull,null\nCO,3\n", collect(t, plan))
+	require.Equal(t, schema, plan.Schema())
+	require.Equal(t, "HashDistinctExec", plan.String())
+
+	ordered := NewHashDistinctExec(sortedStateScan())
+	require.Equal(t, fmt.Sprint(sortedStateScan().OutputOrdering()), fmt.Sprint(ordered.OutputOrdering()))
+}
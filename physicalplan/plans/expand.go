@@ -0,0 +1,107 @@
+package plans
+
+import (
+	"context"
+	"fmt"
+	"query-engine/datatypes"
+	"query-engine/physicalplan"
+)
+
+// ExpandExec returns every input batch once for every grouping set, its columns followed by the group keys
+// and the index of the grouping set. The keys which are not part of the grouping set are null, so that
+// an aggregation by the keys and the index groups the rows by every grouping set in a single pass over the input.
+type ExpandExec struct {
+	input     physicalplan.PhysicalPlan
+	groupExpr []physicalplan.PhysicalExpr
+	// groupingSets are lists of indexes of groupExpr
+	groupingSets [][]int
+	// schema is the input fields followed by the fields of the groupExpr and the Int64 field of the index
+	schema datatypes.Schema
+
+	// input batch being expanded, keys are its group keys and set is the next grouping set to return
+	recordBatch datatypes.RecordBatch
+	keys        []datatypes.ColumnArray
+	set         int
+
+	// batch prepared by Next, or the error of preparing it
+	batch datatypes.RecordBatch
+	err   error
+}
+
+func NewExpandExec(
+	input physicalplan.PhysicalPlan, groupExpr []physicalplan.PhysicalExpr, groupingSets [][]int, schema datatypes.Schema,
+) *ExpandExec {
+	return &ExpandExec{
+		input:        input,
+		groupExpr:    groupExpr,
+		groupingSets: groupingSets,
+		schema:       schema,
+		set:          len(groupingSets),
+	}
+}
+
+func (e *ExpandExec) Schema() datatypes.Schema {
+	return e.schema
+}
+
+func (e *ExpandExec) Execute(ctx context.Context) (datatypes.RecordBatch, error) {
+	return e.batch, e.err
+}
+
+// Next reads an input batch once all the grouping sets of the previous one are returned
+func (e *ExpandExec) Next(ctx context.Context) bool {
+	if e.err != nil {
+		return false
+	}
+	if e.set >= len(e.groupingSets) {
+		if !e.input.Next(ctx) {
+			return false
+		}
+		e.recordBatch, e.err = e.input.Execute(ctx)
+		if e.err == nil {
+			e.keys, e.err = evaluateExprs(e.groupExpr, e.recordBatch)
+		}
+		if e.err != nil {
+			return true
+		}
+		e.set = 0
+	}
+
+	rows := e.recordBatch.RowCount()
+	fields := append([]datatypes.ColumnArray{}, e.recordBatch.Fields...)
+	included := make([]bool, len(e.groupExpr))
+	for _, idx := range e.groupingSets[e.set] {
+		included[idx] = true
+	}
+	for i, key := range e.keys {
+		if !included[i] {
+			key = datatypes.NewLiteralValueArray(key.GetType(), nil, rows)
+		}
+		fields = append(fields, key)
+	}
+	fields = append(fields, datatypes.NewLiteralValueArray(datatypes.Int64Type, int64(e.set), rows))
+	e.batch = datatypes.RecordBatch{Schema: e.schema, Fields: fields}
+	e.set++
+	return true
+}
+
+func (e *ExpandExec) Children() []physicalplan.PhysicalPlan {
+	return []physicalplan.PhysicalPlan{e.input}
+}
+
+func (e *ExpandExec) Close() {
+	e.input.Close()
+}
+
+func (e *ExpandExec) OutputPartitioning() physicalplan.Partitioning {
+	return physicalplan.UnknownPartitioning(e.input.OutputPartitioning().Count)
+}
+
+// OutputOrdering is unknown, as the rows are returned once for every grouping set
+func (e *ExpandExec) OutputOrdering() []physicalplan.PhysicalExpr {
+	return nil
+}
+
+func (e *ExpandExec) String() string {
+	return fmt.Sprintf("ExpandExec: groupExpr=%v, groupingSets=%v", e.groupExpr, e.groupingSets)
+}
@@ -0,0 +1,53 @@
+package plans
+
+import (
+	"github.com/stretchr/testify/require"
+	"query-engine/datatypes"
+	"query-engine/physicalplan"
+	"query-engine/physicalplan/exprs"
+	"testing"
+)
+
+func expandSchema() datatypes.Schema {
+	return datatypes.Schema{Fields: []datatypes.Field{
+		{Name: "state", DataType: datatypes.StringType},
+		{Name: "salary", DataType: datatypes.Int64Type},
+		{Name: "state", DataType: datatypes.StringType},
+		{Name: "grouping_set", DataType: datatypes.Int64Type},
+	}}
+}
+
+func TestExpandExec(t *testing.T) {
+	input := memScan(datatypes.Schema{Fields: expandSchema().Fields[:2]},
+		[]interface{}{"CA", "CO", nil},
+		[]interface{}{int64(1), int64(2), int64(3)},
+	)
+	groupExpr := []physicalplan.PhysicalExpr{exprs.NewColumnIndexExpr(0)}
+	plan := NewExpandExec(input, groupExpr, [][]int{{0}, {}}, expandSchema())
+
+	// the scan returns a row per batch, every batch is returned by grouping set
+	expect := "CA,1,CA,0\nCA,1,null,1\nCO,2,CO,0\nCO,2,null,1\nnull,3,null,0\nnull,3,null,1\n"
+	require.Equal(t, expect, collect(t, plan))
+	require.Equal(t, "ExpandExec: groupExpr=[#0], groupingSets=[[0] []]", plan.String())
+}
+
+func TestExpandExec_aggregate(t *testing.T) {
+	groupExpr := []physicalplan.PhysicalExpr{exprs.NewColumnIndexExpr(0)}
+	expand := NewExpandExec(sortedStateScan(), groupExpr, [][]int{{0}, {}}, expandSchema())
+
+	// the null state of the grand total is told from the null state by the index of the grouping set
+	aggExpr := []exprs.AggregateExpr{
+		exprs.NewSumExpr(exprs.NewColumnIndexExpr(1)),
+		exprs.NewGroupingExpr(exprs.NewColumnIndexExpr(3), groupExpr, []int64{0, 1}),
+	}
+	schema := datatypes.Schema{Fields: []datatypes.Field{
+		{Name: "state", DataType: datatypes.StringType},
+		{Name: "grouping_set", DataType: datatypes.Int64Type},
+		{Name: "SUM(salary)", DataType: datatypes.Int64Type},
+		{Name: "GROUPING(state)", DataType: datatypes.Int64Type},
+	}}
+	plan := NewHashAggregateExec(expand, []physicalplan.PhysicalExpr{exprs.NewColumnIndexExpr(2), exprs.NewColumnIndexExpr(3)},
+		aggExpr, schema)
+	// the scan returns a row per batch, so that the grand total is found after the first row
+	require.Equal(t, "CA,0,3,0\nnull,1,21,1\nCO,0,12,0\nnull,0,6,0\n", collect(t, plan))
+}
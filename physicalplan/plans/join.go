@@ -0,0 +1,302 @@
+package plans
+
+import (
+	"context"
+	"fmt"
+	"github.com/apache/arrow/go/v6/arrow/memory"
+	"query-engine/datatypes"
+	"query-engine/logicalplan"
+	"query-engine/physicalplan"
+	"strings"
+)
+
+// HashJoinExec is an equi-join: it loads the whole build side into a hash table keyed
+// by the join keys, then streams the probe side batch by batch looking up matching rows.
+// The right input is the build side for inner, left, semi and anti joins, the left input for right joins,
+// so that unmatched probe rows can be padded with nulls as soon as they are read.
+// The rows matching the keys must also satisfy the optional residual filter.
+type HashJoinExec struct {
+	left     physicalplan.PhysicalPlan
+	right    physicalplan.PhysicalPlan
+	joinType logicalplan.JoinType
+
+	// leftKeys and rightKeys are the column indices of the join keys, compared pairwise for equality
+	leftKeys  []int
+	rightKeys []int
+
+	// leftOutput and rightOutput are the column indices of each input in the output,
+	// the output is always the left columns followed by the right columns
+	leftOutput  []int
+	rightOutput []int
+
+	// filter is the residual predicate, nil matches the rows with equal keys
+	filter *joinFilter
+
+	schema datatypes.Schema
+
+	// build side, loaded by the first Next
+	built        bool
+	buildBatches []datatypes.RecordBatch
+	// hashTable maps the row keys of the build keys to their rows, see appendRowKey
+	hashTable map[string][]rowRef
+	// err of loading the build side, returned by Execute
+	err error
+
+	// row and buf are reused to build the row keys
+	row []interface{}
+	buf []byte
+}
+
+// rowRef locates a row of the build side
+type rowRef struct {
+	batch int
+	row   int
+}
+
+func NewHashJoinExec(
+	left, right physicalplan.PhysicalPlan, joinType logicalplan.JoinType,
+	leftKeys, rightKeys []int, leftOutput, rightOutput []int, schema datatypes.Schema,
+) *HashJoinExec {
+	return &HashJoinExec{
+		left:        left,
+		right:       right,
+		joinType:    joinType,
+		leftKeys:    leftKeys,
+		rightKeys:   rightKeys,
+		leftOutput:  leftOutput,
+		rightOutput: rightOutput,
+		schema:      schema,
+	}
+}
+
+// NewHashJoinExecWithFilter also matches the pairs of rows on the filter, evaluated against the left columns
+// followed by the right columns
+func NewHashJoinExecWithFilter(
+	left, right physicalplan.PhysicalPlan, joinType logicalplan.JoinType,
+	leftKeys, rightKeys []int, leftOutput, rightOutput []int, filter physicalplan.PhysicalExpr, schema datatypes.Schema,
+) *HashJoinExec {
+	h := NewHashJoinExec(left, right, joinType, leftKeys, rightKeys, leftOutput, rightOutput, schema)
+	h.filter = newJoinFilter(filter, left, right)
+	return h
+}
+
+func (h *HashJoinExec) Schema() datatypes.Schema {
+	return h.schema
+}
+
+func (h *HashJoinExec) Execute(ctx context.Context) (datatypes.RecordBatch, error) {
+	if h.err != nil {
+		return datatypes.RecordBatch{}, h.err
+	}
+	_, probe := h.sides()
+	_, probeKeys := h.keys()
+	probeBatch, err := probe.Execute(ctx)
+	if err != nil {
+		return datatypes.RecordBatch{}, err
+	}
+
+	builders := make([]datatypes.ArrowArrayBuilder, len(h.schema.Fields))
+	for i, field := range h.schema.Fields {
+		builders[i] = datatypes.NewArrowArrayBuilder(memory.NewGoAllocator(), field.DataType)
+	}
+
+	for rowIdx := 0; rowIdx < probeBatch.RowCount(); rowIdx++ {
+		var matches []rowRef
+		ok, err := h.joinKey(probeBatch, probeKeys, rowIdx)
+		if err != nil {
+			return datatypes.RecordBatch{}, err
+		}
+		if ok {
+			matches = h.hashTable[string(h.buf)]
+		}
+		if h.filter != nil && len(matches) > 0 {
+			if matches, err = h.filterMatches(&probeBatch, rowIdx, matches); err != nil {
+				return datatypes.RecordBatch{}, err
+			}
+		}
+		switch h.joinType {
+		case logicalplan.LeftSemiJoin, logicalplan.LeftAntiJoin:
+			// the left row is returned once, whatever the number of matches
+			if (len(matches) > 0) == (h.joinType == logicalplan.LeftSemiJoin) {
+				h.appendRow(builders, &probeBatch, rowIdx, nil, 0)
+			}
+			continue
+		}
+		if len(matches) == 0 && h.joinType != logicalplan.InnerJoin {
+			// outer join, pad the build side with nulls
+			if h.joinType == logicalplan.LeftJoin {
+				h.appendRow(builders, &probeBatch, rowIdx, nil, 0)
+			} else {
+				h.appendRow(builders, nil, 0, &probeBatch, rowIdx)
+			}
+		}
+		for _, match := range matches {
+			buildBatch := &h.buildBatches[match.batch]
+			if h.joinType == logicalplan.RightJoin {
+				h.appendRow(builders, buildBatch, match.row, &probeBatch, rowIdx)
+			} else {
+				h.appendRow(builders, &probeBatch, rowIdx, buildBatch, match.row)
+			}
+		}
+	}
+
+	fields := make([]datatypes.ColumnArray, len(builders))
+	for i := 0; i < len(builders); i++ {
+		fields[i] = builders[i].Build()
+	}
+	return datatypes.RecordBatch{Schema: h.schema, Fields: fields}, nil
+}
+
+func (h *HashJoinExec) Next(ctx context.Context) bool {
+	if h.err != nil {
+		return false
+	}
+	if !h.built {
+		if h.err = h.build(ctx); h.err != nil {
+			return true
+		}
+	}
+	_, probe := h.sides()
+	return probe.Next(ctx)
+}
+
+func (h *HashJoinExec) Children() []physicalplan.PhysicalPlan {
+	return []physicalplan.PhysicalPlan{h.left, h.right}
+}
+
+func (h *HashJoinExec) Close() {
+	h.left.Close()
+	h.right.Close()
+}
+
+func (h *HashJoinExec) OutputPartitioning() physicalplan.Partitioning {
+	// the whole build side is loaded, the output has the partitions of the probe side
+	_, probe := h.sides()
+	return physicalplan.UnknownPartitioning(probe.OutputPartitioning().Count)
+}
+
+func (h *HashJoinExec) OutputOrdering() []physicalplan.PhysicalExpr {
+	return nil
+}
+
+func (h *HashJoinExec) String() string {
+	on := make([]string, len(h.leftKeys))
+	for i := range h.leftKeys {
+		on[i] = fmt.Sprintf("#%d=#%d", h.leftKeys[i], h.rightKeys[i])
+	}
+	if h.filter != nil {
+		return fmt.Sprintf("HashJoinExec: type=%s, on=[%s], filter=%s", h.joinType, strings.Join(on, ", "), h.filter.expr)
+	}
+	return fmt.Sprintf("HashJoinExec: type=%s, on=[%s]", h.joinType, strings.Join(on, ", "))
+}
+
+// filterMatches returns the build rows matching the keys of a probe row which also satisfy the filter
+func (h *HashJoinExec) filterMatches(probeBatch *datatypes.RecordBatch, rowIdx int, matches []rowRef) ([]rowRef, error) {
+	columns := make([]datatypes.ColumnArray, len(h.buildBatches[0].Fields))
+	for i := range columns {
+		builder := datatypes.NewArrowArrayBuilder(memory.NewGoAllocator(), h.buildBatches[0].Field(i).GetType())
+		builder.Reserve(len(matches))
+		for _, match := range matches {
+			builder.Append(h.buildBatches[match.batch].Field(i).GetValue(match.row))
+		}
+		columns[i] = builder.Build()
+	}
+	matched, err := h.filter.evaluate(probeBatch, rowIdx, columns, h.joinType != logicalplan.RightJoin)
+	if err != nil {
+		return nil, err
+	}
+	filtered := make([]rowRef, 0, len(matches))
+	for i, match := range matches {
+		if matched[i] {
+			filtered = append(filtered, match)
+		}
+	}
+	return filtered, nil
+}
+
+// build loads the build side into the hash table, rows with a null key never match
+func (h *HashJoinExec) build(ctx context.Context) error {
+	build, _ := h.sides()
+	buildKeys, _ := h.keys()
+	h.hashTable = make(map[string][]rowRef)
+	for build.Next(ctx) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		batch, err := build.Execute(ctx)
+		if err != nil {
+			return err
+		}
+		batchIdx := len(h.buildBatches)
+		h.buildBatches = append(h.buildBatches, batch)
+		for rowIdx := 0; rowIdx < batch.RowCount(); rowIdx++ {
+			ok, err := h.joinKey(batch, buildKeys, rowIdx)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			key := string(h.buf)
+			h.hashTable[key] = append(h.hashTable[key], rowRef{batchIdx, rowIdx})
+		}
+	}
+	h.built = true
+	return nil
+}
+
+// sides returns the build and probe inputs
+func (h *HashJoinExec) sides() (physicalplan.PhysicalPlan, physicalplan.PhysicalPlan) {
+	if h.joinType == logicalplan.RightJoin {
+		return h.left, h.right
+	}
+	return h.right, h.left
+}
+
+// keys returns the build and probe key indices
+func (h *HashJoinExec) keys() ([]int, []int) {
+	if h.joinType == logicalplan.RightJoin {
+		return h.leftKeys, h.rightKeys
+	}
+	return h.rightKeys, h.leftKeys
+}
+
+// appendRow appends the output columns of a left and a right row, a nil batch appends nulls
+func (h *HashJoinExec) appendRow(
+	builders []datatypes.ArrowArrayBuilder,
+	left *datatypes.RecordBatch, leftRow int, right *datatypes.RecordBatch, rightRow int,
+) {
+	for i, colIdx := range h.leftOutput {
+		if left == nil {
+			builders[i].Append(nil)
+		} else {
+			builders[i].Append(left.Field(colIdx).GetValue(leftRow))
+		}
+	}
+	for i, colIdx := range h.rightOutput {
+		b := &builders[len(h.leftOutput)+i]
+		if right == nil {
+			b.Append(nil)
+		} else {
+			b.Append(right.Field(colIdx).GetValue(rightRow))
+		}
+	}
+}
+
+// joinKey builds the row key of the key columns of a row into h.buf, so that 0 and -0 match, as do all the NaN.
+// ok is false when any key is null, as null never equals anything.
+func (h *HashJoinExec) joinKey(batch datatypes.RecordBatch, keys []int, rowIdx int) (bool, error) {
+	h.row = h.row[:0]
+	for _, colIdx := range keys {
+		value := batch.Field(colIdx).GetValue(rowIdx)
+		if value == nil {
+			return false, nil
+		}
+		h.row = append(h.row, value)
+	}
+	var err error
+	if h.buf, err = appendRowKey(h.buf[:0], h.row); err != nil {
+		return false, err
+	}
+	return true, nil
+}
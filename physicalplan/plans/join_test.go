@@ -0,0 +1,181 @@
+package plans
+
+import (
+	"context"
+	"github.com/apache/arrow/go/v6/arrow/memory"
+	"github.com/stretchr/testify/require"
+	"math"
+	"query-engine/datasource"
+	"query-engine/datatypes"
+	"query-engine/logicalplan"
+	"query-engine/physicalplan"
+	"query-engine/physicalplan/exprs"
+	"testing"
+)
+
+func memScan(schema datatypes.Schema, columns ...[]interface{}) ScanExec {
+	fields := make([]datatypes.ColumnArray, len(columns))
+	for i, column := range columns {
+		builder := datatypes.NewArrowArrayBuilder(memory.NewGoAllocator(), schema.Fields[i].DataType)
+		builder.AppendValues(column...)
+		fields[i] = builder.Build()
+	}
+	data := datatypes.RecordBatch{Schema: schema, Fields: fields}
+	return NewScanExec(datasource.NewInMemDataSource(schema, data), []string{})
+}
+
+func employeeScan() ScanExec {
+	schema := datatypes.Schema{Fields: []datatypes.Field{
+		{Name: "id", DataType: datatypes.Int64Type},
+		{Name: "name", DataType: datatypes.StringType},
+		{Name: "dept", DataType: datatypes.Int64Type},
+	}}
+	return memScan(schema,
+		[]interface{}{int64(1), int64(2), int64(3), int64(4)},
+		[]interface{}{"a", "b", "c", "d"},
+		[]interface{}{int64(10), int64(20), nil, int64(30)},
+	)
+}
+
+func deptScan() ScanExec {
+	schema := datatypes.Schema{Fields: []datatypes.Field{
+		{Name: "dept", DataType: datatypes.Int64Type},
+		{Name: "dept_name", DataType: datatypes.StringType},
+	}}
+	return memScan(schema,
+		[]interface{}{int64(10), int64(20), int64(20), int64(40)},
+		[]interface{}{"Eng", "Sales", "Support", "Ops"},
+	)
+}
+
+func joinSchema() datatypes.Schema {
+	return datatypes.Schema{Fields: []datatypes.Field{
+		{Name: "id", DataType: datatypes.Int64Type},
+		{Name: "name", DataType: datatypes.StringType},
+		{Name: "dept", DataType: datatypes.Int64Type},
+		{Name: "dept_name", DataType: datatypes.StringType},
+	}}
+}
+
+// collectBatches drains the plan and returns its batches
+func collectBatches(t *testing.T, plan physicalplan.PhysicalPlan) []datatypes.RecordBatch {
+	batches := make([]datatypes.RecordBatch, 0)
+	for plan.Next(context.Background()) {
+		batch, err := plan.Execute(context.Background())
+		require.NoError(t, err)
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// collect drains the plan and returns its rows as CSV
+func collect(t *testing.T, plan physicalplan.PhysicalPlan) string {
+	res := ""
+	for _, batch := range collectBatches(t, plan) {
+		res += batch.ToCSV()
+	}
+	return res
+}
+
+func TestHashJoinExec_inner(t *testing.T) {
+	plan := NewHashJoinExec(employeeScan(), deptScan(), logicalplan.InnerJoin,
+		[]int{2}, []int{0}, []int{0, 1, 2}, []int{1}, joinSchema())
+
+	expect := "1,a,10,Eng\n2,b,20,Sales\n2,b,20,Support\n"
+	require.Equal(t, expect, collect(t, plan))
+	require.Equal(t, "HashJoinExec: type=Inner, on=[#2=#0]", plan.String())
+}
+
+func TestHashJoinExec_left(t *testing.T) {
+	plan := NewHashJoinExec(employeeScan(), deptScan(), logicalplan.LeftJoin,
+		[]int{2}, []int{0}, []int{0, 1, 2}, []int{1}, joinSchema())
+
+	expect := "1,a,10,Eng\n2,b,20,Sales\n2,b,20,Support\n3,c,null,null\n4,d,30,null\n"
+	require.Equal(t, expect, collect(t, plan))
+}
+
+func TestHashJoinExec_right(t *testing.T) {
+	plan := NewHashJoinExec(employeeScan(), deptScan(), logicalplan.RightJoin,
+		[]int{2}, []int{0}, []int{0, 1}, []int{0, 1}, joinSchema())
+
+	expect := "1,a,10,Eng\n2,b,20,Sales\n2,b,20,Support\nnull,null,40,Ops\n"
+	require.Equal(t, expect, collect(t, plan))
+}
+
+func TestHashJoinExec_composite_key(t *testing.T) {
+	schema := datatypes.Schema{Fields: []datatypes.Field{
+		{Name: "a", DataType: datatypes.StringType},
+		{Name: "b", DataType: datatypes.StringType},
+	}}
+	left := memScan(schema, []interface{}{"1", "11"}, []interface{}{"11", "1"})
+	right := memScan(schema, []interface{}{"11"}, []interface{}{"1"})
+	plan := NewHashJoinExec(left, right, logicalplan.InnerJoin,
+		[]int{0, 1}, []int{0, 1}, []int{0, 1}, []int{}, schema)
+
+	require.Equal(t, "11,1\n", collect(t, plan))
+}
+
+func TestHashJoinExec_float_keys(t *testing.T) {
+	schema := datatypes.Schema{Fields: []datatypes.Field{
+		{Name: "v", DataType: datatypes.DoubleType},
+		{Name: "s", DataType: datatypes.StringType},
+	}}
+	left := func() ScanExec {
+		return memScan(schema, []interface{}{0.0, math.NaN(), 1.5}, []interface{}{"a", "b", "c"})
+	}
+	right := func() ScanExec {
+		return memScan(schema, []interface{}{math.Copysign(0, -1), math.Float64frombits(0x7ff8000000000002), 2.5},
+			[]interface{}{"a", "b", "c"})
+	}
+	outSchema := datatypes.Schema{Fields: []datatypes.Field{schema.Fields[0], schema.Fields[1], schema.Fields[0]}}
+
+	// 0 and -0 are equal keys, as are all the NaN, on a single key and in composite keys
+	single := NewHashJoinExec(left(), right(), logicalplan.InnerJoin,
+		[]int{0}, []int{0}, []int{0, 1}, []int{0}, outSchema)
+	require.Equal(t, "0,a,-0\nNaN,b,NaN\n", collect(t, single))
+
+	composite := NewHashJoinExec(left(), right(), logicalplan.InnerJoin,
+		[]int{0, 1}, []int{0, 1}, []int{0, 1}, []int{0}, outSchema)
+	require.Equal(t, "0,a,-0\nNaN,b,NaN\n", collect(t, composite))
+}
+
+func TestHashJoinExec_semi_anti(t *testing.T) {
+	schema := datatypes.Schema{Fields: joinSchema().Fields[:3]}
+
+	// a left row is returned once whatever its number of matches, a null key never matches
+	semi := NewHashJoinExec(employeeScan(), deptScan(), logicalplan.LeftSemiJoin,
+		[]int{2}, []int{0}, []int{0, 1, 2}, []int{}, schema)
+	require.Equal(t, "1,a,10\n2,b,20\n", collect(t, semi))
+	require.Equal(t, "HashJoinExec: type=LeftSemi, on=[#2=#0]", semi.String())
+
+	anti := NewHashJoinExec(employeeScan(), deptScan(), logicalplan.LeftAntiJoin,
+		[]int{2}, []int{0}, []int{0, 1, 2}, []int{}, schema)
+	require.Equal(t, "3,c,null\n4,d,30\n", collect(t, anti))
+}
+
+func TestHashJoinExec_filter(t *testing.T) {
+	// the filter is evaluated against the left columns followed by the right columns
+	filter := exprs.NewNeqExpr(exprs.NewColumnIndexExpr(4), exprs.NewLiteralStringExpr("Sales"))
+	for _, test := range []struct {
+		joinType   logicalplan.JoinType
+		leftOutput []int
+		expect     string
+	}{
+		{logicalplan.InnerJoin, []int{0, 1, 2}, "1,a,10,Eng\n2,b,20,Support\n"},
+		{logicalplan.LeftJoin, []int{0, 1, 2}, "1,a,10,Eng\n2,b,20,Support\n3,c,null,null\n4,d,30,null\n"},
+		{logicalplan.RightJoin, []int{0, 1}, "1,a,10,Eng\nnull,null,20,Sales\n2,b,20,Support\nnull,null,40,Ops\n"},
+	} {
+		rightOutput := []int{1}
+		if test.joinType == logicalplan.RightJoin {
+			rightOutput = []int{0, 1}
+		}
+		plan := NewHashJoinExecWithFilter(employeeScan(), deptScan(), test.joinType,
+			[]int{2}, []int{0}, test.leftOutput, rightOutput, filter, joinSchema())
+		require.Equal(t, test.expect, collect(t, plan), test.joinType.String())
+	}
+
+	anti := NewHashJoinExecWithFilter(employeeScan(), deptScan(), logicalplan.LeftAntiJoin,
+		[]int{2}, []int{0}, []int{0, 1, 2}, []int{}, filter, datatypes.Schema{Fields: joinSchema().Fields[:3]})
+	require.Equal(t, "3,c,null\n4,d,30\n", collect(t, anti))
+	require.Equal(t, "HashJoinExec: type=LeftAnti, on=[#2=#0], filter=#4 != 'Sales'", anti.String())
+}
@@ -0,0 +1,98 @@
+package plans
+
+import (
+	"context"
+	"fmt"
+	"query-engine/datatypes"
+	"query-engine/physicalplan"
+)
+
+// LimitExec skips the first offset rows of its input, then returns at most limit rows.
+// It stops pulling from its input as soon as limit rows were returned.
+type LimitExec struct {
+	input  physicalplan.PhysicalPlan
+	offset int
+	// limit is negative when all the rows after offset are returned
+	limit int
+
+	// skipped and fetched rows so far
+	skipped int
+	fetched int
+	// batch prepared by Next, or the error of pulling it
+	batch datatypes.RecordBatch
+	err   error
+}
+
+func NewLimitExec(input physicalplan.PhysicalPlan, offset int, limit int) *LimitExec {
+	return &LimitExec{input: input, offset: offset, limit: limit}
+}
+
+func (l *LimitExec) Schema() datatypes.Schema {
+	return l.input.Schema()
+}
+
+func (l *LimitExec) Execute(ctx context.Context) (datatypes.RecordBatch, error) {
+	return l.batch, l.err
+}
+
+// Next pulls input batches until one has rows left after the offset,
+// the batch is sliced to the rows within the offset and limit.
+func (l *LimitExec) Next(ctx context.Context) bool {
+	if l.err != nil {
+		return false
+	}
+	for l.limit < 0 || l.fetched < l.limit {
+		if !l.input.Next(ctx) {
+			return false
+		}
+		batch, err := l.input.Execute(ctx)
+		if err != nil {
+			// the error is returned by Execute, then the limit stops
+			l.err = err
+			return true
+		}
+		rowCount := batch.RowCount()
+
+		start := l.offset - l.skipped
+		if start > rowCount {
+			start = rowCount
+		}
+		l.skipped += start
+		end := rowCount
+		if l.limit >= 0 && end-start > l.limit-l.fetched {
+			end = start + l.limit - l.fetched
+		}
+		if start == end {
+			continue
+		}
+
+		l.fetched += end - start
+		if start == 0 && end == rowCount {
+			l.batch = batch
+		} else {
+			l.batch = batch.Slice(start, end)
+		}
+		return true
+	}
+	return false
+}
+
+func (l *LimitExec) Children() []physicalplan.PhysicalPlan {
+	return []physicalplan.PhysicalPlan{l.input}
+}
+
+func (l *LimitExec) Close() {
+	l.input.Close()
+}
+
+func (l *LimitExec) OutputPartitioning() physicalplan.Partitioning {
+	return physicalplan.UnknownPartitioning(l.input.OutputPartitioning().Count)
+}
+
+func (l *LimitExec) OutputOrdering() []physicalplan.PhysicalExpr {
+	return l.input.OutputOrdering()
+}
+
+func (l *LimitExec) String() string {
+	return fmt.Sprintf("LimitExec: limit=%d, offset=%d", l.limit, l.offset)
+}
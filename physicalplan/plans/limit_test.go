@@ -0,0 +1,53 @@
+package plans
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"query-engine/physicalplan"
+	"testing"
+)
+
+// countingExec counts the batches pulled from its input
+type countingExec struct {
+	physicalplan.PhysicalPlan
+	pulled int
+}
+
+func (c *countingExec) Next(ctx context.Context) bool {
+	if c.PhysicalPlan.Next(ctx) {
+		c.pulled++
+		return true
+	}
+	return false
+}
+
+func TestLimitExec(t *testing.T) {
+	testCases := []struct {
+		offset, limit int
+		expect        string
+		pulled        int
+	}{
+		{0, 4, "4\n5\n6\n7\n", 2},
+		{0, 3, "4\n5\n6\n", 1},
+		{2, 3, "6\n7\n2\n", 2},
+		{4, -1, "2\n3\n0\n1\n", 3},
+		{7, 10, "1\n", 3},
+		{10, 1, "", 3},
+		{0, 0, "", 0},
+	}
+	for _, tc := range testCases {
+		input := &countingExec{PhysicalPlan: parquetScan(t, 3, []string{"Id"})}
+		plan := NewLimitExec(input, tc.offset, tc.limit)
+		require.Equal(t, tc.expect, collect(t, plan), "offset=%d, limit=%d", tc.offset, tc.limit)
+		require.Equal(t, tc.pulled, input.pulled, "offset=%d, limit=%d", tc.offset, tc.limit)
+	}
+}
+
+func TestLimitExec_String(t *testing.T) {
+	plan := NewLimitExec(parquetScan(t, 3, []string{"Id"}), 1, 2)
+	planFormat := `
+LimitExec: limit=2, offset=1
+	ScanExec: schema={[{Id int32}]}, projection=[Id]
+`
+	require.Equal(t, planFormat, physicalplan.PrettyFormat(plan))
+}
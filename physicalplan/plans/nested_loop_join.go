@@ -0,0 +1,260 @@
+package plans
+
+import (
+	"context"
+	"fmt"
+	"github.com/apache/arrow/go/v6/arrow/memory"
+	"query-engine/datatypes"
+	"query-engine/logicalplan"
+	"query-engine/physicalplan"
+)
+
+// NestedLoopJoinExec joins without join keys: it loads the whole right input, then streams the left input
+// batch by batch comparing every left row with every right row. A pair of rows matches when it satisfies
+// the filter, evaluated against the left columns followed by the right columns, a nil filter matches
+// every pair like a cross join. The output is the left columns followed by the right columns,
+// the left columns only for semi and anti joins. A right join returns the unmatched right rows
+// padded with nulls once the left input is done.
+type NestedLoopJoinExec struct {
+	left     physicalplan.PhysicalPlan
+	right    physicalplan.PhysicalPlan
+	joinType logicalplan.JoinType
+	filter   *joinFilter
+	schema   datatypes.Schema
+
+	// right input, loaded by the first Next, and the right rows matched so far for right joins
+	built        bool
+	rightBatches []datatypes.RecordBatch
+	rightMatched [][]bool
+	// unmatched is set once the unmatched right rows are returned
+	unmatched bool
+
+	// batch prepared by Next, or the error of preparing it
+	batch datatypes.RecordBatch
+	err   error
+}
+
+func NewNestedLoopJoinExec(
+	left, right physicalplan.PhysicalPlan, joinType logicalplan.JoinType, filter physicalplan.PhysicalExpr,
+	schema datatypes.Schema,
+) *NestedLoopJoinExec {
+	return &NestedLoopJoinExec{
+		left:     left,
+		right:    right,
+		joinType: joinType,
+		filter:   newJoinFilter(filter, left, right),
+		schema:   schema,
+	}
+}
+
+func (n *NestedLoopJoinExec) Schema() datatypes.Schema {
+	return n.schema
+}
+
+func (n *NestedLoopJoinExec) Execute(ctx context.Context) (datatypes.RecordBatch, error) {
+	return n.batch, n.err
+}
+
+// Next joins the next left batch, as the matched right rows must be updated once per batch
+func (n *NestedLoopJoinExec) Next(ctx context.Context) bool {
+	if n.err != nil {
+		return false
+	}
+	if !n.built {
+		if n.err = n.build(ctx); n.err != nil {
+			return true
+		}
+	}
+	if n.left.Next(ctx) {
+		leftBatch, err := n.left.Execute(ctx)
+		if err == nil {
+			n.batch, err = n.join(leftBatch)
+		}
+		n.err = err
+		return true
+	}
+	if n.joinType == logicalplan.RightJoin && !n.unmatched {
+		n.unmatched = true
+		n.batch = n.unmatchedRight()
+		return true
+	}
+	return false
+}
+
+func (n *NestedLoopJoinExec) Children() []physicalplan.PhysicalPlan {
+	return []physicalplan.PhysicalPlan{n.left, n.right}
+}
+
+func (n *NestedLoopJoinExec) Close() {
+	n.left.Close()
+	n.right.Close()
+}
+
+func (n *NestedLoopJoinExec) OutputPartitioning() physicalplan.Partitioning {
+	return physicalplan.UnknownPartitioning(n.left.OutputPartitioning().Count)
+}
+
+func (n *NestedLoopJoinExec) OutputOrdering() []physicalplan.PhysicalExpr {
+	return nil
+}
+
+func (n *NestedLoopJoinExec) String() string {
+	if n.filter != nil {
+		return fmt.Sprintf("NestedLoopJoinExec: type=%s, filter=%s", n.joinType, n.filter.expr)
+	}
+	return fmt.Sprintf("NestedLoopJoinExec: type=%s", n.joinType)
+}
+
+// build loads the right input
+func (n *NestedLoopJoinExec) build(ctx context.Context) error {
+	for n.right.Next(ctx) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		batch, err := n.right.Execute(ctx)
+		if err != nil {
+			return err
+		}
+		n.rightBatches = append(n.rightBatches, batch)
+		n.rightMatched = append(n.rightMatched, make([]bool, batch.RowCount()))
+	}
+	n.built = true
+	return nil
+}
+
+// join compares every row of a left batch with every right row
+func (n *NestedLoopJoinExec) join(leftBatch datatypes.RecordBatch) (datatypes.RecordBatch, error) {
+	builders := n.newBuilders()
+	semiOrAnti := n.joinType == logicalplan.LeftSemiJoin || n.joinType == logicalplan.LeftAntiJoin
+	for leftRow := 0; leftRow < leftBatch.RowCount(); leftRow++ {
+		matchedAny := false
+		for b, rightBatch := range n.rightBatches {
+			if rightBatch.RowCount() == 0 {
+				continue
+			}
+			var matched []bool
+			if n.filter != nil {
+				var err error
+				if matched, err = n.filter.evaluate(&leftBatch, leftRow, rightBatch.Fields, true); err != nil {
+					return datatypes.RecordBatch{}, err
+				}
+			}
+			for rightRow := 0; rightRow < rightBatch.RowCount(); rightRow++ {
+				if matched != nil && !matched[rightRow] {
+					continue
+				}
+				matchedAny = true
+				if semiOrAnti {
+					break
+				}
+				n.rightMatched[b][rightRow] = true
+				n.appendRow(builders, &leftBatch, leftRow, &n.rightBatches[b], rightRow)
+			}
+			if matchedAny && semiOrAnti {
+				break
+			}
+		}
+
+		switch {
+		case n.joinType == logicalplan.LeftJoin && !matchedAny:
+			n.appendRow(builders, &leftBatch, leftRow, nil, 0)
+		case n.joinType == logicalplan.LeftSemiJoin && matchedAny, n.joinType == logicalplan.LeftAntiJoin && !matchedAny:
+			n.appendRow(builders, &leftBatch, leftRow, nil, 0)
+		}
+	}
+	return n.buildBatch(builders), nil
+}
+
+// unmatchedRight returns the right rows which matched no left row, padded with nulls
+func (n *NestedLoopJoinExec) unmatchedRight() datatypes.RecordBatch {
+	builders := n.newBuilders()
+	for b := range n.rightBatches {
+		for rightRow, matched := range n.rightMatched[b] {
+			if !matched {
+				n.appendRow(builders, nil, 0, &n.rightBatches[b], rightRow)
+			}
+		}
+	}
+	return n.buildBatch(builders)
+}
+
+// appendRow appends the columns of a left and a right row, a nil batch appends nulls.
+// Semi and anti joins only have the left columns.
+func (n *NestedLoopJoinExec) appendRow(
+	builders []datatypes.ArrowArrayBuilder,
+	left *datatypes.RecordBatch, leftRow int, right *datatypes.RecordBatch, rightRow int,
+) {
+	leftColumns := len(n.left.Schema().Fields)
+	for i := range builders {
+		switch {
+		case i < leftColumns && left != nil:
+			builders[i].Append(left.Field(i).GetValue(leftRow))
+		case i >= leftColumns && right != nil:
+			builders[i].Append(right.Field(i - leftColumns).GetValue(rightRow))
+		default:
+			builders[i].Append(nil)
+		}
+	}
+}
+
+func (n *NestedLoopJoinExec) newBuilders() []datatypes.ArrowArrayBuilder {
+	builders := make([]datatypes.ArrowArrayBuilder, len(n.schema.Fields))
+	for i, field := range n.schema.Fields {
+		builders[i] = datatypes.NewArrowArrayBuilder(memory.NewGoAllocator(), field.DataType)
+	}
+	return builders
+}
+
+func (n *NestedLoopJoinExec) buildBatch(builders []datatypes.ArrowArrayBuilder) datatypes.RecordBatch {
+	fields := make([]datatypes.ColumnArray, len(builders))
+	for i := range builders {
+		fields[i] = builders[i].Build()
+	}
+	return datatypes.RecordBatch{Schema: n.schema, Fields: fields}
+}
+
+// joinFilter is the predicate of a join, evaluated against the left columns followed by the right columns
+type joinFilter struct {
+	expr physicalplan.PhysicalExpr
+	// schema is the left fields followed by the right fields
+	schema datatypes.Schema
+}
+
+// newJoinFilter returns nil for a nil expr
+func newJoinFilter(expr physicalplan.PhysicalExpr, left, right physicalplan.PhysicalPlan) *joinFilter {
+	if expr == nil {
+		return nil
+	}
+	fields := append([]datatypes.Field{}, left.Schema().Fields...)
+	fields = append(fields, right.Schema().Fields...)
+	return &joinFilter{expr: expr, schema: datatypes.Schema{Fields: fields}}
+}
+
+// evaluate evaluates the filter over the pairs of a row of one side and every row of the columns
+// of the other side, the row is the left one when rowIsLeft. A null predicate doesn't match the pair.
+func (f *joinFilter) evaluate(
+	batch *datatypes.RecordBatch, rowIdx int, others []datatypes.ColumnArray, rowIsLeft bool,
+) ([]bool, error) {
+	rows := others[0].Size()
+	repeated := make([]datatypes.ColumnArray, len(batch.Fields))
+	for i, column := range batch.Fields {
+		repeated[i] = datatypes.NewLiteralValueArray(column.GetType(), column.GetValue(rowIdx), rows)
+	}
+	fields := append(repeated, others...)
+	if !rowIsLeft {
+		fields = append(append([]datatypes.ColumnArray{}, others...), repeated...)
+	}
+
+	result, err := f.expr.Evaluate(datatypes.RecordBatch{Schema: f.schema, Fields: fields})
+	if err != nil {
+		return nil, err
+	}
+	if result.GetType() != datatypes.BooleanType {
+		return nil, datatypes.NewSchemaError("join filter unexpect expr: %s and type: %s", f.expr, result.GetType())
+	}
+	matched := make([]bool, rows)
+	for i := range matched {
+		matched[i] = result.GetValue(i) == true
+	}
+	return matched, nil
+}
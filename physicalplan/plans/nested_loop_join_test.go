@@ -0,0 +1,73 @@
+package plans
+
+import (
+	"github.com/stretchr/testify/require"
+	"query-engine/datatypes"
+	"query-engine/logicalplan"
+	"query-engine/physicalplan/exprs"
+	"testing"
+)
+
+func eventScan() ScanExec {
+	schema := datatypes.Schema{Fields: []datatypes.Field{{Name: "ts", DataType: datatypes.Int64Type}}}
+	return memScan(schema, []interface{}{int64(1), int64(5), int64(9), nil})
+}
+
+func periodScan() ScanExec {
+	return memScan(periodSchema(),
+		[]interface{}{int64(0), int64(4), int64(3), int64(10)},
+		[]interface{}{int64(4), int64(6), int64(8), int64(12)},
+		[]interface{}{"a", "b", "c", "d"},
+	)
+}
+
+func periodSchema() datatypes.Schema {
+	return datatypes.Schema{Fields: []datatypes.Field{
+		{Name: "start", DataType: datatypes.Int64Type},
+		{Name: "end", DataType: datatypes.Int64Type},
+		{Name: "period", DataType: datatypes.StringType},
+	}}
+}
+
+func TestNestedLoopJoinExec(t *testing.T) {
+	schema := datatypes.Schema{Fields: append(eventScan().Schema().Fields, periodSchema().Fields...)}
+	// ts BETWEEN start AND end, the columns of the left input come first
+	ts := exprs.NewColumnIndexExpr(0)
+	between := exprs.NewAndExpr(
+		exprs.NewGtEqExpr(ts, exprs.NewColumnIndexExpr(1)), exprs.NewLtEqExpr(ts, exprs.NewColumnIndexExpr(2)))
+
+	// the inputs return a row per batch, a null ts matches no period
+	for _, test := range []struct {
+		joinType logicalplan.JoinType
+		expect   string
+	}{
+		{logicalplan.InnerJoin, "1,0,4,a\n5,4,6,b\n5,3,8,c\n"},
+		{logicalplan.LeftJoin, "1,0,4,a\n5,4,6,b\n5,3,8,c\n9,null,null,null\nnull,null,null,null\n"},
+		{logicalplan.RightJoin, "1,0,4,a\n5,4,6,b\n5,3,8,c\nnull,10,12,d\n"},
+	} {
+		plan := NewNestedLoopJoinExec(eventScan(), periodScan(), test.joinType, between, schema)
+		require.Equal(t, test.expect, collect(t, plan), test.joinType.String())
+	}
+
+	semi := NewNestedLoopJoinExec(eventScan(), periodScan(), logicalplan.LeftSemiJoin, between, eventScan().Schema())
+	require.Equal(t, "1\n5\n", collect(t, semi))
+	require.Equal(t, "NestedLoopJoinExec: type=LeftSemi, filter=#0 >= #1 AND #0 <= #2", semi.String())
+	anti := NewNestedLoopJoinExec(eventScan(), periodScan(), logicalplan.LeftAntiJoin, between, eventScan().Schema())
+	require.Equal(t, "9\nnull\n", collect(t, anti))
+}
+
+func TestNestedLoopJoinExec_cross(t *testing.T) {
+	schema := datatypes.Schema{Fields: append(eventScan().Schema().Fields, periodSchema().Fields...)}
+	left := memScan(eventScan().Schema(), []interface{}{int64(1), int64(2)})
+	right := memScan(periodSchema(), []interface{}{int64(0), nil}, []interface{}{int64(4), nil}, []interface{}{"a", "b"})
+	plan := NewNestedLoopJoinExec(left, right, logicalplan.CrossJoin, nil, schema)
+	require.Equal(t, "1,0,4,a\n1,null,null,b\n2,0,4,a\n2,null,null,b\n", collect(t, plan))
+	require.Equal(t, "NestedLoopJoinExec: type=Cross", plan.String())
+
+	// the semi join of an empty right input is empty, the anti join returns all the left rows
+	empty := memScan(periodSchema(), []interface{}{}, []interface{}{}, []interface{}{})
+	require.Equal(t, "", collect(t, NewNestedLoopJoinExec(left, empty, logicalplan.LeftSemiJoin, nil, left.Schema())))
+	left = memScan(eventScan().Schema(), []interface{}{int64(1), int64(2)})
+	empty = memScan(periodSchema(), []interface{}{}, []interface{}{}, []interface{}{})
+	require.Equal(t, "1\n2\n", collect(t, NewNestedLoopJoinExec(left, empty, logicalplan.LeftAntiJoin, nil, left.Schema())))
+}
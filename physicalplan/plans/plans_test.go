@@ -1,9 +1,12 @@
 package plans
 
 import (
+	"context"
+	"errors"
 	"github.com/stretchr/testify/require"
 	"query-engine/datasource"
 	"query-engine/datatypes"
+	"query-engine/logicalplan"
 	"query-engine/physicalplan"
 	"query-engine/physicalplan/exprs"
 	"testing"
@@ -12,8 +15,15 @@ import (
 const dir = "../../testdata"
 const filename = dir + "/alltypes_plain.parquet"
 
+func parquetScan(t *testing.T, batchSize int, projection []string) ScanExec {
+	pds, err := datasource.NewParquetDataSource(filename, batchSize)
+	require.NoError(t, err)
+	return NewScanExec(pds, projection)
+}
+
 func TestPhysicalPlan_Scan(t *testing.T) {
-	pds := datasource.NewParquetDataSource(filename, 10)
+	pds, err := datasource.NewParquetDataSource(filename, 10)
+	require.NoError(t, err)
 	headers := []string{"Id", "Bool_col", "Tinyint_col", "Smallint_col", "Int_col", "Bigint_col", "Float_col", "Double_col", "Date_string_col", "String_col", "Timestamp_col"}
 	for i, header := range headers {
 		require.Equal(t, header, pds.Schema().Fields[i].Name)
@@ -34,8 +44,9 @@ func TestPhysicalPlan_Scan(t *testing.T) {
 	physicalExprs := []physicalplan.PhysicalExpr{exprs.NewColumnIndexExpr(0), exprs.NewColumnIndexExpr(1), exprs.NewColumnIndexExpr(3)}
 	plan := NewProjectionExec(selection, schema, physicalExprs)
 
-	require.True(t, plan.Next())
-	result := plan.Execute()
+	require.True(t, plan.Next(context.Background()))
+	result, err := plan.Execute(context.Background())
+	require.NoError(t, err)
 	require.Equal(t, 1, result.RowCount())
 
 	expectCol0MatchedIds := []int32{1}
@@ -43,7 +54,7 @@ func TestPhysicalPlan_Scan(t *testing.T) {
 		require.Equal(t, id, result.Fields[0].GetValue(i))
 	}
 
-	require.False(t, plan.Next())
+	require.False(t, plan.Next(context.Background()))
 
 	planFormat := `
 ProjectionExec: [#0 #1 #3]
@@ -54,7 +65,8 @@ ProjectionExec: [#0 #1 #3]
 }
 
 func TestPhysicalPlan_Scan_smallBatchSize(t *testing.T) {
-	pds := datasource.NewParquetDataSource(filename, 3)
+	pds, err := datasource.NewParquetDataSource(filename, 3)
+	require.NoError(t, err)
 	headers := []string{"Id", "Bool_col", "Tinyint_col", "Smallint_col", "Int_col", "Bigint_col", "Float_col", "Double_col", "Date_string_col", "String_col", "Timestamp_col"}
 	for i, header := range headers {
 		require.Equal(t, header, pds.Schema().Fields[i].Name)
@@ -76,18 +88,21 @@ func TestPhysicalPlan_Scan_smallBatchSize(t *testing.T) {
 	plan := NewProjectionExec(selection, schema, physicalExprs)
 
 	// first batch
-	require.True(t, plan.Next())
-	result := plan.Execute()
+	require.True(t, plan.Next(context.Background()))
+	result, err := plan.Execute(context.Background())
+	require.NoError(t, err)
 	require.Equal(t, 0, result.RowCount())
 
 	// second batch
-	require.True(t, plan.Next())
-	result = plan.Execute()
+	require.True(t, plan.Next(context.Background()))
+	result, err = plan.Execute(context.Background())
+	require.NoError(t, err)
 	require.Equal(t, 0, result.RowCount())
 
 	// third batch
-	require.True(t, plan.Next())
-	result = plan.Execute()
+	require.True(t, plan.Next(context.Background()))
+	result, err = plan.Execute(context.Background())
+	require.NoError(t, err)
 	require.Equal(t, 1, result.RowCount())
 
 	expectCol0MatchedIds := []int32{1}
@@ -95,7 +110,7 @@ func TestPhysicalPlan_Scan_smallBatchSize(t *testing.T) {
 		require.Equal(t, id, result.Fields[0].GetValue(i))
 	}
 
-	require.False(t, plan.Next())
+	require.False(t, plan.Next(context.Background()))
 
 	planFormat := `
 ProjectionExec: [#0 #1 #3]
@@ -104,3 +119,82 @@ ProjectionExec: [#0 #1 #3]
 `
 	require.Equal(t, planFormat, physicalplan.PrettyFormat(plan))
 }
+
+func TestPhysicalPlan_errors(t *testing.T) {
+	// the scan fails as the projected column doesn't exist, every operator returns the error from Execute
+	id := exprs.NewColumnIndexExpr(0)
+	testCases := []physicalplan.PhysicalPlan{
+		parquetScan(t, 3, []string{"Nope"}),
+		NewSelectionExec(parquetScan(t, 3, []string{"Nope"}), exprs.NewEqExpr(id, id)),
+		NewProjectionExec(parquetScan(t, 3, []string{"Nope"}), datatypes.Schema{}, []physicalplan.PhysicalExpr{id}),
+		NewHashAggregateExec(parquetScan(t, 3, []string{"Nope"}), nil, []exprs.AggregateExpr{exprs.NewMaxExpr(id)}, datatypes.Schema{}),
+		NewSortAggregateExec(parquetScan(t, 3, []string{"Nope"}), SingleAggregate, []physicalplan.PhysicalExpr{id},
+			[]exprs.AggregateExpr{exprs.NewMaxExpr(id)}, datatypes.Schema{}, 3),
+		NewLimitExec(parquetScan(t, 3, []string{"Nope"}), 1, 2),
+		NewSortExec(parquetScan(t, 3, []string{"Nope"}), []exprs.SortExpr{exprs.NewSortExpr(id, true, false)}, 3, 0, ""),
+		NewHashJoinExec(parquetScan(t, 3, []string{"Id"}), parquetScan(t, 3, []string{"Nope"}), logicalplan.InnerJoin,
+			[]int{0}, []int{0}, []int{0}, []int{0}, datatypes.Schema{}),
+		NewNestedLoopJoinExec(parquetScan(t, 3, []string{"Id"}), parquetScan(t, 3, []string{"Nope"}),
+			logicalplan.CrossJoin, nil, datatypes.Schema{}),
+		NewHashDistinctExec(parquetScan(t, 3, []string{"Nope"})),
+		NewUnionExec([]physicalplan.PhysicalPlan{parquetScan(t, 3, []string{"Nope"})}, datatypes.Schema{}),
+		NewHashSetOpExec(parquetScan(t, 3, []string{"Id"}), parquetScan(t, 3, []string{"Nope"}),
+			logicalplan.ExceptOperator, datatypes.Schema{}),
+	}
+	for _, plan := range testCases {
+		require.True(t, plan.Next(context.Background()), plan.String())
+		_, err := plan.Execute(context.Background())
+		var schemaErr *datatypes.SchemaError
+		require.True(t, errors.As(err, &schemaErr), plan.String())
+		require.Equal(t, "No column named: Nope", err.Error())
+	}
+}
+
+func TestSelectionExec_null_condition(t *testing.T) {
+	// a null condition doesn't match the row
+	input := memScan(datatypes.Schema{Fields: []datatypes.Field{{Name: "id", DataType: datatypes.Int64Type}}},
+		[]interface{}{int64(1), nil, int64(3)})
+	plan := NewSelectionExec(input, exprs.NewGtExpr(exprs.NewColumnIndexExpr(0), exprs.NewLiteralLongExpr(1)))
+	require.Equal(t, "3\n", collect(t, plan))
+}
+
+// cancelExec cancels the query once its input returned a batch
+type cancelExec struct {
+	physicalplan.PhysicalPlan
+	cancel context.CancelFunc
+}
+
+func (c cancelExec) Execute(ctx context.Context) (datatypes.RecordBatch, error) {
+	defer c.cancel()
+	return c.PhysicalPlan.Execute(ctx)
+}
+
+func TestPhysicalPlan_cancel(t *testing.T) {
+	// the input has 3 batches, operators stop at the next batch once cancelled
+	id := exprs.NewColumnIndexExpr(0)
+	newPlans := []func(input physicalplan.PhysicalPlan) physicalplan.PhysicalPlan{
+		func(input physicalplan.PhysicalPlan) physicalplan.PhysicalPlan {
+			return NewHashAggregateExec(input, nil, []exprs.AggregateExpr{exprs.NewMaxExpr(id)}, datatypes.Schema{})
+		},
+		func(input physicalplan.PhysicalPlan) physicalplan.PhysicalPlan {
+			return NewSortExec(input, []exprs.SortExpr{exprs.NewSortExpr(id, true, false)}, 3, 0, "")
+		},
+		func(input physicalplan.PhysicalPlan) physicalplan.PhysicalPlan {
+			return NewHashJoinExec(parquetScan(t, 3, []string{"Id"}), input, logicalplan.InnerJoin,
+				[]int{0}, []int{0}, []int{0}, []int{}, datatypes.Schema{})
+		},
+		func(input physicalplan.PhysicalPlan) physicalplan.PhysicalPlan {
+			return NewNestedLoopJoinExec(parquetScan(t, 3, []string{"Id"}), input, logicalplan.CrossJoin, nil, datatypes.Schema{})
+		},
+		func(input physicalplan.PhysicalPlan) physicalplan.PhysicalPlan {
+			return NewHashSetOpExec(parquetScan(t, 3, []string{"Id"}), input, logicalplan.IntersectOperator, datatypes.Schema{})
+		},
+	}
+	for _, newPlan := range newPlans {
+		ctx, cancel := context.WithCancel(context.Background())
+		plan := newPlan(cancelExec{parquetScan(t, 3, []string{"Id"}), cancel})
+		require.True(t, plan.Next(ctx), plan.String())
+		_, err := plan.Execute(ctx)
+		require.ErrorIs(t, err, context.Canceled, plan.String())
+	}
+}
@@ -1,9 +1,11 @@
 package plans
 
 import (
+	"context"
 	"fmt"
 	"query-engine/datatypes"
 	"query-engine/physicalplan"
+	"query-engine/physicalplan/exprs"
 )
 
 type ProjectionExec struct {
@@ -19,23 +21,60 @@ func (p ProjectionExec) Schema() datatypes.Schema {
 	return p.schema
 }
 
-func (p ProjectionExec) Execute() datatypes.RecordBatch {
-	recordBatch := p.input.Execute()
+func (p ProjectionExec) Execute(ctx context.Context) (datatypes.RecordBatch, error) {
+	recordBatch, err := p.input.Execute(ctx)
+	if err != nil {
+		return datatypes.RecordBatch{}, err
+	}
 	fields := make([]datatypes.ColumnArray, len(p.exprs))
 	for i := 0; i < len(p.exprs); i++ {
-		fields[i] = p.exprs[i].Evaluate(recordBatch)
+		fields[i], err = p.exprs[i].Evaluate(recordBatch)
+		if err != nil {
+			return datatypes.RecordBatch{}, err
+		}
 	}
-	return datatypes.RecordBatch{Schema: p.schema, Fields: fields}
+	return datatypes.RecordBatch{Schema: p.schema, Fields: fields}, nil
 }
 
-func (p ProjectionExec) Next() bool {
-	return p.input.Next()
+func (p ProjectionExec) Next(ctx context.Context) bool {
+	return p.input.Next(ctx)
 }
 
 func (p ProjectionExec) Children() []physicalplan.PhysicalPlan {
 	return []physicalplan.PhysicalPlan{p.input}
 }
 
+func (p ProjectionExec) Close() {
+	p.input.Close()
+}
+
+func (p ProjectionExec) OutputPartitioning() physicalplan.Partitioning {
+	// the exprs change the columns, so that hash keys of the input no longer apply
+	return physicalplan.UnknownPartitioning(p.input.OutputPartitioning().Count)
+}
+
+// OutputOrdering maps the ordering of the input to the projected columns, up to the first expr not projected
+func (p ProjectionExec) OutputOrdering() []physicalplan.PhysicalExpr {
+	ordering := make([]physicalplan.PhysicalExpr, 0)
+	for _, expr := range p.input.OutputOrdering() {
+		idx := -1
+		for i, projected := range p.exprs {
+			if fmt.Sprint(projected) == fmt.Sprint(expr) {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			break
+		}
+		ordering = append(ordering, exprs.NewColumnIndexExpr(idx))
+	}
+	if len(ordering) == 0 {
+		return nil
+	}
+	return ordering
+}
+
 func (p ProjectionExec) String() string {
 	return fmt.Sprintf("ProjectionExec: %v", p.exprs)
 }
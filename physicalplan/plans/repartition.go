@@ -0,0 +1,355 @@
+package plans
+
+import (
+	"context"
+	"fmt"
+	"github.com/apache/arrow/go/v6/arrow/memory"
+	"hash/fnv"
+	"query-engine/datatypes"
+	"query-engine/physicalplan"
+	"sync"
+)
+
+// RepartitionExec is an output partition of an exchange, which redistributes the rows of its input partitions
+// into the partitions of a physicalplan.Partitioning: by the hash of its exprs, or round robin by batch
+// without exprs. The first Next of any partition starts a goroutine for every input, the batches are queued
+// per output partition up to queueCapacity batches, an input waits while the queue of a partition is full.
+// So the partitions are read concurrently, and a partition which stops early is closed so that its batches
+// are dropped. Once all the partitions are closed, the goroutines are stopped, every goroutine closes its input.
+type RepartitionExec struct {
+	exchange  *exchange
+	partition int
+	closed    bool
+
+	// batch prepared by Next, or the error of preparing it
+	batch datatypes.RecordBatch
+	err   error
+}
+
+// exchange is shared by the RepartitionExec of all the output partitions
+type exchange struct {
+	inputs       []physicalplan.PhysicalPlan
+	partitioning physicalplan.Partitioning
+
+	start  sync.Once
+	queues []*batchQueue
+	// cancel stops the input goroutines, done is closed once they are all done
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// mu guards open, the number of partitions not closed yet
+	mu   sync.Mutex
+	open int
+}
+
+// NewRepartitionExecs creates the RepartitionExec of every output partition of partitioning
+func NewRepartitionExecs(
+	inputs []physicalplan.PhysicalPlan, partitioning physicalplan.Partitioning,
+) []physicalplan.PhysicalPlan {
+	ex := &exchange{
+		inputs:       inputs,
+		partitioning: partitioning,
+		queues:       make([]*batchQueue, partitioning.Count),
+		done:         make(chan struct{}),
+		open:         partitioning.Count,
+	}
+	partitions := make([]physicalplan.PhysicalPlan, partitioning.Count)
+	for i := range partitions {
+		ex.queues[i] = newBatchQueue()
+		partitions[i] = &RepartitionExec{exchange: ex, partition: i}
+	}
+	return partitions
+}
+
+func (r *RepartitionExec) Schema() datatypes.Schema {
+	return r.exchange.inputs[0].Schema()
+}
+
+func (r *RepartitionExec) Execute(ctx context.Context) (datatypes.RecordBatch, error) {
+	return r.batch, r.err
+}
+
+// Next waits for a batch of the partition, an input error is returned by Execute in every partition
+func (r *RepartitionExec) Next(ctx context.Context) bool {
+	if r.err != nil {
+		return false
+	}
+	r.exchange.start.Do(func() {
+		r.exchange.run(ctx)
+	})
+	result, ok, err := r.exchange.queues[r.partition].pop(ctx)
+	if err != nil {
+		r.err = err
+		return true
+	}
+	if !ok {
+		return false
+	}
+	r.batch, r.err = result.batch, result.err
+	return true
+}
+
+func (r *RepartitionExec) Children() []physicalplan.PhysicalPlan {
+	return r.exchange.inputs
+}
+
+func (r *RepartitionExec) Close() {
+	if r.closed {
+		return
+	}
+	r.closed = true
+	r.exchange.queues[r.partition].discard()
+	r.exchange.closePartition()
+}
+
+func (r *RepartitionExec) OutputPartitioning() physicalplan.Partitioning {
+	return r.exchange.partitioning
+}
+
+func (r *RepartitionExec) OutputOrdering() []physicalplan.PhysicalExpr {
+	return nil
+}
+
+func (r *RepartitionExec) String() string {
+	return fmt.Sprintf("RepartitionExec: partitioning=%s, partition=%d", r.exchange.partitioning, r.partition)
+}
+
+// run starts a goroutine for every input, the queues are closed once all the inputs are done.
+// Once an input fails, the error is queued to every partition and the other inputs are cancelled.
+func (e *exchange) run(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	e.cancel = cancel
+	var wg sync.WaitGroup
+	wg.Add(len(e.inputs))
+	for i, input := range e.inputs {
+		go func(input physicalplan.PhysicalPlan, next int) {
+			defer wg.Done()
+			defer input.Close()
+			if err := e.distribute(ctx, input, next); err != nil {
+				cancel()
+				for _, queue := range e.queues {
+					_ = queue.push(ctx, exchangeResult{err: err})
+				}
+			}
+		}(input, i)
+	}
+	go func() {
+		wg.Wait()
+		cancel()
+		for _, queue := range e.queues {
+			queue.close()
+		}
+		close(e.done)
+	}()
+}
+
+// closePartition stops the goroutines once the last partition is closed, the inputs are closed
+// right away when the goroutines were never started
+func (e *exchange) closePartition() {
+	e.mu.Lock()
+	e.open--
+	last := e.open == 0
+	e.mu.Unlock()
+	if !last {
+		return
+	}
+	started := true
+	e.start.Do(func() {
+		started = false
+	})
+	if !started {
+		closePlans(e.inputs)
+		return
+	}
+	e.cancel()
+	<-e.done
+}
+
+// distribute queues the rows of an input to their partitions, next is the first round robin partition
+func (e *exchange) distribute(ctx context.Context, input physicalplan.PhysicalPlan, next int) error {
+	count := e.partitioning.Count
+	for input.Next(ctx) {
+		batch, err := input.Execute(ctx)
+		if err != nil {
+			return err
+		}
+		if len(e.partitioning.Exprs) == 0 {
+			if err := e.queues[next%count].push(ctx, exchangeResult{batch: batch}); err != nil {
+				return err
+			}
+			next++
+			continue
+		}
+		parts, err := e.hashPartition(batch)
+		if err != nil {
+			return err
+		}
+		for i, part := range parts {
+			if part.RowCount() == 0 {
+				continue
+			}
+			if err := e.queues[i].push(ctx, exchangeResult{batch: part}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hashPartition splits a batch by the hash of the row keys of the partitioning exprs, see appendRowKey,
+// so that the equal keys of a group, a join or a set operation are in the same partition
+func (e *exchange) hashPartition(batch datatypes.RecordBatch) ([]datatypes.RecordBatch, error) {
+	keys := make([]datatypes.ColumnArray, len(e.partitioning.Exprs))
+	for i, expr := range e.partitioning.Exprs {
+		var err error
+		if keys[i], err = expr.Evaluate(batch); err != nil {
+			return nil, err
+		}
+	}
+	rows := make([][]int, e.partitioning.Count)
+	values := make([]interface{}, len(keys))
+	var buf []byte
+	hash := fnv.New64a()
+	for rowIdx := 0; rowIdx < batch.RowCount(); rowIdx++ {
+		for i, key := range keys {
+			values[i] = key.GetValue(rowIdx)
+		}
+		var err error
+		if buf, err = appendRowKey(buf[:0], values); err != nil {
+			return nil, err
+		}
+		hash.Reset()
+		hash.Write(buf)
+		p := hash.Sum64() % uint64(e.partitioning.Count)
+		rows[p] = append(rows[p], rowIdx)
+	}
+	parts := make([]datatypes.RecordBatch, len(rows))
+	for i := range rows {
+		parts[i] = takeRows(batch, rows[i])
+	}
+	return parts, nil
+}
+
+// takeRows copies the rows of a batch into a new batch
+func takeRows(batch datatypes.RecordBatch, rows []int) datatypes.RecordBatch {
+	fields := make([]datatypes.ColumnArray, batch.ColumnCount())
+	for i := range fields {
+		column := batch.Field(i)
+		builder := datatypes.NewArrowArrayBuilder(memory.NewGoAllocator(), column.GetType())
+		builder.Reserve(len(rows))
+		for _, rowIdx := range rows {
+			builder.Append(column.GetValue(rowIdx))
+		}
+		fields[i] = builder.Build()
+	}
+	return datatypes.RecordBatch{Schema: batch.Schema, Fields: fields}
+}
+
+// queueCapacity is the max number of batches queued for an output partition
+const queueCapacity = 16
+
+// batchQueue is a bounded queue of the results of an output partition, a producer waits while it is full
+type batchQueue struct {
+	mu      sync.Mutex
+	results []exchangeResult
+	closed  bool
+	// discarded is set once the partition is closed, the results pushed after are dropped
+	discarded bool
+	// notify wakes up the reader once a result is pushed or the queue is closed,
+	// space wakes up a producer once a result is read, it is closed once the queue is discarded
+	notify chan struct{}
+	space  chan struct{}
+}
+
+func newBatchQueue() *batchQueue {
+	return &batchQueue{notify: make(chan struct{}, 1), space: make(chan struct{}, 1)}
+}
+
+// push waits for room in the queue, until ctx is done. An error is queued right away, as the producers
+// are cancelled once an input fails.
+func (q *batchQueue) push(ctx context.Context, result exchangeResult) error {
+	for {
+		q.mu.Lock()
+		if q.discarded {
+			q.mu.Unlock()
+			return nil
+		}
+		if len(q.results) < queueCapacity || result.err != nil {
+			q.results = append(q.results, result)
+			if len(q.results) < queueCapacity {
+				// another producer may wait for the room left
+				q.signalSpace()
+			}
+			q.mu.Unlock()
+			q.wake()
+			return nil
+		}
+		q.mu.Unlock()
+		select {
+		case <-q.space:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (q *batchQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.wake()
+}
+
+// discard drops the queued results and the ones pushed later, the waiting producers are woken up
+func (q *batchQueue) discard() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.discarded {
+		return
+	}
+	q.discarded = true
+	q.results = nil
+	close(q.space)
+}
+
+func (q *batchQueue) wake() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// signalSpace wakes up a producer waiting for room, q.mu is held so that space isn't closed meanwhile
+func (q *batchQueue) signalSpace() {
+	if q.discarded {
+		return
+	}
+	select {
+	case q.space <- struct{}{}:
+	default:
+	}
+}
+
+// pop waits for the next result, ok is false once the queue is closed and empty
+func (q *batchQueue) pop(ctx context.Context) (exchangeResult, bool, error) {
+	for {
+		q.mu.Lock()
+		if len(q.results) > 0 {
+			result := q.results[0]
+			q.results = q.results[1:]
+			q.signalSpace()
+			q.mu.Unlock()
+			return result, true, nil
+		}
+		closed := q.closed
+		q.mu.Unlock()
+		if closed {
+			return exchangeResult{}, false, nil
+		}
+		select {
+		case <-q.notify:
+		case <-ctx.Done():
+			return exchangeResult{}, false, ctx.Err()
+		}
+	}
+}
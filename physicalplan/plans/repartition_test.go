@@ -0,0 +1,141 @@
+package plans
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/apache/arrow/go/v6/arrow/memory"
+	"github.com/stretchr/testify/require"
+	"math"
+	"query-engine/datatypes"
+	"query-engine/physicalplan"
+	"query-engine/physicalplan/exprs"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRepartitionExec_hash(t *testing.T) {
+	partitioning := physicalplan.HashPartitioning([]physicalplan.PhysicalExpr{exprs.NewColumnIndexExpr(0)}, 4)
+	partitions := NewRepartitionExecs(parquetPartitions(t, 3, []string{"Id", "Bool_col"}), partitioning)
+	require.Len(t, partitions, 4)
+	require.Equal(t, partitioning, partitions[0].OutputPartitioning())
+
+	// the partitions are read one after the other, every id is in a single partition
+	partitionOf := make(map[string]int)
+	count := 0
+	for i, partition := range partitions {
+		for _, row := range sortedRows(collect(t, partition)) {
+			if row == "" {
+				continue
+			}
+			p, ok := partitionOf[row]
+			require.True(t, !ok || p == i, row)
+			partitionOf[row] = i
+			count++
+		}
+	}
+	require.Len(t, partitionOf, 8)
+	require.Equal(t, 24, count)
+}
+
+func TestRepartitionExec_hash_float_keys(t *testing.T) {
+	schema := datatypes.Schema{Fields: []datatypes.Field{{Name: "v", DataType: datatypes.DoubleType}}}
+	values := make([]interface{}, 0)
+	// the mem scan batches are single rows, fewer than queueCapacity as the partitions are read in turn
+	for i := 0; i < 3; i++ {
+		values = append(values, 0.0, math.Copysign(0, -1), math.NaN(), math.Float64frombits(0x7ff8000000000002), float64(i+1))
+	}
+	partitioning := physicalplan.HashPartitioning([]physicalplan.PhysicalExpr{exprs.NewColumnIndexExpr(0)}, 3)
+	partitions := NewRepartitionExecs([]physicalplan.PhysicalPlan{memScan(schema, values)}, partitioning)
+
+	// 0 and -0 are in the same partition, as are all the NaN
+	partitionOf := make(map[string]int)
+	count := 0
+	for i, partition := range partitions {
+		for _, batch := range collectBatches(t, partition) {
+			for rowIdx := 0; rowIdx < batch.RowCount(); rowIdx++ {
+				key := fmt.Sprint(batch.Field(0).GetValue(rowIdx))
+				if key == "-0" {
+					key = "0"
+				}
+				p, ok := partitionOf[key]
+				require.True(t, !ok || p == i, key)
+				partitionOf[key] = i
+				count++
+			}
+		}
+	}
+	require.Len(t, partitionOf, 5)
+	require.Equal(t, 15, count)
+}
+
+func TestRepartitionExec_round_robin(t *testing.T) {
+	partitions := NewRepartitionExecs(parquetPartitions(t, 2, []string{"Id"}), physicalplan.UnknownPartitioning(3))
+	plan := NewCoalesceExec(partitions)
+
+	expect := make([]string, 0)
+	for _, id := range []string{"0", "1", "2", "3", "4", "5", "6", "7"} {
+		expect = append(expect, id, id)
+	}
+	require.Equal(t, expect, sortedRows(collect(t, plan)))
+
+	// the batches of every input are sent round robin to the 3 partitions
+	require.Len(t, plan.Children(), 3)
+}
+
+func TestRepartitionExec_error(t *testing.T) {
+	inputs := []physicalplan.PhysicalPlan{parquetScan(t, 3, []string{"Id"}), parquetScan(t, 3, []string{"Missing"})}
+	partitions := NewRepartitionExecs(inputs, physicalplan.UnknownPartitioning(2))
+
+	// every partition returns the error
+	for _, partition := range partitions {
+		var err error
+		for err == nil && partition.Next(context.Background()) {
+			_, err = partition.Execute(context.Background())
+		}
+		var schemaErr *datatypes.SchemaError
+		require.True(t, errors.As(err, &schemaErr))
+	}
+}
+
+func TestRepartitionExec_cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	partitions := NewRepartitionExecs(parquetPartitions(t, 2, []string{"Id"}), physicalplan.UnknownPartitioning(2))
+
+	require.True(t, partitions[0].Next(ctx))
+	_, err := partitions[0].Execute(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestRepartitionExec_bounded_queues(t *testing.T) {
+	schema := datatypes.Schema{Fields: []datatypes.Field{{Name: "id", DataType: datatypes.Int64Type}}}
+	batches := make([]datatypes.RecordBatch, 100)
+	for i := range batches {
+		builder := datatypes.NewArrowArrayBuilder(memory.NewGoAllocator(), datatypes.Int64Type)
+		builder.Append(int64(i))
+		batches[i] = datatypes.RecordBatch{Schema: schema, Fields: []datatypes.ColumnArray{builder.Build()}}
+	}
+	partitions := NewRepartitionExecs(
+		[]physicalplan.PhysicalPlan{&batchesExec{schema: schema, batches: batches}}, physicalplan.UnknownPartitioning(2))
+	exchange := partitions[0].(*RepartitionExec).exchange
+	queued := func(partition int) int {
+		queue := exchange.queues[partition]
+		queue.mu.Lock()
+		defer queue.mu.Unlock()
+		return len(queue.results)
+	}
+
+	// the input waits once the queue of the partition which isn't read is full
+	require.True(t, partitions[0].Next(context.Background()))
+	time.Sleep(50 * time.Millisecond)
+	require.LessOrEqual(t, queued(0), queueCapacity)
+	require.LessOrEqual(t, queued(1), queueCapacity)
+
+	// the batches of a closed partition are dropped, so that the other partition is read to the end
+	partitions[1].Close()
+	require.Equal(t, 49, strings.Count(collect(t, partitions[0]), "\n"))
+	partitions[0].Close()
+	require.Equal(t, 0, queued(1))
+}
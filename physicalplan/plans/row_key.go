@@ -0,0 +1,225 @@
+package plans
+
+import (
+	"encoding/binary"
+	"math"
+	"query-engine/datatypes"
+)
+
+// tags of the values of a row key, a value is its tag followed by its big endian bytes,
+// a string is its tag followed by its uvarint length and bytes, null is its tag alone
+const (
+	keyNull byte = iota
+	keyFalse
+	keyTrue
+	keyInt8
+	keyInt16
+	keyInt32
+	keyInt64
+	keyUint8
+	keyUint16
+	keyUint32
+	keyUint64
+	keyFloat32
+	keyFloat64
+	keyString
+)
+
+// appendRowKey appends the binary row key of values to buf. Two rows have the same key
+// only when their values have the same types and are equal, so that null, "<nil>" and
+// the strings of ("1", "11") and ("11", "1") are distinct keys. 0 and -0 have the same key,
+// as do all the NaN of a float type.
+func appendRowKey(buf []byte, values []interface{}) ([]byte, error) {
+	var scratch [binary.MaxVarintLen64]byte
+	for _, value := range values {
+		switch v := value.(type) {
+		case nil:
+			buf = append(buf, keyNull)
+		case bool:
+			if v {
+				buf = append(buf, keyTrue)
+			} else {
+				buf = append(buf, keyFalse)
+			}
+		case int8:
+			buf = append(buf, keyInt8, byte(v))
+		case int16:
+			buf = append(buf, keyInt16)
+			buf = appendUint(buf, uint64(uint16(v)), 2)
+		case int32:
+			buf = append(buf, keyInt32)
+			buf = appendUint(buf, uint64(uint32(v)), 4)
+		case int64:
+			buf = append(buf, keyInt64)
+			buf = appendUint(buf, uint64(v), 8)
+		case uint8:
+			buf = append(buf, keyUint8, v)
+		case uint16:
+			buf = append(buf, keyUint16)
+			buf = appendUint(buf, uint64(v), 2)
+		case uint32:
+			buf = append(buf, keyUint32)
+			buf = appendUint(buf, uint64(v), 4)
+		case uint64:
+			buf = append(buf, keyUint64)
+			buf = appendUint(buf, v, 8)
+		case float32:
+			buf = append(buf, keyFloat32)
+			buf = appendUint(buf, uint64(math.Float32bits(normalizeFloat32(v))), 4)
+		case float64:
+			buf = append(buf, keyFloat64)
+			buf = appendUint(buf, math.Float64bits(normalizeFloat64(v)), 8)
+		case string:
+			buf = append(buf, keyString)
+			n := binary.PutUvarint(scratch[:], uint64(len(v)))
+			buf = append(buf, scratch[:n]...)
+			buf = append(buf, v...)
+		default:
+			return nil, datatypes.NewSchemaError("unsupported group key type %T", value)
+		}
+	}
+	return buf, nil
+}
+
+// decodeRowKey returns the values of a row key built by appendRowKey
+func decodeRowKey(key string) ([]interface{}, error) {
+	values := make([]interface{}, 0)
+	for pos := 0; pos < len(key); {
+		tag := key[pos]
+		pos++
+		size := 0
+		switch tag {
+		case keyInt8, keyUint8:
+			size = 1
+		case keyInt16, keyUint16:
+			size = 2
+		case keyInt32, keyUint32, keyFloat32:
+			size = 4
+		case keyInt64, keyUint64, keyFloat64:
+			size = 8
+		case keyString:
+			end := pos + binary.MaxVarintLen64
+			if end > len(key) {
+				end = len(key)
+			}
+			length, n := binary.Uvarint([]byte(key[pos:end]))
+			if n <= 0 || uint64(len(key)-pos-n) < length {
+				return nil, datatypes.NewPlanError("invalid group key at byte %d", pos)
+			}
+			pos += n
+			size = int(length)
+		}
+		if len(key)-pos < size {
+			return nil, datatypes.NewPlanError("invalid group key at byte %d", pos)
+		}
+		var bits uint64
+		if tag != keyString {
+			bits = readUint(key[pos:], size)
+		}
+
+		switch tag {
+		case keyNull:
+			values = append(values, nil)
+		case keyFalse:
+			values = append(values, false)
+		case keyTrue:
+			values = append(values, true)
+		case keyInt8:
+			values = append(values, int8(bits))
+		case keyInt16:
+			values = append(values, int16(bits))
+		case keyInt32:
+			values = append(values, int32(bits))
+		case keyInt64:
+			values = append(values, int64(bits))
+		case keyUint8:
+			values = append(values, uint8(bits))
+		case keyUint16:
+			values = append(values, uint16(bits))
+		case keyUint32:
+			values = append(values, uint32(bits))
+		case keyUint64:
+			values = append(values, bits)
+		case keyFloat32:
+			values = append(values, math.Float32frombits(uint32(bits)))
+		case keyFloat64:
+			values = append(values, math.Float64frombits(bits))
+		case keyString:
+			values = append(values, key[pos:pos+size])
+		default:
+			return nil, datatypes.NewPlanError("invalid group key tag %d at byte %d", tag, pos-1)
+		}
+		pos += size
+	}
+	return values, nil
+}
+
+func appendUint(buf []byte, v uint64, size int) []byte {
+	for shift := 8 * (size - 1); shift >= 0; shift -= 8 {
+		buf = append(buf, byte(v>>uint(shift)))
+	}
+	return buf
+}
+
+// readUint reads the size big endian bytes of a fixed width value
+func readUint(s string, size int) uint64 {
+	var v uint64
+	for i := 0; i < size; i++ {
+		v = v<<8 | uint64(s[i])
+	}
+	return v
+}
+
+func normalizeFloat32(v float32) float32 {
+	if v != v {
+		return float32(math.NaN())
+	}
+	if v == 0 {
+		return 0
+	}
+	return v
+}
+
+func normalizeFloat64(v float64) float64 {
+	if v != v {
+		return math.NaN()
+	}
+	if v == 0 {
+		return 0
+	}
+	return v
+}
+
+// rowSet is a set of the rows of record batches, keyed by their row key over all the columns
+type rowSet struct {
+	keys map[string]struct{}
+	// buf is reused to build the row keys
+	buf []byte
+}
+
+func newRowSet() *rowSet {
+	return &rowSet{keys: make(map[string]struct{})}
+}
+
+// add adds a row to the set, it returns whether the row was not already in the set
+func (s *rowSet) add(batch datatypes.RecordBatch, rowIdx int) (bool, error) {
+	var err error
+	if s.buf, err = appendRowKey(s.buf[:0], rowKeys(batch.Fields, rowIdx)); err != nil {
+		return false, err
+	}
+	if _, ok := s.keys[string(s.buf)]; ok {
+		return false, nil
+	}
+	s.keys[string(s.buf)] = struct{}{}
+	return true, nil
+}
+
+// contains tells whether a row is in the set
+func (s *rowSet) contains(batch datatypes.RecordBatch, rowIdx int) (bool, error) {
+	var err error
+	if s.buf, err = appendRowKey(s.buf[:0], rowKeys(batch.Fields, rowIdx)); err != nil {
+		return false, err
+	}
+	_, ok := s.keys[string(s.buf)]
+	return ok, nil
+}
@@ -0,0 +1,69 @@
+package plans
+
+import (
+	"errors"
+	"github.com/stretchr/testify/require"
+	"math"
+	"query-engine/datatypes"
+	"testing"
+)
+
+func rowKey(t *testing.T, values ...interface{}) string {
+	key, err := appendRowKey(nil, values)
+	require.NoError(t, err)
+	return string(key)
+}
+
+func TestRowKey_round_trip(t *testing.T) {
+	values := []interface{}{
+		nil, true, false, int8(-8), int16(-16), int32(-32), int64(-64),
+		uint8(8), uint16(16), uint32(32), uint64(math.MaxUint64),
+		float32(1.5), -2.5, "", "CA", nil, "a longer string of more than one hundred and twenty seven bytes, " +
+			"so that its uvarint length takes two bytes instead of a single one in the row key",
+	}
+	res, err := decodeRowKey(rowKey(t, values...))
+	require.NoError(t, err)
+	require.Equal(t, values, res)
+
+	res, err = decodeRowKey("")
+	require.NoError(t, err)
+	require.Empty(t, res)
+}
+
+func TestRowKey_distinct(t *testing.T) {
+	testCases := [][2][]interface{}{
+		{{"1", "11"}, {"11", "1"}},
+		{{"a", ""}, {"", "a"}},
+		{{nil}, {"<nil>"}},
+		{{nil}, {""}},
+		{{nil}, {false}},
+		{{nil, "a"}, {"a", nil}},
+		{{int32(1)}, {int64(1)}},
+		{{int64(1)}, {uint64(1)}},
+		{{int64(1)}, {float64(1)}},
+		{{"1"}, {int64(1)}},
+		{{true}, {"true"}},
+	}
+	for _, tc := range testCases {
+		require.NotEqual(t, rowKey(t, tc[0]...), rowKey(t, tc[1]...), "%v %v", tc[0], tc[1])
+	}
+}
+
+func TestRowKey_equal_floats(t *testing.T) {
+	require.Equal(t, rowKey(t, 0.0), rowKey(t, math.Copysign(0, -1)))
+	require.Equal(t, rowKey(t, math.NaN()), rowKey(t, -math.NaN()))
+	require.Equal(t, rowKey(t, float32(0)), rowKey(t, float32(math.Copysign(0, -1))))
+}
+
+func TestRowKey_errors(t *testing.T) {
+	var schemaErr *datatypes.SchemaError
+	_, err := appendRowKey(nil, []interface{}{[]int{1}})
+	require.True(t, errors.As(err, &schemaErr))
+	require.EqualError(t, err, "unsupported group key type []int")
+
+	var planErr *datatypes.PlanError
+	for _, key := range []string{rowKey(t, int64(1))[:3], rowKey(t, "abc")[:3], "\xff"} {
+		_, err = decodeRowKey(key)
+		require.True(t, errors.As(err, &planErr), key)
+	}
+}
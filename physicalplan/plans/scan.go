@@ -1,15 +1,19 @@
 package plans
 
 import (
+	"context"
 	"fmt"
 	"query-engine/datasource"
 	"query-engine/datatypes"
 	"query-engine/physicalplan"
+	"query-engine/physicalplan/exprs"
 )
 
 type ScanExec struct {
 	ds         datasource.DataSource
 	projection []string
+	// partitions is the number of sibling ScanExec reading the other partitions of the data source
+	partitions int
 }
 
 func (s ScanExec) Schema() datatypes.Schema {
@@ -18,22 +22,60 @@ func (s ScanExec) Schema() datatypes.Schema {
 	return schema
 }
 
-func (s ScanExec) Execute() datatypes.RecordBatch {
-	return s.ds.Scan(s.projection)
+func (s ScanExec) Execute(ctx context.Context) (datatypes.RecordBatch, error) {
+	return s.ds.Scan(ctx, s.projection)
 }
 
-func (s ScanExec) Next() bool {
-	return s.ds.Next()
+func (s ScanExec) Next(ctx context.Context) bool {
+	return s.ds.Next(ctx)
 }
 
 func (s ScanExec) Children() []physicalplan.PhysicalPlan {
 	return []physicalplan.PhysicalPlan{}
 }
 
+func (s ScanExec) Close() {
+	s.ds.Close()
+}
+
+func (s ScanExec) OutputPartitioning() physicalplan.Partitioning {
+	return physicalplan.UnknownPartitioning(s.partitions)
+}
+
+// OutputOrdering returns the projected columns of a datasource.SortedDataSource, up to the first one not projected
+func (s ScanExec) OutputOrdering() []physicalplan.PhysicalExpr {
+	ds, ok := s.ds.(datasource.SortedDataSource)
+	if !ok {
+		return nil
+	}
+	schema := s.Schema()
+	ordering := make([]physicalplan.PhysicalExpr, 0)
+	for _, name := range ds.SortedBy() {
+		idx := schema.FindFirstIndexByName(name)
+		if idx < 0 {
+			break
+		}
+		ordering = append(ordering, exprs.NewColumnIndexExpr(idx))
+	}
+	if len(ordering) == 0 {
+		return nil
+	}
+	return ordering
+}
+
 func (s ScanExec) String() string {
 	return fmt.Sprintf("ScanExec: schema=%s, projection=%v", s.Schema(), s.projection)
 }
 
 func NewScanExec(ds datasource.DataSource, projection []string) ScanExec {
-	return ScanExec{ds, projection}
+	return ScanExec{ds, projection, 1}
+}
+
+// NewPartitionScanExecs creates a ScanExec for every partition of a data source, see datasource.PartitionedDataSource
+func NewPartitionScanExecs(partitions []datasource.DataSource, projection []string) []physicalplan.PhysicalPlan {
+	scans := make([]physicalplan.PhysicalPlan, len(partitions))
+	for i, ds := range partitions {
+		scans[i] = ScanExec{ds, projection, len(partitions)}
+	}
+	return scans
 }
@@ -1,6 +1,7 @@
 package plans
 
 import (
+	"context"
 	"fmt"
 	"github.com/apache/arrow/go/v6/arrow/memory"
 	"query-engine/datatypes"
@@ -20,27 +21,46 @@ func (s SelectionExec) Schema() datatypes.Schema {
 	return s.input.Schema()
 }
 
-func (s SelectionExec) Execute() datatypes.RecordBatch {
-	recordBatch := s.input.Execute()
+func (s SelectionExec) Execute(ctx context.Context) (datatypes.RecordBatch, error) {
+	recordBatch, err := s.input.Execute(ctx)
+	if err != nil {
+		return datatypes.RecordBatch{}, err
+	}
 	// use boolean binary expr to evaluate input recordBatch
 	// and produce a bool columnArray to represents current row whether matched or not
-	rowBoolEvalResult := s.expr.Evaluate(recordBatch)
+	rowBoolEvalResult, err := s.expr.Evaluate(recordBatch)
+	if err != nil {
+		return datatypes.RecordBatch{}, err
+	}
 	if rowBoolEvalResult.GetType() != datatypes.BooleanType {
-		panic(fmt.Sprintf("SelectionExec unexpect expr: %s and type: %s", s.expr, rowBoolEvalResult.GetType()))
+		return datatypes.RecordBatch{}, datatypes.NewSchemaError(
+			"SelectionExec unexpect expr: %s and type: %s", s.expr, rowBoolEvalResult.GetType())
 	}
 
 	filteredColumnArray := s.filter(recordBatch, rowBoolEvalResult)
-	return datatypes.RecordBatch{Schema: recordBatch.Schema, Fields: filteredColumnArray}
+	return datatypes.RecordBatch{Schema: recordBatch.Schema, Fields: filteredColumnArray}, nil
 }
 
-func (s SelectionExec) Next() bool {
-	return s.input.Next()
+func (s SelectionExec) Next(ctx context.Context) bool {
+	return s.input.Next(ctx)
 }
 
 func (s SelectionExec) Children() []physicalplan.PhysicalPlan {
 	return []physicalplan.PhysicalPlan{s.input}
 }
 
+func (s SelectionExec) Close() {
+	s.input.Close()
+}
+
+func (s SelectionExec) OutputPartitioning() physicalplan.Partitioning {
+	return s.input.OutputPartitioning()
+}
+
+func (s SelectionExec) OutputOrdering() []physicalplan.PhysicalExpr {
+	return s.input.OutputOrdering()
+}
+
 func (s SelectionExec) String() string {
 	return fmt.Sprintf("Selection: %s", s.expr)
 }
@@ -51,7 +71,8 @@ func (s SelectionExec) filter(recordBatch datatypes.RecordBatch, rowBoolEvalResu
 		columnArray := recordBatch.Field(i)
 		b := datatypes.NewArrowArrayBuilder(memory.NewGoAllocator(), columnArray.GetType())
 		for j := 0; j < rowBoolEvalResult.Size(); j++ {
-			if rowBoolEvalResult.GetValue(j).(bool) {
+			// a null condition doesn't match
+			if matched, _ := rowBoolEvalResult.GetValue(j).(bool); matched {
 				b.Append(columnArray.GetValue(j))
 			}
 		}
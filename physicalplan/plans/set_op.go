@@ -0,0 +1,128 @@
+package plans
+
+import (
+	"context"
+	"fmt"
+	"query-engine/datatypes"
+	"query-engine/logicalplan"
+	"query-engine/physicalplan"
+)
+
+// HashSetOpExec is an INTERSECT or an EXCEPT: it loads the rows of the right input into a hash set,
+// then streams the distinct rows of the left input which are in the set for INTERSECT, or not in the set
+// for EXCEPT. Both inputs have the types of the schema, nulls are equal to each other.
+type HashSetOpExec struct {
+	left  physicalplan.PhysicalPlan
+	right physicalplan.PhysicalPlan
+	op    logicalplan.SetOperator
+
+	schema datatypes.Schema
+
+	// rows of the right input, loaded by the first Next
+	rightRows *rowSet
+	// left rows returned so far
+	seen *rowSet
+
+	// batch prepared by Next, or the error of preparing it
+	batch datatypes.RecordBatch
+	err   error
+}
+
+func NewHashSetOpExec(
+	left, right physicalplan.PhysicalPlan, op logicalplan.SetOperator, schema datatypes.Schema,
+) *HashSetOpExec {
+	return &HashSetOpExec{left: left, right: right, op: op, schema: schema, seen: newRowSet()}
+}
+
+func (h *HashSetOpExec) Schema() datatypes.Schema {
+	return h.schema
+}
+
+func (h *HashSetOpExec) Execute(ctx context.Context) (datatypes.RecordBatch, error) {
+	return h.batch, h.err
+}
+
+// Next loads the right input on the first call, then filters the rows of the next left batch
+func (h *HashSetOpExec) Next(ctx context.Context) bool {
+	if h.err != nil {
+		return false
+	}
+	if h.rightRows == nil {
+		if h.err = h.build(ctx); h.err != nil {
+			return true
+		}
+	}
+	if !h.left.Next(ctx) {
+		return false
+	}
+	batch, err := h.left.Execute(ctx)
+	if err != nil {
+		h.err = err
+		return true
+	}
+	rows := make([]int, 0)
+	for rowIdx := 0; rowIdx < batch.RowCount(); rowIdx++ {
+		inRight, err := h.rightRows.contains(batch, rowIdx)
+		if err != nil {
+			h.err = err
+			return true
+		}
+		if inRight != (h.op == logicalplan.IntersectOperator) {
+			continue
+		}
+		added, err := h.seen.add(batch, rowIdx)
+		if err != nil {
+			h.err = err
+			return true
+		}
+		if added {
+			rows = append(rows, rowIdx)
+		}
+	}
+	batch = takeRows(batch, rows)
+	h.batch = datatypes.RecordBatch{Schema: h.schema, Fields: batch.Fields}
+	return true
+}
+
+func (h *HashSetOpExec) Children() []physicalplan.PhysicalPlan {
+	return []physicalplan.PhysicalPlan{h.left, h.right}
+}
+
+func (h *HashSetOpExec) Close() {
+	h.left.Close()
+	h.right.Close()
+}
+
+func (h *HashSetOpExec) OutputPartitioning() physicalplan.Partitioning {
+	return physicalplan.UnknownPartitioning(h.left.OutputPartitioning().Count)
+}
+
+// OutputOrdering is the ordering of the left input, as its rows are filtered in place
+func (h *HashSetOpExec) OutputOrdering() []physicalplan.PhysicalExpr {
+	return h.left.OutputOrdering()
+}
+
+func (h *HashSetOpExec) String() string {
+	return fmt.Sprintf("HashSetOpExec: op=%s", h.op)
+}
+
+// build loads the rows of the right input into the hash set
+func (h *HashSetOpExec) build(ctx context.Context) error {
+	rightRows := newRowSet()
+	for h.right.Next(ctx) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		batch, err := h.right.Execute(ctx)
+		if err != nil {
+			return err
+		}
+		for rowIdx := 0; rowIdx < batch.RowCount(); rowIdx++ {
+			if _, err := rightRows.add(batch, rowIdx); err != nil {
+				return err
+			}
+		}
+	}
+	h.rightRows = rightRows
+	return nil
+}
@@ -0,0 +1,38 @@
+package plans
+
+import (
+	"github.com/stretchr/testify/require"
+	"query-engine/datatypes"
+	"query-engine/logicalplan"
+	"testing"
+)
+
+func TestHashSetOpExec(t *testing.T) {
+	schema := datatypes.Schema{Fields: []datatypes.Field{
+		{Name: "state", DataType: datatypes.StringType},
+		{Name: "id", DataType: datatypes.Int64Type},
+	}}
+	left := func() ScanExec {
+		return memScan(schema,
+			[]interface{}{"CA", "CO", "CA", nil, "WA", nil},
+			[]interface{}{int64(1), int64(2), int64(1), nil, int64(3), nil},
+		)
+	}
+	right := func() ScanExec {
+		return memScan(schema,
+			[]interface{}{"CA", "CO", nil, "CA"},
+			[]interface{}{int64(1), int64(3), nil, int64(1)},
+		)
+	}
+
+	// the left rows are distinct, nulls are equal to each other
+	intersect := NewHashSetOpExec(left(), right(), logicalplan.IntersectOperator, schema)
+	require.Equal(t, "CA,1\nnull,null\n", collect(t, intersect))
+	require.Equal(t, "HashSetOpExec: op=Intersect", intersect.String())
+
+	except := NewHashSetOpExec(left(), right(), logicalplan.ExceptOperator, schema)
+	require.Equal(t, "CO,2\nWA,3\n", collect(t, except))
+
+	empty := memScan(schema, []interface{}{}, []interface{}{})
+	require.Equal(t, "", collect(t, NewHashSetOpExec(left(), empty, logicalplan.IntersectOperator, schema)))
+}
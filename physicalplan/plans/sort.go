@@ -0,0 +1,513 @@
+package plans
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"github.com/apache/arrow/go/v6/arrow/memory"
+	"os"
+	"query-engine/datatypes"
+	"query-engine/physicalplan"
+	"query-engine/physicalplan/exprs"
+	"sort"
+	"strings"
+)
+
+// SortExec orders all the rows of its input by the sort exprs, it is an external merge sort:
+// input batches are buffered in memory, and whenever they exceed memoryLimit bytes the buffered rows
+// are sorted and spilled as a run to an Arrow IPC file in spillDir. Once the input is consumed,
+// the runs are k-way merged back, maxMergeRuns at a time into longer runs until they are merged at once.
+// Without spilled runs the rows are sorted in memory. The sorted rows are returned in batches of batchSize rows.
+type SortExec struct {
+	input     physicalplan.PhysicalPlan
+	sortExprs []exprs.SortExpr
+	// batchSize is the max rows of an output batch or of a spilled run batch, 0 or less means all the rows
+	batchSize int
+	// memoryLimit is the max bytes of buffered input batches, 0 or less means no limit
+	memoryLimit int64
+	// spillDir is where the runs are written, the default temp directory when empty
+	spillDir string
+
+	// input batches and their rows, loaded by the first Next
+	sorted  bool
+	batches []datatypes.RecordBatch
+	rows    []sortRow
+	memUsed int64
+	// cursor is the next row to return when the rows are sorted in memory
+	cursor int
+
+	// tempDir holds the spilled runs, merge reads them back
+	tempDir string
+	runs    []string
+	merge   *sortMerge
+
+	// batch prepared by Next, or the error of preparing it
+	batch datatypes.RecordBatch
+	err   error
+}
+
+// maxMergeRuns is the max number of runs merged at once, that is of spill files open at once
+const maxMergeRuns = 64
+
+// sortRow locates an input row along with the values of its sort keys
+type sortRow struct {
+	rowRef
+	keys []interface{}
+}
+
+func NewSortExec(
+	input physicalplan.PhysicalPlan, sortExprs []exprs.SortExpr, batchSize int, memoryLimit int64, spillDir string,
+) *SortExec {
+	return &SortExec{input: input, sortExprs: sortExprs, batchSize: batchSize, memoryLimit: memoryLimit, spillDir: spillDir}
+}
+
+func (s *SortExec) Schema() datatypes.Schema {
+	return s.input.Schema()
+}
+
+func (s *SortExec) Execute(ctx context.Context) (datatypes.RecordBatch, error) {
+	return s.batch, s.err
+}
+
+// Next returns true when a batch or an error is ready, a failed or cancelled sort returns no more batches
+func (s *SortExec) Next(ctx context.Context) bool {
+	if s.err != nil {
+		if s.merge != nil {
+			s.merge.close()
+		}
+		s.cleanup()
+		return false
+	}
+	if !s.sorted {
+		if s.err = s.sort(ctx); s.err != nil {
+			return true
+		}
+	} else if s.err = ctx.Err(); s.err != nil {
+		return true
+	}
+	if s.merge != nil {
+		return s.nextMerged()
+	}
+	if s.cursor >= len(s.rows) {
+		return false
+	}
+	end := s.batchEnd(s.cursor)
+	s.batch = s.buildBatch(s.rows[s.cursor:end])
+	s.cursor = end
+	return true
+}
+
+func (s *SortExec) Children() []physicalplan.PhysicalPlan {
+	return []physicalplan.PhysicalPlan{s.input}
+}
+
+// Close closes the runs being merged and removes them, like when the consumer stops before the last row
+func (s *SortExec) Close() {
+	if s.merge != nil {
+		s.merge.close()
+	}
+	s.cleanup()
+	s.input.Close()
+}
+
+func (s *SortExec) OutputPartitioning() physicalplan.Partitioning {
+	return physicalplan.UnknownPartitioning(s.input.OutputPartitioning().Count)
+}
+
+func (s *SortExec) OutputOrdering() []physicalplan.PhysicalExpr {
+	ordering := make([]physicalplan.PhysicalExpr, len(s.sortExprs))
+	for i, expr := range s.sortExprs {
+		ordering[i] = expr.InputExpr()
+	}
+	return ordering
+}
+
+func (s *SortExec) String() string {
+	exprStrList := make([]string, len(s.sortExprs))
+	for i, expr := range s.sortExprs {
+		exprStrList[i] = expr.String()
+	}
+	return fmt.Sprintf("SortExec: [%s]", strings.Join(exprStrList, ", "))
+}
+
+// sort loads the input, spilling a sorted run whenever the memory limit is exceeded
+func (s *SortExec) sort(ctx context.Context) error {
+	for s.input.Next(ctx) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		batch, err := s.input.Execute(ctx)
+		if err != nil {
+			return err
+		}
+		if err := s.bufferBatch(batch); err != nil {
+			return err
+		}
+		if s.memoryLimit > 0 && s.memUsed > s.memoryLimit {
+			if err := s.spill(); err != nil {
+				return err
+			}
+		}
+	}
+	s.sortRows()
+	if len(s.runs) > 0 {
+		// the remaining rows become the last run, so that all the runs are merged the same way
+		if len(s.rows) > 0 {
+			if err := s.spill(); err != nil {
+				return err
+			}
+		}
+		if err := s.mergeRuns(ctx); err != nil {
+			return err
+		}
+		merge, err := s.newSortMerge(s.runs)
+		if err != nil {
+			return err
+		}
+		s.merge = merge
+		// the open runs stay readable once removed, so nothing is left behind if the consumer stops early
+		s.cleanup()
+	}
+	s.sorted = true
+	return nil
+}
+
+func (s *SortExec) bufferBatch(batch datatypes.RecordBatch) error {
+	keyColumns, err := s.evaluateKeys(batch)
+	if err != nil {
+		return err
+	}
+	batchIdx := len(s.batches)
+	s.batches = append(s.batches, batch)
+	s.memUsed += batch.MemorySize()
+	for rowIdx := 0; rowIdx < batch.RowCount(); rowIdx++ {
+		s.rows = append(s.rows, sortRow{rowRef{batchIdx, rowIdx}, rowKeys(keyColumns, rowIdx)})
+	}
+	return nil
+}
+
+// sortRows sorts the buffered rows, the sort is stable so that equal rows keep the input order
+func (s *SortExec) sortRows() {
+	sort.SliceStable(s.rows, func(i, j int) bool {
+		return compareSortKeys(s.sortExprs, s.rows[i].keys, s.rows[j].keys) < 0
+	})
+}
+
+// spill writes the buffered rows in sorted order as a new run and releases them
+func (s *SortExec) spill() error {
+	if s.tempDir == "" {
+		tempDir, err := os.MkdirTemp(s.spillDir, "sort-")
+		if err != nil {
+			return datatypes.NewIOError(err, "create sort spill dir")
+		}
+		s.tempDir = tempDir
+	}
+	s.sortRows()
+
+	writer, err := newSpillWriter(s.tempDir, s.Schema())
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(s.rows); {
+		end := s.batchEnd(start)
+		if err := writer.write(s.buildBatch(s.rows[start:end])); err != nil {
+			_, _ = writer.close()
+			return err
+		}
+		start = end
+	}
+	path, err := writer.close()
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, path)
+
+	s.batches = nil
+	s.rows = nil
+	s.memUsed = 0
+	return nil
+}
+
+// batchEnd is the end of the batch of buffered rows starting at start
+func (s *SortExec) batchEnd(start int) int {
+	if s.batchSize > 0 && start+s.batchSize < len(s.rows) {
+		return start + s.batchSize
+	}
+	return len(s.rows)
+}
+
+// mergeRuns merges the runs maxMergeRuns at a time into longer runs, until they can be merged at once.
+// The runs are merged in order, so that the merge stays stable.
+func (s *SortExec) mergeRuns(ctx context.Context) error {
+	for len(s.runs) > maxMergeRuns {
+		runs := make([]string, 0, (len(s.runs)+maxMergeRuns-1)/maxMergeRuns)
+		for start := 0; start < len(s.runs); start += maxMergeRuns {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			end := start + maxMergeRuns
+			if end > len(s.runs) {
+				end = len(s.runs)
+			}
+			path, err := s.mergeRun(s.runs[start:end])
+			if err != nil {
+				return err
+			}
+			runs = append(runs, path)
+		}
+		s.runs = runs
+	}
+	return nil
+}
+
+// mergeRun merges runs into a new run, the merged runs are removed
+func (s *SortExec) mergeRun(paths []string) (string, error) {
+	merge, err := s.newSortMerge(paths)
+	if err != nil {
+		return "", err
+	}
+	defer merge.close()
+
+	writer, err := newSpillWriter(s.tempDir, s.Schema())
+	if err != nil {
+		return "", err
+	}
+	for merge.Len() > 0 {
+		batch, _, err := s.mergeBatch(merge)
+		if err == nil {
+			err = writer.write(batch)
+		}
+		if err != nil {
+			_, _ = writer.close()
+			return "", err
+		}
+	}
+	path, err := writer.close()
+	if err != nil {
+		return "", err
+	}
+	for _, merged := range paths {
+		_ = os.Remove(merged)
+	}
+	return path, nil
+}
+
+// nextMerged builds the next batch from the merged runs
+func (s *SortExec) nextMerged() bool {
+	batch, rowCount, err := s.mergeBatch(s.merge)
+	if err != nil {
+		s.err = err
+		s.merge.close()
+		return true
+	}
+	if s.merge.Len() == 0 {
+		s.cleanup()
+	}
+	if rowCount == 0 {
+		return false
+	}
+	s.batch = batch
+	return true
+}
+
+// mergeBatch builds a batch of up to batchSize rows from the runs of a merge
+func (s *SortExec) mergeBatch(merge *sortMerge) (datatypes.RecordBatch, int, error) {
+	builders := s.newBuilders()
+	rowCount := 0
+	for (s.batchSize <= 0 || rowCount < s.batchSize) && merge.Len() > 0 {
+		run := merge.runs[0]
+		for i := range builders {
+			builders[i].Append(run.batch.Field(i).GetValue(run.row))
+		}
+		rowCount++
+		ok, err := run.advance()
+		if err != nil {
+			return datatypes.RecordBatch{}, 0, err
+		}
+		if ok {
+			heap.Fix(merge, 0)
+		} else {
+			heap.Pop(merge)
+		}
+	}
+	return s.finishBatch(builders), rowCount, nil
+}
+
+// cleanup removes the spilled runs, the dir is kept when it can't be removed, like open files on windows
+func (s *SortExec) cleanup() {
+	if s.tempDir != "" && os.RemoveAll(s.tempDir) == nil {
+		s.tempDir = ""
+	}
+}
+
+func (s *SortExec) buildBatch(rows []sortRow) datatypes.RecordBatch {
+	builders := s.newBuilders()
+	for _, row := range rows {
+		batch := s.batches[row.batch]
+		for i := range builders {
+			builders[i].Append(batch.Field(i).GetValue(row.row))
+		}
+	}
+	return s.finishBatch(builders)
+}
+
+func (s *SortExec) newBuilders() []datatypes.ArrowArrayBuilder {
+	schema := s.Schema()
+	builders := make([]datatypes.ArrowArrayBuilder, len(schema.Fields))
+	for i, field := range schema.Fields {
+		builders[i] = datatypes.NewArrowArrayBuilder(memory.NewGoAllocator(), field.DataType)
+	}
+	return builders
+}
+
+func (s *SortExec) finishBatch(builders []datatypes.ArrowArrayBuilder) datatypes.RecordBatch {
+	fields := make([]datatypes.ColumnArray, len(builders))
+	for i := 0; i < len(builders); i++ {
+		fields[i] = builders[i].Build()
+	}
+	return datatypes.RecordBatch{Schema: s.Schema(), Fields: fields}
+}
+
+func (s *SortExec) evaluateKeys(batch datatypes.RecordBatch) ([]datatypes.ColumnArray, error) {
+	keyColumns := make([]datatypes.ColumnArray, len(s.sortExprs))
+	for i, expr := range s.sortExprs {
+		var err error
+		keyColumns[i], err = expr.InputExpr().Evaluate(batch)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return keyColumns, nil
+}
+
+// newSortMerge opens the runs, each run is already sorted so only their current rows are compared
+func (s *SortExec) newSortMerge(paths []string) (*sortMerge, error) {
+	merge := &sortMerge{sortExprs: s.sortExprs}
+	for i, path := range paths {
+		reader, err := openSpillFile(path, s.Schema())
+		if err != nil {
+			merge.close()
+			return nil, err
+		}
+		run := &sortRun{idx: i, reader: reader, sortExec: s}
+		ok, err := run.loadBatch()
+		if err != nil {
+			merge.close()
+			return nil, err
+		}
+		if ok {
+			merge.runs = append(merge.runs, run)
+		}
+	}
+	heap.Init(merge)
+	return merge, nil
+}
+
+// sortRun is a cursor over the rows of a spilled run
+type sortRun struct {
+	idx      int
+	reader   *spillReader
+	sortExec *SortExec
+
+	batch datatypes.RecordBatch
+	row   int
+	// keys of the current row
+	keys       []interface{}
+	keyColumns []datatypes.ColumnArray
+}
+
+// loadBatch reads the next non-empty batch of the run, the run is closed when there is none left
+func (r *sortRun) loadBatch() (bool, error) {
+	for {
+		batch, ok, err := r.reader.read()
+		if err != nil {
+			r.reader.close()
+			return false, err
+		}
+		if !ok {
+			r.reader.close()
+			return false, nil
+		}
+		if batch.RowCount() == 0 {
+			continue
+		}
+		keyColumns, err := r.sortExec.evaluateKeys(batch)
+		if err != nil {
+			r.reader.close()
+			return false, err
+		}
+		r.batch = batch
+		r.row = 0
+		r.keyColumns = keyColumns
+		r.keys = rowKeys(r.keyColumns, 0)
+		return true, nil
+	}
+}
+
+// advance moves to the next row of the run, it returns false when the run is exhausted
+func (r *sortRun) advance() (bool, error) {
+	r.row++
+	if r.row < r.batch.RowCount() {
+		r.keys = rowKeys(r.keyColumns, r.row)
+		return true, nil
+	}
+	return r.loadBatch()
+}
+
+// sortMerge is a min heap of runs ordered by their current row,
+// ties are broken by the run index so that the merge is stable
+type sortMerge struct {
+	sortExprs []exprs.SortExpr
+	runs      []*sortRun
+}
+
+func (m *sortMerge) Len() int {
+	return len(m.runs)
+}
+
+func (m *sortMerge) Less(i, j int) bool {
+	if c := compareSortKeys(m.sortExprs, m.runs[i].keys, m.runs[j].keys); c != 0 {
+		return c < 0
+	}
+	return m.runs[i].idx < m.runs[j].idx
+}
+
+func (m *sortMerge) Swap(i, j int) {
+	m.runs[i], m.runs[j] = m.runs[j], m.runs[i]
+}
+
+func (m *sortMerge) Push(x interface{}) {
+	m.runs = append(m.runs, x.(*sortRun))
+}
+
+func (m *sortMerge) Pop() interface{} {
+	last := m.runs[len(m.runs)-1]
+	m.runs = m.runs[:len(m.runs)-1]
+	return last
+}
+
+// close closes the runs still being merged, after a failure or once the consumer stops early
+func (m *sortMerge) close() {
+	for _, run := range m.runs {
+		run.reader.close()
+	}
+	m.runs = nil
+}
+
+func rowKeys(keyColumns []datatypes.ColumnArray, rowIdx int) []interface{} {
+	keys := make([]interface{}, len(keyColumns))
+	for i, column := range keyColumns {
+		keys[i] = column.GetValue(rowIdx)
+	}
+	return keys
+}
+
+// compareSortKeys compares two rows key by key, the first non-equal key decides
+func compareSortKeys(sortExprs []exprs.SortExpr, l, r []interface{}) int {
+	for i, expr := range sortExprs {
+		if c := expr.Compare(l[i], r[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
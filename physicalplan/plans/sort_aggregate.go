@@ -0,0 +1,207 @@
+package plans
+
+import (
+	"bytes"
+	"context"
+	"query-engine/datatypes"
+	"query-engine/physicalplan"
+	"query-engine/physicalplan/exprs"
+)
+
+// SortAggregateExec aggregates an input sorted by the group keys, see physicalplan.PhysicalPlan OutputOrdering.
+// The rows of a group are adjacent, so that a group is complete once the keys change: only the current group
+// is held in memory, and the completed groups are returned in batches of batchSize rows as the input is read.
+type SortAggregateExec struct {
+	// input plan sorted by the groupExpr
+	input physicalplan.PhysicalPlan
+
+	aggregation
+
+	// batchSize is the max rows of an output batch, 0 or less returns a batch of the groups of every input batch
+	batchSize int
+
+	// key, values and accs are the row key, the group values and the accumulators of the current group,
+	// accs is nil before the first row
+	key    []byte
+	values []interface{}
+	accs   []exprs.Accumulator
+	// buf is reused to build the row key of every input row
+	buf []byte
+
+	// builders hold the completed groups, pending is their number
+	builders []datatypes.ArrowArrayBuilder
+	pending  int
+	// ready holds the readyRows completed groups being returned, cursor is the next group to return
+	ready     datatypes.RecordBatch
+	readyRows int
+	cursor    int
+
+	// inputDone is set once the input is consumed, emitted once a batch is returned,
+	// so that no groups return a single empty batch
+	inputDone bool
+	emitted   bool
+
+	// batch prepared by Next, or the error of preparing it
+	batch datatypes.RecordBatch
+	err   error
+}
+
+// NewSortAggregateExec creates a phase of a two-phase aggregation of an input sorted by groupExpr,
+// the arguments are the ones of NewHashAggregateExecWithMode
+func NewSortAggregateExec(
+	input physicalplan.PhysicalPlan, mode AggregateMode,
+	groupExpr []physicalplan.PhysicalExpr, aggExpr []exprs.AggregateExpr, schema datatypes.Schema, batchSize int,
+) *SortAggregateExec {
+	s := &SortAggregateExec{
+		input:       input,
+		aggregation: newAggregation(mode, groupExpr, aggExpr, schema),
+		batchSize:   batchSize,
+	}
+	s.builders = newBuilders(s.Schema(), 0)
+	return s
+}
+
+func (s *SortAggregateExec) Schema() datatypes.Schema {
+	return s.outputSchema()
+}
+
+func (s *SortAggregateExec) Execute(ctx context.Context) (datatypes.RecordBatch, error) {
+	return s.batch, s.err
+}
+
+// Next reads the input until batchSize groups are complete, a failed or cancelled aggregation
+// returns no more batches
+func (s *SortAggregateExec) Next(ctx context.Context) bool {
+	if s.err != nil {
+		return false
+	}
+	for {
+		if s.cursor < s.readyRows {
+			end := s.readyRows
+			if s.batchSize > 0 && s.cursor+s.batchSize < end {
+				end = s.cursor + s.batchSize
+			}
+			s.batch = s.ready.Slice(s.cursor, end)
+			s.cursor = end
+			s.emitted = true
+			return true
+		}
+		if s.inputDone {
+			if s.emitted {
+				return false
+			}
+			// no groups return a single empty batch
+			s.batch = s.flush()
+			s.emitted = true
+			return true
+		}
+
+		if !s.input.Next(ctx) {
+			s.inputDone = true
+			if s.err = s.finishGroup(); s.err != nil {
+				return true
+			}
+			if s.pending > 0 {
+				s.prepare()
+			}
+			continue
+		}
+		if s.err = ctx.Err(); s.err != nil {
+			return true
+		}
+		recordBatch, err := s.input.Execute(ctx)
+		if err == nil {
+			err = s.updateBatch(recordBatch)
+		}
+		if err != nil {
+			s.err = err
+			return true
+		}
+		if s.pending > 0 && (s.batchSize <= 0 || s.pending >= s.batchSize) {
+			s.prepare()
+		}
+	}
+}
+
+func (s *SortAggregateExec) Children() []physicalplan.PhysicalPlan {
+	return []physicalplan.PhysicalPlan{s.input}
+}
+
+func (s *SortAggregateExec) Close() {
+	s.input.Close()
+}
+
+func (s *SortAggregateExec) OutputPartitioning() physicalplan.Partitioning {
+	return physicalplan.UnknownPartitioning(s.input.OutputPartitioning().Count)
+}
+
+// OutputOrdering is the group keys, as the groups are returned in the order of the input
+func (s *SortAggregateExec) OutputOrdering() []physicalplan.PhysicalExpr {
+	ordering := make([]physicalplan.PhysicalExpr, len(s.groupExpr))
+	for i := range ordering {
+		ordering[i] = exprs.NewColumnIndexExpr(i)
+	}
+	return ordering
+}
+
+func (s *SortAggregateExec) String() string {
+	return s.format("SortAggregateExec")
+}
+
+// updateBatch accumulates the rows of a batch into the current group, a new group starts once the keys change
+func (s *SortAggregateExec) updateBatch(recordBatch datatypes.RecordBatch) error {
+	merge := s.mode == FinalAggregate
+	groupKeyColumnArray, inputs, err := s.evaluate(recordBatch, merge)
+	if err != nil {
+		return err
+	}
+	row := make([]interface{}, len(groupKeyColumnArray))
+	for rowIdx := 0; rowIdx < recordBatch.RowCount(); rowIdx++ {
+		for i, column := range groupKeyColumnArray {
+			row[i] = column.GetValue(rowIdx)
+		}
+		if s.buf, err = appendRowKey(s.buf[:0], row); err != nil {
+			return err
+		}
+		if s.accs == nil || !bytes.Equal(s.buf, s.key) {
+			if err := s.finishGroup(); err != nil {
+				return err
+			}
+			s.key = append(s.key[:0], s.buf...)
+			s.values = append([]interface{}{}, row...)
+			s.accs = s.newAccumulators()
+		}
+		if err := s.update(s.accs, inputs, rowIdx, merge); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finishGroup appends the current group to the completed groups
+func (s *SortAggregateExec) finishGroup() error {
+	if s.accs == nil {
+		return nil
+	}
+	if err := appendGroup(s.builders, s.values, s.accs, s.mode == PartialAggregate); err != nil {
+		return err
+	}
+	s.pending++
+	s.accs = nil
+	return nil
+}
+
+// prepare makes the completed groups ready to be returned
+func (s *SortAggregateExec) prepare() {
+	s.readyRows, s.cursor = s.pending, 0
+	s.ready = s.flush()
+}
+
+// flush builds the completed groups into a batch
+func (s *SortAggregateExec) flush() datatypes.RecordBatch {
+	schema := s.Schema()
+	batch := buildBatch(schema, s.builders)
+	s.builders = newBuilders(schema, 0)
+	s.pending = 0
+	return batch
+}
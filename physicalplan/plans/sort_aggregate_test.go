@@ -0,0 +1,95 @@
+package plans
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"query-engine/datasource"
+	"query-engine/datatypes"
+	"query-engine/physicalplan"
+	"query-engine/physicalplan/exprs"
+	"testing"
+)
+
+func sortedStateScan() ScanExec {
+	schema := datatypes.Schema{Fields: []datatypes.Field{
+		{Name: "state", DataType: datatypes.StringType},
+		{Name: "salary", DataType: datatypes.Int64Type},
+	}}
+	return memScan(schema,
+		[]interface{}{"CA", "CA", "CO", "CO", "CO", nil},
+		[]interface{}{int64(1), int64(2), int64(3), int64(4), int64(5), int64(6)},
+	)
+}
+
+func sumSchema() datatypes.Schema {
+	return datatypes.Schema{Fields: []datatypes.Field{
+		{Name: "state", DataType: datatypes.StringType},
+		{Name: "SUM(salary)", DataType: datatypes.Int64Type},
+	}}
+}
+
+func TestSortAggregateExec(t *testing.T) {
+	groupExpr := []physicalplan.PhysicalExpr{exprs.NewColumnIndexExpr(0)}
+	aggExpr := []exprs.AggregateExpr{exprs.NewSumExpr(exprs.NewColumnIndexExpr(1))}
+
+	// the input returns a row per batch, the groups span several batches
+	plan := NewSortAggregateExec(sortedStateScan(), SingleAggregate, groupExpr, aggExpr, sumSchema(), 2)
+	batches := collectBatches(t, plan)
+	require.Len(t, batches, 2)
+	require.Equal(t, "CA,3\nCO,12\n", batches[0].ToCSV())
+	require.Equal(t, "null,6\n", batches[1].ToCSV())
+
+	hash := NewHashAggregateExec(sortedStateScan(), groupExpr, aggExpr, sumSchema())
+	unbatched := NewSortAggregateExec(sortedStateScan(), SingleAggregate, groupExpr, aggExpr, sumSchema(), 0)
+	require.Equal(t, collect(t, hash), collect(t, unbatched))
+	require.Equal(t, "SortAggregateExec: groupExpr=[#0], aggExpr=[SUM(#1)]", plan.String())
+	require.Equal(t, "[#0]", fmt.Sprint(plan.OutputOrdering()))
+}
+
+func TestSortAggregateExec_two_phase(t *testing.T) {
+	groupExpr := []physicalplan.PhysicalExpr{exprs.NewColumnIndexExpr(0)}
+	aggExpr := []exprs.AggregateExpr{exprs.NewSumExpr(exprs.NewColumnIndexExpr(1))}
+	partitions := []physicalplan.PhysicalPlan{
+		NewSortAggregateExec(sortedStateScan(), PartialAggregate, groupExpr, aggExpr, sumSchema(), 2),
+		NewSortAggregateExec(sortedStateScan(), PartialAggregate, groupExpr, aggExpr, sumSchema(), 2),
+	}
+	finalGroupExpr := []physicalplan.PhysicalExpr{exprs.NewColumnIndexExpr(0)}
+	plan := NewHashAggregateExecWithMode(
+		NewCoalesceExec(partitions), FinalAggregate, finalGroupExpr, aggExpr, sumSchema(), 0, 0, "")
+	require.Equal(t, []string{"CA,6", "CO,24", "null,12"}, sortedRows(collect(t, plan)))
+}
+
+func TestSortAggregateExec_empty(t *testing.T) {
+	empty := memScan(sumSchema(), []interface{}{}, []interface{}{})
+	plan := NewSortAggregateExec(empty, SingleAggregate,
+		[]physicalplan.PhysicalExpr{exprs.NewColumnIndexExpr(0)},
+		[]exprs.AggregateExpr{exprs.NewSumExpr(exprs.NewColumnIndexExpr(1))}, sumSchema(), 2)
+	require.True(t, plan.Next(context.Background()))
+	batch, err := plan.Execute(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 0, batch.RowCount())
+	require.False(t, plan.Next(context.Background()))
+}
+
+func TestOutputOrdering(t *testing.T) {
+	csv, err := datasource.NewCsvDataSourceWithOptions(dir+"/employee.csv", 2,
+		datasource.CsvOptions{SortedBy: []string{"state", "id"}})
+	require.NoError(t, err)
+
+	// the ordering stops at the first column not projected
+	require.Equal(t, "[#1 #0]", fmt.Sprint(NewScanExec(csv, []string{"id", "state"}).OutputOrdering()))
+	require.Equal(t, "[#0]", fmt.Sprint(NewScanExec(csv, []string{"state", "salary"}).OutputOrdering()))
+	require.Empty(t, NewScanExec(csv, []string{"id"}).OutputOrdering())
+
+	scan := NewScanExec(csv, []string{})
+	projection := NewProjectionExec(scan, datatypes.Schema{}, []physicalplan.PhysicalExpr{
+		exprs.NewColumnIndexExpr(5), exprs.NewColumnIndexExpr(3),
+	})
+	require.Equal(t, "[#1]", fmt.Sprint(projection.OutputOrdering()))
+	require.Equal(t, "[#3 #0]", fmt.Sprint(NewSelectionExec(scan, exprs.NewColumnIndexExpr(0)).OutputOrdering()))
+
+	sort := NewSortExec(scan, []exprs.SortExpr{exprs.NewSortExpr(exprs.NewColumnIndexExpr(5), false, true)}, 2, 0, "")
+	require.Equal(t, "[#5]", fmt.Sprint(sort.OutputOrdering()))
+	require.Empty(t, NewCoalesceExec([]physicalplan.PhysicalPlan{sort, sort}).OutputOrdering())
+}
@@ -0,0 +1,211 @@
+package plans
+
+import (
+	"context"
+	"fmt"
+	"github.com/apache/arrow/go/v6/arrow/memory"
+	"github.com/stretchr/testify/require"
+	"math/rand"
+	"os"
+	"query-engine/datatypes"
+	"query-engine/physicalplan"
+	"query-engine/physicalplan/exprs"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// batchesExec returns the given batches one by one
+type batchesExec struct {
+	physicalplan.PhysicalPlan
+	schema  datatypes.Schema
+	batches []datatypes.RecordBatch
+	next    int
+}
+
+func (b *batchesExec) Schema() datatypes.Schema {
+	return b.schema
+}
+
+func (b *batchesExec) Next(ctx context.Context) bool {
+	b.next++
+	return b.next <= len(b.batches)
+}
+
+func (b *batchesExec) Execute(ctx context.Context) (datatypes.RecordBatch, error) {
+	return b.batches[b.next-1], nil
+}
+
+func (b *batchesExec) Close() {
+	b.next = len(b.batches)
+}
+
+func TestSortExec_multipleKeys(t *testing.T) {
+	// sort by dept desc with nulls last, then by name asc
+	input := memScan(datatypes.Schema{Fields: []datatypes.Field{
+		{Name: "name", DataType: datatypes.StringType},
+		{Name: "dept", DataType: datatypes.Int64Type},
+	}},
+		[]interface{}{"d", "a", "c", nil, "b", "e"},
+		[]interface{}{int64(10), int64(20), nil, int64(10), int64(10), nil},
+	)
+	plan := NewSortExec(input, []exprs.SortExpr{
+		exprs.NewSortExpr(exprs.NewColumnIndexExpr(1), false, false),
+		exprs.NewSortExpr(exprs.NewColumnIndexExpr(0), true, true),
+	}, 1024, 0, "")
+
+	expect := "a,20\nnull,10\nb,10\nd,10\nc,null\ne,null\n"
+	require.Equal(t, expect, collect(t, plan))
+	require.Equal(t, "SortExec: [#1 DESC NULLS LAST, #0 ASC NULLS FIRST]", plan.String())
+}
+
+func TestSortExec_batches(t *testing.T) {
+	// the 8 input rows are read in batches of 3 rows, the output has batches of 5 rows
+	input := parquetScan(t, 3, []string{"Id", "Bool_col"})
+	plan := NewSortExec(input, []exprs.SortExpr{
+		exprs.NewSortExpr(exprs.NewColumnIndexExpr(1), true, false),
+		exprs.NewSortExpr(exprs.NewColumnIndexExpr(0), false, true),
+	}, 5, 0, "")
+
+	batches := collectBatches(t, plan)
+	require.Len(t, batches, 2)
+	require.Equal(t, "7,false\n5,false\n3,false\n1,false\n6,true\n", batches[0].ToCSV())
+	require.Equal(t, "4,true\n2,true\n0,true\n", batches[1].ToCSV())
+	require.False(t, plan.Next(context.Background()))
+}
+
+func TestSortExec_unlimited_batch_size(t *testing.T) {
+	// a batch size of 0 or less returns all the rows in a single batch, spilled or not
+	for _, memoryLimit := range []int64{0, 1} {
+		input := parquetScan(t, 3, []string{"Id"})
+		plan := NewSortExec(input, []exprs.SortExpr{exprs.NewSortExpr(exprs.NewColumnIndexExpr(0), false, true)}, 0, memoryLimit, t.TempDir())
+		require.True(t, plan.Next(context.Background()))
+		batch, err := plan.Execute(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, "7\n6\n5\n4\n3\n2\n1\n0\n", batch.ToCSV())
+		require.False(t, plan.Next(context.Background()))
+		// every input batch is spilled with a memory limit
+		require.Len(t, plan.runs, 3*int(memoryLimit))
+	}
+}
+
+func TestSortExec_spill(t *testing.T) {
+	spillDir := t.TempDir()
+	// every input batch exceeds the memory limit, so each one is spilled as a run
+	input := parquetScan(t, 3, []string{"Id", "Bool_col"})
+	plan := NewSortExec(input, []exprs.SortExpr{
+		exprs.NewSortExpr(exprs.NewColumnIndexExpr(1), true, false),
+		exprs.NewSortExpr(exprs.NewColumnIndexExpr(0), false, true),
+	}, 5, 1, spillDir)
+
+	require.Equal(t, "7,false\n5,false\n3,false\n1,false\n6,true\n4,true\n2,true\n0,true\n", collect(t, plan))
+	require.Len(t, plan.runs, 3)
+	entries, err := os.ReadDir(spillDir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestSortExec_spill_matches_in_memory_sort(t *testing.T) {
+	schema := datatypes.Schema{Fields: []datatypes.Field{
+		{Name: "key", DataType: datatypes.Int64Type},
+		{Name: "name", DataType: datatypes.StringType},
+	}}
+	random := rand.New(rand.NewSource(42))
+	batches := make([]datatypes.RecordBatch, 10)
+	expect := make([][]interface{}, 0)
+	for i := range batches {
+		keyBuilder := datatypes.NewArrowArrayBuilder(memory.NewGoAllocator(), datatypes.Int64Type)
+		nameBuilder := datatypes.NewArrowArrayBuilder(memory.NewGoAllocator(), datatypes.StringType)
+		for j := 0; j < 100; j++ {
+			var key interface{}
+			if random.Intn(10) > 0 {
+				key = int64(random.Intn(50))
+			}
+			name := fmt.Sprintf("row-%d-%d", i, j)
+			keyBuilder.Append(key)
+			nameBuilder.Append(name)
+			expect = append(expect, []interface{}{key, name})
+		}
+		batches[i] = datatypes.RecordBatch{Schema: schema, Fields: []datatypes.ColumnArray{keyBuilder.Build(), nameBuilder.Build()}}
+	}
+	sortExpr := exprs.NewSortExpr(exprs.NewColumnIndexExpr(0), false, true)
+	sort.SliceStable(expect, func(i, j int) bool {
+		return sortExpr.Compare(expect[i][0], expect[j][0]) < 0
+	})
+	expectCSV := ""
+	for _, row := range expect {
+		batch := datatypes.RecordBatch{Schema: schema, Fields: []datatypes.ColumnArray{
+			datatypes.NewLiteralValueArray(datatypes.Int64Type, row[0], 1),
+			datatypes.NewLiteralValueArray(datatypes.StringType, row[1], 1),
+		}}
+		expectCSV += batch.ToCSV()
+	}
+
+	input := &batchesExec{schema: schema, batches: batches}
+	plan := NewSortExec(input, []exprs.SortExpr{sortExpr}, 64, batches[0].MemorySize()+1, t.TempDir())
+	require.Equal(t, expectCSV, collect(t, plan))
+	require.Len(t, plan.runs, 5)
+}
+
+func TestSortExec_merge_passes(t *testing.T) {
+	schema := datatypes.Schema{Fields: []datatypes.Field{
+		{Name: "key", DataType: datatypes.Int64Type},
+		{Name: "name", DataType: datatypes.StringType},
+	}}
+	// every batch is spilled as a run, the 150 runs are merged into 3 runs before the last merge
+	batches := make([]datatypes.RecordBatch, 150)
+	expect := make([]string, 0)
+	for i := range batches {
+		keyBuilder := datatypes.NewArrowArrayBuilder(memory.NewGoAllocator(), datatypes.Int64Type)
+		nameBuilder := datatypes.NewArrowArrayBuilder(memory.NewGoAllocator(), datatypes.StringType)
+		keyBuilder.Append(int64(i % 3))
+		nameBuilder.Append(fmt.Sprintf("row-%d", i))
+		batches[i] = datatypes.RecordBatch{Schema: schema, Fields: []datatypes.ColumnArray{keyBuilder.Build(), nameBuilder.Build()}}
+	}
+	for key := 0; key < 3; key++ {
+		for i := key; i < len(batches); i += 3 {
+			expect = append(expect, fmt.Sprintf("%d,row-%d\n", key, i))
+		}
+	}
+
+	spillDir := t.TempDir()
+	sortExpr := exprs.NewSortExpr(exprs.NewColumnIndexExpr(0), true, false)
+	plan := NewSortExec(&batchesExec{schema: schema, batches: batches}, []exprs.SortExpr{sortExpr}, 64, 1, spillDir)
+	require.Equal(t, strings.Join(expect, ""), collect(t, plan))
+	require.Len(t, plan.runs, 3)
+	entries, err := os.ReadDir(spillDir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestSortExec_close(t *testing.T) {
+	spillDir := t.TempDir()
+	input := parquetScan(t, 1, []string{"Id"})
+	plan := NewSortExec(input, []exprs.SortExpr{exprs.NewSortExpr(exprs.NewColumnIndexExpr(0), false, true)}, 1, 1, spillDir)
+
+	// the consumer stops after the first row, like ORDER BY ... LIMIT 1, the runs of the other rows are open
+	require.True(t, plan.Next(context.Background()))
+	require.Equal(t, 7, plan.merge.Len())
+	plan.Close()
+	plan.Close()
+	require.Equal(t, 0, plan.merge.Len())
+	entries, err := os.ReadDir(spillDir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestSortExec_emptyInput(t *testing.T) {
+	input := memScan(datatypes.Schema{Fields: []datatypes.Field{{Name: "id", DataType: datatypes.Int64Type}}}, []interface{}{})
+	plan := NewSortExec(input, []exprs.SortExpr{exprs.NewSortExpr(exprs.NewColumnIndexExpr(0), true, false)}, 2, 0, "")
+	require.False(t, plan.Next(context.Background()))
+}
+
+func TestSortExec_String(t *testing.T) {
+	plan := NewSortExec(parquetScan(t, 3, []string{"Id"}),
+		[]exprs.SortExpr{exprs.NewSortExpr(exprs.NewColumnIndexExpr(0), true, false)}, 3, 0, "")
+	planFormat := `
+SortExec: [#0 ASC NULLS LAST]
+	ScanExec: schema={[{Id int32}]}, projection=[Id]
+`
+	require.Equal(t, planFormat, physicalplan.PrettyFormat(plan))
+}
@@ -0,0 +1,85 @@
+package plans
+
+import (
+	"github.com/apache/arrow/go/v6/arrow/ipc"
+	"os"
+	"query-engine/datatypes"
+)
+
+// spillWriter writes record batches to a temp file in the Arrow IPC file format,
+// it is used by operators buffering more data than their memory budget allows.
+type spillWriter struct {
+	file   *os.File
+	writer *ipc.FileWriter
+}
+
+func newSpillWriter(dir string, schema datatypes.Schema) (*spillWriter, error) {
+	file, err := os.CreateTemp(dir, "spill-*.arrow")
+	if err != nil {
+		return nil, datatypes.NewIOError(err, "create spill file")
+	}
+	writer, err := ipc.NewFileWriter(file, ipc.WithSchema(schema.ToArrow()))
+	if err != nil {
+		_ = file.Close()
+		return nil, datatypes.NewIOError(err, "create spill file writer of %s", file.Name())
+	}
+	return &spillWriter{file, writer}, nil
+}
+
+func (w *spillWriter) write(batch datatypes.RecordBatch) error {
+	if err := w.writer.Write(batch.ToArrowRecord()); err != nil {
+		return datatypes.NewIOError(err, "write spill file %s", w.file.Name())
+	}
+	return nil
+}
+
+// close flushes the file footer and returns the path of the spill file
+func (w *spillWriter) close() (string, error) {
+	if err := w.writer.Close(); err != nil {
+		_ = w.file.Close()
+		return "", datatypes.NewIOError(err, "close spill file writer of %s", w.file.Name())
+	}
+	if err := w.file.Close(); err != nil {
+		return "", datatypes.NewIOError(err, "close spill file %s", w.file.Name())
+	}
+	return w.file.Name(), nil
+}
+
+// spillReader reads back the record batches of a spill file in order
+type spillReader struct {
+	file   *os.File
+	reader *ipc.FileReader
+	schema datatypes.Schema
+	next   int
+}
+
+func openSpillFile(path string, schema datatypes.Schema) (*spillReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, datatypes.NewIOError(err, "open spill file")
+	}
+	reader, err := ipc.NewFileReader(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, datatypes.NewIOError(err, "create spill file reader of %s", path)
+	}
+	return &spillReader{file: file, reader: reader, schema: schema}, nil
+}
+
+// read returns the next batch, ok is false once all the batches were read
+func (r *spillReader) read() (batch datatypes.RecordBatch, ok bool, err error) {
+	if r.next >= r.reader.NumRecords() {
+		return datatypes.RecordBatch{}, false, nil
+	}
+	record, err := r.reader.RecordAt(r.next)
+	if err != nil {
+		return datatypes.RecordBatch{}, false, datatypes.NewIOError(err, "read spill file %s", r.file.Name())
+	}
+	r.next++
+	return datatypes.NewRecordBatchFromArrow(r.schema, record), true, nil
+}
+
+func (r *spillReader) close() {
+	_ = r.reader.Close()
+	_ = r.file.Close()
+}
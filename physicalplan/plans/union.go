@@ -0,0 +1,65 @@
+package plans
+
+import (
+	"context"
+	"fmt"
+	"query-engine/datatypes"
+	"query-engine/physicalplan"
+)
+
+// UnionExec returns the batches of its inputs one input after the other, as a single partition.
+// The inputs have the types of the schema, the batches are returned with the schema, so that
+// the column names are the ones of the first input.
+type UnionExec struct {
+	inputs []physicalplan.PhysicalPlan
+	schema datatypes.Schema
+	// current is the index of the input being read
+	current int
+}
+
+func NewUnionExec(inputs []physicalplan.PhysicalPlan, schema datatypes.Schema) *UnionExec {
+	return &UnionExec{inputs: inputs, schema: schema}
+}
+
+func (u *UnionExec) Schema() datatypes.Schema {
+	return u.schema
+}
+
+func (u *UnionExec) Execute(ctx context.Context) (datatypes.RecordBatch, error) {
+	batch, err := u.inputs[u.current].Execute(ctx)
+	if err != nil {
+		return datatypes.RecordBatch{}, err
+	}
+	return datatypes.RecordBatch{Schema: u.schema, Fields: batch.Fields}, nil
+}
+
+// Next moves to the next input once the current one is done
+func (u *UnionExec) Next(ctx context.Context) bool {
+	for ; u.current < len(u.inputs); u.current++ {
+		if u.inputs[u.current].Next(ctx) {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *UnionExec) Children() []physicalplan.PhysicalPlan {
+	return u.inputs
+}
+
+func (u *UnionExec) Close() {
+	closePlans(u.inputs)
+}
+
+func (u *UnionExec) OutputPartitioning() physicalplan.Partitioning {
+	return physicalplan.SinglePartition()
+}
+
+// OutputOrdering is unknown, as the rows of an input aren't ordered after the ones of the previous input
+func (u *UnionExec) OutputOrdering() []physicalplan.PhysicalExpr {
+	return nil
+}
+
+func (u *UnionExec) String() string {
+	return fmt.Sprintf("UnionExec: inputs=%d", len(u.inputs))
+}
@@ -0,0 +1,26 @@
+package plans
+
+import (
+	"github.com/stretchr/testify/require"
+	"query-engine/datatypes"
+	"query-engine/physicalplan"
+	"testing"
+)
+
+func TestUnionExec(t *testing.T) {
+	schema := datatypes.Schema{Fields: []datatypes.Field{{Name: "state", DataType: datatypes.StringType}}}
+	right := memScan(datatypes.Schema{Fields: []datatypes.Field{{Name: "name", DataType: datatypes.StringType}}},
+		[]interface{}{"CA", "WA"})
+	empty := memScan(schema, []interface{}{})
+	plan := NewUnionExec([]physicalplan.PhysicalPlan{memScan(schema, []interface{}{"CA", nil}), empty, right}, schema)
+
+	// the batches of the inputs are returned in order, with the schema of the union
+	rows := ""
+	for _, batch := range collectBatches(t, plan) {
+		require.Equal(t, schema, batch.Schema)
+		rows += batch.ToCSV()
+	}
+	require.Equal(t, "CA\nnull\nCA\nWA\n", rows)
+	require.Equal(t, 1, plan.OutputPartitioning().Count)
+	require.Equal(t, "UnionExec: inputs=3", plan.String())
+}
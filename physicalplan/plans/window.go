@@ -0,0 +1,246 @@
+package plans
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"query-engine/datatypes"
+	"query-engine/physicalplan"
+	"query-engine/physicalplan/exprs"
+)
+
+// WindowExec evaluates window functions sharing the same partition and order keys over an input sorted
+// by the partition keys then the order keys, so that the rows of a partition are adjacent. The rows of
+// the current partition are held in memory until the keys change, then the partition is returned with
+// the values of the window functions appended to its rows, in batches of batchSize rows.
+type WindowExec struct {
+	input       physicalplan.PhysicalPlan
+	partitionBy []physicalplan.PhysicalExpr
+	orderBy     []exprs.SortExpr
+	windowExprs []exprs.WindowExpr
+	// schema is the input fields followed by the fields of the windowExprs
+	schema datatypes.Schema
+	// batchSize is the max rows of an output batch, 0 or less returns a batch of the partitions of every input batch
+	batchSize int
+
+	// key is the partition key of the current partition, buf is reused to build the key of every input row
+	key []byte
+	buf []byte
+	// rows, inputs and orderKeys hold the current partition: the values of the input rows, the values
+	// of the InputExprs of every window expr and the order keys of the rows
+	rows      [][]interface{}
+	inputs    [][][]interface{}
+	orderKeys [][]interface{}
+
+	// builders hold the completed partitions, pending is their number of rows
+	builders []datatypes.ArrowArrayBuilder
+	pending  int
+	// ready holds the readyRows completed rows being returned, cursor is the next row to return
+	ready     datatypes.RecordBatch
+	readyRows int
+	cursor    int
+	inputDone bool
+
+	// batch prepared by Next, or the error of preparing it
+	batch datatypes.RecordBatch
+	err   error
+}
+
+func NewWindowExec(
+	input physicalplan.PhysicalPlan, partitionBy []physicalplan.PhysicalExpr, orderBy []exprs.SortExpr,
+	windowExprs []exprs.WindowExpr, schema datatypes.Schema, batchSize int,
+) *WindowExec {
+	w := &WindowExec{
+		input:       input,
+		partitionBy: partitionBy,
+		orderBy:     orderBy,
+		windowExprs: windowExprs,
+		schema:      schema,
+		batchSize:   batchSize,
+	}
+	w.builders = newBuilders(schema, 0)
+	w.resetPartition()
+	return w
+}
+
+func (w *WindowExec) Schema() datatypes.Schema {
+	return w.schema
+}
+
+func (w *WindowExec) Execute(ctx context.Context) (datatypes.RecordBatch, error) {
+	return w.batch, w.err
+}
+
+// Next reads the input until batchSize rows of completed partitions are ready, a failed or cancelled
+// evaluation returns no more batches
+func (w *WindowExec) Next(ctx context.Context) bool {
+	if w.err != nil {
+		return false
+	}
+	for {
+		if w.cursor < w.readyRows {
+			end := w.readyRows
+			if w.batchSize > 0 && w.cursor+w.batchSize < end {
+				end = w.cursor + w.batchSize
+			}
+			w.batch = w.ready.Slice(w.cursor, end)
+			w.cursor = end
+			return true
+		}
+		if w.inputDone {
+			return false
+		}
+
+		if !w.input.Next(ctx) {
+			w.inputDone = true
+			if w.err = w.finishPartition(); w.err != nil {
+				return true
+			}
+			if w.pending > 0 {
+				w.prepare()
+			}
+			continue
+		}
+		if w.err = ctx.Err(); w.err != nil {
+			return true
+		}
+		recordBatch, err := w.input.Execute(ctx)
+		if err == nil {
+			err = w.updateBatch(recordBatch)
+		}
+		if err != nil {
+			w.err = err
+			return true
+		}
+		if w.pending > 0 && (w.batchSize <= 0 || w.pending >= w.batchSize) {
+			w.prepare()
+		}
+	}
+}
+
+func (w *WindowExec) Children() []physicalplan.PhysicalPlan {
+	return []physicalplan.PhysicalPlan{w.input}
+}
+
+func (w *WindowExec) Close() {
+	w.input.Close()
+}
+
+func (w *WindowExec) OutputPartitioning() physicalplan.Partitioning {
+	return w.input.OutputPartitioning()
+}
+
+// OutputOrdering is the partition keys followed by the order keys, as the input rows are returned in order
+func (w *WindowExec) OutputOrdering() []physicalplan.PhysicalExpr {
+	ordering := append([]physicalplan.PhysicalExpr{}, w.partitionBy...)
+	for _, expr := range w.orderBy {
+		ordering = append(ordering, expr.InputExpr())
+	}
+	if len(ordering) == 0 {
+		return nil
+	}
+	return ordering
+}
+
+func (w *WindowExec) String() string {
+	return fmt.Sprintf("WindowExec: partitionBy=%v, orderBy=%v, windowExpr=%v", w.partitionBy, w.orderBy, w.windowExprs)
+}
+
+// updateBatch appends the rows of a batch to the current partition, a new partition starts once the keys change
+func (w *WindowExec) updateBatch(recordBatch datatypes.RecordBatch) error {
+	partitionColumns, err := evaluateExprs(w.partitionBy, recordBatch)
+	if err != nil {
+		return err
+	}
+	orderExprs := make([]physicalplan.PhysicalExpr, len(w.orderBy))
+	for i, expr := range w.orderBy {
+		orderExprs[i] = expr.InputExpr()
+	}
+	orderColumns, err := evaluateExprs(orderExprs, recordBatch)
+	if err != nil {
+		return err
+	}
+	inputColumns := make([][]datatypes.ColumnArray, len(w.windowExprs))
+	for i, expr := range w.windowExprs {
+		if inputColumns[i], err = evaluateExprs(expr.InputExprs(), recordBatch); err != nil {
+			return err
+		}
+	}
+
+	for rowIdx := 0; rowIdx < recordBatch.RowCount(); rowIdx++ {
+		if w.buf, err = appendRowKey(w.buf[:0], rowKeys(partitionColumns, rowIdx)); err != nil {
+			return err
+		}
+		if len(w.rows) > 0 && !bytes.Equal(w.buf, w.key) {
+			if err := w.finishPartition(); err != nil {
+				return err
+			}
+		}
+		if len(w.rows) == 0 {
+			w.key = append(w.key[:0], w.buf...)
+		}
+		w.rows = append(w.rows, rowKeys(recordBatch.Fields, rowIdx))
+		w.orderKeys = append(w.orderKeys, rowKeys(orderColumns, rowIdx))
+		for i, columns := range inputColumns {
+			for j, column := range columns {
+				w.inputs[i][j] = append(w.inputs[i][j], column.GetValue(rowIdx))
+			}
+		}
+	}
+	return nil
+}
+
+// finishPartition evaluates the window functions over the current partition and appends its rows
+// to the completed ones
+func (w *WindowExec) finishPartition() error {
+	if len(w.rows) == 0 {
+		return nil
+	}
+	values := make([][]interface{}, len(w.windowExprs))
+	for i, expr := range w.windowExprs {
+		var err error
+		values[i], err = expr.Evaluate(exprs.NewWindowPartition(w.inputs[i], w.orderKeys, w.orderBy))
+		if err != nil {
+			return err
+		}
+	}
+	for rowIdx, row := range w.rows {
+		for i, value := range row {
+			w.builders[i].Append(value)
+		}
+		for i := range w.windowExprs {
+			w.builders[len(row)+i].Append(values[i][rowIdx])
+		}
+	}
+	w.pending += len(w.rows)
+	w.resetPartition()
+	return nil
+}
+
+func (w *WindowExec) resetPartition() {
+	w.rows, w.orderKeys = nil, nil
+	w.inputs = make([][][]interface{}, len(w.windowExprs))
+	for i, expr := range w.windowExprs {
+		w.inputs[i] = make([][]interface{}, len(expr.InputExprs()))
+	}
+}
+
+// prepare makes the completed rows ready to be returned
+func (w *WindowExec) prepare() {
+	w.readyRows, w.cursor = w.pending, 0
+	w.ready = buildBatch(w.schema, w.builders)
+	w.builders = newBuilders(w.schema, 0)
+	w.pending = 0
+}
+
+// evaluateExprs evaluates a list of exprs against a batch
+func evaluateExprs(exprList []physicalplan.PhysicalExpr, recordBatch datatypes.RecordBatch) ([]datatypes.ColumnArray, error) {
+	columns := make([]datatypes.ColumnArray, len(exprList))
+	for i, expr := range exprList {
+		var err error
+		if columns[i], err = expr.Evaluate(recordBatch); err != nil {
+			return nil, err
+		}
+	}
+	return columns, nil
+}
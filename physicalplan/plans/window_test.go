@@ -0,0 +1,61 @@
+package plans
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"query-engine/datatypes"
+	"query-engine/physicalplan"
+	"query-engine/physicalplan/exprs"
+	"testing"
+)
+
+func windowSchema() datatypes.Schema {
+	return datatypes.Schema{Fields: []datatypes.Field{
+		{Name: "state", DataType: datatypes.StringType},
+		{Name: "salary", DataType: datatypes.Int64Type},
+		{Name: "ROW_NUMBER()", DataType: datatypes.UInt64Type},
+		{Name: "SUM(salary)", DataType: datatypes.Int64Type},
+		{Name: "LAG(salary)", DataType: datatypes.Int64Type},
+	}}
+}
+
+func TestWindowExec(t *testing.T) {
+	partitionBy := []physicalplan.PhysicalExpr{exprs.NewColumnIndexExpr(0)}
+	orderBy := []exprs.SortExpr{exprs.NewSortExpr(exprs.NewColumnIndexExpr(1), true, false)}
+	running := exprs.NewWindowFrame(exprs.RowsFrame,
+		exprs.FrameBound{Type: exprs.UnboundedPreceding}, exprs.FrameBound{Type: exprs.CurrentRow})
+	windowExprs := []exprs.WindowExpr{
+		exprs.NewRowNumberExpr(),
+		exprs.NewAggregateWindowExpr(exprs.NewSumExpr(exprs.NewColumnIndexExpr(1)), running),
+		exprs.NewLagExpr(exprs.NewColumnIndexExpr(1), 1, int64(0)),
+	}
+
+	// the input returns a row per batch, the partitions span several batches
+	plan := NewWindowExec(sortedStateScan(), partitionBy, orderBy, windowExprs, windowSchema(), 4)
+	batches := make([]string, 0)
+	for _, batch := range collectBatches(t, plan) {
+		require.Equal(t, windowSchema(), batch.Schema)
+		batches = append(batches, batch.ToCSV())
+	}
+	require.Equal(t, []string{
+		"CA,1,1,1,0\nCA,2,2,3,1\nCO,3,1,3,0\nCO,4,2,7,3\n",
+		"CO,5,3,12,4\n",
+		"null,6,1,6,0\n",
+	}, batches)
+
+	unbatched := NewWindowExec(sortedStateScan(), partitionBy, orderBy, windowExprs, windowSchema(), 0)
+	require.Equal(t, "CA,1,1,1,0\nCA,2,2,3,1\nCO,3,1,3,0\nCO,4,2,7,3\nCO,5,3,12,4\nnull,6,1,6,0\n", collect(t, unbatched))
+	require.Equal(t, "[#0 #1]", fmt.Sprint(plan.OutputOrdering()))
+	require.Equal(t, "WindowExec: partitionBy=[#0], orderBy=[#1 ASC NULLS LAST], "+
+		"windowExpr=[ROW_NUMBER() SUM(#1) ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW LAG(#1, 1, 0)]", plan.String())
+}
+
+func TestWindowExec_empty(t *testing.T) {
+	schema := datatypes.Schema{Fields: []datatypes.Field{
+		{Name: "state", DataType: datatypes.StringType},
+		{Name: "ROW_NUMBER()", DataType: datatypes.UInt64Type},
+	}}
+	input := memScan(datatypes.Schema{Fields: schema.Fields[:1]}, []interface{}{})
+	plan := NewWindowExec(input, nil, nil, []exprs.WindowExpr{exprs.NewRowNumberExpr()}, schema, 4)
+	require.Equal(t, "", collect(t, plan))
+}
@@ -2,6 +2,8 @@ package queryplaner
 
 import (
 	"fmt"
+	"github.com/apache/arrow/go/v6/arrow"
+	"query-engine/datasource"
 	"query-engine/datatypes"
 	"query-engine/logicalplan"
 	"query-engine/physicalplan"
@@ -9,59 +11,847 @@ import (
 	"query-engine/physicalplan/plans"
 )
 
-func NewPhysicalPlan(plan logicalplan.LogicalPlan) physicalplan.PhysicalPlan {
+// Config holds the execution settings the physical plans are created with
+type Config struct {
+	// BatchSize is the max number of rows in the batches built by operators materialising their input, like sort
+	BatchSize int
+	// MemoryLimit is the max bytes an operator buffers before spilling to disk, 0 means no limit
+	MemoryLimit int64
+	// SpillDir is the directory of the spill files, the default temp directory when empty
+	SpillDir string
+	// TargetPartitions is the number of partitions the scans are split into, the partitions of a scan
+	// and of the following selections and projections run in parallel. 1 or less runs a single partition.
+	TargetPartitions int
+}
+
+func DefaultConfig() Config {
+	return Config{BatchSize: 1024, TargetPartitions: 1}
+}
+
+func NewPhysicalPlan(plan logicalplan.LogicalPlan) (physicalplan.PhysicalPlan, error) {
+	return NewPhysicalPlanWithConfig(plan, DefaultConfig())
+}
+
+func NewPhysicalPlanWithConfig(plan logicalplan.LogicalPlan, config Config) (physicalplan.PhysicalPlan, error) {
+	return physicalPlanner{config}.createPhysicalPlan(plan)
+}
+
+type physicalPlanner struct {
+	config Config
+}
+
+// createPhysicalPlan creates the plan of all the rows, the partitions of its input are merged by a CoalesceExec
+func (q physicalPlanner) createPhysicalPlan(plan logicalplan.LogicalPlan) (physicalplan.PhysicalPlan, error) {
+	partitions, err := q.createPartitions(plan)
+	if err != nil {
+		return nil, err
+	}
+	if len(partitions) == 1 {
+		return partitions[0], nil
+	}
+	return plans.NewCoalesceExec(partitions), nil
+}
+
+// createPartitions creates a plan for every partition, scans are split into partitions,
+// selections and projections keep the partitions of their input, aggregations are run in two phases
+// and distinct plans run in parallel over the partitions of their rows, the other plans run a single partition.
+func (q physicalPlanner) createPartitions(plan logicalplan.LogicalPlan) ([]physicalplan.PhysicalPlan, error) {
 	switch p := plan.(type) {
 	case logicalplan.Scan:
-		return plans.NewScanExec(p.DataSource, p.Projection)
+		// reopen or split the data source into new ones, so that the same DataFrame can be planned again
+		// or scanned twice in a self join
+		ds, ok := p.DataSource.(datasource.PartitionedDataSource)
+		if !ok || q.config.TargetPartitions <= 1 {
+			return []physicalplan.PhysicalPlan{plans.NewScanExec(p.DataSource.Reopen(), p.Projection)}, nil
+		}
+		sources, err := ds.Partitions(q.config.TargetPartitions)
+		if err != nil {
+			return nil, err
+		}
+		return plans.NewPartitionScanExecs(sources, p.Projection), nil
 	case logicalplan.Selection:
-		return plans.NewSelectionExec(NewPhysicalPlan(p.Input), NewPhysicalExpr(p.Expr, p.Input))
+		partitions, err := q.createPartitions(p.Input)
+		if err != nil {
+			return nil, err
+		}
+		expr, err := NewPhysicalExpr(p.Expr, p.Input)
+		if err != nil {
+			return nil, err
+		}
+		for i, input := range partitions {
+			partitions[i] = plans.NewSelectionExec(input, expr)
+		}
+		return partitions, nil
 	case logicalplan.Projection:
-		input := NewPhysicalPlan(p.Input)
+		partitions, err := q.createPartitions(p.Input)
+		if err != nil {
+			return nil, err
+		}
 		physicalExprs := make([]physicalplan.PhysicalExpr, len(p.Exprs))
 		fields := make([]datatypes.Field, len(p.Exprs))
 		for i, expr := range p.Exprs {
-			physicalExprs[i] = NewPhysicalExpr(expr, p.Input)
+			physicalExprs[i], err = NewPhysicalExpr(expr, p.Input)
+			if err != nil {
+				return nil, err
+			}
 			fields[i] = expr.ToField(p.Input)
 		}
 		schema := datatypes.Schema{Fields: fields}
-		return plans.NewProjectionExec(input, schema, physicalExprs)
+		for i, input := range partitions {
+			partitions[i] = plans.NewProjectionExec(input, schema, physicalExprs)
+		}
+		return partitions, nil
 	case logicalplan.Aggregate:
-		input := NewPhysicalPlan(p.Input)
-
-		groupExprs := make([]physicalplan.PhysicalExpr, len(p.GroupExpr))
-		for i, expr := range p.GroupExpr {
-			groupExprs[i] = NewPhysicalExpr(expr, p.Input)
-		}
-
-		aggExprs := make([]exprs.AggregateExpr, len(p.AggExpr))
-		for i, expr := range p.AggExpr {
-			switch expr.Name {
-			case "SUM":
-				aggExprs[i] = exprs.NewSumExpr(NewPhysicalExpr(expr.Expr, p.Input))
-			case "MIN":
-				aggExprs[i] = exprs.NewMinExpr(NewPhysicalExpr(expr.Expr, p.Input))
-			case "MAX":
-				aggExprs[i] = exprs.NewMaxExpr(NewPhysicalExpr(expr.Expr, p.Input))
-			default:
-				panic(fmt.Sprintf("Unsupported aggregate function: %s", expr.Name))
+		return q.createAggregate(p)
+	case logicalplan.Window:
+		return q.createWindow(p)
+	case logicalplan.Distinct:
+		partitions, err := q.createPartitions(p.Input)
+		if err != nil {
+			return nil, err
+		}
+		return q.distinctPartitions(partitions), nil
+	case logicalplan.Union:
+		return q.createUnion(p)
+	default:
+		physicalPlan, err := q.createSinglePartition(plan)
+		if err != nil {
+			return nil, err
+		}
+		return []physicalplan.PhysicalPlan{physicalPlan}, nil
+	}
+}
+
+func (q physicalPlanner) createSinglePartition(plan logicalplan.LogicalPlan) (physicalplan.PhysicalPlan, error) {
+	switch p := plan.(type) {
+	case logicalplan.Limit:
+		input, err := q.createPhysicalPlan(p.Input)
+		if err != nil {
+			return nil, err
+		}
+		return plans.NewLimitExec(input, p.Offset, p.Limit), nil
+	case logicalplan.Sort:
+		input, err := q.createPhysicalPlan(p.Input)
+		if err != nil {
+			return nil, err
+		}
+		sortExprs := make([]exprs.SortExpr, len(p.SortExprs))
+		for i, expr := range p.SortExprs {
+			inputExpr, err := NewPhysicalExpr(expr.Expr, p.Input)
+			if err != nil {
+				return nil, err
+			}
+			sortExprs[i] = exprs.NewSortExpr(inputExpr, expr.Asc, expr.NullsFirst)
+		}
+		return plans.NewSortExec(input, sortExprs, q.config.BatchSize, q.config.MemoryLimit, q.config.SpillDir), nil
+	case logicalplan.Join:
+		return q.createJoin(p)
+	case logicalplan.Intersect:
+		return q.newHashSetOpExec(logicalplan.IntersectOperator, p.Left, p.Right)
+	case logicalplan.Except:
+		return q.newHashSetOpExec(logicalplan.ExceptOperator, p.Left, p.Right)
+	default:
+		return nil, datatypes.NewPlanError("Unsupported plan: %s", p)
+	}
+}
+
+// createAggregate runs a two-phase aggregation when the input has several partitions: every partition is
+// aggregated into partial accumulator states, which are merged by the final aggregation. The states are
+// repartitioned by the hash of the group keys, so that the final aggregations of the partitions run in parallel.
+// A partition sorted by the group keys is aggregated by a SortAggregateExec, which only holds the current group.
+// An aggregation by grouping sets expands the rows of every partition into a row for every grouping set by an
+// ExpandExec, then groups the rows by the group keys and the index of their grouping set, see createGroupingSets.
+func (q physicalPlanner) createAggregate(p logicalplan.Aggregate) ([]physicalplan.PhysicalPlan, error) {
+	partitions, err := q.createPartitions(p.Input)
+	if err != nil {
+		return nil, err
+	}
+
+	groupExprs := make([]physicalplan.PhysicalExpr, len(p.GroupExpr))
+	for i, expr := range p.GroupExpr {
+		groupExprs[i], err = NewPhysicalExpr(expr, p.Input)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	groupingSets, err := groupingSetsOf(p)
+	if err != nil {
+		return nil, err
+	}
+	if groupingSets != nil {
+		return q.createGroupingSets(p, partitions, groupExprs, groupingSets)
+	}
+
+	aggExprs := make([]exprs.AggregateExpr, len(p.AggExpr))
+	for i, expr := range p.AggExpr {
+		aggExprs[i], err = newAggregateExpr(expr, p.Input)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return q.aggregatePartitions(partitions, groupExprs, aggExprs, p.Schema()), nil
+}
+
+// createGroupingSets aggregates the rows expanded by grouping set: the ExpandExec appends the group keys and
+// the index of the grouping set to the input columns, so that the inputs of the aggregates keep their columns.
+// The index is a group key, so that the grouping sets are aggregated apart, and is projected out of the output.
+func (q physicalPlanner) createGroupingSets(
+	p logicalplan.Aggregate, partitions []physicalplan.PhysicalPlan,
+	groupExprs []physicalplan.PhysicalExpr, groupingSets [][]int,
+) ([]physicalplan.PhysicalPlan, error) {
+	inputFields := p.Input.Schema().Fields
+	outputFields := p.Schema().Fields
+	setField := datatypes.Field{Name: "grouping_set", DataType: datatypes.Int64Type}
+	setColumn := len(inputFields) + len(groupExprs)
+
+	expandFields := append([]datatypes.Field{}, inputFields...)
+	expandFields = append(expandFields, outputFields[:len(groupExprs)]...)
+	expandSchema := datatypes.Schema{Fields: append(expandFields, setField)}
+	for i, input := range partitions {
+		partitions[i] = plans.NewExpandExec(input, groupExprs, groupingSets, expandSchema)
+	}
+
+	keys := make([]physicalplan.PhysicalExpr, len(groupExprs)+1)
+	for i := range keys {
+		keys[i] = exprs.NewColumnIndexExpr(len(inputFields) + i)
+	}
+	aggExprs := make([]exprs.AggregateExpr, len(p.AggExpr))
+	for i, expr := range p.AggExpr {
+		var err error
+		if expr.Name == "GROUPING" {
+			aggExprs[i], err = newGroupingExpr(expr, p, groupExprs, groupingSets, setColumn)
+		} else {
+			aggExprs[i], err = newAggregateExpr(expr, p.Input)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fields := append([]datatypes.Field{}, outputFields[:len(groupExprs)]...)
+	fields = append(fields, setField)
+	fields = append(fields, outputFields[len(groupExprs):]...)
+	partitions = q.aggregatePartitions(partitions, keys, aggExprs, datatypes.Schema{Fields: fields})
+
+	projection := make([]physicalplan.PhysicalExpr, 0, len(outputFields))
+	for i := range fields {
+		if i != len(groupExprs) {
+			projection = append(projection, exprs.NewColumnIndexExpr(i))
+		}
+	}
+	for i, input := range partitions {
+		partitions[i] = plans.NewProjectionExec(input, p.Schema(), projection)
+	}
+	return partitions, nil
+}
+
+// groupingSetsOf returns the grouping sets of an aggregate, nil for a plain aggregation. GROUPING needs the index
+// of the grouping set, so that an aggregate using it without grouping sets has a single set of all the group exprs.
+func groupingSetsOf(p logicalplan.Aggregate) ([][]int, error) {
+	if p.GroupingSets == nil {
+		for _, expr := range p.AggExpr {
+			if expr.Name == "GROUPING" {
+				all := make([]int, len(p.GroupExpr))
+				for i := range all {
+					all[i] = i
+				}
+				return [][]int{all}, nil
+			}
+		}
+		return nil, nil
+	}
+	if len(p.GroupingSets) == 0 {
+		return nil, datatypes.NewPlanError("Aggregate expects at least one grouping set")
+	}
+	for _, set := range p.GroupingSets {
+		for _, idx := range set {
+			if idx < 0 || idx >= len(p.GroupExpr) {
+				return nil, datatypes.NewPlanError("Grouping set index %d out of range of %d group exprs", idx, len(p.GroupExpr))
+			}
+		}
+	}
+	return p.GroupingSets, nil
+}
+
+// newGroupingExpr creates the GROUPING of group exprs, its value for every grouping set has a bit for every
+// group expr, set when the group expr is not part of the grouping set
+func newGroupingExpr(
+	expr logicalplan.AggregateExpr, p logicalplan.Aggregate,
+	groupExprs []physicalplan.PhysicalExpr, groupingSets [][]int, setColumn int,
+) (exprs.AggregateExpr, error) {
+	if expr.Filter != nil {
+		return nil, datatypes.NewPlanError("FILTER is not supported by GROUPING")
+	}
+	args := expr.Inputs()
+	if len(args) > 63 {
+		return nil, datatypes.NewPlanError("GROUPING expects at most 63 arguments, got %d", len(args))
+	}
+	positions := make([]int, len(args))
+	argExprs := make([]physicalplan.PhysicalExpr, len(args))
+	for i, arg := range args {
+		positions[i] = -1
+		for j, groupExpr := range p.GroupExpr {
+			if groupExpr.String() == arg.String() {
+				positions[i] = j
+				break
+			}
+		}
+		if positions[i] < 0 {
+			return nil, datatypes.NewPlanError("GROUPING argument %s is not a group expr", arg)
+		}
+		argExprs[i] = groupExprs[positions[i]]
+	}
+
+	values := make([]int64, len(groupingSets))
+	for s, set := range groupingSets {
+		included := make(map[int]bool, len(set))
+		for _, idx := range set {
+			included[idx] = true
+		}
+		for _, pos := range positions {
+			values[s] <<= 1
+			if !included[pos] {
+				values[s] |= 1
 			}
 		}
-		return plans.NewHashAggregateExec(input, groupExprs, aggExprs, p.Schema())
+	}
+	return exprs.NewGroupingExpr(exprs.NewColumnIndexExpr(setColumn), argExprs, values), nil
+}
+
+// aggregatePartitions creates the aggregation phases over the partitions, see createAggregate
+func (q physicalPlanner) aggregatePartitions(
+	partitions []physicalplan.PhysicalPlan,
+	groupExprs []physicalplan.PhysicalExpr, aggExprs []exprs.AggregateExpr, schema datatypes.Schema,
+) []physicalplan.PhysicalPlan {
+	batchSize, limit, spillDir := q.config.BatchSize, q.config.MemoryLimit, q.config.SpillDir
+	sorted := len(groupExprs) > 0
+	for _, input := range partitions {
+		sorted = sorted && orderedBy(input, groupExprs)
+	}
+	if len(partitions) == 1 {
+		if sorted {
+			single := plans.NewSortAggregateExec(
+				partitions[0], plans.SingleAggregate, groupExprs, aggExprs, schema, batchSize)
+			return []physicalplan.PhysicalPlan{single}
+		}
+		single := plans.NewHashAggregateExecWithMode(
+			partitions[0], plans.SingleAggregate, groupExprs, aggExprs, schema, batchSize, limit, spillDir)
+		return []physicalplan.PhysicalPlan{single}
+	}
+
+	// the partial output has the group keys followed by the accumulator states
+	for i, input := range partitions {
+		if sorted {
+			partitions[i] = plans.NewSortAggregateExec(
+				input, plans.PartialAggregate, groupExprs, aggExprs, schema, batchSize)
+			continue
+		}
+		partitions[i] = plans.NewHashAggregateExecWithMode(
+			input, plans.PartialAggregate, groupExprs, aggExprs, schema, batchSize, limit, spillDir)
+	}
+
+	finalGroupExprs := make([]physicalplan.PhysicalExpr, len(groupExprs))
+	for i := range finalGroupExprs {
+		finalGroupExprs[i] = exprs.NewColumnIndexExpr(i)
+	}
+	if len(groupExprs) == 0 {
+		final := plans.NewHashAggregateExecWithMode(plans.NewCoalesceExec(partitions),
+			plans.FinalAggregate, finalGroupExprs, aggExprs, schema, batchSize, limit, spillDir)
+		return []physicalplan.PhysicalPlan{final}
+	}
+	partitions = plans.NewRepartitionExecs(
+		partitions, physicalplan.HashPartitioning(finalGroupExprs, q.config.TargetPartitions))
+	for i, input := range partitions {
+		partitions[i] = plans.NewHashAggregateExecWithMode(
+			input, plans.FinalAggregate, finalGroupExprs, aggExprs, schema, batchSize, limit, spillDir)
+	}
+	return partitions
+}
+
+// newAggregateExpr creates the physical aggregate of a logical one, its inputs are evaluated against the input plan
+func newAggregateExpr(expr logicalplan.AggregateExpr, input logicalplan.LogicalPlan) (exprs.AggregateExpr, error) {
+	if expr.Filter != nil {
+		if dataType := expr.Filter.ToField(input).DataType; dataType != datatypes.BooleanType {
+			return nil, datatypes.NewPlanError("FILTER of %s expects a boolean predicate, got %s", expr.Name, dataType)
+		}
+		filter, err := NewPhysicalExpr(expr.Filter, input)
+		if err != nil {
+			return nil, err
+		}
+		aggExpr, err := newAggregateExpr(expr.WithFilter(nil), input)
+		if err != nil {
+			return nil, err
+		}
+		return exprs.NewFilteredAggregateExpr(aggExpr, filter), nil
+	}
+
+	inputs := make([]physicalplan.PhysicalExpr, 0)
+	for _, arg := range expr.Inputs() {
+		inputExpr, err := NewPhysicalExpr(arg, input)
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, inputExpr)
+	}
+	switch expr.Name {
+	case "COVAR_SAMP", "COVAR_POP", "CORR", "APPROX_PERCENTILE", "PERCENTILE_CONT", "PERCENTILE_DISC", "STRING_AGG":
+		if len(inputs) != 2 {
+			return nil, datatypes.NewPlanError("aggregate function %s expects 2 arguments, got %d", expr.Name, len(inputs))
+		}
+	default:
+		if len(inputs) != 1 {
+			return nil, datatypes.NewPlanError("aggregate function %s expects 1 argument, got %d", expr.Name, len(inputs))
+		}
+	}
+
+	switch expr.Name {
+	case "SUM":
+		return exprs.NewSumExpr(inputs[0]), nil
+	case "MIN":
+		return exprs.NewMinExpr(inputs[0]), nil
+	case "MAX":
+		return exprs.NewMaxExpr(inputs[0]), nil
+	case "AVG":
+		return exprs.NewAvgExpr(inputs[0]), nil
+	case "COUNT":
+		return exprs.NewCountExpr(inputs[0]), nil
+	case "COUNT_DISTINCT":
+		return exprs.NewCountDistinctExpr(inputs[0]), nil
+	case "VAR_SAMP", "VAR_POP":
+		return exprs.NewVarianceExpr(inputs[0], expr.Name == "VAR_POP"), nil
+	case "STDDEV_SAMP", "STDDEV_POP":
+		return exprs.NewStddevExpr(inputs[0], expr.Name == "STDDEV_POP"), nil
+	case "COVAR_SAMP", "COVAR_POP":
+		return exprs.NewCovarianceExpr(inputs[0], inputs[1], expr.Name == "COVAR_POP"), nil
+	case "CORR":
+		return exprs.NewCorrExpr(inputs[0], inputs[1]), nil
+	case "APPROX_COUNT_DISTINCT":
+		return exprs.NewApproxCountDistinctExpr(inputs[0]), nil
+	case "APPROX_MEDIAN":
+		return exprs.NewApproxPercentileExpr(inputs[0], 0.5), nil
+	case "MEDIAN":
+		return exprs.NewPercentileContExpr(inputs[0], 0.5), nil
+	case "ARRAY_AGG":
+		return exprs.NewArrayAggExpr(inputs[0]), nil
+	case "STRING_AGG":
+		separator, ok := expr.Args[0].(logicalplan.LiteralString)
+		if !ok {
+			return nil, datatypes.NewPlanError("%s expects a literal string separator, got %s", expr.Name, expr.Args[0])
+		}
+		return exprs.NewStringAggExpr(inputs[0], separator.Str), nil
+	case "APPROX_PERCENTILE", "PERCENTILE_CONT", "PERCENTILE_DISC":
+		percentile, ok := literalPercentile(expr.Args[0])
+		if !ok {
+			return nil, datatypes.NewPlanError("%s expects a literal percentile between 0 and 1, got %s", expr.Name, expr.Args[0])
+		}
+		switch expr.Name {
+		case "PERCENTILE_CONT":
+			return exprs.NewPercentileContExpr(inputs[0], percentile), nil
+		case "PERCENTILE_DISC":
+			return exprs.NewPercentileDiscExpr(inputs[0], percentile), nil
+		}
+		return exprs.NewApproxPercentileExpr(inputs[0], percentile), nil
 	default:
-		panic(fmt.Sprintf("Unsupported plan: %s", p))
+		return nil, datatypes.NewPlanError("Unsupported aggregate function: %s", expr.Name)
+	}
+}
+
+// literalPercentile returns the value of a literal between 0 and 1
+func literalPercentile(expr logicalplan.LogicalExpr) (float64, bool) {
+	var percentile float64
+	switch e := expr.(type) {
+	case logicalplan.LiteralDouble:
+		percentile = e.N
+	case logicalplan.LiteralLong:
+		percentile = float64(e.N)
+	default:
+		return 0, false
+	}
+	return percentile, percentile >= 0 && percentile <= 1
+}
+
+// createWindow evaluates the window exprs with the same partition and order keys by a WindowExec over its input
+// sorted by the keys, the WindowExec of every group of keys appends its values to the rows of the previous one.
+// With partition keys, the rows are repartitioned by the hash of the keys, so that the partitions are evaluated
+// in parallel, otherwise all the rows are evaluated by a single partition.
+func (q physicalPlanner) createWindow(p logicalplan.Window) ([]physicalplan.PhysicalPlan, error) {
+	partitions, err := q.createPartitions(p.Input)
+	if err != nil {
+		return nil, err
 	}
+
+	// the indices of the window exprs of every group of keys, in the order of the first expr of the groups
+	groups := make([][]int, 0)
+	groupIndex := make(map[string]int)
+	for i, expr := range p.WindowExprs {
+		key := fmt.Sprint(expr.PartitionBy, expr.OrderBy)
+		if _, ok := groupIndex[key]; !ok {
+			groupIndex[key] = len(groups)
+			groups = append(groups, nil)
+		}
+		groups[groupIndex[key]] = append(groups[groupIndex[key]], i)
+	}
+
+	fields := append([]datatypes.Field{}, p.Input.Schema().Fields...)
+	// columns are the output columns of the window exprs
+	columns := make([]int, len(p.WindowExprs))
+	for _, group := range groups {
+		first := p.WindowExprs[group[0]]
+		partitionBy := make([]physicalplan.PhysicalExpr, len(first.PartitionBy))
+		sortExprs := make([]exprs.SortExpr, 0)
+		for i, expr := range first.PartitionBy {
+			if partitionBy[i], err = NewPhysicalExpr(expr, p.Input); err != nil {
+				return nil, err
+			}
+			sortExprs = append(sortExprs, exprs.NewSortExpr(partitionBy[i], true, false))
+		}
+		orderBy := make([]exprs.SortExpr, len(first.OrderBy))
+		for i, expr := range first.OrderBy {
+			inputExpr, err := NewPhysicalExpr(expr.Expr, p.Input)
+			if err != nil {
+				return nil, err
+			}
+			orderBy[i] = exprs.NewSortExpr(inputExpr, expr.Asc, expr.NullsFirst)
+		}
+		sortExprs = append(sortExprs, orderBy...)
+
+		windowExprs := make([]exprs.WindowExpr, len(group))
+		for i, idx := range group {
+			expr := p.WindowExprs[idx]
+			if windowExprs[i], err = newWindowExpr(expr, p.Input); err != nil {
+				return nil, err
+			}
+			columns[idx] = len(fields)
+			fields = append(fields, expr.ToField(p.Input))
+		}
+		schema := datatypes.Schema{Fields: append([]datatypes.Field{}, fields...)}
+
+		switch {
+		case len(partitions) > 1 && len(partitionBy) > 0:
+			partitions = plans.NewRepartitionExecs(
+				partitions, physicalplan.HashPartitioning(partitionBy, q.config.TargetPartitions))
+		case len(partitions) > 1:
+			partitions = []physicalplan.PhysicalPlan{plans.NewCoalesceExec(partitions)}
+		}
+		for i, input := range partitions {
+			if len(sortExprs) > 0 {
+				input = plans.NewSortExec(input, sortExprs, q.config.BatchSize, q.config.MemoryLimit, q.config.SpillDir)
+			}
+			partitions[i] = plans.NewWindowExec(input, partitionBy, orderBy, windowExprs, schema, q.config.BatchSize)
+		}
+	}
+
+	// put the window values back in the order of the window exprs
+	reordered := false
+	for i, column := range columns {
+		reordered = reordered || column != len(p.Input.Schema().Fields)+i
+	}
+	if !reordered {
+		return partitions, nil
+	}
+	inputColumns := len(p.Input.Schema().Fields)
+	projection := make([]physicalplan.PhysicalExpr, inputColumns+len(columns))
+	for i := range projection {
+		if i < inputColumns {
+			projection[i] = exprs.NewColumnIndexExpr(i)
+		} else {
+			projection[i] = exprs.NewColumnIndexExpr(columns[i-inputColumns])
+		}
+	}
+	for i, input := range partitions {
+		partitions[i] = plans.NewProjectionExec(input, p.Schema(), projection)
+	}
+	return partitions, nil
+}
+
+// newWindowExpr creates the physical window function of a logical one, its inputs are evaluated against the input plan
+func newWindowExpr(expr logicalplan.WindowExpr, input logicalplan.LogicalPlan) (exprs.WindowExpr, error) {
+	switch expr.Name {
+	case "ROW_NUMBER", "RANK", "DENSE_RANK":
+		if len(expr.Args) != 0 {
+			return nil, datatypes.NewPlanError("window function %s expects 0 arguments, got %d", expr.Name, len(expr.Args))
+		}
+		switch expr.Name {
+		case "ROW_NUMBER":
+			return exprs.NewRowNumberExpr(), nil
+		case "RANK":
+			return exprs.NewRankExpr(), nil
+		}
+		return exprs.NewDenseRankExpr(), nil
+	case "LAG", "LEAD":
+		return newOffsetExpr(expr, input)
+	}
+
+	aggExpr, err := newAggregateExpr(expr.Aggregate(), input)
+	if err != nil {
+		return nil, err
+	}
+	frame := expr.WindowFrame()
+	if frame.Start.Type == logicalplan.UnboundedFollowing || frame.End.Type == logicalplan.UnboundedPreceding ||
+		frame.Start.Type > frame.End.Type || frame.Start.Offset < 0 || frame.End.Offset < 0 {
+		return nil, datatypes.NewPlanError("Invalid window frame: %s", frame)
+	}
+	offsets := frame.Start.Type == logicalplan.Preceding || frame.Start.Type == logicalplan.Following ||
+		frame.End.Type == logicalplan.Preceding || frame.End.Type == logicalplan.Following
+	if frame.Units == logicalplan.RangeFrame && offsets &&
+		(len(expr.OrderBy) != 1 || !isNumeric(expr.OrderBy[0].Expr.ToField(input).DataType)) {
+		return nil, datatypes.NewPlanError("RANGE offsets require a single numeric ORDER BY key: %s", expr)
+	}
+	return exprs.NewAggregateWindowExpr(aggExpr, exprs.NewWindowFrame(
+		exprs.FrameUnits(frame.Units),
+		exprs.FrameBound{Type: exprs.FrameBoundType(frame.Start.Type), Offset: frame.Start.Offset},
+		exprs.FrameBound{Type: exprs.FrameBoundType(frame.End.Type), Offset: frame.End.Offset},
+	)), nil
+}
+
+// newOffsetExpr creates LAG or LEAD, the offset is a literal integer and the default a literal of the input type
+func newOffsetExpr(expr logicalplan.WindowExpr, input logicalplan.LogicalPlan) (exprs.WindowExpr, error) {
+	if len(expr.Args) < 1 || len(expr.Args) > 3 {
+		return nil, datatypes.NewPlanError("window function %s expects 1 to 3 arguments, got %d", expr.Name, len(expr.Args))
+	}
+	inputExpr, err := NewPhysicalExpr(expr.Args[0], input)
+	if err != nil {
+		return nil, err
+	}
+	offset := int64(1)
+	if len(expr.Args) > 1 {
+		literal, ok := expr.Args[1].(logicalplan.LiteralLong)
+		if !ok || literal.N < 0 {
+			return nil, datatypes.NewPlanError("%s expects a literal non negative offset, got %s", expr.Name, expr.Args[1])
+		}
+		offset = literal.N
+	}
+	var defaultValue interface{}
+	if len(expr.Args) > 2 {
+		switch literal := expr.Args[2].(type) {
+		case logicalplan.LiteralLong:
+			defaultValue = literal.N
+		case logicalplan.LiteralDouble:
+			defaultValue = literal.N
+		case logicalplan.LiteralString:
+			defaultValue = literal.Str
+		default:
+			return nil, datatypes.NewPlanError("%s expects a literal default, got %s", expr.Name, expr.Args[2])
+		}
+		inputType, defaultType := expr.Args[0].ToField(input).DataType, expr.Args[2].ToField(input).DataType
+		if !arrow.TypeEqual(inputType, defaultType) {
+			return nil, datatypes.NewPlanError(
+				"%s default %s of type %s doesn't match the input type %s", expr.Name, expr.Args[2], defaultType, inputType)
+		}
+	}
+	if expr.Name == "LAG" {
+		return exprs.NewLagExpr(inputExpr, offset, defaultValue), nil
+	}
+	return exprs.NewLeadExpr(inputExpr, offset, defaultValue), nil
+}
+
+func isNumeric(dataType arrow.DataType) bool {
+	switch dataType.ID() {
+	case arrow.INT8, arrow.INT16, arrow.INT32, arrow.INT64, arrow.UINT8, arrow.UINT16, arrow.UINT32, arrow.UINT64,
+		arrow.FLOAT32, arrow.FLOAT64:
+		return true
+	}
+	return false
+}
+
+// orderedBy returns whether the rows of a plan with equal values of keys are adjacent:
+// the longest prefix of the ordering of the plan made of keys has all the keys
+func orderedBy(plan physicalplan.PhysicalPlan, keys []physicalplan.PhysicalExpr) bool {
+	keySet := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		keySet[fmt.Sprint(key)] = true
+	}
+	prefix := make(map[string]bool, len(keys))
+	for _, expr := range plan.OutputOrdering() {
+		if !keySet[fmt.Sprint(expr)] {
+			break
+		}
+		prefix[fmt.Sprint(expr)] = true
+	}
+	return len(prefix) == len(keySet)
+}
+
+// createJoin creates a HashJoinExec for a join with keys, otherwise a NestedLoopJoinExec comparing every pair of rows
+func (q physicalPlanner) createJoin(p logicalplan.Join) (physicalplan.PhysicalPlan, error) {
+	if p.JoinType == logicalplan.CrossJoin && (len(p.On) > 0 || p.Filter != nil) {
+		return nil, datatypes.NewPlanError("Cross join doesn't take a join condition, got on=%v, filter=%v", p.On, p.Filter)
+	}
+	var filter physicalplan.PhysicalExpr
+	if p.Filter != nil {
+		if err := p.CheckFilter(); err != nil {
+			return nil, err
+		}
+		if dataType := p.Filter.ToField(p.FilterInput()).DataType; dataType != datatypes.BooleanType {
+			return nil, datatypes.NewPlanError("Join filter %s expects a boolean predicate, got %s", p.Filter, dataType)
+		}
+		var err error
+		if filter, err = NewPhysicalExpr(p.Filter, p.FilterInput()); err != nil {
+			return nil, err
+		}
+	}
+	if len(p.On) > 0 {
+		return q.newHashJoinExec(p, filter)
+	}
+
+	left, err := q.createPhysicalPlan(p.Left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := q.createPhysicalPlan(p.Right)
+	if err != nil {
+		return nil, err
+	}
+	return plans.NewNestedLoopJoinExec(left, right, p.JoinType, filter, p.Schema()), nil
+}
+
+func (q physicalPlanner) newHashJoinExec(p logicalplan.Join, filter physicalplan.PhysicalExpr) (physicalplan.PhysicalPlan, error) {
+	leftSchema := p.Left.Schema()
+	rightSchema := p.Right.Schema()
+
+	leftKeys := make([]int, len(p.On))
+	rightKeys := make([]int, len(p.On))
+	for i, pair := range p.On {
+		leftKeys[i] = leftSchema.FindFirstIndexByName(pair[0])
+		if leftKeys[i] < 0 {
+			return nil, datatypes.NewSchemaError("No column named: %s", pair[0])
+		}
+		rightKeys[i] = rightSchema.FindFirstIndexByName(pair[1])
+		if rightKeys[i] < 0 {
+			return nil, datatypes.NewSchemaError("No column named: %s", pair[1])
+		}
+		lType := leftSchema.Fields[leftKeys[i]].DataType
+		rType := rightSchema.Fields[rightKeys[i]].DataType
+		if lType != rType {
+			return nil, datatypes.NewSchemaError(
+				"Join key %s of type %s can't be compared with %s of type %s", pair[0], lType, pair[1], rType)
+		}
+	}
+
+	// keep the output columns in line with the logical join schema, semi and anti joins only return the left columns
+	duplicateKeys := p.DuplicateKeys()
+	leftOnly := p.JoinType == logicalplan.LeftSemiJoin || p.JoinType == logicalplan.LeftAntiJoin
+	leftOutput := make([]int, 0)
+	for i, field := range leftSchema.Fields {
+		if _, ok := duplicateKeys[field.Name]; !ok || p.JoinType != logicalplan.RightJoin {
+			leftOutput = append(leftOutput, i)
+		}
+	}
+	rightOutput := make([]int, 0)
+	for i, field := range rightSchema.Fields {
+		if _, ok := duplicateKeys[field.Name]; (!ok || p.JoinType == logicalplan.RightJoin) && !leftOnly {
+			rightOutput = append(rightOutput, i)
+		}
+	}
+
+	left, err := q.createPhysicalPlan(p.Left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := q.createPhysicalPlan(p.Right)
+	if err != nil {
+		return nil, err
+	}
+	if filter != nil {
+		return plans.NewHashJoinExecWithFilter(
+			left, right, p.JoinType, leftKeys, rightKeys, leftOutput, rightOutput, filter, p.Schema(),
+		), nil
+	}
+	return plans.NewHashJoinExec(
+		left, right, p.JoinType, leftKeys, rightKeys, leftOutput, rightOutput, p.Schema(),
+	), nil
+}
+
+// distinctPartitions removes the duplicate rows of the partitions, the rows are repartitioned by the hash
+// of all the columns first, so that the duplicates are in the same partition
+func (q physicalPlanner) distinctPartitions(partitions []physicalplan.PhysicalPlan) []physicalplan.PhysicalPlan {
+	if len(partitions) > 1 {
+		columns := make([]physicalplan.PhysicalExpr, len(partitions[0].Schema().Fields))
+		for i := range columns {
+			columns[i] = exprs.NewColumnIndexExpr(i)
+		}
+		partitions = plans.NewRepartitionExecs(partitions, physicalplan.HashPartitioning(columns, q.config.TargetPartitions))
+	}
+	distinct := make([]physicalplan.PhysicalPlan, len(partitions))
+	for i, input := range partitions {
+		distinct[i] = plans.NewHashDistinctExec(input)
+	}
+	return distinct
+}
+
+// createUnion returns the rows of both sides one after the other as a single partition,
+// without the duplicates unless ALL
+func (q physicalPlanner) createUnion(p logicalplan.Union) ([]physicalplan.PhysicalPlan, error) {
+	schema, err := logicalplan.SetSchema(logicalplan.UnionOperator, p.Left, p.Right)
+	if err != nil {
+		return nil, err
+	}
+	inputs, err := q.createSetInputs(schema, p.Left, p.Right)
+	if err != nil {
+		return nil, err
+	}
+	partitions := []physicalplan.PhysicalPlan{plans.NewUnionExec(inputs, schema)}
+	if p.All {
+		return partitions, nil
+	}
+	return q.distinctPartitions(partitions), nil
+}
+
+func (q physicalPlanner) newHashSetOpExec(
+	op logicalplan.SetOperator, left, right logicalplan.LogicalPlan,
+) (physicalplan.PhysicalPlan, error) {
+	schema, err := logicalplan.SetSchema(op, left, right)
+	if err != nil {
+		return nil, err
+	}
+	inputs, err := q.createSetInputs(schema, left, right)
+	if err != nil {
+		return nil, err
+	}
+	return plans.NewHashSetOpExec(inputs[0], inputs[1], op, schema), nil
+}
+
+// createSetInputs creates the plans of the sides of a set operation, the columns whose type differs
+// from the widened type of the schema are cast to it
+func (q physicalPlanner) createSetInputs(
+	schema datatypes.Schema, sides ...logicalplan.LogicalPlan,
+) ([]physicalplan.PhysicalPlan, error) {
+	inputs := make([]physicalplan.PhysicalPlan, len(sides))
+	for i, side := range sides {
+		input, err := q.createPhysicalPlan(side)
+		if err != nil {
+			return nil, err
+		}
+		columns := make([]physicalplan.PhysicalExpr, len(schema.Fields))
+		fields := make([]datatypes.Field, len(schema.Fields))
+		cast := false
+		for j, field := range side.Schema().Fields {
+			columns[j] = exprs.NewColumnIndexExpr(j)
+			fields[j] = field
+			if !arrow.TypeEqual(field.DataType, schema.Fields[j].DataType) {
+				columns[j] = exprs.NewCastExpr(columns[j], schema.Fields[j].DataType)
+				fields[j].DataType = schema.Fields[j].DataType
+				cast = true
+			}
+		}
+		if cast {
+			input = plans.NewProjectionExec(input, datatypes.Schema{Fields: fields}, columns)
+		}
+		inputs[i] = input
+	}
+	return inputs, nil
 }
 
-func NewPhysicalExpr(expr logicalplan.LogicalExpr, input logicalplan.LogicalPlan) physicalplan.PhysicalExpr {
+func NewPhysicalExpr(expr logicalplan.LogicalExpr, input logicalplan.LogicalPlan) (physicalplan.PhysicalExpr, error) {
 	switch e := expr.(type) {
 	case logicalplan.LiteralLong:
-		return exprs.NewLiteralLongExpr(e.N)
+		return exprs.NewLiteralLongExpr(e.N), nil
 	case logicalplan.LiteralDouble:
-		return exprs.NewLiteralDoubleExpr(e.N)
+		return exprs.NewLiteralDoubleExpr(e.N), nil
 	case logicalplan.LiteralString:
-		return exprs.NewLiteralStringExpr(e.Str)
+		return exprs.NewLiteralStringExpr(e.Str), nil
 	case logicalplan.ColumnIndex:
-		return exprs.NewColumnIndexExpr(e.Index)
+		return exprs.NewColumnIndexExpr(e.Index), nil
 	case logicalplan.Alias:
 		// note that there is no physical expression for an alias since the alias
 		// only affects the name using in the planning phase and not how the aliased
@@ -71,43 +861,119 @@ func NewPhysicalExpr(expr logicalplan.LogicalExpr, input logicalplan.LogicalPlan
 		schema := input.Schema()
 		idx := schema.FindFirstIndexByName(e.Name)
 		if idx < 0 {
-			panic(fmt.Sprintf("No column named: %s", e.Name))
+			return nil, datatypes.NewSchemaError("No column named: %s", e.Name)
 		}
-		return exprs.NewColumnIndexExpr(idx)
+		return exprs.NewColumnIndexExpr(idx), nil
+	case logicalplan.JoinColumn:
+		join, ok := input.(logicalplan.Join)
+		if !ok {
+			return nil, datatypes.NewPlanError("Column %s only refers to a side of a join filter", e)
+		}
+		idx := join.FilterColumnIndex(e)
+		if idx < 0 {
+			return nil, datatypes.NewSchemaError("No column named: %s", e.Name)
+		}
+		return exprs.NewColumnIndexExpr(idx), nil
 	case logicalplan.CastExpr:
-		return exprs.NewCastExpr(NewPhysicalExpr(e.Expr, input), e.DType)
+		inputExpr, err := NewPhysicalExpr(e.Expr, input)
+		if err != nil {
+			return nil, err
+		}
+		return exprs.NewCastExpr(inputExpr, e.DType), nil
 	case logicalplan.BooleanBinaryExpr:
-		l := NewPhysicalExpr(e.L, input)
-		r := NewPhysicalExpr(e.R, input)
+		var l, r physicalplan.PhysicalExpr
+		var err error
+		if e.Name == "and" || e.Name == "or" {
+			l, r, err = newPhysicalOperands(e.L, e.R, input)
+		} else {
+			l, r, err = newCoercedOperands(e.L, e.R, input)
+		}
+		if err != nil {
+			return nil, err
+		}
 		switch e.Name {
 		case "eq":
-			return exprs.NewEqExpr(l, r)
+			return exprs.NewEqExpr(l, r), nil
 		case "neq":
-			return exprs.NewNeqExpr(l, r)
+			return exprs.NewNeqExpr(l, r), nil
 		case "gt":
-			return exprs.NewGtExpr(l, r)
+			return exprs.NewGtExpr(l, r), nil
 		case "gteq":
-			return exprs.NewGtEqExpr(l, r)
+			return exprs.NewGtEqExpr(l, r), nil
 		case "lt":
-			return exprs.NewLtExpr(l, r)
+			return exprs.NewLtExpr(l, r), nil
 		case "lteq":
-			return exprs.NewLtEqExpr(l, r)
+			return exprs.NewLtEqExpr(l, r), nil
 		case "and":
-			return exprs.NewAndExpr(l, r)
+			return exprs.NewAndExpr(l, r), nil
 		case "or":
-			return exprs.NewOrExpr(l, r)
+			return exprs.NewOrExpr(l, r), nil
+		default:
+			return nil, datatypes.NewPlanError("Unsupported binary expression: %s", e)
+		}
+	case logicalplan.MathExpr:
+		l, r, err := newCoercedOperands(e.L, e.R, input)
+		if err != nil {
+			return nil, err
+		}
+		switch e.Name {
 		case "add":
-			return exprs.NewAddExpr(l, r)
+			return exprs.NewAddExpr(l, r), nil
 		case "subtract":
-			return exprs.NewSubtractExpr(l, r)
+			return exprs.NewSubtractExpr(l, r), nil
 		case "multiply":
-			return exprs.NewMultiplyExpr(l, r)
+			return exprs.NewMultiplyExpr(l, r), nil
 		case "divide":
-			return exprs.NewDivideExpr(l, r)
+			return exprs.NewDivideExpr(l, r), nil
+		case "modulus":
+			return exprs.NewModulusExpr(l, r), nil
 		default:
-			panic(fmt.Sprintf("Unsupported binary expression: %s", e))
+			return nil, datatypes.NewPlanError("Unsupported binary expression: %s", e)
 		}
 	default:
-		panic(fmt.Sprintf("Unsupported logical expression: %s", e))
+		return nil, datatypes.NewPlanError("Unsupported logical expression: %s", e)
+	}
+}
+
+// newCoercedOperands coerces numeric operands of different types to their logicalplan.CoercedType:
+// a literal becomes a literal of that type, the other operands are cast to it.
+func newCoercedOperands(
+	l, r logicalplan.LogicalExpr, input logicalplan.LogicalPlan,
+) (physicalplan.PhysicalExpr, physicalplan.PhysicalExpr, error) {
+	lExpr, rExpr, err := newPhysicalOperands(l, r, input)
+	if err != nil {
+		return nil, nil, err
+	}
+	dType, ok := logicalplan.CoercedType(l, r, input)
+	if !ok {
+		return lExpr, rExpr, nil
+	}
+	return coerce(l, lExpr, dType, input), coerce(r, rExpr, dType, input), nil
+}
+
+// coerce converts an operand to dType, unless it already has that type
+func coerce(
+	expr logicalplan.LogicalExpr, physicalExpr physicalplan.PhysicalExpr, dType arrow.DataType, input logicalplan.LogicalPlan,
+) physicalplan.PhysicalExpr {
+	if arrow.TypeEqual(expr.ToField(input).DataType, dType) {
+		return physicalExpr
+	}
+	if val, ok := logicalplan.LiteralAs(expr, dType); ok {
+		return exprs.NewLiteralValueExpr(val, dType)
+	}
+	return exprs.NewCastExpr(physicalExpr, dType)
+}
+
+func newPhysicalOperands(
+	l, r logicalplan.LogicalExpr, input logicalplan.LogicalPlan,
+) (physicalplan.PhysicalExpr, physicalplan.PhysicalExpr, error) {
+	lExpr, err := NewPhysicalExpr(l, input)
+	if err != nil {
+		return nil, nil, err
+	}
+	rExpr, err := NewPhysicalExpr(r, input)
+	if err != nil {
+		return nil, nil, err
 	}
+	return lExpr, rExpr, nil
 }
@@ -1,23 +1,52 @@
 package queryplaner
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/stretchr/testify/require"
+	"os"
 	"query-engine/datasource"
+	"query-engine/datatypes"
 	. "query-engine/logicalplan"
 	"query-engine/optimizer"
 	"query-engine/physicalplan"
+	"sort"
+	"strings"
 	"testing"
 )
 
 const dir = "../testdata"
 
-func csvDataFrame() DataFrame {
-	csv := datasource.NewCsvDataSource(dir+"/employee.csv", 1024)
+func csvDataFrame(t *testing.T) DataFrame {
+	csv, err := datasource.NewCsvDataSource(dir+"/employee.csv", 1024)
+	require.NoError(t, err)
 	return NewDefaultDataFrame(NewScan("employee", csv, []string{}))
 }
 
+// collectBatches drains the plan and returns its batches, which have the schema of the plan
+func collectBatches(t *testing.T, plan physicalplan.PhysicalPlan) []datatypes.RecordBatch {
+	batches := make([]datatypes.RecordBatch, 0)
+	for plan.Next(context.Background()) {
+		batch, err := plan.Execute(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, plan.Schema(), batch.Schema)
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// collect drains the plan and returns its rows as CSV
+func collect(t *testing.T, plan physicalplan.PhysicalPlan) string {
+	result := ""
+	for _, batch := range collectBatches(t, plan) {
+		result += batch.ToCSV()
+	}
+	return result
+}
+
 func TestAggregatePlan(t *testing.T) {
-	df := csvDataFrame()
+	df := csvDataFrame(t)
 	df = df.Aggregate(
 		[]LogicalExpr{
 			NewCol("state"),
@@ -33,17 +62,660 @@ Aggregate: groupExpr=[#state], aggregateExpr=[MIN(#salary) MAX(#salary) SUM(#sal
 `
 	require.Equal(t, expect, PrettyFormat(df.LogicalPlan()))
 
-	optimizedPlan := optimizer.NewOptimizer().Optimize(df.LogicalPlan())
+	optimizedPlan, err := optimizer.NewOptimizer().Optimize(df.LogicalPlan())
+	require.NoError(t, err)
 	expect = `
 Aggregate: groupExpr=[#state], aggregateExpr=[MIN(#salary) MAX(#salary) SUM(#salary)]
 	Scan: employee; projection=[state salary]
 `
 	require.Equal(t, expect, PrettyFormat(optimizedPlan))
 
-	plan := NewPhysicalPlan(optimizedPlan)
+	plan, err := NewPhysicalPlan(optimizedPlan)
+	require.NoError(t, err)
 	expect = `
 HashAggregateExec: groupExpr=[#0], aggExpr=[MIN(#1) MAX(#1) SUM(#1)]
 	ScanExec: schema={[{state utf8} {salary utf8}]}, projection=[state salary]
 `
 	require.Equal(t, expect, physicalplan.PrettyFormat(plan))
 }
+
+func TestAggregatePlan_filter(t *testing.T) {
+	manager := NewEq(NewCol("job_title"), NewLiteralString("Manager"))
+	df := csvDataFrame(t).Aggregate(
+		[]LogicalExpr{NewCol("state")},
+		[]AggregateExpr{NewCount(NewCol("id")).WithFilter(manager)},
+	)
+	count := NewCast(NewCol("COUNT(#id) FILTER (WHERE #job_title = 'Manager')"), datatypes.Int64Type)
+	df = df.Filter(NewEq(count, NewLiteralLong(1)))
+
+	optimizedPlan, err := optimizer.NewOptimizer().Optimize(df.LogicalPlan())
+	require.NoError(t, err)
+	plan, err := NewPhysicalPlan(optimizedPlan)
+	require.NoError(t, err)
+	expect := `
+Selection: CAST(#1 AS int64) = 1
+	HashAggregateExec: groupExpr=[#0], aggExpr=[COUNT(#1) FILTER (WHERE #2 = 'Manager')]
+		ScanExec: schema={[{state utf8} {id utf8} {job_title utf8}]}, projection=[state id job_title]
+`
+	require.Equal(t, expect, physicalplan.PrettyFormat(plan))
+
+	require.Equal(t, "CA,1\n", collect(t, plan))
+}
+
+func TestGroupingSetsPlan(t *testing.T) {
+	salary := NewCast(NewCol("salary"), datatypes.Int64Type)
+	df := csvDataFrame(t).AggregateGroupingSets(
+		[]LogicalExpr{NewCol("state"), NewCol("job_title")},
+		RollupSets(2),
+		[]AggregateExpr{NewSum(salary), NewGrouping(NewCol("state"), NewCol("job_title"))})
+	optimizedPlan, err := optimizer.NewOptimizer().Optimize(df.LogicalPlan())
+	require.NoError(t, err)
+	expect := `
+Aggregate: groupExpr=[#state #job_title], groupingSets=[(#state, #job_title) (#state) ()], aggregateExpr=[SUM(CAST(#salary AS int64)) GROUPING(#state, #job_title)]
+	Scan: employee; projection=[state job_title salary]
+`
+	require.Equal(t, expect, PrettyFormat(optimizedPlan))
+
+	plan, err := NewPhysicalPlan(optimizedPlan)
+	require.NoError(t, err)
+	// every row is aggregated once by grouping set, the index of the grouping set is projected out
+	expect = `
+ProjectionExec: [#0 #1 #3 #4]
+	HashAggregateExec: groupExpr=[#3 #4 #5], aggExpr=[SUM(CAST(#2 AS int64)) GROUPING(#0, #1)]
+		ExpandExec: groupExpr=[#0 #1], groupingSets=[[0 1] [0] []]
+			ScanExec: schema={[{state utf8} {job_title utf8} {salary utf8}]}, projection=[state job_title salary]
+`
+	require.Equal(t, expect, physicalplan.PrettyFormat(plan))
+
+	require.Equal(t, df.Schema(), plan.Schema())
+	rows := strings.Split(strings.TrimSuffix(collect(t, plan), "\n"), "\n")
+	sort.Strings(rows)
+	require.Equal(t, []string{
+		",Defensive End,11500,0", ",null,11500,1",
+		"CA,Manager,12000,0", "CA,null,12000,1",
+		"CO,Driver,10000,0", "CO,Manager, Software,11500,0", "CO,null,21500,1",
+		"null,null,45000,3",
+	}, rows)
+}
+
+func TestGroupingSetsPlan_errors(t *testing.T) {
+	state, salary := NewCol("state"), NewCol("salary")
+	testCases := []struct {
+		groupingSets [][]int
+		aggExpr      AggregateExpr
+		err          string
+	}{
+		{[][]int{}, NewMax(salary), "Aggregate expects at least one grouping set"},
+		{[][]int{{0}, {1}}, NewMax(salary), "Grouping set index 1 out of range of 1 group exprs"},
+		{RollupSets(1), NewGrouping(salary), "GROUPING argument #salary is not a group expr"},
+		{RollupSets(1), NewGrouping(state).WithFilter(NewEq(salary, salary)), "FILTER is not supported by GROUPING"},
+	}
+	for _, tc := range testCases {
+		df := csvDataFrame(t).AggregateGroupingSets([]LogicalExpr{state}, tc.groupingSets, []AggregateExpr{tc.aggExpr})
+		_, err := NewPhysicalPlan(df.LogicalPlan())
+		var planErr *datatypes.PlanError
+		require.True(t, errors.As(err, &planErr), tc.err)
+		require.Equal(t, tc.err, err.Error())
+	}
+}
+
+func TestJoinPlan(t *testing.T) {
+	employee := csvDataFrame(t).Project([]LogicalExpr{NewCol("id"), NewCol("first_name"), NewCol("state")})
+	manager := csvDataFrame(t).Project([]LogicalExpr{NewCol("state"), NewAlias(NewCol("first_name"), "manager")})
+	df := employee.Join(manager, RightJoin, [][]string{{"state", "state"}})
+
+	optimizedPlan, err := optimizer.NewOptimizer().Optimize(df.LogicalPlan())
+	require.NoError(t, err)
+	plan, err := NewPhysicalPlan(optimizedPlan)
+	require.NoError(t, err)
+	expect := `
+HashJoinExec: type=Right, on=[#2=#0]
+	ProjectionExec: [#0 #1 #2]
+		ScanExec: schema={[{id utf8} {first_name utf8} {state utf8}]}, projection=[id first_name state]
+	ProjectionExec: [#0 #1]
+		ScanExec: schema={[{state utf8} {first_name utf8}]}, projection=[state first_name]
+`
+	require.Equal(t, expect, physicalplan.PrettyFormat(plan))
+
+	result := collect(t, plan)
+	// the right join keeps the manager state, employees are matched for every manager of their state
+	expect = "1,Bill,CA,Bill\n2,Gregg,CO,Gregg\n3,John,CO,Gregg\n2,Gregg,CO,John\n3,John,CO,John\n4,Von,,Von\n"
+	require.Equal(t, expect, result)
+}
+
+func TestJoinPlan_key_type_mismatch(t *testing.T) {
+	left := csvDataFrame(t)
+	right := csvDataFrame(t).Project([]LogicalExpr{NewAlias(NewCast(NewCol("id"), datatypes.Int64Type), "key")})
+	df := left.Join(right, InnerJoin, [][]string{{"id", "key"}})
+	_, err := NewPhysicalPlan(df.LogicalPlan())
+	var schemaErr *datatypes.SchemaError
+	require.True(t, errors.As(err, &schemaErr))
+	require.Equal(t, "Join key id of type utf8 can't be compared with key of type int64", err.Error())
+}
+
+func TestNestedLoopJoinPlan(t *testing.T) {
+	employee := csvDataFrame(t).Project([]LogicalExpr{NewCol("id"), NewCast(NewCol("salary"), datatypes.Int64Type)})
+	other := csvDataFrame(t).Project([]LogicalExpr{NewAlias(NewCast(NewCol("salary"), datatypes.Int64Type), "other_salary")})
+	lower := NewLt(NewCol("salary"), NewCol("other_salary"))
+
+	// without keys the join compares every pair of rows
+	df := employee.JoinWithFilter(other, LeftSemiJoin, nil, lower)
+	optimizedPlan, err := optimizer.NewOptimizer().Optimize(df.LogicalPlan())
+	require.NoError(t, err)
+	plan, err := NewPhysicalPlan(optimizedPlan)
+	require.NoError(t, err)
+	expect := `
+NestedLoopJoinExec: type=LeftSemi, filter=#1 < #2
+	ProjectionExec: [#0 CAST(#1 AS int64)]
+		ScanExec: schema={[{id utf8} {salary utf8}]}, projection=[id salary]
+	ProjectionExec: [CAST(#0 AS int64)]
+		ScanExec: schema={[{salary utf8}]}, projection=[salary]
+`
+	require.Equal(t, expect, physicalplan.PrettyFormat(plan))
+	// the employees someone earns more than
+	require.Equal(t, "2,10000\n3,11500\n4,11500\n", collect(t, plan))
+
+	df = employee.JoinWithFilter(other, LeftAntiJoin, nil, lower)
+	plan, err = NewPhysicalPlan(df.LogicalPlan())
+	require.NoError(t, err)
+	require.Equal(t, "1,12000\n", collect(t, plan))
+
+	df = employee.CrossJoin(other).Aggregate(nil, []AggregateExpr{NewCount(NewCol("id"))})
+	plan, err = NewPhysicalPlan(df.LogicalPlan())
+	require.NoError(t, err)
+	require.Equal(t, "16\n", collect(t, plan))
+}
+
+func TestNestedLoopJoinPlan_columns_of_both_sides(t *testing.T) {
+	employee := csvDataFrame(t).Project([]LogicalExpr{NewCol("id"), NewAlias(NewCast(NewCol("salary"), datatypes.Int64Type), "salary")})
+	// the pairs of employees where the left one earns less, both sides have an id and a salary
+	lower := NewLt(NewLeftCol("salary"), NewRightCol("salary"))
+	df := employee.JoinWithFilter(employee, InnerJoin, nil, lower)
+	optimizedPlan, err := optimizer.NewOptimizer().Optimize(df.LogicalPlan())
+	require.NoError(t, err)
+	plan, err := NewPhysicalPlan(optimizedPlan)
+	require.NoError(t, err)
+	require.Equal(t, "NestedLoopJoinExec: type=Inner, filter=#1 < #3", plan.String())
+	require.Equal(t, "2,10000,1,12000\n2,10000,3,11500\n2,10000,4,11500\n3,11500,1,12000\n4,11500,1,12000\n", collect(t, plan))
+
+	df = employee.JoinWithFilter(employee, InnerJoin, nil, NewLt(NewCol("salary"), NewRightCol("salary")))
+	_, err = NewPhysicalPlan(df.LogicalPlan())
+	var planErr *datatypes.PlanError
+	require.True(t, errors.As(err, &planErr))
+	require.Equal(t, "Join filter column salary is ambiguous, both sides have it", err.Error())
+}
+
+func TestJoinPlan_with_filter(t *testing.T) {
+	employee := csvDataFrame(t).Project([]LogicalExpr{NewCol("id"), NewCol("state"), NewCast(NewCol("salary"), datatypes.Int64Type)})
+	other := csvDataFrame(t).Project([]LogicalExpr{
+		NewCol("state"), NewAlias(NewCol("id"), "other_id"), NewAlias(NewCast(NewCol("salary"), datatypes.Int64Type), "other_salary"),
+	})
+	// the colleagues of the same state earning more
+	df := employee.JoinWithFilter(other, InnerJoin, [][]string{{"state", "state"}}, NewLt(NewCol("salary"), NewCol("other_salary")))
+	plan, err := NewPhysicalPlan(df.LogicalPlan())
+	require.NoError(t, err)
+	require.Equal(t, "HashJoinExec: type=Inner, on=[#1=#0], filter=#2 < #5", plan.String())
+	require.Equal(t, "2,CO,10000,3,11500\n", collect(t, plan))
+}
+
+func TestJoinPlan_errors(t *testing.T) {
+	employee := csvDataFrame(t).Project([]LogicalExpr{NewCol("id"), NewCol("state")})
+	other := csvDataFrame(t).Project([]LogicalExpr{NewAlias(NewCol("id"), "other_id")})
+	testCases := []struct {
+		df  DataFrame
+		err string
+	}{
+		{
+			employee.JoinWithFilter(other, CrossJoin, [][]string{{"id", "other_id"}}, nil),
+			"Cross join doesn't take a join condition, got on=[[id other_id]], filter=<nil>",
+		},
+		{
+			employee.JoinWithFilter(other, InnerJoin, nil, NewCol("other_id")),
+			"Join filter #other_id expects a boolean predicate, got utf8",
+		},
+	}
+	for _, tc := range testCases {
+		_, err := NewPhysicalPlan(tc.df.LogicalPlan())
+		var planErr *datatypes.PlanError
+		require.True(t, errors.As(err, &planErr), tc.err)
+		require.Equal(t, tc.err, err.Error())
+	}
+}
+
+func TestSetOperationsPlan(t *testing.T) {
+	// the sides are widened to int64
+	ids := csvDataFrame(t).Project([]LogicalExpr{NewCast(NewCol("id"), datatypes.Int8Type)})
+	df := ids.Union(csvDataFrame(t).Project([]LogicalExpr{NewCast(NewCol("id"), datatypes.Int64Type)}), false)
+	optimizedPlan, err := optimizer.NewOptimizer().Optimize(df.LogicalPlan())
+	require.NoError(t, err)
+	plan, err := NewPhysicalPlan(optimizedPlan)
+	require.NoError(t, err)
+	expect := `
+HashDistinctExec
+	UnionExec: inputs=2
+		ProjectionExec: [CAST(#0 AS int64)]
+			ProjectionExec: [CAST(#0 AS int8)]
+				ScanExec: schema={[{id utf8}]}, projection=[id]
+		ProjectionExec: [CAST(#0 AS int64)]
+			ScanExec: schema={[{id utf8}]}, projection=[id]
+`
+	require.Equal(t, expect, physicalplan.PrettyFormat(plan))
+	require.Equal(t, "1\n2\n3\n4\n", collect(t, plan))
+
+	states := csvDataFrame(t).Project([]LogicalExpr{NewCol("state")})
+	managers := csvDataFrame(t).
+		Filter(NewEq(NewCol("job_title"), NewLiteralString("Manager"))).
+		Project([]LogicalExpr{NewCol("state")})
+	for _, test := range []struct {
+		df     DataFrame
+		expect string
+	}{
+		{states.Union(managers, true), "CA\nCO\nCO\n\nCA\n"},
+		{states.Union(managers, false), "CA\nCO\n\n"},
+		{states.Intersect(managers), "CA\n"},
+		{states.Except(managers), "CO\n\n"},
+		{states.Distinct(), "CA\nCO\n\n"},
+	} {
+		plan, err := NewPhysicalPlan(test.df.LogicalPlan())
+		require.NoError(t, err)
+		require.Equal(t, test.expect, collect(t, plan), PrettyFormat(test.df.LogicalPlan()))
+	}
+
+	plan, err = NewPhysicalPlan(states.Except(managers).LogicalPlan())
+	require.NoError(t, err)
+	expect = `
+HashSetOpExec: op=Except
+	ProjectionExec: [#3]
+		ScanExec: schema={[{id utf8} {first_name utf8} {last_name utf8} {state utf8} {job_title utf8} {salary utf8}]}, projection=[]
+	ProjectionExec: [#3]
+		Selection: #4 = 'Manager'
+			ScanExec: schema={[{id utf8} {first_name utf8} {last_name utf8} {state utf8} {job_title utf8} {salary utf8}]}, projection=[]
+`
+	require.Equal(t, expect, physicalplan.PrettyFormat(plan))
+}
+
+func TestSetOperationsPlan_errors(t *testing.T) {
+	states := csvDataFrame(t).Project([]LogicalExpr{NewCol("state")})
+	ids := csvDataFrame(t).Project([]LogicalExpr{NewCast(NewCol("id"), datatypes.Int64Type)})
+	for _, test := range []struct {
+		df     DataFrame
+		expect string
+	}{
+		{states.Union(ids, true), "Union can't combine column state of type utf8 with id of type int64"},
+		{states.Intersect(csvDataFrame(t)), "Intersect expects the same number of columns on both sides, got 1 and 6"},
+		{ids.Except(states), "Except can't combine column id of type int64 with state of type utf8"},
+	} {
+		_, err := NewPhysicalPlan(test.df.LogicalPlan())
+		var schemaErr *datatypes.SchemaError
+		require.True(t, errors.As(err, &schemaErr))
+		require.Equal(t, test.expect, err.Error())
+	}
+}
+
+func TestSortPlan(t *testing.T) {
+	df := csvDataFrame(t).
+		Sort([]SortExpr{NewDesc(NewCol("salary")), NewAsc(NewCol("id"))}).
+		Project([]LogicalExpr{NewCol("first_name")})
+
+	optimizedPlan, err := optimizer.NewOptimizer().Optimize(df.LogicalPlan())
+	require.NoError(t, err)
+	expect := `
+Projection: #first_name
+	Sort: #salary DESC NULLS FIRST, #id ASC NULLS LAST
+		Scan: employee; projection=[first_name salary id]
+`
+	require.Equal(t, expect, PrettyFormat(optimizedPlan))
+
+	plan, err := NewPhysicalPlanWithConfig(optimizedPlan, Config{BatchSize: 3})
+	require.NoError(t, err)
+	expect = `
+ProjectionExec: [#0]
+	SortExec: [#1 DESC NULLS FIRST, #2 ASC NULLS LAST]
+		ScanExec: schema={[{first_name utf8} {salary utf8} {id utf8}]}, projection=[first_name salary id]
+`
+	require.Equal(t, expect, physicalplan.PrettyFormat(plan))
+
+	batches := collectBatches(t, plan)
+	require.Len(t, batches, 2)
+	require.Equal(t, "Bill\nJohn\nVon\n", batches[0].ToCSV())
+	require.Equal(t, "Gregg\n", batches[1].ToCSV())
+}
+
+func TestPhysicalPlan_errors(t *testing.T) {
+	df := csvDataFrame(t).Aggregate([]LogicalExpr{NewCol("state")}, []AggregateExpr{{Name: "FIRST", Expr: NewCol("salary")}})
+	_, err := NewPhysicalPlan(df.LogicalPlan())
+	var planErr *datatypes.PlanError
+	require.True(t, errors.As(err, &planErr))
+	require.Equal(t, "Unsupported aggregate function: FIRST", err.Error())
+
+	df = csvDataFrame(t).Aggregate([]LogicalExpr{}, []AggregateExpr{NewApproxPercentile(NewCol("salary"), NewCol("id"))})
+	_, err = NewPhysicalPlan(df.LogicalPlan())
+	require.True(t, errors.As(err, &planErr))
+	require.Equal(t, "APPROX_PERCENTILE expects a literal percentile between 0 and 1, got #id", err.Error())
+
+	df = csvDataFrame(t).Aggregate([]LogicalExpr{}, []AggregateExpr{NewStringAgg(NewCol("state"), NewCol("id"))})
+	_, err = NewPhysicalPlan(df.LogicalPlan())
+	require.True(t, errors.As(err, &planErr))
+	require.Equal(t, "STRING_AGG expects a literal string separator, got #id", err.Error())
+
+	df = csvDataFrame(t).Aggregate([]LogicalExpr{}, []AggregateExpr{NewMax(NewCol("salary")).WithFilter(NewCol("state"))})
+	_, err = NewPhysicalPlan(df.LogicalPlan())
+	require.True(t, errors.As(err, &planErr))
+	require.Equal(t, "FILTER of MAX expects a boolean predicate, got utf8", err.Error())
+
+	_, err = NewPhysicalExpr(NewCol("age"), csvDataFrame(t).LogicalPlan())
+	var schemaErr *datatypes.SchemaError
+	require.True(t, errors.As(err, &schemaErr))
+	require.Equal(t, "No column named: age", err.Error())
+}
+
+// numbersDataFrame reads a csv file of 30 rows with id and name columns, split into partitions of 100 bytes
+func numbersDataFrame(t *testing.T) DataFrame {
+	filename := t.TempDir() + "/numbers.csv"
+	content := "id,name\n"
+	for i := 0; i < 30; i++ {
+		content += fmt.Sprintf("%d,name-%d\n", i, i)
+	}
+	require.NoError(t, os.WriteFile(filename, []byte(content), 0644))
+	csv, err := datasource.NewCsvDataSourceWithOptions(filename, 1024, datasource.CsvOptions{MinPartitionBytes: 100})
+	require.NoError(t, err)
+	return NewDefaultDataFrame(NewScan("numbers", csv, []string{}))
+}
+
+func TestNewPhysicalExpr_operand_coercion(t *testing.T) {
+	count := csvDataFrame(t).Aggregate(nil, []AggregateExpr{NewCount(NewCol("id"))}).
+		Project([]LogicalExpr{NewCol("COUNT(#id)"), NewAlias(NewCast(NewCol("COUNT(#id)"), datatypes.Int8Type), "tiny")}).
+		LogicalPlan()
+	countCol, tinyCol := NewCol("COUNT(#id)"), NewCol("tiny")
+	testCases := []struct {
+		expr   LogicalExpr
+		expect string
+	}{
+		// a literal takes the type of the other operand when it fits
+		{NewGt(countCol, NewLiteralLong(1)), "#0 > 1"},
+		{NewLtEq(NewLiteralDouble(2), countCol), "2 <= #0"},
+		{NewEq(tinyCol, NewLiteralLong(3)), "#1 = 3"},
+		// otherwise the operands are cast to their widened type
+		{NewGt(countCol, NewLiteralLong(-1)), "CAST(#0 AS int64) > -1"},
+		{NewGt(tinyCol, NewLiteralLong(1000)), "CAST(#1 AS int64) > 1000"},
+		{NewLt(countCol, NewLiteralDouble(1.5)), "CAST(#0 AS float64) < 1.5"},
+		{NewNeq(countCol, tinyCol), "CAST(#0 AS int64) != CAST(#1 AS int64)"},
+		// the operands of the other types are compared as they are
+		{NewEq(NewCast(countCol, datatypes.StringType), NewLiteralString("1")), "CAST(#0 AS utf8) = '1'"},
+		// the operands of arithmetic are coerced the same way
+		{NewAdd(countCol, NewLiteralLong(1)), "#0 + 1"},
+		{NewMultiply(tinyCol, NewLiteralDouble(1.5)), "CAST(#1 AS float64) * 1.5"},
+		{NewSubtract(countCol, tinyCol), "CAST(#0 AS int64) - CAST(#1 AS int64)"},
+	}
+	for _, tc := range testCases {
+		expr, err := NewPhysicalExpr(tc.expr, count)
+		require.NoError(t, err)
+		require.Equal(t, tc.expect, fmt.Sprint(expr))
+	}
+
+	// the coerced comparison is evaluated
+	plan, err := NewPhysicalPlan(NewSelection(count, NewGt(countCol, NewLiteralLong(1))))
+	require.NoError(t, err)
+	require.Equal(t, "4,4\n", collect(t, plan))
+
+	// the arithmetic has the type of its coerced operands
+	projection := NewProjection(count, []LogicalExpr{NewAdd(countCol, NewLiteralLong(1)), NewMultiply(tinyCol, NewLiteralDouble(1.5))})
+	require.Equal(t, datatypes.UInt64Type, projection.Schema().Fields[0].DataType)
+	require.Equal(t, datatypes.DoubleType, projection.Schema().Fields[1].DataType)
+	plan, err = NewPhysicalPlan(projection)
+	require.NoError(t, err)
+	require.Equal(t, "5,6\n", collect(t, plan))
+}
+
+func TestPartitionedPlan(t *testing.T) {
+	df := numbersDataFrame(t).
+		Filter(NewNeq(NewCol("name"), NewLiteralString("name-3"))).
+		Project([]LogicalExpr{NewCol("id")}).
+		Sort([]SortExpr{NewDesc(NewCast(NewCol("id"), datatypes.Int64Type))}).
+		Limit(2)
+	optimizedPlan, err := optimizer.NewOptimizer().Optimize(df.LogicalPlan())
+	require.NoError(t, err)
+	config := DefaultConfig()
+	config.TargetPartitions = 2
+	plan, err := NewPhysicalPlanWithConfig(optimizedPlan, config)
+	require.NoError(t, err)
+
+	// the partitions of the scan, selection and projection are merged before the sort
+	expect := `
+LimitExec: limit=2, offset=0
+	SortExec: [CAST(#0 AS int64) DESC NULLS FIRST]
+		CoalesceExec: partitions=2
+			ProjectionExec: [#0]
+				Selection: #1 != 'name-3'
+					ScanExec: schema={[{id utf8} {name utf8}]}, projection=[id name]
+			ProjectionExec: [#0]
+				Selection: #1 != 'name-3'
+					ScanExec: schema={[{id utf8} {name utf8}]}, projection=[id name]
+`
+	require.Equal(t, expect, physicalplan.PrettyFormat(plan))
+	require.Equal(t, physicalplan.UnknownPartitioning(2), plan.Children()[0].Children()[0].Children()[0].OutputPartitioning())
+	require.Equal(t, "29\n28\n", collect(t, plan))
+}
+
+func TestPartitionedAggregatePlan(t *testing.T) {
+	id := NewCast(NewCol("id"), datatypes.Int64Type)
+	df := numbersDataFrame(t).
+		Aggregate([]LogicalExpr{NewCol("name")}, []AggregateExpr{NewSum(id)}).
+		Aggregate([]LogicalExpr{}, []AggregateExpr{NewMax(NewCol("SUM(CAST(#id AS int64))"))})
+	optimizedPlan, err := optimizer.NewOptimizer().Optimize(df.LogicalPlan())
+	require.NoError(t, err)
+	config := DefaultConfig()
+	config.TargetPartitions = 2
+	plan, err := NewPhysicalPlanWithConfig(optimizedPlan, config)
+	require.NoError(t, err)
+
+	// the partial states of every partition are repartitioned by the group keys, then merged
+	expect := `
+HashAggregateExec: mode=final, groupExpr=[], aggExpr=[MAX(#1)]
+	CoalesceExec: partitions=2
+		HashAggregateExec: mode=partial, groupExpr=[], aggExpr=[MAX(#1)]
+			HashAggregateExec: mode=final, groupExpr=[#0], aggExpr=[SUM(CAST(#1 AS int64))]
+				RepartitionExec: partitioning=Hash([#0], 2), partition=0
+					HashAggregateExec: mode=partial, groupExpr=[#0], aggExpr=[SUM(CAST(#1 AS int64))]
+						ScanExec: schema={[{name utf8} {id utf8}]}, projection=[name id]
+					HashAggregateExec: mode=partial, groupExpr=[#0], aggExpr=[SUM(CAST(#1 AS int64))]
+						ScanExec: schema={[{name utf8} {id utf8}]}, projection=[name id]
+		HashAggregateExec: mode=partial, groupExpr=[], aggExpr=[MAX(#1)]
+			HashAggregateExec: mode=final, groupExpr=[#0], aggExpr=[SUM(CAST(#1 AS int64))]
+				RepartitionExec: partitioning=Hash([#0], 2), partition=1
+					HashAggregateExec: mode=partial, groupExpr=[#0], aggExpr=[SUM(CAST(#1 AS int64))]
+						ScanExec: schema={[{name utf8} {id utf8}]}, projection=[name id]
+					HashAggregateExec: mode=partial, groupExpr=[#0], aggExpr=[SUM(CAST(#1 AS int64))]
+						ScanExec: schema={[{name utf8} {id utf8}]}, projection=[name id]
+`
+	require.Equal(t, expect, physicalplan.PrettyFormat(plan))
+
+	require.True(t, plan.Next(context.Background()))
+	result, err := plan.Execute(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "29\n", result.ToCSV())
+	require.False(t, plan.Next(context.Background()))
+}
+
+func TestPartitionedDistinctPlan(t *testing.T) {
+	tens := NewAlias(NewDivide(NewCast(NewCol("id"), datatypes.Int64Type), NewLiteralLong(10)), "tens")
+	df := numbersDataFrame(t).
+		Project([]LogicalExpr{tens}).
+		Distinct().
+		Sort([]SortExpr{NewAsc(NewCol("tens"))})
+	optimizedPlan, err := optimizer.NewOptimizer().Optimize(df.LogicalPlan())
+	require.NoError(t, err)
+	config := DefaultConfig()
+	config.TargetPartitions = 2
+	plan, err := NewPhysicalPlanWithConfig(optimizedPlan, config)
+	require.NoError(t, err)
+
+	// the rows are repartitioned by all the columns, so that the duplicates are removed in parallel
+	expect := `
+SortExec: [#0 ASC NULLS LAST]
+	CoalesceExec: partitions=2
+		HashDistinctExec
+			RepartitionExec: partitioning=Hash([#0], 2), partition=0
+				ProjectionExec: [CAST(#0 AS int64) / 10]
+					ScanExec: schema={[{id utf8}]}, projection=[id]
+				ProjectionExec: [CAST(#0 AS int64) / 10]
+					ScanExec: schema={[{id utf8}]}, projection=[id]
+		HashDistinctExec
+			RepartitionExec: partitioning=Hash([#0], 2), partition=1
+				ProjectionExec: [CAST(#0 AS int64) / 10]
+					ScanExec: schema={[{id utf8}]}, projection=[id]
+				ProjectionExec: [CAST(#0 AS int64) / 10]
+					ScanExec: schema={[{id utf8}]}, projection=[id]
+`
+	require.Equal(t, expect, physicalplan.PrettyFormat(plan))
+	require.Equal(t, "0\n1\n2\n", collect(t, plan))
+}
+
+func TestSortAggregatePlan(t *testing.T) {
+	df := csvDataFrame(t).
+		Sort([]SortExpr{NewAsc(NewCol("state"))}).
+		Aggregate([]LogicalExpr{NewCol("state")}, []AggregateExpr{NewMax(NewCast(NewCol("salary"), datatypes.Int64Type))})
+	plan, err := NewPhysicalPlan(df.LogicalPlan())
+	require.NoError(t, err)
+
+	// the sort groups the rows of every state together
+	expect := `
+SortAggregateExec: groupExpr=[#3], aggExpr=[MAX(CAST(#5 AS int64))]
+	SortExec: [#3 ASC NULLS LAST]
+		ScanExec: schema={[{id utf8} {first_name utf8} {last_name utf8} {state utf8} {job_title utf8} {salary utf8}]}, projection=[]
+`
+	require.Equal(t, expect, physicalplan.PrettyFormat(plan))
+	require.Equal(t, ",11500\nCA,12000\nCO,11500\n", collect(t, plan))
+}
+
+func TestPartitionedSortAggregatePlan(t *testing.T) {
+	filename := t.TempDir() + "/buckets.csv"
+	content := "bucket,id\n"
+	for i := 0; i < 30; i++ {
+		content += fmt.Sprintf("b%d,%d\n", i/10, i)
+	}
+	require.NoError(t, os.WriteFile(filename, []byte(content), 0644))
+	csv, err := datasource.NewCsvDataSourceWithOptions(filename, 4,
+		datasource.CsvOptions{MinPartitionBytes: 50, SortedBy: []string{"bucket"}})
+	require.NoError(t, err)
+	df := NewDefaultDataFrame(NewScan("buckets", csv, []string{})).
+		Aggregate([]LogicalExpr{NewCol("bucket")}, []AggregateExpr{NewSum(NewCast(NewCol("id"), datatypes.Int64Type))})
+	optimizedPlan, err := optimizer.NewOptimizer().Optimize(df.LogicalPlan())
+	require.NoError(t, err)
+	config := DefaultConfig()
+	config.TargetPartitions = 2
+	plan, err := NewPhysicalPlanWithConfig(optimizedPlan, config)
+	require.NoError(t, err)
+
+	// every partition of the file is sorted, the partial states are merged by hash
+	expect := `
+CoalesceExec: partitions=2
+	HashAggregateExec: mode=final, groupExpr=[#0], aggExpr=[SUM(CAST(#1 AS int64))]
+		RepartitionExec: partitioning=Hash([#0], 2), partition=0
+			SortAggregateExec: mode=partial, groupExpr=[#0], aggExpr=[SUM(CAST(#1 AS int64))]
+				ScanExec: schema={[{bucket utf8} {id utf8}]}, projection=[bucket id]
+			SortAggregateExec: mode=partial, groupExpr=[#0], aggExpr=[SUM(CAST(#1 AS int64))]
+				ScanExec: schema={[{bucket utf8} {id utf8}]}, projection=[bucket id]
+	HashAggregateExec: mode=final, groupExpr=[#0], aggExpr=[SUM(CAST(#1 AS int64))]
+		RepartitionExec: partitioning=Hash([#0], 2), partition=1
+			SortAggregateExec: mode=partial, groupExpr=[#0], aggExpr=[SUM(CAST(#1 AS int64))]
+				ScanExec: schema={[{bucket utf8} {id utf8}]}, projection=[bucket id]
+			SortAggregateExec: mode=partial, groupExpr=[#0], aggExpr=[SUM(CAST(#1 AS int64))]
+				ScanExec: schema={[{bucket utf8} {id utf8}]}, projection=[bucket id]
+`
+	require.Equal(t, expect, physicalplan.PrettyFormat(plan))
+	result := collect(t, plan)
+	rows := strings.Split(strings.TrimSuffix(result, "\n"), "\n")
+	sort.Strings(rows)
+	require.Equal(t, []string{"b0,45", "b1,145", "b2,245"}, rows)
+}
+
+func TestWindowPlan(t *testing.T) {
+	id := NewCast(NewCol("id"), datatypes.Int64Type)
+	byName := []LogicalExpr{NewCol("name")}
+	running := NewWindowFrame(RowsFrame, FrameBound{Type: Preceding, Offset: 1}, FrameBound{Type: CurrentRow})
+	df := numbersDataFrame(t).Window([]WindowExpr{
+		NewRowNumber().Over(byName, nil, nil),
+		NewWindowAggregate(NewSum(id)).Over(nil, []SortExpr{NewAsc(id)}, running),
+		NewLag(NewCol("id"), 1, NewLiteralString("none")).Over(byName, nil, nil),
+	})
+	optimizedPlan, err := optimizer.NewOptimizer().Optimize(df.LogicalPlan())
+	require.NoError(t, err)
+	config := DefaultConfig()
+	config.TargetPartitions = 2
+	plan, err := NewPhysicalPlanWithConfig(optimizedPlan, config)
+	require.NoError(t, err)
+
+	// the partitions of the window with partition keys are evaluated in parallel, the other window is
+	// evaluated by a single partition, then the window values are put back in the order of the window exprs
+	expect := `
+ProjectionExec: [#0 #1 #2 #4 #3]
+	WindowExec: partitionBy=[], orderBy=[CAST(#0 AS int64) ASC NULLS LAST], windowExpr=[SUM(CAST(#0 AS int64)) ROWS BETWEEN 1 PRECEDING AND CURRENT ROW]
+		SortExec: [CAST(#0 AS int64) ASC NULLS LAST]
+			CoalesceExec: partitions=2
+				WindowExec: partitionBy=[#1], orderBy=[], windowExpr=[ROW_NUMBER() LAG(#0, 1, none)]
+					SortExec: [#1 ASC NULLS LAST]
+						RepartitionExec: partitioning=Hash([#1], 2), partition=0
+							ScanExec: schema={[{id utf8} {name utf8}]}, projection=[id name]
+							ScanExec: schema={[{id utf8} {name utf8}]}, projection=[id name]
+				WindowExec: partitionBy=[#1], orderBy=[], windowExpr=[ROW_NUMBER() LAG(#0, 1, none)]
+					SortExec: [#1 ASC NULLS LAST]
+						RepartitionExec: partitioning=Hash([#1], 2), partition=1
+							ScanExec: schema={[{id utf8} {name utf8}]}, projection=[id name]
+							ScanExec: schema={[{id utf8} {name utf8}]}, projection=[id name]
+`
+	require.Equal(t, expect, physicalplan.PrettyFormat(plan))
+
+	expectRows := ""
+	for i := 0; i < 30; i++ {
+		sum := i
+		if i > 0 {
+			sum += i - 1
+		}
+		expectRows += fmt.Sprintf("%d,name-%d,1,%d,none\n", i, i, sum)
+	}
+	require.Equal(t, df.Schema(), plan.Schema())
+	require.Equal(t, expectRows, collect(t, plan))
+}
+
+func TestWindowPlan_errors(t *testing.T) {
+	salary := NewCast(NewCol("salary"), datatypes.Int64Type)
+	testCases := []struct {
+		expr WindowExpr
+		err  string
+	}{
+		{
+			WindowExpr{Name: "RANK", Args: []LogicalExpr{NewCol("id")}},
+			"window function RANK expects 0 arguments, got 1",
+		},
+		{
+			WindowExpr{Name: "LAG", Args: []LogicalExpr{NewCol("id"), NewCol("id")}},
+			"LAG expects a literal non negative offset, got #id",
+		},
+		{
+			NewLead(NewCol("id"), 1, NewLiteralLong(0)),
+			"LEAD default 0 of type int64 doesn't match the input type utf8",
+		},
+		{
+			NewWindowAggregate(NewSum(salary)).Over(nil, []SortExpr{NewAsc(NewCol("id"))},
+				NewWindowFrame(RangeFrame, FrameBound{Type: Preceding, Offset: 1}, FrameBound{Type: CurrentRow})),
+			"RANGE offsets require a single numeric ORDER BY key: SUM(CAST(#salary AS int64)) OVER (ORDER BY #id ASC NULLS LAST RANGE BETWEEN 1 PRECEDING AND CURRENT ROW)",
+		},
+		{
+			NewWindowAggregate(NewSum(salary)).Over(nil, nil,
+				NewWindowFrame(RowsFrame, FrameBound{Type: CurrentRow}, FrameBound{Type: Preceding, Offset: 1})),
+			"Invalid window frame: ROWS BETWEEN CURRENT ROW AND 1 PRECEDING",
+		},
+		{
+			WindowExpr{Name: "FIRST", Args: []LogicalExpr{NewCol("id")}},
+			"Unsupported aggregate function: FIRST",
+		},
+	}
+	for _, tc := range testCases {
+		df := csvDataFrame(t).Window([]WindowExpr{tc.expr})
+		_, err := NewPhysicalPlan(df.LogicalPlan())
+		var planErr *datatypes.PlanError
+		require.True(t, errors.As(err, &planErr), tc.err)
+		require.Equal(t, tc.err, err.Error())
+	}
+}
@@ -0,0 +1,287 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Expr is a node of the SQL abstract syntax tree produced by the Parser.
+type Expr interface {
+	String() string
+}
+
+// Identifier a column or table name
+type Identifier struct {
+	Name string
+}
+
+func (i Identifier) String() string {
+	return i.Name
+}
+
+// Star the `*` in `SELECT *`
+type Star struct{}
+
+func (s Star) String() string {
+	return "*"
+}
+
+type LongLiteral struct {
+	Value int64
+}
+
+func (l LongLiteral) String() string {
+	return fmt.Sprintf("%d", l.Value)
+}
+
+type DoubleLiteral struct {
+	Value float64
+}
+
+func (d DoubleLiteral) String() string {
+	return fmt.Sprintf("%g", d.Value)
+}
+
+type StringLiteral struct {
+	Value string
+}
+
+func (s StringLiteral) String() string {
+	return fmt.Sprintf("'%s'", s.Value)
+}
+
+// BinaryExpr covers comparison, boolean and math operators, Op is the upper-cased operator text.
+type BinaryExpr struct {
+	L  Expr
+	Op string
+	R  Expr
+}
+
+func (b BinaryExpr) String() string {
+	return fmt.Sprintf("%s %s %s", b.L, b.Op, b.R)
+}
+
+type Alias struct {
+	Expr  Expr
+	Alias string
+}
+
+func (a Alias) String() string {
+	return fmt.Sprintf("%s AS %s", a.Expr, a.Alias)
+}
+
+type Cast struct {
+	Expr     Expr
+	DataType string
+}
+
+func (c Cast) String() string {
+	return fmt.Sprintf("CAST(%s AS %s)", c.Expr, c.DataType)
+}
+
+// Function a function call, like aggregate MAX(salary), Distinct is set by COUNT(DISTINCT salary),
+// Over is set by a window function call like RANK() OVER (ORDER BY salary)
+// Function a function call, the optional Filter is the predicate of `FILTER (WHERE ...)` of an aggregate
+type Function struct {
+	Name     string
+	Args     []Expr
+	Distinct bool
+	Filter   Expr
+	Over     *WindowSpec
+}
+
+func (f Function) String() string {
+	str := fmt.Sprintf("%s(%s)", f.Name, joinExprs(f.Args))
+	if f.Distinct {
+		str = fmt.Sprintf("%s(DISTINCT %s)", f.Name, joinExprs(f.Args))
+	}
+	if f.Filter != nil {
+		str += fmt.Sprintf(" FILTER (WHERE %s)", f.Filter)
+	}
+	if f.Over != nil {
+		str += fmt.Sprintf(" OVER (%s)", f.Over)
+	}
+	return str
+}
+
+// WindowSpec the `PARTITION BY ... ORDER BY ... frame` of the OVER clause, all the parts are optional
+type WindowSpec struct {
+	PartitionBy []Expr
+	OrderBy     []SortExpr
+	Frame       *WindowFrame
+}
+
+func (w WindowSpec) String() string {
+	parts := make([]string, 0)
+	if len(w.PartitionBy) > 0 {
+		parts = append(parts, "PARTITION BY "+joinExprs(w.PartitionBy))
+	}
+	if len(w.OrderBy) > 0 {
+		orderBy := make([]Expr, len(w.OrderBy))
+		for i, expr := range w.OrderBy {
+			orderBy[i] = expr
+		}
+		parts = append(parts, "ORDER BY "+joinExprs(orderBy))
+	}
+	if w.Frame != nil {
+		parts = append(parts, w.Frame.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+// WindowFrame `ROWS | RANGE BETWEEN start AND end`, the parser sets End to CURRENT ROW when only the start is given
+type WindowFrame struct {
+	// Units is ROWS or RANGE
+	Units string
+	Start FrameBound
+	End   FrameBound
+}
+
+func (w WindowFrame) String() string {
+	return fmt.Sprintf("%s BETWEEN %s AND %s", w.Units, w.Start, w.End)
+}
+
+// FrameBound a bound of a window frame, Kind is one of UNBOUNDED PRECEDING, PRECEDING, CURRENT ROW,
+// FOLLOWING and UNBOUNDED FOLLOWING, Offset is the n of n PRECEDING and n FOLLOWING
+type FrameBound struct {
+	Kind   string
+	Offset int64
+}
+
+func (f FrameBound) String() string {
+	if f.Kind == "PRECEDING" || f.Kind == "FOLLOWING" {
+		return fmt.Sprintf("%d %s", f.Offset, f.Kind)
+	}
+	return f.Kind
+}
+
+// SortExpr an item of the ORDER BY clause, the parser resolves the default null ordering:
+// nulls are sorted as larger than any value, so last when ascending and first when descending.
+type SortExpr struct {
+	Expr       Expr
+	Asc        bool
+	NullsFirst bool
+}
+
+func (s SortExpr) String() string {
+	direction, nulls := "ASC", "NULLS LAST"
+	if !s.Asc {
+		direction = "DESC"
+	}
+	if s.NullsFirst {
+		nulls = "NULLS FIRST"
+	}
+	return fmt.Sprintf("%s %s %s", s.Expr, direction, nulls)
+}
+
+// GroupingSets `GROUPING SETS ((a, b), (a), ())` in the GROUP BY clause, a set of a single expr may omit the parentheses
+type GroupingSets struct {
+	Sets [][]Expr
+}
+
+func (g GroupingSets) String() string {
+	sets := make([]string, len(g.Sets))
+	for i, set := range g.Sets {
+		sets[i] = "(" + joinExprs(set) + ")"
+	}
+	return fmt.Sprintf("GROUPING SETS (%s)", strings.Join(sets, ", "))
+}
+
+// Rollup `ROLLUP(a, b)` in the GROUP BY clause, the grouping sets (a, b), (a) and ()
+type Rollup struct {
+	Exprs []Expr
+}
+
+func (r Rollup) String() string {
+	return fmt.Sprintf("ROLLUP(%s)", joinExprs(r.Exprs))
+}
+
+// Cube `CUBE(a, b)` in the GROUP BY clause, the grouping sets of every subset of the exprs
+type Cube struct {
+	Exprs []Expr
+}
+
+func (c Cube) String() string {
+	return fmt.Sprintf("CUBE(%s)", joinExprs(c.Exprs))
+}
+
+// Select a SELECT statement, the optional Selection (WHERE clause), Having, Limit and Offset may be nil.
+// Distinct removes the duplicate rows of SELECT DISTINCT.
+// The GroupBy items are exprs, GroupingSets, Rollup or Cube.
+type Select struct {
+	Distinct   bool
+	Projection []Expr
+	Table      string
+	Selection  Expr
+	GroupBy    []Expr
+	Having     Expr
+	OrderBy    []SortExpr
+	Limit      Expr
+	Offset     Expr
+}
+
+func (s Select) String() string {
+	str := "SELECT "
+	if s.Distinct {
+		str += "DISTINCT "
+	}
+	str += fmt.Sprintf("%s FROM %s", joinExprs(s.Projection), s.Table)
+	if s.Selection != nil {
+		str += fmt.Sprintf(" WHERE %s", s.Selection)
+	}
+	if len(s.GroupBy) > 0 {
+		str += fmt.Sprintf(" GROUP BY %s", joinExprs(s.GroupBy))
+	}
+	if s.Having != nil {
+		str += fmt.Sprintf(" HAVING %s", s.Having)
+	}
+	return str + tailString(s.OrderBy, s.Limit, s.Offset)
+}
+
+// SetOperation combines the rows of two queries by a UNION, INTERSECT or EXCEPT Op, All keeps the duplicate rows.
+// Left and Right are a Select or a SetOperation. The OrderBy, Limit and Offset written after the last SELECT
+// apply to the combined rows.
+type SetOperation struct {
+	Op      string
+	All     bool
+	Left    Expr
+	Right   Expr
+	OrderBy []SortExpr
+	Limit   Expr
+	Offset  Expr
+}
+
+func (s SetOperation) String() string {
+	op := s.Op
+	if s.All {
+		op += " ALL"
+	}
+	return fmt.Sprintf("%s %s %s", s.Left, op, s.Right) + tailString(s.OrderBy, s.Limit, s.Offset)
+}
+
+// tailString returns the ORDER BY, LIMIT and OFFSET clauses
+func tailString(sortExprs []SortExpr, limit Expr, offset Expr) string {
+	str := ""
+	if len(sortExprs) > 0 {
+		orderBy := make([]Expr, len(sortExprs))
+		for i, expr := range sortExprs {
+			orderBy[i] = expr
+		}
+		str += fmt.Sprintf(" ORDER BY %s", joinExprs(orderBy))
+	}
+	if limit != nil {
+		str += fmt.Sprintf(" LIMIT %s", limit)
+	}
+	if offset != nil {
+		str += fmt.Sprintf(" OFFSET %s", offset)
+	}
+	return str
+}
+
+func joinExprs(exprs []Expr) string {
+	strList := make([]string, len(exprs))
+	for i, expr := range exprs {
+		strList[i] = expr.String()
+	}
+	return strings.Join(strList, ", ")
+}
@@ -0,0 +1,717 @@
+package sql
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Parser is a Pratt (top down operator precedence) parser turning a TokenStream into an Expr tree.
+// see: https://tdop.github.io/
+//
+// The grammar is a subset of SQL. A SELECT reads a single table, whose name may qualify its columns, like employee.id.
+// `expr [NOT] BETWEEN low AND high` is parsed as the comparisons `expr >= low AND expr <= high`, and NOT is pushed
+// down into its operand, so that it only applies to comparisons, AND, OR and BETWEEN.
+// IS [NOT] NULL, joins, subqueries and table aliases are not supported.
+type Parser struct {
+	tokens *TokenStream
+	// qualifiers are the tables of the qualified columns, checked once the FROM table of their SELECT is parsed
+	qualifiers []Token
+}
+
+func NewParser(tokens *TokenStream) *Parser {
+	return &Parser{tokens: tokens}
+}
+
+// Parse the whole token stream, the result is usually a Select, or a SetOperation of several ones.
+func (p *Parser) Parse() (Expr, error) {
+	expr, err := p.parse(0)
+	if err != nil {
+		return nil, err
+	}
+	if stmt, ok := expr.(Select); ok {
+		if expr, err = p.parseSetOperation(stmt); err != nil {
+			return nil, err
+		}
+	}
+	p.tokens.consumeSymbol(";")
+	if token, ok := p.tokens.Peek(); ok {
+		return nil, p.unexpected(token)
+	}
+	return expr, nil
+}
+
+func (p *Parser) parse(precedence int) (Expr, error) {
+	expr, err := p.parsePrefix()
+	if err != nil {
+		return nil, err
+	}
+	for precedence < p.nextPrecedence() {
+		expr, err = p.parseInfix(expr, p.nextPrecedence())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return expr, nil
+}
+
+// nextPrecedence returns the binding power of the next token, 0 stops the current expression.
+func (p *Parser) nextPrecedence() int {
+	token, ok := p.tokens.Peek()
+	if !ok {
+		return 0
+	}
+	switch token.Type {
+	case KeywordToken:
+		switch token.Text {
+		case "AS":
+			return 10
+		case "OR":
+			return 20
+		case "AND":
+			return 30
+		case "NOT", "BETWEEN", "IS":
+			return 40
+		}
+	case SymbolToken:
+		switch token.Text {
+		case "=", "!=", "<>", "<", "<=", ">", ">=":
+			return 40
+		case "+", "-":
+			return 50
+		case "*", "/", "%":
+			return 60
+		case "(":
+			return 70
+		}
+	}
+	return 0
+}
+
+func (p *Parser) parsePrefix() (Expr, error) {
+	token, ok := p.tokens.Next()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of query")
+	}
+	switch token.Type {
+	case KeywordToken:
+		switch token.Text {
+		case "SELECT":
+			return p.parseSelect()
+		case "CAST":
+			return p.parseCast()
+		case "GROUPING":
+			// the GROUPING function, GROUPING SETS is parsed by parseGroupBy
+			return Identifier{token.Text}, nil
+		case "NOT":
+			// NOT binds tighter than AND, and looser than the comparisons
+			expr, err := p.parse(35)
+			if err != nil {
+				return nil, err
+			}
+			return negate(expr, token)
+		}
+	case IdentifierToken:
+		if p.tokens.consumeSymbol(".") {
+			return p.parseQualified(token)
+		}
+		return Identifier{token.Text}, nil
+	case LongToken:
+		return p.parseLong(token.Text, token)
+	case DoubleToken:
+		return p.parseDouble(token.Text, token)
+	case StringToken:
+		return StringLiteral{token.Text}, nil
+	case SymbolToken:
+		switch token.Text {
+		case "*":
+			return Star{}, nil
+		case "(":
+			expr, err := p.parse(0)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectSymbol(")"); err != nil {
+				return nil, err
+			}
+			return expr, nil
+		case "-":
+			// negative numeric literal
+			next, ok := p.tokens.Next()
+			if ok && next.Type == LongToken {
+				return p.parseLong("-"+next.Text, next)
+			}
+			if ok && next.Type == DoubleToken {
+				return p.parseDouble("-"+next.Text, next)
+			}
+		}
+	}
+	return nil, p.unexpected(token)
+}
+
+func (p *Parser) parseInfix(left Expr, precedence int) (Expr, error) {
+	token, _ := p.tokens.Next()
+	switch token.Type {
+	case KeywordToken:
+		switch token.Text {
+		case "AND", "OR":
+			right, err := p.parse(precedence)
+			if err != nil {
+				return nil, err
+			}
+			return BinaryExpr{left, token.Text, right}, nil
+		case "AS":
+			alias, ok := p.tokens.Next()
+			if !ok || alias.Type != IdentifierToken {
+				return nil, fmt.Errorf("expected alias after AS at offset %d", token.Offset)
+			}
+			return Alias{left, alias.Text}, nil
+		case "BETWEEN":
+			return p.parseBetween(left)
+		case "NOT":
+			if !p.tokens.consumeKeyword("BETWEEN") {
+				return nil, p.expected("BETWEEN")
+			}
+			between, err := p.parseBetween(left)
+			if err != nil {
+				return nil, err
+			}
+			return negate(between, token)
+		case "IS":
+			return nil, fmt.Errorf("IS [NOT] NULL at offset %d is not supported", token.Offset)
+		}
+	case SymbolToken:
+		if token.Text == "(" {
+			return p.parseFunction(left, token)
+		}
+		right, err := p.parse(precedence)
+		if err != nil {
+			return nil, err
+		}
+		return BinaryExpr{left, token.Text, right}, nil
+	}
+	return nil, p.unexpected(token)
+}
+
+func (p *Parser) parseSelect() (Expr, error) {
+	qualifiers := len(p.qualifiers)
+	distinct := p.tokens.consumeKeyword("DISTINCT")
+	projection, err := p.parseExprList()
+	if err != nil {
+		return nil, err
+	}
+	if !p.tokens.consumeKeyword("FROM") {
+		return nil, p.expected("FROM")
+	}
+	table, ok := p.tokens.Next()
+	if !ok || table.Type != IdentifierToken {
+		return nil, p.expected("table name")
+	}
+
+	stmt := Select{Distinct: distinct, Projection: projection, Table: table.Text}
+	if p.tokens.consumeKeyword("WHERE") {
+		stmt.Selection, err = p.parse(0)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.tokens.consumeKeyword("GROUP") {
+		if !p.tokens.consumeKeyword("BY") {
+			return nil, p.expected("BY")
+		}
+		stmt.GroupBy, err = p.parseGroupBy()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.tokens.consumeKeyword("HAVING") {
+		stmt.Having, err = p.parse(0)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.tokens.consumeKeyword("ORDER") {
+		if !p.tokens.consumeKeyword("BY") {
+			return nil, p.expected("BY")
+		}
+		stmt.OrderBy, err = p.parseOrderBy()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.tokens.consumeKeyword("LIMIT") {
+		stmt.Limit, err = p.parse(0)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.tokens.consumeKeyword("OFFSET") {
+		stmt.Offset, err = p.parse(0)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, qualifier := range p.qualifiers[qualifiers:] {
+		if qualifier.Text != stmt.Table {
+			return nil, fmt.Errorf("unknown table %s at offset %d, a column can only be qualified by the FROM table %s",
+				qualifier.Text, qualifier.Offset, stmt.Table)
+		}
+	}
+	return stmt, nil
+}
+
+// parseSetOperation parses the UNION, INTERSECT and EXCEPT operations following the first SELECT, if any.
+// INTERSECT binds tighter than UNION and EXCEPT, which are left-associative. The ORDER BY, LIMIT and OFFSET
+// of the last SELECT are moved to the top SetOperation, the other SELECTs can't have them.
+func (p *Parser) parseSetOperation(first Select) (Expr, error) {
+	last := first
+	left, err := p.parseIntersect(withoutTail(first), &last)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		token, ok := p.tokens.Peek()
+		if !ok || token.Type != KeywordToken || (token.Text != "UNION" && token.Text != "EXCEPT") {
+			break
+		}
+		all, right, err := p.parseSetOperand(&last)
+		if err != nil {
+			return nil, err
+		}
+		if right, err = p.parseIntersect(right, &last); err != nil {
+			return nil, err
+		}
+		left = SetOperation{Op: token.Text, All: all, Left: left, Right: right}
+	}
+
+	set, ok := left.(SetOperation)
+	if !ok {
+		return first, nil
+	}
+	set.OrderBy, set.Limit, set.Offset = last.OrderBy, last.Limit, last.Offset
+	return set, nil
+}
+
+// parseIntersect parses the INTERSECT operations following left
+func (p *Parser) parseIntersect(left Expr, last *Select) (Expr, error) {
+	for {
+		token, ok := p.tokens.Peek()
+		if !ok || token.Type != KeywordToken || token.Text != "INTERSECT" {
+			return left, nil
+		}
+		all, right, err := p.parseSetOperand(last)
+		if err != nil {
+			return nil, err
+		}
+		left = SetOperation{Op: token.Text, All: all, Left: left, Right: right}
+	}
+}
+
+// parseSetOperand parses `operator [ALL] SELECT ...`, last is the previous SELECT, replaced by the parsed one.
+// The SELECT is returned without its ORDER BY, LIMIT and OFFSET, which are only allowed after the last one.
+func (p *Parser) parseSetOperand(last *Select) (bool, Expr, error) {
+	operator, _ := p.tokens.Next()
+	if len(last.OrderBy) > 0 || last.Limit != nil || last.Offset != nil {
+		return false, nil, fmt.Errorf(
+			"unexpected %s at offset %d, ORDER BY, LIMIT and OFFSET must follow the last SELECT", operator.Text, operator.Offset)
+	}
+	all := p.tokens.consumeKeyword("ALL")
+	if !p.tokens.consumeKeyword("SELECT") {
+		return false, nil, p.expected("SELECT")
+	}
+	stmt, err := p.parseSelect()
+	if err != nil {
+		return false, nil, err
+	}
+	*last = stmt.(Select)
+	return all, withoutTail(*last), nil
+}
+
+func withoutTail(stmt Select) Select {
+	stmt.OrderBy, stmt.Limit, stmt.Offset = nil, nil, nil
+	return stmt
+}
+
+// parseOrderBy parses `expr [ASC | DESC] [NULLS FIRST | NULLS LAST], ...`
+func (p *Parser) parseOrderBy() ([]SortExpr, error) {
+	sortExprs := make([]SortExpr, 0)
+	for {
+		expr, err := p.parse(0)
+		if err != nil {
+			return nil, err
+		}
+		sortExpr := SortExpr{Expr: expr, Asc: true}
+		if p.tokens.consumeKeyword("DESC") {
+			sortExpr.Asc = false
+		} else {
+			p.tokens.consumeKeyword("ASC")
+		}
+		sortExpr.NullsFirst = !sortExpr.Asc
+		if p.tokens.consumeKeyword("NULLS") {
+			switch {
+			case p.tokens.consumeKeyword("FIRST"):
+				sortExpr.NullsFirst = true
+			case p.tokens.consumeKeyword("LAST"):
+				sortExpr.NullsFirst = false
+			default:
+				return nil, p.expected("FIRST or LAST")
+			}
+		}
+		sortExprs = append(sortExprs, sortExpr)
+		if !p.tokens.consumeSymbol(",") {
+			return sortExprs, nil
+		}
+	}
+}
+
+// parseGroupBy parses the GROUP BY items: `expr`, `ROLLUP(exprs)`, `CUBE(exprs)` or `GROUPING SETS (sets)`
+func (p *Parser) parseGroupBy() ([]Expr, error) {
+	items := make([]Expr, 0)
+	for {
+		var item Expr
+		var err error
+		switch {
+		case p.tokens.consumeKeyword("ROLLUP"):
+			var exprs []Expr
+			exprs, err = p.parseGroupingSet()
+			item = Rollup{exprs}
+		case p.tokens.consumeKeyword("CUBE"):
+			var exprs []Expr
+			exprs, err = p.parseGroupingSet()
+			item = Cube{exprs}
+		case p.tokens.consumeKeyword("GROUPING"):
+			if !p.tokens.consumeKeyword("SETS") {
+				return nil, p.expected("SETS")
+			}
+			item, err = p.parseGroupingSets()
+		default:
+			item, err = p.parse(0)
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		if !p.tokens.consumeSymbol(",") {
+			return items, nil
+		}
+	}
+}
+
+// parseGroupingSets parses `(set, ...)` after GROUPING SETS, where a set is `(exprs)`, `()` or a single expr
+func (p *Parser) parseGroupingSets() (Expr, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	sets := make([][]Expr, 0)
+	for {
+		var set []Expr
+		var err error
+		if token, ok := p.tokens.Peek(); ok && token.Type == SymbolToken && token.Text == "(" {
+			set, err = p.parseGroupingSet()
+		} else {
+			var expr Expr
+			expr, err = p.parse(0)
+			set = []Expr{expr}
+		}
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, set)
+		if !p.tokens.consumeSymbol(",") {
+			break
+		}
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	return GroupingSets{sets}, nil
+}
+
+// parseGroupingSet parses `(exprs)` or `()`
+func (p *Parser) parseGroupingSet() ([]Expr, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	if p.tokens.consumeSymbol(")") {
+		return []Expr{}, nil
+	}
+	exprs, err := p.parseExprList()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	return exprs, nil
+}
+
+// parseQualified parses the column of `table.column`, the table is checked by parseSelect
+func (p *Parser) parseQualified(table Token) (Expr, error) {
+	column, ok := p.tokens.Peek()
+	if !ok || column.Type != IdentifierToken {
+		return nil, p.expected("column name")
+	}
+	p.tokens.Next()
+	p.qualifiers = append(p.qualifiers, table)
+	return Identifier{column.Text}, nil
+}
+
+// parseBetween parses `low AND high` after `expr BETWEEN`, which is `expr >= low AND expr <= high`
+func (p *Parser) parseBetween(expr Expr) (Expr, error) {
+	low, err := p.parse(40)
+	if err != nil {
+		return nil, err
+	}
+	if !p.tokens.consumeKeyword("AND") {
+		return nil, p.expected("AND")
+	}
+	high, err := p.parse(40)
+	if err != nil {
+		return nil, err
+	}
+	return BinaryExpr{BinaryExpr{expr, ">=", low}, "AND", BinaryExpr{expr, "<=", high}}, nil
+}
+
+// negatedOps are the operators of the negated comparisons
+var negatedOps = map[string]string{"=": "!=", "!=": "=", "<>": "=", "<": ">=", ">=": "<", ">": "<=", "<=": ">"}
+
+// negate returns NOT expr: the negated comparison, or the negated operands of AND and OR by De Morgan's laws,
+// which hold for null operands too. The plans have no NOT of other exprs, like a boolean column.
+func negate(expr Expr, not Token) (Expr, error) {
+	if b, ok := expr.(BinaryExpr); ok {
+		if op, ok := negatedOps[b.Op]; ok {
+			return BinaryExpr{b.L, op, b.R}, nil
+		}
+		if b.Op == "AND" || b.Op == "OR" {
+			l, err := negate(b.L, not)
+			if err != nil {
+				return nil, err
+			}
+			r, err := negate(b.R, not)
+			if err != nil {
+				return nil, err
+			}
+			if b.Op == "AND" {
+				return BinaryExpr{l, "OR", r}, nil
+			}
+			return BinaryExpr{l, "AND", r}, nil
+		}
+	}
+	return nil, fmt.Errorf("NOT at offset %d only applies to comparisons, AND, OR and BETWEEN, got NOT %s", not.Offset, expr)
+}
+
+// parseCast parses `CAST(expr AS type)`, the `expr AS type` part is parsed like an alias
+func (p *Parser) parseCast() (Expr, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	expr, err := p.parse(0)
+	if err != nil {
+		return nil, err
+	}
+	alias, ok := expr.(Alias)
+	if !ok {
+		return nil, fmt.Errorf("expected CAST(expr AS type), got CAST(%s)", expr)
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	return Cast{alias.Expr, alias.Alias}, nil
+}
+
+func (p *Parser) parseFunction(left Expr, paren Token) (Expr, error) {
+	name, ok := left.(Identifier)
+	if !ok {
+		return nil, p.unexpected(paren)
+	}
+	args := make([]Expr, 0)
+	distinct := p.tokens.consumeKeyword("DISTINCT")
+	if distinct || !p.tokens.consumeSymbol(")") {
+		var err error
+		args, err = p.parseExprList()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+	}
+	function := Function{Name: name.Name, Args: args, Distinct: distinct}
+	if p.tokens.consumeKeyword("FILTER") {
+		filter, err := p.parseFilter()
+		if err != nil {
+			return nil, err
+		}
+		function.Filter = filter
+	}
+	if p.tokens.consumeKeyword("OVER") {
+		over, err := p.parseWindowSpec()
+		if err != nil {
+			return nil, err
+		}
+		function.Over = over
+	}
+	return function, nil
+}
+
+// parseFilter parses `(WHERE expr)` after FILTER
+func (p *Parser) parseFilter() (Expr, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	if !p.tokens.consumeKeyword("WHERE") {
+		return nil, p.expected("WHERE")
+	}
+	filter, err := p.parse(0)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// parseWindowSpec parses `([PARTITION BY exprs] [ORDER BY sort exprs] [frame])` after OVER
+func (p *Parser) parseWindowSpec() (*WindowSpec, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	spec := &WindowSpec{}
+	var err error
+	if p.tokens.consumeKeyword("PARTITION") {
+		if !p.tokens.consumeKeyword("BY") {
+			return nil, p.expected("BY")
+		}
+		if spec.PartitionBy, err = p.parseExprList(); err != nil {
+			return nil, err
+		}
+	}
+	if p.tokens.consumeKeyword("ORDER") {
+		if !p.tokens.consumeKeyword("BY") {
+			return nil, p.expected("BY")
+		}
+		if spec.OrderBy, err = p.parseOrderBy(); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case p.tokens.consumeKeyword("ROWS"):
+		spec.Frame, err = p.parseWindowFrame("ROWS")
+	case p.tokens.consumeKeyword("RANGE"):
+		spec.Frame, err = p.parseWindowFrame("RANGE")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// parseWindowFrame parses `BETWEEN start AND end` or `start` after ROWS or RANGE
+func (p *Parser) parseWindowFrame(units string) (*WindowFrame, error) {
+	if !p.tokens.consumeKeyword("BETWEEN") {
+		start, err := p.parseFrameBound()
+		if err != nil {
+			return nil, err
+		}
+		return &WindowFrame{units, start, FrameBound{Kind: "CURRENT ROW"}}, nil
+	}
+	start, err := p.parseFrameBound()
+	if err != nil {
+		return nil, err
+	}
+	if !p.tokens.consumeKeyword("AND") {
+		return nil, p.expected("AND")
+	}
+	end, err := p.parseFrameBound()
+	if err != nil {
+		return nil, err
+	}
+	return &WindowFrame{units, start, end}, nil
+}
+
+// parseFrameBound parses `UNBOUNDED PRECEDING`, `n PRECEDING`, `CURRENT ROW`, `n FOLLOWING` or `UNBOUNDED FOLLOWING`
+func (p *Parser) parseFrameBound() (FrameBound, error) {
+	switch {
+	case p.tokens.consumeKeyword("UNBOUNDED"):
+		switch {
+		case p.tokens.consumeKeyword("PRECEDING"):
+			return FrameBound{Kind: "UNBOUNDED PRECEDING"}, nil
+		case p.tokens.consumeKeyword("FOLLOWING"):
+			return FrameBound{Kind: "UNBOUNDED FOLLOWING"}, nil
+		}
+		return FrameBound{}, p.expected("PRECEDING or FOLLOWING")
+	case p.tokens.consumeKeyword("CURRENT"):
+		if !p.tokens.consumeKeyword("ROW") {
+			return FrameBound{}, p.expected("ROW")
+		}
+		return FrameBound{Kind: "CURRENT ROW"}, nil
+	}
+	token, ok := p.tokens.Peek()
+	if !ok || token.Type != LongToken {
+		return FrameBound{}, p.expected("frame bound")
+	}
+	p.tokens.Next()
+	offset, err := p.parseLong(token.Text, token)
+	if err != nil {
+		return FrameBound{}, err
+	}
+	switch {
+	case p.tokens.consumeKeyword("PRECEDING"):
+		return FrameBound{Kind: "PRECEDING", Offset: offset.(LongLiteral).Value}, nil
+	case p.tokens.consumeKeyword("FOLLOWING"):
+		return FrameBound{Kind: "FOLLOWING", Offset: offset.(LongLiteral).Value}, nil
+	}
+	return FrameBound{}, p.expected("PRECEDING or FOLLOWING")
+}
+
+func (p *Parser) parseExprList() ([]Expr, error) {
+	exprs := make([]Expr, 0)
+	for {
+		expr, err := p.parse(0)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+		if !p.tokens.consumeSymbol(",") {
+			return exprs, nil
+		}
+	}
+}
+
+func (p *Parser) parseLong(text string, token Token) (Expr, error) {
+	n, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number %s at offset %d: %v", text, token.Offset, err)
+	}
+	return LongLiteral{n}, nil
+}
+
+func (p *Parser) parseDouble(text string, token Token) (Expr, error) {
+	n, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number %s at offset %d: %v", text, token.Offset, err)
+	}
+	return DoubleLiteral{n}, nil
+}
+
+func (p *Parser) expectSymbol(symbol string) error {
+	if !p.tokens.consumeSymbol(symbol) {
+		return p.expected(symbol)
+	}
+	return nil
+}
+
+func (p *Parser) expected(what string) error {
+	token, ok := p.tokens.Peek()
+	if !ok {
+		return fmt.Errorf("expected %s, got end of query", what)
+	}
+	return fmt.Errorf("expected %s, got %s at offset %d", what, token.Text, token.Offset)
+}
+
+func (p *Parser) unexpected(token Token) error {
+	return fmt.Errorf("unexpected %s at offset %d", token.Text, token.Offset)
+}
@@ -0,0 +1,258 @@
+package sql
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func parse(t *testing.T, query string) Expr {
+	tokens, err := NewTokenizer(query).Tokenize()
+	require.NoError(t, err)
+	expr, err := NewParser(tokens).Parse()
+	require.NoError(t, err)
+	return expr
+}
+
+func TestParser_precedence(t *testing.T) {
+	expr := parse(t, "SELECT a FROM t WHERE a + b * 2 > 10 AND c = 'x' OR d < -1.5")
+	where := expr.(Select).Selection
+
+	// ((a + (b * 2)) > 10 AND c = 'x') OR d < -1.5
+	or := where.(BinaryExpr)
+	require.Equal(t, "OR", or.Op)
+	and := or.L.(BinaryExpr)
+	require.Equal(t, "AND", and.Op)
+	gt := and.L.(BinaryExpr)
+	require.Equal(t, ">", gt.Op)
+	add := gt.L.(BinaryExpr)
+	require.Equal(t, "+", add.Op)
+	require.Equal(t, BinaryExpr{Identifier{"b"}, "*", LongLiteral{2}}, add.R)
+	require.Equal(t, BinaryExpr{Identifier{"d"}, "<", DoubleLiteral{-1.5}}, or.R)
+}
+
+func TestParser_parenthesis(t *testing.T) {
+	expr := parse(t, "SELECT (a + b) * c FROM t")
+	mul := expr.(Select).Projection[0].(BinaryExpr)
+	require.Equal(t, "*", mul.Op)
+	require.Equal(t, BinaryExpr{Identifier{"a"}, "+", Identifier{"b"}}, mul.L)
+}
+
+func TestParser_select(t *testing.T) {
+	expr := parse(t, "SELECT state, MAX(CAST(salary AS double)) AS max_salary FROM employee WHERE id > 1 GROUP BY state;")
+	expect := Select{
+		Projection: []Expr{
+			Identifier{"state"},
+			Alias{Function{"MAX", []Expr{Cast{Identifier{"salary"}, "double"}}, false, nil, nil}, "max_salary"},
+		},
+		Table:     "employee",
+		Selection: BinaryExpr{Identifier{"id"}, ">", LongLiteral{1}},
+		GroupBy:   []Expr{Identifier{"state"}},
+	}
+	require.Equal(t, expect, expr)
+	require.Equal(t, "SELECT state, MAX(CAST(salary AS double)) AS max_salary FROM employee WHERE id > 1 GROUP BY state", expr.String())
+}
+
+func TestParser_select_limit(t *testing.T) {
+	expr := parse(t, "SELECT id FROM employee LIMIT 10 OFFSET 5")
+	expect := Select{
+		Projection: []Expr{Identifier{"id"}},
+		Table:      "employee",
+		Limit:      LongLiteral{10},
+		Offset:     LongLiteral{5},
+	}
+	require.Equal(t, expect, expr)
+	require.Equal(t, "SELECT id FROM employee LIMIT 10 OFFSET 5", expr.String())
+}
+
+func TestParser_select_order_by(t *testing.T) {
+	expr := parse(t, "SELECT id FROM employee ORDER BY state, salary DESC, id ASC NULLS FIRST, last_name DESC NULLS LAST LIMIT 1")
+	expect := Select{
+		Projection: []Expr{Identifier{"id"}},
+		Table:      "employee",
+		OrderBy: []SortExpr{
+			{Expr: Identifier{"state"}, Asc: true, NullsFirst: false},
+			{Expr: Identifier{"salary"}, Asc: false, NullsFirst: true},
+			{Expr: Identifier{"id"}, Asc: true, NullsFirst: true},
+			{Expr: Identifier{"last_name"}, Asc: false, NullsFirst: false},
+		},
+		Limit: LongLiteral{1},
+	}
+	require.Equal(t, expect, expr)
+	require.Equal(t, "SELECT id FROM employee ORDER BY state ASC NULLS LAST, salary DESC NULLS FIRST, "+
+		"id ASC NULLS FIRST, last_name DESC NULLS LAST LIMIT 1", expr.String())
+}
+
+func TestParser_count_distinct(t *testing.T) {
+	expr := parse(t, "SELECT COUNT(DISTINCT state), COUNT(*) FROM employee")
+	require.Equal(t, []Expr{
+		Function{Name: "COUNT", Args: []Expr{Identifier{"state"}}, Distinct: true},
+		Function{Name: "COUNT", Args: []Expr{Star{}}},
+	}, expr.(Select).Projection)
+	require.Equal(t, "COUNT(DISTINCT state)", expr.(Select).Projection[0].String())
+}
+
+func TestParser_window(t *testing.T) {
+	expr := parse(t, `SELECT RANK() OVER (PARTITION BY state ORDER BY salary DESC),
+SUM(salary) OVER (ORDER BY id ROWS BETWEEN 1 PRECEDING AND UNBOUNDED FOLLOWING),
+LAG(salary, 2) OVER (RANGE CURRENT ROW), ROW_NUMBER() OVER () FROM employee`)
+	require.Equal(t, []Expr{
+		Function{Name: "RANK", Args: []Expr{}, Over: &WindowSpec{
+			PartitionBy: []Expr{Identifier{"state"}},
+			OrderBy:     []SortExpr{{Identifier{"salary"}, false, true}},
+		}},
+		Function{Name: "SUM", Args: []Expr{Identifier{"salary"}}, Over: &WindowSpec{
+			OrderBy: []SortExpr{{Identifier{"id"}, true, false}},
+			Frame:   &WindowFrame{"ROWS", FrameBound{"PRECEDING", 1}, FrameBound{Kind: "UNBOUNDED FOLLOWING"}},
+		}},
+		Function{Name: "LAG", Args: []Expr{Identifier{"salary"}, LongLiteral{2}}, Over: &WindowSpec{
+			Frame: &WindowFrame{"RANGE", FrameBound{Kind: "CURRENT ROW"}, FrameBound{Kind: "CURRENT ROW"}},
+		}},
+		Function{Name: "ROW_NUMBER", Args: []Expr{}, Over: &WindowSpec{}},
+	}, expr.(Select).Projection)
+	require.Equal(t, "SUM(salary) OVER (ORDER BY id ASC NULLS LAST ROWS BETWEEN 1 PRECEDING AND UNBOUNDED FOLLOWING)",
+		expr.(Select).Projection[1].String())
+}
+
+func TestParser_grouping_sets(t *testing.T) {
+	expr := parse(t, `SELECT GROUPING(state, job_title) FROM employee
+GROUP BY id, ROLLUP(state, job_title), CUBE(a), GROUPING SETS ((state, id), b, ())`)
+	require.Equal(t, []Expr{
+		Function{Name: "GROUPING", Args: []Expr{Identifier{"state"}, Identifier{"job_title"}}},
+	}, expr.(Select).Projection)
+	require.Equal(t, []Expr{
+		Identifier{"id"},
+		Rollup{[]Expr{Identifier{"state"}, Identifier{"job_title"}}},
+		Cube{[]Expr{Identifier{"a"}}},
+		GroupingSets{[][]Expr{{Identifier{"state"}, Identifier{"id"}}, {Identifier{"b"}}, {}}},
+	}, expr.(Select).GroupBy)
+	require.Equal(t, "SELECT GROUPING(state, job_title) FROM employee "+
+		"GROUP BY id, ROLLUP(state, job_title), CUBE(a), GROUPING SETS ((state, id), (b), ())", expr.String())
+}
+
+func TestParser_having_filter(t *testing.T) {
+	expr := parse(t, `SELECT state, COUNT(*) FILTER (WHERE salary > 10) FROM employee
+GROUP BY state HAVING MAX(salary) > 1 ORDER BY state`)
+	require.Equal(t, Function{
+		Name:   "COUNT",
+		Args:   []Expr{Star{}},
+		Filter: BinaryExpr{Identifier{"salary"}, ">", LongLiteral{10}},
+	}, expr.(Select).Projection[1])
+	require.Equal(t, BinaryExpr{Function{Name: "MAX", Args: []Expr{Identifier{"salary"}}}, ">", LongLiteral{1}},
+		expr.(Select).Having)
+	require.Equal(t, "SELECT state, COUNT(*) FILTER (WHERE salary > 10) FROM employee "+
+		"GROUP BY state HAVING MAX(salary) > 1 ORDER BY state ASC NULLS LAST", expr.String())
+}
+
+func TestParser_set_operations(t *testing.T) {
+	a := Select{Projection: []Expr{Identifier{"a"}}, Table: "t"}
+	b := Select{Distinct: true, Projection: []Expr{Identifier{"b"}}, Table: "u"}
+	c := Select{Projection: []Expr{Identifier{"c"}}, Table: "v"}
+
+	// INTERSECT binds tighter, UNION and EXCEPT are left-associative
+	expr := parse(t, "SELECT a FROM t UNION ALL SELECT DISTINCT b FROM u INTERSECT SELECT c FROM v EXCEPT SELECT a FROM t")
+	require.Equal(t, SetOperation{
+		Op:    "EXCEPT",
+		Left:  SetOperation{Op: "UNION", All: true, Left: a, Right: SetOperation{Op: "INTERSECT", Left: b, Right: c}},
+		Right: a,
+	}, expr)
+	require.Equal(t, "SELECT a FROM t UNION ALL SELECT DISTINCT b FROM u INTERSECT SELECT c FROM v EXCEPT SELECT a FROM t",
+		expr.String())
+
+	// the ORDER BY, LIMIT and OFFSET of the last SELECT apply to the result
+	expr = parse(t, "SELECT a FROM t UNION SELECT c FROM v ORDER BY a DESC LIMIT 2 OFFSET 1")
+	require.Equal(t, SetOperation{
+		Op:      "UNION",
+		Left:    a,
+		Right:   c,
+		OrderBy: []SortExpr{{Expr: Identifier{"a"}, Asc: false, NullsFirst: true}},
+		Limit:   LongLiteral{2},
+		Offset:  LongLiteral{1},
+	}, expr)
+	require.Equal(t, "SELECT a FROM t UNION SELECT c FROM v ORDER BY a DESC NULLS FIRST LIMIT 2 OFFSET 1", expr.String())
+
+	// a single SELECT keeps its clauses
+	expr = parse(t, "SELECT DISTINCT a FROM t LIMIT 1")
+	require.Equal(t, Select{Distinct: true, Projection: []Expr{Identifier{"a"}}, Table: "t", Limit: LongLiteral{1}}, expr)
+}
+
+func TestParser_between_not(t *testing.T) {
+	expr := parse(t, "SELECT a FROM t WHERE a + 1 BETWEEN 2 AND b * 3 AND NOT (c = 'x' OR d NOT BETWEEN 1 AND 2)")
+	a := BinaryExpr{Identifier{"a"}, "+", LongLiteral{1}}
+	d := Identifier{"d"}
+	require.Equal(t, BinaryExpr{
+		BinaryExpr{BinaryExpr{a, ">=", LongLiteral{2}}, "AND", BinaryExpr{a, "<=", BinaryExpr{Identifier{"b"}, "*", LongLiteral{3}}}},
+		"AND",
+		BinaryExpr{
+			BinaryExpr{Identifier{"c"}, "!=", StringLiteral{"x"}},
+			"AND",
+			BinaryExpr{BinaryExpr{d, ">=", LongLiteral{1}}, "AND", BinaryExpr{d, "<=", LongLiteral{2}}},
+		},
+	}, expr.(Select).Selection)
+
+	// NOT binds tighter than AND and OR, and looser than the comparisons
+	expr = parse(t, "SELECT a FROM t WHERE NOT a < 1 AND NOT NOT b >= 2 OR NOT c <> 3")
+	require.Equal(t, "a >= 1 AND b >= 2 OR c = 3", expr.(Select).Selection.String())
+}
+
+func TestParser_qualified_columns(t *testing.T) {
+	expr := parse(t, "SELECT employee.id, MAX(employee.salary) FROM employee GROUP BY employee.id "+
+		"UNION SELECT t.a, t.b FROM t")
+	require.Equal(t, "SELECT id, MAX(salary) FROM employee GROUP BY id UNION SELECT a, b FROM t", expr.String())
+}
+
+func TestParser_select_star(t *testing.T) {
+	expr := parse(t, "SELECT * FROM employee")
+	require.Equal(t, Select{Projection: []Expr{Star{}}, Table: "employee"}, expr)
+}
+
+func TestParser_errors(t *testing.T) {
+	testCases := []struct {
+		query string
+		err   string
+	}{
+		{"SELECT a", "expected FROM, got end of query"},
+		{"SELECT a FROM", "expected table name, got end of query"},
+		{"SELECT a FROM t GROUP state", "expected BY, got state at offset 22"},
+		{"SELECT CAST(a) FROM t", "expected CAST(expr AS type), got CAST(a)"},
+		{"SELECT MAX(a FROM t", "expected ), got FROM at offset 13"},
+		{"SELECT a FROM t t2", "unexpected t2 at offset 16"},
+		{"SELECT a FROM t WHERE", "unexpected end of query"},
+		{"SELECT a FROM t ORDER a", "expected BY, got a at offset 22"},
+		{"SELECT a FROM t ORDER BY a NULLS", "expected FIRST or LAST, got end of query"},
+		{"SELECT RANK() OVER ORDER BY a FROM t", "expected (, got ORDER at offset 19"},
+		{"SELECT RANK() OVER (PARTITION a) FROM t", "expected BY, got a at offset 30"},
+		{"SELECT SUM(a) OVER (ROWS BETWEEN 1 PRECEDING) FROM t", "expected AND, got ) at offset 44"},
+		{"SELECT SUM(a) OVER (ROWS a PRECEDING) FROM t", "expected frame bound, got a at offset 25"},
+		{"SELECT SUM(a) OVER (ROWS UNBOUNDED ROW) FROM t", "expected PRECEDING or FOLLOWING, got ROW at offset 35"},
+		{"SELECT a FROM t GROUP BY GROUPING (a)", "expected SETS, got ( at offset 34"},
+		{"SELECT SUM(a) FILTER WHERE a > 1 FROM t", "expected (, got WHERE at offset 21"},
+		{"SELECT SUM(a) FILTER (a > 1) FROM t", "expected WHERE, got a at offset 22"},
+		{"SELECT SUM(a) FILTER (WHERE a > 1 FROM t", "expected ), got FROM at offset 34"},
+		{"SELECT a FROM t HAVING", "unexpected end of query"},
+		{"SELECT a FROM t GROUP BY ROLLUP a", "expected (, got a at offset 32"},
+		{"SELECT a FROM t GROUP BY GROUPING SETS ((a), b", "expected ), got end of query"},
+		{"SELECT a FROM t UNION b", "expected SELECT, got b at offset 22"},
+		{"SELECT a FROM t INTERSECT ALL", "expected SELECT, got end of query"},
+		{"SELECT a FROM t LIMIT 1 UNION SELECT b FROM u",
+			"unexpected UNION at offset 24, ORDER BY, LIMIT and OFFSET must follow the last SELECT"},
+		{"SELECT a FROM t UNION SELECT b FROM u ORDER BY b INTERSECT SELECT c FROM v",
+			"unexpected INTERSECT at offset 49, ORDER BY, LIMIT and OFFSET must follow the last SELECT"},
+		{"SELECT a FROM t UNION", "expected SELECT, got end of query"},
+		{"SELECT a FROM t WHERE a BETWEEN 1", "expected AND, got end of query"},
+		{"SELECT a FROM t WHERE a NOT IN (1)", "expected BETWEEN, got IN at offset 28"},
+		{"SELECT a FROM t WHERE NOT a", "NOT at offset 22 only applies to comparisons, AND, OR and BETWEEN, got NOT a"},
+		{"SELECT a FROM t WHERE NOT a + 1", "NOT at offset 22 only applies to comparisons, AND, OR and BETWEEN, got NOT a + 1"},
+		{"SELECT a FROM t WHERE a IS NULL", "IS [NOT] NULL at offset 24 is not supported"},
+		{"SELECT a FROM t WHERE a IS NOT NULL", "IS [NOT] NULL at offset 24 is not supported"},
+		{"SELECT t. FROM t", "expected column name, got FROM at offset 10"},
+		{"SELECT u.a FROM t", "unknown table u at offset 7, a column can only be qualified by the FROM table t"},
+		{"SELECT a FROM t UNION SELECT t.a FROM u",
+			"unknown table t at offset 29, a column can only be qualified by the FROM table u"},
+	}
+	for _, tc := range testCases {
+		tokens, err := NewTokenizer(tc.query).Tokenize()
+		require.NoError(t, err)
+		_, err = NewParser(tokens).Parse()
+		require.EqualError(t, err, tc.err, tc.query)
+	}
+}
@@ -0,0 +1,903 @@
+package sql
+
+import (
+	"github.com/apache/arrow/go/v6/arrow"
+	"query-engine/datatypes"
+	"query-engine/logicalplan"
+	"sort"
+	"strings"
+)
+
+var aggregateFunctions = map[string]func(input logicalplan.LogicalExpr) logicalplan.AggregateExpr{
+	"SUM":   logicalplan.NewSum,
+	"MIN":   logicalplan.NewMin,
+	"MAX":   logicalplan.NewMax,
+	"AVG":   logicalplan.NewAvg,
+	"COUNT": logicalplan.NewCount,
+
+	"VARIANCE":    logicalplan.NewVariance,
+	"VAR_SAMP":    logicalplan.NewVariance,
+	"VAR_POP":     logicalplan.NewVariancePop,
+	"STDDEV":      logicalplan.NewStddev,
+	"STDDEV_SAMP": logicalplan.NewStddev,
+	"STDDEV_POP":  logicalplan.NewStddevPop,
+
+	"MEDIAN":                logicalplan.NewMedian,
+	"ARRAY_AGG":             logicalplan.NewArrayAgg,
+	"APPROX_COUNT_DISTINCT": logicalplan.NewApproxCountDistinct,
+	"APPROX_MEDIAN":         logicalplan.NewApproxMedian,
+}
+
+// binaryAggregateFunctions are the aggregate functions of two arguments
+var binaryAggregateFunctions = map[string]func(y, x logicalplan.LogicalExpr) logicalplan.AggregateExpr{
+	"COVAR_SAMP": logicalplan.NewCovar,
+	"COVAR_POP":  logicalplan.NewCovarPop,
+	"CORR":       logicalplan.NewCorr,
+
+	"STRING_AGG":        logicalplan.NewStringAgg,
+	"PERCENTILE_CONT":   logicalplan.NewPercentileCont,
+	"PERCENTILE_DISC":   logicalplan.NewPercentileDisc,
+	"APPROX_PERCENTILE": logicalplan.NewApproxPercentile,
+}
+
+// isAggregateFunction tells whether a function is an aggregate function or GROUPING,
+// which is only allowed in an aggregation
+func isAggregateFunction(name string) bool {
+	_, ok := aggregateFunctions[strings.ToUpper(name)]
+	_, binary := binaryAggregateFunctions[strings.ToUpper(name)]
+	return ok || binary || strings.ToUpper(name) == "GROUPING"
+}
+
+// dataTypes are the type names accepted by CAST, limited to the types the cast expression can produce
+var dataTypes = map[string]arrow.DataType{
+	"TINYINT": datatypes.Int8Type,
+	"INT":     datatypes.Int64Type,
+	"INTEGER": datatypes.Int64Type,
+	"BIGINT":  datatypes.Int64Type,
+	"FLOAT":   datatypes.FloatType,
+	"DOUBLE":  datatypes.DoubleType,
+	"VARCHAR": datatypes.StringType,
+	"STRING":  datatypes.StringType,
+}
+
+// Planner creates a logical plan (in the form of a DataFrame) from a SQL statement.
+type Planner struct{}
+
+func NewPlanner() Planner {
+	return Planner{}
+}
+
+// frameBounds are the bound kinds of a window frame
+var frameBounds = map[string]logicalplan.FrameBoundType{
+	"UNBOUNDED PRECEDING": logicalplan.UnboundedPreceding,
+	"PRECEDING":           logicalplan.Preceding,
+	"CURRENT ROW":         logicalplan.CurrentRow,
+	"FOLLOWING":           logicalplan.Following,
+	"UNBOUNDED FOLLOWING": logicalplan.UnboundedFollowing,
+}
+
+// CreateDataFrame plans a SELECT, or a set operation of SELECTs, against the given tables. A SELECT produces
+// Scan -> Selection (WHERE) -> Aggregate (GROUP BY or aggregate functions) -> Selection (HAVING)
+// or Window (window functions) -> Sort (ORDER BY) -> Projection -> Distinct (SELECT DISTINCT) -> Limit
+// The sort is planned below the projection, so that ORDER BY can use columns which are not selected.
+// A set operation combines the plans of its SELECTs by Union, Intersect or Except -> Sort (ORDER BY) -> Limit
+func (p Planner) CreateDataFrame(stmt Expr, tables map[string]logicalplan.DataFrame) (logicalplan.DataFrame, error) {
+	switch s := stmt.(type) {
+	case Select:
+		df, err := p.planSelect(s, tables)
+		if err != nil {
+			return nil, err
+		}
+		if s.Distinct {
+			df = df.Distinct()
+		}
+		return p.planLimit(s.Limit, s.Offset, df)
+	case SetOperation:
+		df, err := p.planSetOperation(s, tables)
+		if err != nil {
+			return nil, err
+		}
+		if len(s.OrderBy) > 0 {
+			// the ORDER BY references the columns of the combined rows, named after the first SELECT
+			input := df
+			sortExprs, err := p.createSortExprs(Select{OrderBy: s.OrderBy}, func(expr Expr) (logicalplan.LogicalExpr, error) {
+				return p.createLogicalExpr(expr, input)
+			})
+			if err != nil {
+				return nil, err
+			}
+			df = df.Sort(sortExprs)
+		}
+		return p.planLimit(s.Limit, s.Offset, df)
+	default:
+		return nil, datatypes.NewPlanError("only SELECT statements are supported, got: %s", stmt)
+	}
+}
+
+// Tables returns the names of the tables a statement reads, in the order they appear, without duplicates
+func Tables(stmt Expr) []string {
+	names := make([]string, 0)
+	var walk func(stmt Expr)
+	walk = func(stmt Expr) {
+		switch s := stmt.(type) {
+		case Select:
+			for _, name := range names {
+				if name == s.Table {
+					return
+				}
+			}
+			names = append(names, s.Table)
+		case SetOperation:
+			walk(s.Left)
+			walk(s.Right)
+		}
+	}
+	walk(stmt)
+	return names
+}
+
+// planSetOperation combines the plans of both sides, which must have the same number of columns of compatible types
+func (p Planner) planSetOperation(stmt SetOperation, tables map[string]logicalplan.DataFrame) (logicalplan.DataFrame, error) {
+	left, err := p.CreateDataFrame(stmt.Left, tables)
+	if err != nil {
+		return nil, err
+	}
+	right, err := p.CreateDataFrame(stmt.Right, tables)
+	if err != nil {
+		return nil, err
+	}
+
+	var op logicalplan.SetOperator
+	switch stmt.Op {
+	case "UNION":
+		op = logicalplan.UnionOperator
+	case "INTERSECT":
+		op = logicalplan.IntersectOperator
+	case "EXCEPT":
+		op = logicalplan.ExceptOperator
+	default:
+		return nil, datatypes.NewPlanError("unsupported set operation %s", stmt.Op)
+	}
+	if stmt.All && op != logicalplan.UnionOperator {
+		return nil, datatypes.NewPlanError("%s ALL is not supported", stmt.Op)
+	}
+	if _, err := logicalplan.SetSchema(op, left.LogicalPlan(), right.LogicalPlan()); err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case logicalplan.IntersectOperator:
+		return left.Intersect(right), nil
+	case logicalplan.ExceptOperator:
+		return left.Except(right), nil
+	default:
+		return left.Union(right, stmt.All), nil
+	}
+}
+
+func (p Planner) planSelect(stmt Select, tables map[string]logicalplan.DataFrame) (logicalplan.DataFrame, error) {
+	df, ok := tables[stmt.Table]
+	if !ok {
+		return nil, datatypes.NewPlanError("no table named %s", stmt.Table)
+	}
+
+	if stmt.Selection != nil {
+		filterExpr, err := p.createLogicalExpr(stmt.Selection, df)
+		if err != nil {
+			return nil, err
+		}
+		df = df.Filter(filterExpr)
+	}
+
+	orderBy := make([]Expr, len(stmt.OrderBy))
+	for i, sortExpr := range stmt.OrderBy {
+		orderBy[i] = sortExpr.Expr
+	}
+	windowed := p.containsWindow(stmt.Projection) || p.containsWindow(orderBy)
+	if stmt.Having != nil {
+		windowed = windowed || p.containsWindow([]Expr{stmt.Having})
+	}
+	if len(stmt.GroupBy) > 0 || p.containsAggregate(stmt.Projection) || stmt.Having != nil {
+		if windowed {
+			return nil, datatypes.NewPlanError("window functions are not supported with GROUP BY or aggregate functions")
+		}
+		return p.planAggregate(stmt, df)
+	}
+	if windowed {
+		return p.planWindow(stmt, df)
+	}
+
+	if len(stmt.OrderBy) > 0 {
+		input := df
+		sortExprs, err := p.createSortExprs(stmt, func(expr Expr) (logicalplan.LogicalExpr, error) {
+			return p.createLogicalExpr(expr, input)
+		})
+		if err != nil {
+			return nil, err
+		}
+		df = df.Sort(sortExprs)
+	}
+
+	if len(stmt.Projection) == 1 && stmt.Projection[0] == (Star{}) {
+		return df, nil
+	}
+	projExprs, err := p.createProjectionExprs(stmt.Projection, df)
+	if err != nil {
+		return nil, err
+	}
+	return df.Project(projExprs), nil
+}
+
+// planLimit plans the LIMIT and OFFSET clauses, which may be nil
+func (p Planner) planLimit(limitExpr, offsetExpr Expr, df logicalplan.DataFrame) (logicalplan.DataFrame, error) {
+	if offsetExpr != nil {
+		offset, err := p.createCount("OFFSET", offsetExpr)
+		if err != nil {
+			return nil, err
+		}
+		df = df.Offset(offset)
+	}
+	if limitExpr != nil {
+		limit, err := p.createCount("LIMIT", limitExpr)
+		if err != nil {
+			return nil, err
+		}
+		df = df.Limit(limit)
+	}
+	return df, nil
+}
+
+// createCount returns the non-negative number of rows of a LIMIT or OFFSET clause
+func (p Planner) createCount(clause string, expr Expr) (int, error) {
+	n, ok := expr.(LongLiteral)
+	if !ok || n.Value < 0 {
+		return 0, datatypes.NewPlanError("%s expects a non-negative integer, got %s", clause, expr)
+	}
+	return int(n.Value), nil
+}
+
+func (p Planner) createProjectionExprs(exprs []Expr, input logicalplan.DataFrame) ([]logicalplan.LogicalExpr, error) {
+	projExprs := make([]logicalplan.LogicalExpr, 0, len(exprs))
+	for _, expr := range exprs {
+		if _, ok := expr.(Star); ok {
+			for _, field := range input.Schema().Fields {
+				projExprs = append(projExprs, logicalplan.NewCol(field.Name))
+			}
+			continue
+		}
+		logicalExpr, err := p.createLogicalExpr(expr, input)
+		if err != nil {
+			return nil, err
+		}
+		projExprs = append(projExprs, logicalExpr)
+	}
+	return projExprs, nil
+}
+
+// planAggregate creates an Aggregate over the input, the HAVING filter and the projection above it
+// reference group and aggregate expressions by their index in the aggregate output.
+// The projection is omitted when it selects exactly the aggregate output.
+func (p Planner) planAggregate(stmt Select, input logicalplan.DataFrame) (logicalplan.DataFrame, error) {
+	groupExprs, groupingSets, err := p.createGroupBy(stmt.GroupBy, input)
+	if err != nil {
+		return nil, err
+	}
+
+	aggExprs := make([]logicalplan.AggregateExpr, 0)
+	projExprs := make([]logicalplan.LogicalExpr, len(stmt.Projection))
+	for i, expr := range stmt.Projection {
+		projExpr, err := p.createAggregateProjection(expr, input, groupExprs, &aggExprs)
+		if err != nil {
+			return nil, err
+		}
+		projExprs[i] = projExpr
+	}
+	// the HAVING and sort exprs may add aggregates which are not selected
+	var havingExpr logicalplan.LogicalExpr
+	if stmt.Having != nil {
+		havingExpr, err = p.createAggregateProjection(stmt.Having, input, groupExprs, &aggExprs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	sortExprs, err := p.createSortExprs(stmt, func(expr Expr) (logicalplan.LogicalExpr, error) {
+		return p.createAggregateProjection(expr, input, groupExprs, &aggExprs)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	df := input.Aggregate(groupExprs, aggExprs)
+	if groupingSets != nil {
+		df = input.AggregateGroupingSets(groupExprs, groupingSets, aggExprs)
+	}
+	if havingExpr != nil {
+		df = df.Filter(havingExpr)
+	}
+	if len(sortExprs) > 0 {
+		df = df.Sort(sortExprs)
+	}
+	if len(projExprs) == len(groupExprs)+len(aggExprs) {
+		identity := true
+		for i, expr := range projExprs {
+			if idx, ok := expr.(logicalplan.ColumnIndex); !ok || idx.Index != i {
+				identity = false
+				break
+			}
+		}
+		if identity {
+			return df, nil
+		}
+	}
+	return df.Project(projExprs), nil
+}
+
+// createGroupBy plans the GROUP BY items into group exprs, and the grouping sets of the exprs once an item is
+// a ROLLUP, a CUBE or GROUPING SETS. The grouping sets of several items are the cross product of their sets:
+// every set of an item is combined with every set of the others, an expr being a single set of itself.
+func (p Planner) createGroupBy(
+	items []Expr, input logicalplan.DataFrame,
+) ([]logicalplan.LogicalExpr, [][]int, error) {
+	grouping := false
+	for _, item := range items {
+		switch item.(type) {
+		case Rollup, Cube, GroupingSets:
+			grouping = true
+		}
+	}
+	if !grouping {
+		groupExprs := make([]logicalplan.LogicalExpr, len(items))
+		for i, expr := range items {
+			var err error
+			if groupExprs[i], err = p.createLogicalExpr(expr, input); err != nil {
+				return nil, nil, err
+			}
+		}
+		return groupExprs, nil, nil
+	}
+
+	// the grouping sets are indexes of groupExprs, the same exprs share a group expr
+	groupExprs := make([]logicalplan.LogicalExpr, 0, len(items))
+	indexesOf := func(exprs []Expr) ([]int, error) {
+		indexes := make([]int, len(exprs))
+		for i, expr := range exprs {
+			logicalExpr, err := p.createLogicalExpr(expr, input)
+			if err != nil {
+				return nil, err
+			}
+			indexes[i] = len(groupExprs)
+			for j, groupExpr := range groupExprs {
+				if groupExpr.String() == logicalExpr.String() {
+					indexes[i] = j
+					break
+				}
+			}
+			if indexes[i] == len(groupExprs) {
+				groupExprs = append(groupExprs, logicalExpr)
+			}
+		}
+		return indexes, nil
+	}
+	// setsOf returns the grouping sets of exprs, as the sets of their positions in exprs
+	setsOf := func(exprs []Expr, positionSets [][]int) ([][]int, error) {
+		indexes, err := indexesOf(exprs)
+		if err != nil {
+			return nil, err
+		}
+		sets := make([][]int, len(positionSets))
+		for i, positions := range positionSets {
+			sets[i] = make([]int, len(positions))
+			for j, pos := range positions {
+				sets[i][j] = indexes[pos]
+			}
+		}
+		return sets, nil
+	}
+
+	groupingSets := [][]int{{}}
+	for _, item := range items {
+		var itemSets [][]int
+		var err error
+		switch e := item.(type) {
+		case Rollup:
+			itemSets, err = setsOf(e.Exprs, logicalplan.RollupSets(len(e.Exprs)))
+		case Cube:
+			itemSets, err = setsOf(e.Exprs, logicalplan.CubeSets(len(e.Exprs)))
+		case GroupingSets:
+			for _, set := range e.Sets {
+				var indexes []int
+				if indexes, err = indexesOf(set); err != nil {
+					break
+				}
+				itemSets = append(itemSets, indexes)
+			}
+		default:
+			itemSets, err = setsOf([]Expr{item}, [][]int{{0}})
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		product := make([][]int, 0, len(groupingSets)*len(itemSets))
+		for _, set := range groupingSets {
+			for _, itemSet := range itemSets {
+				product = append(product, unionSet(set, itemSet))
+			}
+		}
+		groupingSets = product
+	}
+	return groupExprs, groupingSets, nil
+}
+
+// unionSet returns the sorted indexes of two grouping sets
+func unionSet(l, r []int) []int {
+	union := append([]int{}, l...)
+	for _, idx := range r {
+		found := false
+		for _, existing := range union {
+			found = found || existing == idx
+		}
+		if !found {
+			union = append(union, idx)
+		}
+	}
+	sort.Ints(union)
+	return union
+}
+
+// createSortExprs plans the ORDER BY clause with the given function,
+// an identifier matching an alias of the select list refers to the aliased expression.
+func (p Planner) createSortExprs(
+	stmt Select, createExpr func(expr Expr) (logicalplan.LogicalExpr, error),
+) ([]logicalplan.SortExpr, error) {
+	sortExprs := make([]logicalplan.SortExpr, len(stmt.OrderBy))
+	for i, sortExpr := range stmt.OrderBy {
+		expr := sortExpr.Expr
+		if identifier, ok := expr.(Identifier); ok {
+			for _, item := range stmt.Projection {
+				if alias, ok := item.(Alias); ok && alias.Alias == identifier.Name {
+					expr = alias.Expr
+					break
+				}
+			}
+		}
+		logicalExpr, err := createExpr(expr)
+		if err != nil {
+			return nil, err
+		}
+		sortExprs[i] = logicalplan.NewSortExpr(logicalExpr, sortExpr.Asc, sortExpr.NullsFirst)
+	}
+	return sortExprs, nil
+}
+
+func (p Planner) createAggregateProjection(
+	expr Expr, input logicalplan.DataFrame, groupExprs []logicalplan.LogicalExpr, aggExprs *[]logicalplan.AggregateExpr,
+) (logicalplan.LogicalExpr, error) {
+	if !p.containsAggregate([]Expr{expr}) {
+		logicalExpr, err := p.createLogicalExpr(expr, input)
+		if err != nil {
+			return nil, err
+		}
+		for i, groupExpr := range groupExprs {
+			if groupExpr.String() == logicalExpr.String() {
+				return logicalplan.NewColumnIndex(i), nil
+			}
+		}
+	}
+
+	switch e := expr.(type) {
+	case Function:
+		aggExpr, err := p.createAggregateExpr(e, input)
+		if err != nil {
+			return nil, err
+		}
+		for i, existing := range *aggExprs {
+			if existing.String() == aggExpr.String() {
+				return logicalplan.NewColumnIndex(len(groupExprs) + i), nil
+			}
+		}
+		*aggExprs = append(*aggExprs, aggExpr)
+		return logicalplan.NewColumnIndex(len(groupExprs) + len(*aggExprs) - 1), nil
+	case Alias:
+		inner, err := p.createAggregateProjection(e.Expr, input, groupExprs, aggExprs)
+		if err != nil {
+			return nil, err
+		}
+		return logicalplan.NewAlias(inner, e.Alias), nil
+	case Cast:
+		inner, err := p.createAggregateProjection(e.Expr, input, groupExprs, aggExprs)
+		if err != nil {
+			return nil, err
+		}
+		return p.createCast(inner, e.DataType)
+	case BinaryExpr:
+		l, err := p.createAggregateProjection(e.L, input, groupExprs, aggExprs)
+		if err != nil {
+			return nil, err
+		}
+		r, err := p.createAggregateProjection(e.R, input, groupExprs, aggExprs)
+		if err != nil {
+			return nil, err
+		}
+		return p.createBinaryExpr(e.Op, l, r)
+	case LongLiteral, DoubleLiteral, StringLiteral:
+		return p.createLogicalExpr(e, input)
+	default:
+		return nil, datatypes.NewPlanError("%s must appear in the GROUP BY clause or be used in an aggregate function", expr)
+	}
+}
+
+// planWindow creates a Window over the input for the window functions of the select list and of the ORDER BY clause,
+// the sort and the projection above it reference the window values by the name of their column.
+func (p Planner) planWindow(stmt Select, input logicalplan.DataFrame) (logicalplan.DataFrame, error) {
+	windowExprs := make([]logicalplan.WindowExpr, 0)
+	projExprs := make([]logicalplan.LogicalExpr, 0, len(stmt.Projection))
+	for _, expr := range stmt.Projection {
+		if _, ok := expr.(Star); ok {
+			for _, field := range input.Schema().Fields {
+				projExprs = append(projExprs, logicalplan.NewCol(field.Name))
+			}
+			continue
+		}
+		projExpr, err := p.createWindowProjection(expr, input, &windowExprs)
+		if err != nil {
+			return nil, err
+		}
+		projExprs = append(projExprs, projExpr)
+	}
+	// sort exprs may add window functions which are not selected
+	sortExprs, err := p.createSortExprs(stmt, func(expr Expr) (logicalplan.LogicalExpr, error) {
+		return p.createWindowProjection(expr, input, &windowExprs)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	df := input.Window(windowExprs)
+	if len(sortExprs) > 0 {
+		df = df.Sort(sortExprs)
+	}
+	return df.Project(projExprs), nil
+}
+
+func (p Planner) createWindowProjection(
+	expr Expr, input logicalplan.DataFrame, windowExprs *[]logicalplan.WindowExpr,
+) (logicalplan.LogicalExpr, error) {
+	switch e := expr.(type) {
+	case Function:
+		if e.Over == nil {
+			return p.createLogicalExpr(e, input)
+		}
+		windowExpr, err := p.createWindowExpr(e, input)
+		if err != nil {
+			return nil, err
+		}
+		name := windowExpr.String()
+		for _, existing := range *windowExprs {
+			if existing.String() == name {
+				return logicalplan.NewCol(name), nil
+			}
+		}
+		*windowExprs = append(*windowExprs, windowExpr)
+		return logicalplan.NewCol(name), nil
+	case Alias:
+		inner, err := p.createWindowProjection(e.Expr, input, windowExprs)
+		if err != nil {
+			return nil, err
+		}
+		return logicalplan.NewAlias(inner, e.Alias), nil
+	case Cast:
+		inner, err := p.createWindowProjection(e.Expr, input, windowExprs)
+		if err != nil {
+			return nil, err
+		}
+		return p.createCast(inner, e.DataType)
+	case BinaryExpr:
+		l, err := p.createWindowProjection(e.L, input, windowExprs)
+		if err != nil {
+			return nil, err
+		}
+		r, err := p.createWindowProjection(e.R, input, windowExprs)
+		if err != nil {
+			return nil, err
+		}
+		return p.createBinaryExpr(e.Op, l, r)
+	default:
+		return p.createLogicalExpr(expr, input)
+	}
+}
+
+// createWindowExpr plans a function with an OVER clause: a ranking function, LAG, LEAD or an aggregate function
+func (p Planner) createWindowExpr(f Function, input logicalplan.DataFrame) (logicalplan.WindowExpr, error) {
+	name := strings.ToUpper(f.Name)
+	var windowExpr logicalplan.WindowExpr
+	switch name {
+	case "ROW_NUMBER", "RANK", "DENSE_RANK", "LAG", "LEAD":
+		if f.Distinct {
+			return logicalplan.WindowExpr{}, datatypes.NewPlanError("DISTINCT is not supported by window function %s", f.Name)
+		}
+		args := make([]logicalplan.LogicalExpr, len(f.Args))
+		for i, arg := range f.Args {
+			var err error
+			if args[i], err = p.createLogicalExpr(arg, input); err != nil {
+				return logicalplan.WindowExpr{}, err
+			}
+		}
+		windowExpr = logicalplan.WindowExpr{Name: name, Args: args}
+	default:
+		if !isAggregateFunction(name) || name == "GROUPING" {
+			return logicalplan.WindowExpr{}, datatypes.NewPlanError("unsupported window function: %s", f.Name)
+		}
+		if f.Distinct {
+			return logicalplan.WindowExpr{}, datatypes.NewPlanError("DISTINCT is not supported by window function %s", f.Name)
+		}
+		if f.Filter != nil {
+			return logicalplan.WindowExpr{}, datatypes.NewPlanError("FILTER is not supported by window function %s", f.Name)
+		}
+		aggExpr, err := p.createAggregateExpr(f, input)
+		if err != nil {
+			return logicalplan.WindowExpr{}, err
+		}
+		windowExpr = logicalplan.NewWindowAggregate(aggExpr)
+	}
+
+	partitionBy := make([]logicalplan.LogicalExpr, len(f.Over.PartitionBy))
+	for i, expr := range f.Over.PartitionBy {
+		var err error
+		if partitionBy[i], err = p.createLogicalExpr(expr, input); err != nil {
+			return logicalplan.WindowExpr{}, err
+		}
+	}
+	orderBy := make([]logicalplan.SortExpr, len(f.Over.OrderBy))
+	for i, sortExpr := range f.Over.OrderBy {
+		expr, err := p.createLogicalExpr(sortExpr.Expr, input)
+		if err != nil {
+			return logicalplan.WindowExpr{}, err
+		}
+		orderBy[i] = logicalplan.NewSortExpr(expr, sortExpr.Asc, sortExpr.NullsFirst)
+	}
+	var frame *logicalplan.WindowFrame
+	if f.Over.Frame != nil {
+		units := logicalplan.RowsFrame
+		if f.Over.Frame.Units == "RANGE" {
+			units = logicalplan.RangeFrame
+		}
+		frame = logicalplan.NewWindowFrame(units,
+			logicalplan.FrameBound{Type: frameBounds[f.Over.Frame.Start.Kind], Offset: f.Over.Frame.Start.Offset},
+			logicalplan.FrameBound{Type: frameBounds[f.Over.Frame.End.Kind], Offset: f.Over.Frame.End.Offset})
+	}
+	return windowExpr.Over(partitionBy, orderBy, frame), nil
+}
+
+func (p Planner) createAggregateExpr(f Function, input logicalplan.DataFrame) (logicalplan.AggregateExpr, error) {
+	if strings.ToUpper(f.Name) == "GROUPING" {
+		return p.createGroupingExpr(f, input)
+	}
+	if f.Filter != nil {
+		// the filter is planned against the input rows, it may not use aggregates
+		filter, err := p.createLogicalExpr(f.Filter, input)
+		if err != nil {
+			return logicalplan.AggregateExpr{}, err
+		}
+		f.Filter = nil
+		aggExpr, err := p.createAggregateExpr(f, input)
+		if err != nil {
+			return logicalplan.AggregateExpr{}, err
+		}
+		return aggExpr.WithFilter(filter), nil
+	}
+	if newBinaryAggregate, ok := binaryAggregateFunctions[strings.ToUpper(f.Name)]; ok {
+		return p.createBinaryAggregateExpr(f, newBinaryAggregate, input)
+	}
+	newAggregate, ok := aggregateFunctions[strings.ToUpper(f.Name)]
+	if !ok {
+		return logicalplan.AggregateExpr{}, datatypes.NewPlanError("unsupported function: %s", f.Name)
+	}
+	if len(f.Args) != 1 {
+		return logicalplan.AggregateExpr{}, datatypes.NewPlanError("aggregate function %s expects 1 argument, got %d", f.Name, len(f.Args))
+	}
+	isCount := strings.ToUpper(f.Name) == "COUNT"
+	if f.Distinct && !isCount {
+		return logicalplan.AggregateExpr{}, datatypes.NewPlanError("DISTINCT is not supported by aggregate function %s", f.Name)
+	}
+	if f.Args[0] == (Star{}) {
+		if !isCount || f.Distinct {
+			return logicalplan.AggregateExpr{}, datatypes.NewPlanError("%s is not supported", f)
+		}
+		return logicalplan.NewCountStar(), nil
+	}
+	arg, err := p.createLogicalExpr(f.Args[0], input)
+	if err != nil {
+		return logicalplan.AggregateExpr{}, err
+	}
+	if f.Distinct {
+		return logicalplan.NewCountDistinct(arg), nil
+	}
+	return newAggregate(arg), nil
+}
+
+// createGroupingExpr plans GROUPING(exprs), the exprs are checked against the group exprs by the physical planner
+func (p Planner) createGroupingExpr(f Function, input logicalplan.DataFrame) (logicalplan.AggregateExpr, error) {
+	if len(f.Args) == 0 {
+		return logicalplan.AggregateExpr{}, datatypes.NewPlanError("GROUPING expects at least 1 argument")
+	}
+	if f.Distinct {
+		return logicalplan.AggregateExpr{}, datatypes.NewPlanError("DISTINCT is not supported by GROUPING")
+	}
+	if f.Filter != nil {
+		return logicalplan.AggregateExpr{}, datatypes.NewPlanError("FILTER is not supported by GROUPING")
+	}
+	args := make([]logicalplan.LogicalExpr, len(f.Args))
+	for i, arg := range f.Args {
+		var err error
+		if args[i], err = p.createLogicalExpr(arg, input); err != nil {
+			return logicalplan.AggregateExpr{}, err
+		}
+	}
+	return logicalplan.NewGrouping(args[0], args[1:]...), nil
+}
+
+func (p Planner) createBinaryAggregateExpr(
+	f Function, newAggregate func(y, x logicalplan.LogicalExpr) logicalplan.AggregateExpr, input logicalplan.DataFrame,
+) (logicalplan.AggregateExpr, error) {
+	if len(f.Args) != 2 {
+		return logicalplan.AggregateExpr{}, datatypes.NewPlanError("aggregate function %s expects 2 arguments, got %d", f.Name, len(f.Args))
+	}
+	if f.Distinct {
+		return logicalplan.AggregateExpr{}, datatypes.NewPlanError("DISTINCT is not supported by aggregate function %s", f.Name)
+	}
+	args := make([]logicalplan.LogicalExpr, len(f.Args))
+	for i, arg := range f.Args {
+		var err error
+		if args[i], err = p.createLogicalExpr(arg, input); err != nil {
+			return logicalplan.AggregateExpr{}, err
+		}
+	}
+	return newAggregate(args[0], args[1]), nil
+}
+
+// createLogicalExpr plans a non-aggregate expression against the input
+func (p Planner) createLogicalExpr(expr Expr, input logicalplan.DataFrame) (logicalplan.LogicalExpr, error) {
+	switch e := expr.(type) {
+	case Identifier:
+		schema := input.Schema()
+		if schema.FindFirstIndexByName(e.Name) < 0 {
+			return nil, datatypes.NewSchemaError("no column named %s", e.Name)
+		}
+		return logicalplan.NewCol(e.Name), nil
+	case LongLiteral:
+		return logicalplan.NewLiteralLong(e.Value), nil
+	case DoubleLiteral:
+		return logicalplan.NewLiteralDouble(e.Value), nil
+	case StringLiteral:
+		return logicalplan.NewLiteralString(e.Value), nil
+	case Alias:
+		inner, err := p.createLogicalExpr(e.Expr, input)
+		if err != nil {
+			return nil, err
+		}
+		return logicalplan.NewAlias(inner, e.Alias), nil
+	case Cast:
+		inner, err := p.createLogicalExpr(e.Expr, input)
+		if err != nil {
+			return nil, err
+		}
+		return p.createCast(inner, e.DataType)
+	case BinaryExpr:
+		l, err := p.createLogicalExpr(e.L, input)
+		if err != nil {
+			return nil, err
+		}
+		r, err := p.createLogicalExpr(e.R, input)
+		if err != nil {
+			return nil, err
+		}
+		return p.createBinaryExpr(e.Op, l, r)
+	case Function:
+		if e.Over != nil {
+			return nil, datatypes.NewPlanError("window function %s is not allowed here", e)
+		}
+		if isAggregateFunction(e.Name) {
+			return nil, datatypes.NewPlanError("aggregate function %s is not allowed here", e)
+		}
+		return nil, datatypes.NewPlanError("unsupported function: %s", e.Name)
+	default:
+		return nil, datatypes.NewPlanError("unsupported expression: %s", e)
+	}
+}
+
+func (p Planner) createCast(expr logicalplan.LogicalExpr, dataType string) (logicalplan.LogicalExpr, error) {
+	dType, ok := dataTypes[strings.ToUpper(dataType)]
+	if !ok {
+		return nil, datatypes.NewPlanError("unsupported data type: %s", dataType)
+	}
+	return logicalplan.NewCast(expr, dType), nil
+}
+
+func (p Planner) createBinaryExpr(op string, l, r logicalplan.LogicalExpr) (logicalplan.LogicalExpr, error) {
+	switch op {
+	case "=":
+		return logicalplan.NewEq(l, r), nil
+	case "!=", "<>":
+		return logicalplan.NewNeq(l, r), nil
+	case ">":
+		return logicalplan.NewGt(l, r), nil
+	case ">=":
+		return logicalplan.NewGtEq(l, r), nil
+	case "<":
+		return logicalplan.NewLt(l, r), nil
+	case "<=":
+		return logicalplan.NewLtEq(l, r), nil
+	case "AND":
+		return logicalplan.NewAnd(l, r), nil
+	case "OR":
+		return logicalplan.NewOr(l, r), nil
+	case "+":
+		return logicalplan.NewAdd(l, r), nil
+	case "-":
+		return logicalplan.NewSubtract(l, r), nil
+	case "*":
+		return logicalplan.NewMultiply(l, r), nil
+	case "/":
+		return logicalplan.NewDivide(l, r), nil
+	case "%":
+		return logicalplan.NewModulus(l, r), nil
+	default:
+		return nil, datatypes.NewPlanError("unsupported binary operator: %s", op)
+	}
+}
+
+func (p Planner) containsAggregate(exprs []Expr) bool {
+	for _, expr := range exprs {
+		switch e := expr.(type) {
+		case Function:
+			if e.Over != nil {
+				// the aggregate functions of a window function are computed by the window
+				continue
+			}
+			if isAggregateFunction(e.Name) {
+				return true
+			}
+			if p.containsAggregate(e.Args) {
+				return true
+			}
+		case Alias:
+			if p.containsAggregate([]Expr{e.Expr}) {
+				return true
+			}
+		case Cast:
+			if p.containsAggregate([]Expr{e.Expr}) {
+				return true
+			}
+		case BinaryExpr:
+			if p.containsAggregate([]Expr{e.L, e.R}) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p Planner) containsWindow(exprs []Expr) bool {
+	for _, expr := range exprs {
+		switch e := expr.(type) {
+		case Function:
+			if e.Over != nil || p.containsWindow(e.Args) {
+				return true
+			}
+		case Alias:
+			if p.containsWindow([]Expr{e.Expr}) {
+				return true
+			}
+		case Cast:
+			if p.containsWindow([]Expr{e.Expr}) {
+				return true
+			}
+		case BinaryExpr:
+			if p.containsWindow([]Expr{e.L, e.R}) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,340 @@
+package sql
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"query-engine/datasource"
+	"query-engine/datatypes"
+	"query-engine/logicalplan"
+	"testing"
+)
+
+const dir = "../testdata"
+
+func planQuery(query string) (logicalplan.DataFrame, error) {
+	csv, err := datasource.NewCsvDataSource(dir+"/employee.csv", 1024)
+	if err != nil {
+		return nil, err
+	}
+	tables := map[string]logicalplan.DataFrame{
+		"employee": logicalplan.NewDefaultDataFrame(logicalplan.NewScan("employee", csv, []string{})),
+	}
+	tokens, err := NewTokenizer(query).Tokenize()
+	if err != nil {
+		return nil, err
+	}
+	ast, err := NewParser(tokens).Parse()
+	if err != nil {
+		return nil, err
+	}
+	return NewPlanner().CreateDataFrame(ast, tables)
+}
+
+func TestPlanner_selection_and_projection(t *testing.T) {
+	df, err := planQuery("SELECT id, first_name, salary * 0.1 AS bonus FROM employee WHERE state = 'CO'")
+	require.NoError(t, err)
+
+	expect := `
+Projection: #id, #first_name, #salary * 0.1 as bonus
+	Selection: #state = 'CO'
+		Scan: employee; projection=None
+`
+	require.Equal(t, expect, logicalplan.PrettyFormat(df.LogicalPlan()))
+}
+
+func TestPlanner_select_star(t *testing.T) {
+	df, err := planQuery("SELECT * FROM employee")
+	require.NoError(t, err)
+	require.Equal(t, "\nScan: employee; projection=None\n", logicalplan.PrettyFormat(df.LogicalPlan()))
+
+	df, err = planQuery("SELECT *, id AS key FROM employee")
+	require.NoError(t, err)
+	require.Len(t, df.Schema().Fields, 7)
+}
+
+func TestPlanner_aggregate(t *testing.T) {
+	df, err := planQuery("SELECT state, MAX(CAST(salary AS double)) FROM employee GROUP BY state")
+	require.NoError(t, err)
+
+	expect := `
+Aggregate: groupExpr=[#state], aggregateExpr=[MAX(CAST(#salary AS float64))]
+	Scan: employee; projection=None
+`
+	require.Equal(t, expect, logicalplan.PrettyFormat(df.LogicalPlan()))
+}
+
+func TestPlanner_count(t *testing.T) {
+	df, err := planQuery("SELECT state, COUNT(*), COUNT(DISTINCT job_title), AVG(CAST(salary AS int)) FROM employee GROUP BY state")
+	require.NoError(t, err)
+
+	expect := `
+Aggregate: groupExpr=[#state], aggregateExpr=[COUNT(1) COUNT(DISTINCT #job_title) AVG(CAST(#salary AS int64))]
+	Scan: employee; projection=None
+`
+	require.Equal(t, expect, logicalplan.PrettyFormat(df.LogicalPlan()))
+	require.Equal(t, []datatypes.Field{
+		{Name: "state", DataType: datatypes.StringType},
+		{Name: "COUNT(1)", DataType: datatypes.UInt64Type},
+		{Name: "COUNT(DISTINCT #job_title)", DataType: datatypes.UInt64Type},
+		{Name: "AVG(CAST(#salary AS int64))", DataType: datatypes.DoubleType},
+	}, df.Schema().Fields)
+}
+
+func TestPlanner_statistics(t *testing.T) {
+	df, err := planQuery("SELECT STDDEV(CAST(salary AS int)), CORR(CAST(salary AS int), CAST(id AS int)) FROM employee")
+	require.NoError(t, err)
+
+	expect := `
+Aggregate: groupExpr=[], aggregateExpr=[STDDEV_SAMP(CAST(#salary AS int64)) CORR(CAST(#salary AS int64), CAST(#id AS int64))]
+	Scan: employee; projection=None
+`
+	require.Equal(t, expect, logicalplan.PrettyFormat(df.LogicalPlan()))
+	require.Equal(t, datatypes.DoubleType, df.Schema().Fields[1].DataType)
+}
+
+func TestPlanner_aggregate_with_projection(t *testing.T) {
+	df, err := planQuery(`SELECT MAX(CAST(salary AS double)) - MIN(CAST(salary AS double)) AS spread, state
+FROM employee WHERE id != '1' GROUP BY state`)
+	require.NoError(t, err)
+
+	expect := `
+Projection: #1 - #2 as spread, #0
+	Aggregate: groupExpr=[#state], aggregateExpr=[MAX(CAST(#salary AS float64)) MIN(CAST(#salary AS float64))]
+		Selection: #id != '1'
+			Scan: employee; projection=None
+`
+	require.Equal(t, expect, logicalplan.PrettyFormat(df.LogicalPlan()))
+	require.Equal(t, "spread", df.Schema().Fields[0].Name)
+	require.Equal(t, "state", df.Schema().Fields[1].Name)
+}
+
+func TestPlanner_window(t *testing.T) {
+	df, err := planQuery(`SELECT first_name, RANK() OVER (PARTITION BY state ORDER BY salary DESC) AS rank,
+SUM(CAST(salary AS int)) OVER (ORDER BY id ROWS 1 PRECEDING) FROM employee ORDER BY rank, first_name`)
+	require.NoError(t, err)
+
+	expect := `
+Projection: #first_name, #RANK() OVER (PARTITION BY #state ORDER BY #salary DESC NULLS FIRST) as rank, #SUM(CAST(#salary AS int64)) OVER (ORDER BY #id ASC NULLS LAST ROWS BETWEEN 1 PRECEDING AND CURRENT ROW)
+	Sort: #RANK() OVER (PARTITION BY #state ORDER BY #salary DESC NULLS FIRST) ASC NULLS LAST, #first_name ASC NULLS LAST
+		Window: RANK() OVER (PARTITION BY #state ORDER BY #salary DESC NULLS FIRST), SUM(CAST(#salary AS int64)) OVER (ORDER BY #id ASC NULLS LAST ROWS BETWEEN 1 PRECEDING AND CURRENT ROW)
+			Scan: employee; projection=None
+`
+	require.Equal(t, expect, logicalplan.PrettyFormat(df.LogicalPlan()))
+	require.Equal(t, "rank", df.Schema().Fields[1].Name)
+	require.Equal(t, datatypes.UInt64Type, df.Schema().Fields[1].DataType)
+	require.Equal(t, datatypes.Int64Type, df.Schema().Fields[2].DataType)
+}
+
+func TestPlanner_grouping_sets(t *testing.T) {
+	df, err := planQuery(`SELECT state, job_title, SUM(CAST(salary AS int)), GROUPING(state, job_title) AS level
+FROM employee GROUP BY ROLLUP(state, job_title) ORDER BY level`)
+	require.NoError(t, err)
+
+	expect := `
+Projection: #0, #1, #2, #3 as level
+	Sort: #3 ASC NULLS LAST
+		Aggregate: groupExpr=[#state #job_title], groupingSets=[(#state, #job_title) (#state) ()], aggregateExpr=[SUM(CAST(#salary AS int64)) GROUPING(#state, #job_title)]
+			Scan: employee; projection=None
+`
+	require.Equal(t, expect, logicalplan.PrettyFormat(df.LogicalPlan()))
+	require.Equal(t, datatypes.Int64Type, df.Schema().Fields[3].DataType)
+
+	// the grouping sets of several items are their cross product, the same exprs share a group expr
+	testCases := []struct {
+		groupBy      string
+		groupExpr    string
+		groupingSets string
+	}{
+		{"state, CUBE(job_title, id)", "[#state #job_title #id]",
+			"[(#state, #job_title, #id) (#state, #job_title) (#state, #id) (#state)]"},
+		{"GROUPING SETS ((state, id), state, ()), ROLLUP(id)", "[#state #id]",
+			"[(#state, #id) (#state, #id) (#state, #id) (#state) (#id) ()]"},
+		{"ROLLUP(state), ROLLUP(job_title)", "[#state #job_title]",
+			"[(#state, #job_title) (#state) (#job_title) ()]"},
+	}
+	for _, tc := range testCases {
+		df, err := planQuery("SELECT COUNT(*) FROM employee GROUP BY " + tc.groupBy)
+		require.NoError(t, err)
+		aggregate := df.LogicalPlan().Children()[0].(logicalplan.Aggregate)
+		require.Equal(t, fmt.Sprintf("Aggregate: groupExpr=%s, groupingSets=%s, aggregateExpr=[COUNT(1)]",
+			tc.groupExpr, tc.groupingSets), aggregate.String(), tc.groupBy)
+	}
+}
+
+func TestPlanner_limit(t *testing.T) {
+	df, err := planQuery("SELECT id FROM employee WHERE state = 'CO' LIMIT 1 OFFSET 1")
+	require.NoError(t, err)
+
+	expect := `
+Limit: 1, offset=1
+	Projection: #id
+		Selection: #state = 'CO'
+			Scan: employee; projection=None
+`
+	require.Equal(t, expect, logicalplan.PrettyFormat(df.LogicalPlan()))
+}
+
+func TestPlanner_order_by(t *testing.T) {
+	// the sort is below the projection, salary is not selected and bonus is an alias
+	df, err := planQuery("SELECT id, salary * 0.1 AS bonus FROM employee ORDER BY bonus DESC, last_name LIMIT 2")
+	require.NoError(t, err)
+
+	expect := `
+Limit: 2
+	Projection: #id, #salary * 0.1 as bonus
+		Sort: #salary * 0.1 DESC NULLS FIRST, #last_name ASC NULLS LAST
+			Scan: employee; projection=None
+`
+	require.Equal(t, expect, logicalplan.PrettyFormat(df.LogicalPlan()))
+}
+
+func TestPlanner_order_by_aggregate(t *testing.T) {
+	// MIN is only used to sort, it is computed by the aggregate but not selected
+	df, err := planQuery(`SELECT state, MAX(salary) AS top FROM employee GROUP BY state
+ORDER BY top DESC NULLS LAST, MIN(salary), state`)
+	require.NoError(t, err)
+
+	expect := `
+Projection: #0, #1 as top
+	Sort: #1 DESC NULLS LAST, #2 ASC NULLS LAST, #0 ASC NULLS LAST
+		Aggregate: groupExpr=[#state], aggregateExpr=[MAX(#salary) MIN(#salary)]
+			Scan: employee; projection=None
+`
+	require.Equal(t, expect, logicalplan.PrettyFormat(df.LogicalPlan()))
+}
+
+func TestPlanner_having_filter(t *testing.T) {
+	// COUNT is only used by HAVING, the filtered MAX is another aggregate than MAX
+	df, err := planQuery(`SELECT state, MAX(salary), MAX(salary) FILTER (WHERE id > 1) FROM employee GROUP BY state
+HAVING COUNT(*) > 1 AND state != 'CA' ORDER BY state`)
+	require.NoError(t, err)
+
+	expect := `
+Projection: #0, #1, #2
+	Sort: #0 ASC NULLS LAST
+		Selection: #3 > 1 AND #0 != 'CA'
+			Aggregate: groupExpr=[#state], aggregateExpr=[MAX(#salary) MAX(#salary) FILTER (WHERE #id > 1) COUNT(1)]
+				Scan: employee; projection=None
+`
+	require.Equal(t, expect, logicalplan.PrettyFormat(df.LogicalPlan()))
+
+	// HAVING without GROUP BY filters the single group of all the rows
+	df, err = planQuery("SELECT 1 FROM employee HAVING MIN(id) > 0")
+	require.NoError(t, err)
+	expect = `
+Projection: 1
+	Selection: #0 > 0
+		Aggregate: groupExpr=[], aggregateExpr=[MIN(#id)]
+			Scan: employee; projection=None
+`
+	require.Equal(t, expect, logicalplan.PrettyFormat(df.LogicalPlan()))
+}
+
+func TestPlanner_distinct(t *testing.T) {
+	// the duplicates are removed after the projection, before the limit
+	df, err := planQuery("SELECT DISTINCT state FROM employee ORDER BY state LIMIT 2")
+	require.NoError(t, err)
+
+	expect := `
+Limit: 2
+	Distinct
+		Projection: #state
+			Sort: #state ASC NULLS LAST
+				Scan: employee; projection=None
+`
+	require.Equal(t, expect, logicalplan.PrettyFormat(df.LogicalPlan()))
+}
+
+func TestTables(t *testing.T) {
+	tokens, err := NewTokenizer("SELECT a FROM t1 UNION SELECT a FROM t2 EXCEPT SELECT a FROM t1").Tokenize()
+	require.NoError(t, err)
+	stmt, err := NewParser(tokens).Parse()
+	require.NoError(t, err)
+	require.Equal(t, []string{"t1", "t2"}, Tables(stmt))
+}
+
+func TestPlanner_set_operations(t *testing.T) {
+	// the ORDER BY references the column names of the first SELECT
+	df, err := planQuery(`SELECT state FROM employee UNION ALL SELECT job_title FROM employee
+EXCEPT SELECT state FROM employee WHERE id = '1' INTERSECT SELECT state FROM employee ORDER BY state DESC LIMIT 3`)
+	require.NoError(t, err)
+
+	expect := `
+Limit: 3
+	Sort: #state DESC NULLS FIRST
+		Except
+			Union: all=true
+				Projection: #state
+					Scan: employee; projection=None
+				Projection: #job_title
+					Scan: employee; projection=None
+			Intersect
+				Projection: #state
+					Selection: #id = '1'
+						Scan: employee; projection=None
+				Projection: #state
+					Scan: employee; projection=None
+`
+	require.Equal(t, expect, logicalplan.PrettyFormat(df.LogicalPlan()))
+}
+
+func TestPlanner_errors(t *testing.T) {
+	testCases := []struct {
+		query string
+		err   string
+	}{
+		{"SELECT id FROM unknown", "no table named unknown"},
+		{"SELECT unknown FROM employee", "no column named unknown"},
+		{"SELECT id, MAX(salary) FROM employee GROUP BY state", "id must appear in the GROUP BY clause or be used in an aggregate function"},
+		{"SELECT id FROM employee WHERE MAX(salary) > 1", "aggregate function MAX(salary) is not allowed here"},
+		{"SELECT MAX(MIN(salary)) FROM employee", "aggregate function MIN(salary) is not allowed here"},
+		{"SELECT UPPER(state) FROM employee", "unsupported function: UPPER"},
+		{"SELECT CAST(id AS date) FROM employee", "unsupported data type: date"},
+		{"SELECT id FROM employee ORDER BY unknown", "no column named unknown"},
+		{"SELECT state FROM employee GROUP BY state ORDER BY id", "id must appear in the GROUP BY clause or be used in an aggregate function"},
+		{"SELECT MAX(DISTINCT salary) FROM employee", "DISTINCT is not supported by aggregate function MAX"},
+		{"SELECT SUM(*) FROM employee", "SUM(*) is not supported"},
+		{"SELECT CORR(salary) FROM employee", "aggregate function CORR expects 2 arguments, got 1"},
+		{"SELECT id FROM employee WHERE STDDEV(salary) > 1", "aggregate function STDDEV(salary) is not allowed here"},
+		{"SELECT id FROM employee LIMIT -1", "LIMIT expects a non-negative integer, got -1"},
+		{"SELECT state, RANK() OVER (ORDER BY id) FROM employee GROUP BY state", "window functions are not supported with GROUP BY or aggregate functions"},
+		{"SELECT MAX(id), RANK() OVER () FROM employee", "window functions are not supported with GROUP BY or aggregate functions"},
+		{"SELECT id FROM employee WHERE RANK() OVER () > 1", "window function RANK() OVER () is not allowed here"},
+		{"SELECT UPPER(id) OVER () FROM employee", "unsupported window function: UPPER"},
+		{"SELECT COUNT(DISTINCT id) OVER () FROM employee", "DISTINCT is not supported by window function COUNT"},
+		{"SELECT RANK() OVER (ORDER BY unknown) FROM employee", "no column named unknown"},
+		{"SELECT id FROM employee LIMIT 1 OFFSET 'a'", "OFFSET expects a non-negative integer, got 'a'"},
+		{"SELECT id FROM employee GROUP BY ROLLUP(state)", "id must appear in the GROUP BY clause or be used in an aggregate function"},
+		{"SELECT GROUPING() FROM employee", "GROUPING expects at least 1 argument"},
+		{"SELECT id FROM employee WHERE GROUPING(id) = 0", "aggregate function GROUPING(id) is not allowed here"},
+		{"SELECT GROUPING(id) OVER () FROM employee", "unsupported window function: GROUPING"},
+		{"SELECT COUNT(*) FROM employee GROUP BY CUBE(unknown)", "no column named unknown"},
+		{"SELECT state FROM employee GROUP BY state HAVING id > 1", "id must appear in the GROUP BY clause or be used in an aggregate function"},
+		{"SELECT state FROM employee GROUP BY state HAVING RANK() OVER () > 1", "window functions are not supported with GROUP BY or aggregate functions"},
+		{"SELECT SUM(id) FILTER (WHERE MAX(id) > 1) FROM employee", "aggregate function MAX(id) is not allowed here"},
+		{"SELECT SUM(id) FILTER (WHERE unknown > 1) FROM employee", "no column named unknown"},
+		{"SELECT SUM(id) FILTER (WHERE id > 1) OVER () FROM employee", "FILTER is not supported by window function SUM"},
+		{"SELECT GROUPING(state) FILTER (WHERE id > 1) FROM employee GROUP BY state", "FILTER is not supported by GROUPING"},
+		{"SELECT id FROM employee UNION SELECT id, state FROM employee", "Union expects the same number of columns on both sides, got 1 and 2"},
+		{"SELECT id FROM employee EXCEPT SELECT CAST(id AS int) FROM employee", "Except can't combine column id of type utf8 with id of type int64"},
+		{"SELECT id FROM employee INTERSECT ALL SELECT id FROM employee", "INTERSECT ALL is not supported"},
+		{"SELECT id FROM employee EXCEPT ALL SELECT id FROM employee", "EXCEPT ALL is not supported"},
+		{"SELECT id FROM employee UNION SELECT unknown FROM employee", "no column named unknown"},
+		{"SELECT id FROM employee UNION SELECT id FROM employee ORDER BY state", "no column named state"},
+	}
+	for _, tc := range testCases {
+		_, err := planQuery(tc.query)
+		require.EqualError(t, err, tc.err, tc.query)
+	}
+}
+
+func TestPlanner_error_types(t *testing.T) {
+	_, err := planQuery("SELECT unknown FROM employee")
+	var schemaErr *datatypes.SchemaError
+	require.True(t, errors.As(err, &schemaErr))
+
+	_, err = planQuery("SELECT UPPER(state) FROM employee")
+	var planErr *datatypes.PlanError
+	require.True(t, errors.As(err, &planErr))
+}
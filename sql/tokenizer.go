@@ -0,0 +1,127 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Tokenizer splits a SQL query into tokens.
+type Tokenizer struct {
+	sql    string
+	offset int
+}
+
+func NewTokenizer(sql string) *Tokenizer {
+	return &Tokenizer{sql: sql}
+}
+
+func (t *Tokenizer) Tokenize() (*TokenStream, error) {
+	tokens := make([]Token, 0)
+	for {
+		t.skipWhitespace()
+		if t.offset >= len(t.sql) {
+			break
+		}
+		token, err := t.nextToken()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return NewTokenStream(tokens), nil
+}
+
+func (t *Tokenizer) nextToken() (Token, error) {
+	start := t.offset
+	ch := t.sql[start]
+	switch {
+	case isIdentifierStart(ch):
+		text := t.readWhile(isIdentifierPart)
+		upper := strings.ToUpper(text)
+		if _, ok := keywords[upper]; ok {
+			return Token{KeywordToken, upper, start}, nil
+		}
+		return Token{IdentifierToken, text, start}, nil
+	case isDigit(ch):
+		return t.readNumber(), nil
+	case ch == '\'':
+		text, err := t.readQuoted('\'')
+		if err != nil {
+			return Token{}, err
+		}
+		return Token{StringToken, text, start}, nil
+	case ch == '"':
+		text, err := t.readQuoted('"')
+		if err != nil {
+			return Token{}, err
+		}
+		return Token{IdentifierToken, text, start}, nil
+	}
+
+	for _, symbol := range symbols {
+		if strings.HasPrefix(t.sql[start:], symbol) {
+			t.offset += len(symbol)
+			return Token{SymbolToken, symbol, start}, nil
+		}
+	}
+	return Token{}, fmt.Errorf("unexpected character %q at offset %d", ch, start)
+}
+
+func (t *Tokenizer) readNumber() Token {
+	start := t.offset
+	t.readWhile(isDigit)
+	if t.offset+1 < len(t.sql) && t.sql[t.offset] == '.' && isDigit(t.sql[t.offset+1]) {
+		t.offset++
+		t.readWhile(isDigit)
+		return Token{DoubleToken, t.sql[start:t.offset], start}
+	}
+	return Token{LongToken, t.sql[start:t.offset], start}
+}
+
+// readQuoted reads a quoted text, a quote char inside the text is escaped by doubling it
+func (t *Tokenizer) readQuoted(quote byte) (string, error) {
+	start := t.offset
+	t.offset++
+	var sb strings.Builder
+	for t.offset < len(t.sql) {
+		ch := t.sql[t.offset]
+		t.offset++
+		if ch != quote {
+			sb.WriteByte(ch)
+			continue
+		}
+		if t.offset < len(t.sql) && t.sql[t.offset] == quote {
+			sb.WriteByte(quote)
+			t.offset++
+			continue
+		}
+		return sb.String(), nil
+	}
+	return "", fmt.Errorf("unterminated quoted text at offset %d", start)
+}
+
+func (t *Tokenizer) readWhile(predicate func(ch byte) bool) string {
+	start := t.offset
+	for t.offset < len(t.sql) && predicate(t.sql[t.offset]) {
+		t.offset++
+	}
+	return t.sql[start:t.offset]
+}
+
+func (t *Tokenizer) skipWhitespace() {
+	t.readWhile(func(ch byte) bool {
+		return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
+	})
+}
+
+func isIdentifierStart(ch byte) bool {
+	return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+func isIdentifierPart(ch byte) bool {
+	return isIdentifierStart(ch) || isDigit(ch)
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
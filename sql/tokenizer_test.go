@@ -0,0 +1,54 @@
+package sql
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestTokenizer_Tokenize(t *testing.T) {
+	tokens, err := NewTokenizer("select id, first_name AS name FROM employee WHERE salary >= 10.5 and state <> 'C''O'").Tokenize()
+	require.NoError(t, err)
+
+	expect := []Token{
+		{KeywordToken, "SELECT", 0},
+		{IdentifierToken, "id", 7},
+		{SymbolToken, ",", 9},
+		{IdentifierToken, "first_name", 11},
+		{KeywordToken, "AS", 22},
+		{IdentifierToken, "name", 25},
+		{KeywordToken, "FROM", 30},
+		{IdentifierToken, "employee", 35},
+		{KeywordToken, "WHERE", 44},
+		{IdentifierToken, "salary", 50},
+		{SymbolToken, ">=", 57},
+		{DoubleToken, "10.5", 60},
+		{KeywordToken, "AND", 65},
+		{IdentifierToken, "state", 69},
+		{SymbolToken, "<>", 75},
+		{StringToken, "C'O", 78},
+	}
+	require.Equal(t, expect, tokens.Tokens())
+}
+
+func TestTokenizer_quoted_identifier(t *testing.T) {
+	tokens, err := NewTokenizer(`SELECT "first name", 42 FROM t`).Tokenize()
+	require.NoError(t, err)
+
+	expect := []Token{
+		{KeywordToken, "SELECT", 0},
+		{IdentifierToken, "first name", 7},
+		{SymbolToken, ",", 19},
+		{LongToken, "42", 21},
+		{KeywordToken, "FROM", 24},
+		{IdentifierToken, "t", 29},
+	}
+	require.Equal(t, expect, tokens.Tokens())
+}
+
+func TestTokenizer_errors(t *testing.T) {
+	_, err := NewTokenizer("SELECT 'abc FROM t").Tokenize()
+	require.EqualError(t, err, "unterminated quoted text at offset 7")
+
+	_, err = NewTokenizer("SELECT a FROM t WHERE a ? 1").Tokenize()
+	require.EqualError(t, err, "unexpected character '?' at offset 24")
+}
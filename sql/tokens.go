@@ -0,0 +1,151 @@
+package sql
+
+import "fmt"
+
+// TokenType classifies the tokens produced by the Tokenizer.
+type TokenType int
+
+const (
+	KeywordToken TokenType = iota
+	IdentifierToken
+	LongToken
+	DoubleToken
+	StringToken
+	SymbolToken
+)
+
+func (t TokenType) String() string {
+	switch t {
+	case KeywordToken:
+		return "Keyword"
+	case IdentifierToken:
+		return "Identifier"
+	case LongToken:
+		return "Long"
+	case DoubleToken:
+		return "Double"
+	case StringToken:
+		return "String"
+	case SymbolToken:
+		return "Symbol"
+	default:
+		return fmt.Sprintf("TokenType(%d)", int(t))
+	}
+}
+
+// Token is a lexical unit of a SQL query.
+// Keywords are upper-cased, string and quoted identifier tokens hold their unquoted text.
+type Token struct {
+	Type TokenType
+	Text string
+	// Offset of the first character of the token in the query
+	Offset int
+}
+
+func (t Token) String() string {
+	return fmt.Sprintf("%s(%s)", t.Type, t.Text)
+}
+
+// keywords are matched case-insensitively, function names like MAX or SUM are plain identifiers.
+var keywords = map[string]struct{}{
+	"SELECT":   {},
+	"FROM":     {},
+	"WHERE":    {},
+	"GROUP":    {},
+	"BY":       {},
+	"AS":       {},
+	"AND":      {},
+	"OR":       {},
+	"NOT":      {},
+	"IS":       {},
+	"NULL":     {},
+	"CAST":     {},
+	"ORDER":    {},
+	"ASC":      {},
+	"DESC":     {},
+	"NULLS":    {},
+	"FIRST":    {},
+	"LAST":     {},
+	"LIMIT":    {},
+	"OFFSET":   {},
+	"DISTINCT": {},
+
+	"OVER":      {},
+	"PARTITION": {},
+	"ROWS":      {},
+	"RANGE":     {},
+	"BETWEEN":   {},
+	"UNBOUNDED": {},
+	"PRECEDING": {},
+	"FOLLOWING": {},
+	"CURRENT":   {},
+	"ROW":       {},
+
+	"GROUPING": {},
+	"SETS":     {},
+	"ROLLUP":   {},
+	"CUBE":     {},
+
+	"HAVING": {},
+	"FILTER": {},
+
+	"UNION":     {},
+	"INTERSECT": {},
+	"EXCEPT":    {},
+	"ALL":       {},
+}
+
+// symbols are sorted by length, so that the longest symbol is matched first
+var symbols = []string{
+	"<=", ">=", "!=", "<>",
+	"=", "<", ">", "+", "-", "*", "/", "%", "(", ")", ",", ";", ".",
+}
+
+// TokenStream is a cursor over the tokens of a query.
+type TokenStream struct {
+	tokens []Token
+	pos    int
+}
+
+func NewTokenStream(tokens []Token) *TokenStream {
+	return &TokenStream{tokens: tokens}
+}
+
+// Peek returns the next token without consuming it
+func (s *TokenStream) Peek() (Token, bool) {
+	if s.pos >= len(s.tokens) {
+		return Token{}, false
+	}
+	return s.tokens[s.pos], true
+}
+
+// Next consumes the next token
+func (s *TokenStream) Next() (Token, bool) {
+	token, ok := s.Peek()
+	if ok {
+		s.pos++
+	}
+	return token, ok
+}
+
+// Tokens returns all the tokens of the stream, including the consumed ones
+func (s *TokenStream) Tokens() []Token {
+	return s.tokens
+}
+
+func (s *TokenStream) consumeKeyword(keyword string) bool {
+	return s.consume(KeywordToken, keyword)
+}
+
+func (s *TokenStream) consumeSymbol(symbol string) bool {
+	return s.consume(SymbolToken, symbol)
+}
+
+func (s *TokenStream) consume(tokenType TokenType, text string) bool {
+	token, ok := s.Peek()
+	if ok && token.Type == tokenType && token.Text == text {
+		s.pos++
+		return true
+	}
+	return false
+}
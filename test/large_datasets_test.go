@@ -1,6 +1,7 @@
 package test
 
 import (
+	"context"
 	"fmt"
 	"query-engine/datatypes"
 	"query-engine/execution"
@@ -14,7 +15,10 @@ func Test_execution_on_large_datasets(t *testing.T) {
 	t.SkipNow()
 
 	ctx := execution.NewCtx()
-	csv := ctx.CSV("./yellow_tripdata_2019-01.csv")
+	csv, err := ctx.CSV("./yellow_tripdata_2019-01.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
 	groupExpr := []LogicalExpr{NewCol("passenger_count")}
 	aggExpr := []AggregateExpr{NewMax(NewCast(NewCol("fare_amount"), datatypes.FloatType))}
 	df := csv.Aggregate(groupExpr, aggExpr)
@@ -22,13 +26,18 @@ func Test_execution_on_large_datasets(t *testing.T) {
 	originalLogicalPlan := df.LogicalPlan()
 	fmt.Printf("Logical Plan:\t%s\n", PrettyFormat(originalLogicalPlan))
 
-	ctx.Plan(df.LogicalPlan())
+	if err := ctx.Plan(df.LogicalPlan()); err != nil {
+		t.Fatal(err)
+	}
 	fmt.Printf("Optimized Physical Plan:\t%s\n", physicalplan.PrettyFormat(ctx.PhysicalPlan))
 
 	start := time.Now()
 
-	for ctx.Next() {
-		recordBatch := ctx.Execute()
+	for ctx.Next(context.Background()) {
+		recordBatch, err := ctx.Execute(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
 		fmt.Printf("Schema: %s\n", recordBatch.Schema)
 		fmt.Printf("CSV:\n%s\n", recordBatch.ToCSV())
 	}
@@ -39,3 +48,34 @@ func Test_execution_on_large_datasets(t *testing.T) {
 	// After removed gob: Query took 6.710639891s
 	fmt.Printf("Query took %s\n", end.Sub(start))
 }
+
+func Test_sort_on_large_datasets(t *testing.T) {
+	t.SkipNow()
+
+	ctx := execution.NewCtx()
+	// sort with a 64MB budget, the sorted runs are spilled to the temp directory
+	ctx.MemoryLimit = 64 << 20
+	csv, err := ctx.CSV("./yellow_tripdata_2019-01.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	df := csv.
+		Sort([]SortExpr{NewDesc(NewCast(NewCol("fare_amount"), datatypes.DoubleType))}).
+		Project([]LogicalExpr{NewCol("VendorID"), NewCol("fare_amount")}).
+		Limit(10)
+
+	if err := ctx.Plan(df.LogicalPlan()); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Printf("Optimized Physical Plan:\t%s\n", physicalplan.PrettyFormat(ctx.PhysicalPlan))
+
+	start := time.Now()
+	for ctx.Next(context.Background()) {
+		recordBatch, err := ctx.Execute(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Printf("CSV:\n%s\n", recordBatch.ToCSV())
+	}
+	fmt.Printf("Query took %s\n", time.Since(start))
+}